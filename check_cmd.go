@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"golox/loxerror"
+	"golox/scanner"
+	"golox/syntax"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// runCheck parses, resolves and checks a .lox file, or every .lox file under
+// a directory, along with the modules they import, without running them.
+// It prints each error and warning with the file it is in, and exits with
+// 65 when there are errors.
+func runCheck(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: golox check <file.lox|directory>")
+		os.Exit(64)
+	}
+
+	reporter := &checkReporter{printed: map[string]bool{}}
+	loxerror.SetReporter(reporter)
+
+	err := filepath.Walk(args[0], func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || filepath.Ext(path) != ".lox" {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		checkFile(path, string(data))
+		return nil
+	})
+
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(74)
+	}
+
+	if reporter.failed {
+		os.Exit(65)
+	}
+}
+
+// checkReporter prints the diagnostics of golox check. A module imported by
+// a file that is checked too has its problems found twice, so each is
+// printed once.
+type checkReporter struct {
+	printed map[string]bool
+	failed  bool
+}
+
+func (reporter *checkReporter) Report(diagnostic *loxerror.Diagnostic) {
+	if diagnostic.Severity == loxerror.SeverityError {
+		reporter.failed = true
+	}
+
+	text := loxerror.Render(diagnostic)
+	if !reporter.printed[text] {
+		reporter.printed[text] = true
+		fmt.Print(text)
+	}
+}
+
+// checkFile reports the errors and warnings in the script at path, naming
+// the file in each.
+func checkFile(path string, source string) {
+	loxerror.Reset()
+	loxerror.SetSource(source)
+	file := loxerror.SetFile(path)
+	defer loxerror.SetFile(file)
+
+	parser := syntax.NewAstParser(scanner.NewScanner(source).ScanTokens())
+	parser.SetFile(path, ioutil.ReadFile)
+	statements := parser.Parse()
+	if loxerror.HadError() {
+		return
+	}
+
+	resolver := syntax.NewResolver(syntax.NewInterpreter())
+	resolver.Resolve(statements)
+	if loxerror.HadError() {
+		return
+	}
+
+	syntax.NewChecker().Check(statements)
+	for _, warning := range resolver.Warnings() {
+		loxerror.Warning(warning.Token.Line, warning.Token.Column, warning.Token.Lexeme, warning.Message)
+	}
+}
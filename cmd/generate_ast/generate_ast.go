@@ -13,38 +13,52 @@ func main() {
 		os.Exit(64)
 	}
 
-	defineAst(os.Args[1], "expression.go", "Expr", []string{
-		"Assign : name *scanner.Token, value Expr",
+	defineAst(os.Args[1], "expression.go", "Expr", "", []string{
+		"Assign : name *scanner.Token, value Expr | depth *int, resolved bool, compound *scanner.Token",
 		"Binary : left Expr, operator *scanner.Token, right Expr",
-		"Call : callee Expr, paren *scanner.Token, arguments []Expr",
-		"GetMethod : object Expr, name *scanner.Token",
-		"GetField : object Expr, name *scanner.Token",
+		"Call : callee Expr, paren *scanner.Token, arguments []Expr | tail bool",
+		"Spawn : keyword *scanner.Token, call *Call",
+		"Spread : ellipsis *scanner.Token, expression Expr",
+		"GetMethod : object Expr, name *scanner.Token, optional bool",
+		"GetField : object Expr, name *scanner.Token, optional bool",
 		"Set : object Expr, name *scanner.Token, value Expr",
-		"Super : keyword *scanner.Token, method *scanner.Token",
-		"This : keyword *scanner.Token",
-		"Grouping : expression Expr",
-		"Literal : value interface{}",
+		"Super : keyword *scanner.Token, method *scanner.Token | depth *int, resolved bool",
+		"This : keyword *scanner.Token | depth *int, resolved bool",
+		"Grouping : expression Expr | opening *scanner.Token, closing *scanner.Token",
+		"Literal : value interface{} | text string, start *scanner.Token, end *scanner.Token",
 		"Logical : left Expr, operator *scanner.Token, right Expr",
 		"Unary : operator *scanner.Token, right Expr",
-		"Variable : name *scanner.Token, t references.FunctionType",
+		"Variable : name *scanner.Token, t references.FunctionType | depth *int, resolved bool",
 	})
 
-	defineAst(os.Args[1], "statement.go", "Stmt", []string{
-		"Block : statements []Stmt, isLoopIncrementer bool",
+	defineAst(os.Args[1], "statement.go", "Stmt", "stmtInfo", []string{
+		"Block : statements []Stmt",
 		"Expression : expression Expr",
-		"Function : name *scanner.Token, params []*scanner.Token, body []Stmt, isStatic bool",
+		"Function : name *scanner.Token, params []*scanner.Token, body []Stmt, isStatic bool, isGetter bool, paramTypes []*scanner.Token, returnType *scanner.Token, variadic bool, defaults []Expr | generator bool, deprecated bool, deprecation string, capture capturePlan, module *loxModule",
 		"IfCmd : condition Expr, thenBranch Stmt, elseBranch Stmt",
 		"Print : expression Expr",
 		"ReturnCmd : keyword *scanner.Token, value Expr",
-		"VarCmd : name *scanner.Token, initializer Expr",
-		"WhileLoop : condition Expr, body Stmt",
-		"BreakCmd : keyword *scanner.Token, envDepth int",
-		"ContinueCmd : keyword *scanner.Token, envDepth int",
-		"Class : name *scanner.Token, superclass *Variable, methods []*Function, fields []*VarCmd",
+		"VarCmd : name *scanner.Token, initializer Expr, constant bool, annotation *scanner.Token",
+		"Unpack : keyword *scanner.Token, names []*scanner.Token, initializer Expr, constant bool",
+		"WhileLoop : condition Expr, body Stmt, increment Expr, label *scanner.Token",
+		"ForIn : name *scanner.Token, iterable Expr, body Stmt, label *scanner.Token",
+		"SwitchCmd : keyword *scanner.Token, subject Expr, cases []*SwitchCase",
+		"Match : keyword *scanner.Token, subject Expr, arms []*MatchArm",
+		"BreakCmd : keyword *scanner.Token, label *scanner.Token",
+		"ContinueCmd : keyword *scanner.Token, label *scanner.Token",
+		"ImportCmd : keyword *scanner.Token, names []*scanner.Token, path *scanner.Token | module *loxModule",
+		"Yield : keyword *scanner.Token, value Expr",
+		"DeferCmd : keyword *scanner.Token, expression Expr",
+		"Enum : name *scanner.Token, members []*scanner.Token",
+		"Class : name *scanner.Token, superclass *Variable, traits []*Variable, methods []*Function, fields []*VarCmd | deprecated bool, deprecation string, capture capturePlan",
 	})
 }
 
-func defineAst(outputDir string, filename string, baseName string, types []string) {
+// defineAst writes the node types of baseName to filename. A type's fields
+// before "|" are passed to its constructor; those after it are filled in
+// later, by the parser or resolver. When embedded isn't empty, every type
+// embeds it and the interface requires an info method returning it.
+func defineAst(outputDir string, filename string, baseName string, embedded string, types []string) {
 	path := fmt.Sprintf("%s/%s", outputDir, filename)
 
 	visitorName := fmt.Sprintf("%sVisitor", baseName)
@@ -53,10 +67,17 @@ func defineAst(outputDir string, filename string, baseName string, types []strin
 
 	sb.WriteString("package syntax\n")
 	sb.WriteString("\n")
-	sb.WriteString("import \"golox/scanner\"\n")
+	if strings.Contains(strings.Join(types, "\n"), "references.") {
+		sb.WriteString("import (\n\t\"golox/references\"\n\t\"golox/scanner\"\n)\n")
+	} else {
+		sb.WriteString("import \"golox/scanner\"\n")
+	}
 	sb.WriteString("\n")
 	sb.WriteString(fmt.Sprintf("type %s interface{\n", baseName))
 	sb.WriteString(fmt.Sprintf("\taccept(visitor %s) interface{}\n", visitorName))
+	if embedded != "" {
+		sb.WriteString(fmt.Sprintf("\tinfo() *%s\n", embedded))
+	}
 	sb.WriteString("\tString() string")
 	sb.WriteString("}\n")
 	sb.WriteString("\n")
@@ -72,8 +93,12 @@ func defineAst(outputDir string, filename string, baseName string, types []strin
 	for _, t := range types {
 		parts := strings.Split(t, ":")
 		structName := strings.TrimSpace(parts[0])
-		fields := strings.TrimSpace(parts[1])
-		defineType(&sb, baseName, structName, visitorName, fields)
+		fields := strings.Split(parts[1], "|")
+		extras := ""
+		if len(fields) > 1 {
+			extras = strings.TrimSpace(fields[1])
+		}
+		defineType(&sb, baseName, structName, visitorName, strings.TrimSpace(fields[0]), extras, embedded)
 	}
 
 	err := ioutil.WriteFile(path, []byte(sb.String()), 0644)
@@ -82,11 +107,19 @@ func defineAst(outputDir string, filename string, baseName string, types []strin
 	}
 }
 
-func defineType(sb *strings.Builder, baseName string, structName string, visitorName string, fieldList string) {
+func defineType(sb *strings.Builder, baseName string, structName string, visitorName string, fieldList string, extraList string, embedded string) {
 	sb.WriteString(fmt.Sprintf("type %s struct {\n", structName))
+	if embedded != "" {
+		sb.WriteString(fmt.Sprintf("\t%s\n", embedded))
+	}
 	for _, f := range strings.Split(fieldList, ",") {
 		sb.WriteString(fmt.Sprintf("\t%s\n", strings.TrimSpace(f)))
 	}
+	if extraList != "" {
+		for _, f := range strings.Split(extraList, ",") {
+			sb.WriteString(fmt.Sprintf("\t%s\n", strings.TrimSpace(f)))
+		}
+	}
 	sb.WriteString("}\n")
 
 	sb.WriteString("\n")
@@ -0,0 +1,47 @@
+//go:build js && wasm
+// +build js,wasm
+
+// Command wasm is golox built for the browser. It defines golox.run(source)
+// for JavaScript, which runs a script and returns what it printed along
+// with its diagnostics.
+package main
+
+import (
+	"golox/engine"
+	"golox/loxerror"
+	"syscall/js"
+)
+
+func main() {
+	js.Global().Set("golox", map[string]interface{}{
+		"run": js.FuncOf(run),
+	})
+
+	// Keep the program alive so JavaScript can go on calling it.
+	select {}
+}
+
+func run(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return js.Global().Get("Error").New("golox.run expects the source of a script")
+	}
+
+	output, diagnostics := engine.RunSource(args[0].String())
+	list := make([]interface{}, len(diagnostics))
+	for i, diagnostic := range diagnostics {
+		list[i] = map[string]interface{}{
+			"severity": diagnostic.Severity.String(),
+			"code":     diagnostic.Code,
+			"message":  diagnostic.Message,
+			"line":     diagnostic.Span.Line,
+			"column":   diagnostic.Span.Column,
+			"length":   diagnostic.Span.Length,
+			"text":     loxerror.Render(diagnostic),
+		}
+	}
+
+	return map[string]interface{}{
+		"output":      output,
+		"diagnostics": list,
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"golox/refactor"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// runCodemod applies a transform script to a .lox file or to every .lox
+// file under a directory, rewriting the files it changes.
+func runCodemod(args []string) {
+	if len(args) != 2 {
+		fmt.Println("Usage: golox codemod <transform.lox> <file.lox|directory>")
+		os.Exit(64)
+	}
+
+	transform, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(64)
+	}
+
+	codemod, err := refactor.LoadCodemod(string(transform))
+	if err != nil {
+		fmt.Printf("%s: %s\n", args[0], err.Error())
+		os.Exit(65)
+	}
+
+	failed := false
+	err = filepath.Walk(args[1], func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || filepath.Ext(path) != ".lox" {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		result, err := codemod.Apply(string(data))
+		if err != nil {
+			fmt.Printf("%s: %s\n", path, err.Error())
+			failed = true
+			return nil
+		}
+
+		if result == string(data) {
+			return nil
+		}
+
+		if err := writeFileAtomic(path, []byte(result)); err != nil {
+			return err
+		}
+
+		fmt.Println(path)
+		return nil
+	})
+
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(74)
+	}
+
+	if failed {
+		os.Exit(65)
+	}
+}
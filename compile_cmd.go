@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"golox/loxerror"
+	"golox/syntax"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// runCompile parses and resolves a script and saves the result, which
+// golox runs without scanning or parsing it again.
+func runCompile(args []string) {
+	flags := flag.NewFlagSet("compile", flag.ExitOnError)
+	out := flags.String("o", "", "write the compiled program to this file instead of next to the script")
+	strip := flags.Bool("strip", false, "leave the source out, so the program can't be recompiled by another golox")
+	info := flags.Bool("info", false, "describe a compiled program instead of compiling a script")
+	flags.BoolVar(optimize, "O", false, "fold constant expressions and drop dead branches")
+	flags.Usage = func() {
+		fmt.Println("Usage: golox compile [-O] [-strip] <script.lox> [-o script.loxc]")
+		fmt.Println("       golox compile -info <script.loxc>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	// Flags may also follow the script.
+	if flags.NArg() > 1 {
+		path := flags.Arg(0)
+		flags.Parse(flags.Args()[1:])
+		if flags.NArg() > 0 {
+			flags.Usage()
+			os.Exit(64)
+		}
+
+		args = []string{path}
+	} else {
+		args = flags.Args()
+	}
+
+	if *info && len(args) == 1 && strings.HasSuffix(args[0], ".loxc") {
+		describeProgram(args[0])
+		return
+	}
+
+	if *info || len(args) != 1 || !strings.HasSuffix(args[0], ".lox") {
+		flags.Usage()
+		os.Exit(64)
+	}
+
+	path := args[0]
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(74)
+	}
+
+	source := string(data)
+	statements := compile(path, source)
+	if loxerror.HadError() {
+		os.Exit(65)
+	}
+
+	if *strip {
+		source = ""
+	}
+
+	var program bytes.Buffer
+	if err := syntax.WriteProgram(&program, path, source, statements); err != nil {
+		fmt.Printf("Can't compile %s: %s\n", path, err.Error())
+		os.Exit(65)
+	}
+
+	if *out == "" {
+		*out = path + "c"
+	}
+
+	if err := ioutil.WriteFile(*out, program.Bytes(), 0644); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(74)
+	}
+}
+
+// describeProgram prints the header of a compiled program and whether this
+// golox can run it as it is, needs to compile it again or can't run it.
+func describeProgram(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(64)
+	}
+
+	program, format, err := syntax.ReadProgramHeader(file)
+	file.Close()
+	if err != nil {
+		fmt.Printf("Can't read %s: %s\n", path, err.Error())
+		os.Exit(65)
+	}
+
+	features := strings.Join(syntax.FeatureNames(program.Features), ", ")
+	if features == "" {
+		features = "none"
+	}
+
+	source := "embedded"
+	if program.Source == "" {
+		source = "stripped"
+	}
+
+	fmt.Printf("Compiled by: golox %s\n", program.Version)
+	fmt.Printf("Format:      %d\n", format)
+	fmt.Printf("Features:    %s\n", features)
+	fmt.Printf("Script:      %s\n", program.Path)
+	fmt.Printf("Source:      %s\n", source)
+
+	switch err := syntax.Loadable(format, program); {
+	case err == nil:
+		fmt.Printf("Runs on golox %s as compiled.\n", syntax.Version)
+	case program.Source != "":
+		fmt.Printf("golox %s compiles it again from its source: %s.\n", syntax.Version, err.Error())
+	default:
+		fmt.Printf("golox %s can't run it: %s.\n", syntax.Version, err.Error())
+	}
+}
+
+// runCompiled runs a program saved by golox compile. A program this golox
+// can't load is compiled again from the source it embeds.
+func runCompiled(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(64)
+	}
+
+	program, err := interpreter.ReadProgram(file)
+	file.Close()
+	if _, ok := err.(*syntax.ProgramMismatchError); ok && program.Source != "" {
+		fmt.Fprintf(os.Stderr, "%s was %s; compiling it again from its source.\n", path, err.Error())
+		run(program.Path, program.Source)
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Can't run %s: %s\n", path, err.Error())
+		os.Exit(65)
+	}
+
+	loxerror.SetSource(program.Source)
+	execute(program.Path, program.Source, program.Statements)
+}
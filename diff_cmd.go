@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"golox/refactor"
+	"io/ioutil"
+	"os"
+)
+
+// runDiff prints the functions, classes and methods that differ between two
+// versions of a script, exiting with 1 when there are any.
+func runDiff(args []string) {
+	if len(args) != 2 {
+		fmt.Println("Usage: golox diff <old.lox> <new.lox>")
+		os.Exit(64)
+	}
+
+	var sources [2]string
+	for i, path := range args {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(64)
+		}
+
+		sources[i] = string(data)
+	}
+
+	changes, err := refactor.Diff(sources[0], sources[1])
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(65)
+	}
+
+	for _, change := range changes {
+		fmt.Println(change.String())
+	}
+
+	if len(changes) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"golox/loxerror"
+	"golox/scanner"
+	"golox/syntax"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// runTokens scans a script and prints one token per line: its position,
+// type, lexeme and literal value.
+func runTokens(path string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(64)
+	}
+
+	loxerror.SetSource(string(data))
+	for _, token := range scanner.NewScanner(string(data)).ScanTokens() {
+		literal := ""
+		switch value := token.Literal.(type) {
+		case nil:
+		case string:
+			literal = fmt.Sprintf("%q", value)
+		default:
+			literal = fmt.Sprintf("%v", value)
+		}
+
+		position := fmt.Sprintf("%d:%d", token.Line, token.Column)
+		line := fmt.Sprintf("%-8s %-16s %-20q %s", position, token.Type, token.Lexeme, literal)
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+
+	if loxerror.HadError() {
+		os.Exit(65)
+	}
+}
+
+// runDumpAst parses a script without running it and prints its syntax
+// tree as JSON.
+func runDumpAst(path string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(64)
+	}
+
+	loxerror.SetSource(string(data))
+	parser := syntax.NewAstParser(scanner.NewScanner(string(data)).ScanTokens())
+	parser.SetFile(path, ioutil.ReadFile)
+	statements := parser.Parse()
+	if loxerror.HadError() {
+		os.Exit(65)
+	}
+
+	if *optimize {
+		statements = syntax.NewOptimizer().Optimize(statements)
+	}
+
+	out, err := json.MarshalIndent(syntax.DumpAst(statements), "", "  ")
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(70)
+	}
+
+	fmt.Println(string(out))
+}
@@ -0,0 +1,253 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"golox/loxerror"
+	"golox/scanner"
+	"golox/syntax"
+	"io"
+	"os"
+	"time"
+)
+
+var ErrCompile = errors.New("lox: compile error")
+var ErrRuntime = errors.New("lox: runtime error")
+
+// Engine runs Lox source on behalf of a Go application. Globals persist
+// between calls to Run, and each engine has its own, as it has its own
+// errors and warnings. An engine runs one call at a time. Engines used
+// from different goroutines take turns running scripts, since errors are
+// reported through the loxerror package as they are found.
+type Engine struct {
+	interpreter *syntax.Interpreter
+	vfs         *syntax.VFS
+	strict      syntax.StrictCheck
+	diagnostics *loxerror.Collector
+}
+
+// Option configures an Engine made by New.
+type Option func(engine *Engine)
+
+// StrictMode makes every strict check, as golox --strict does.
+var StrictMode Option = Strict(syntax.StrictAll)
+
+// Strict makes the given strict checks, such as syntax.CheckUnused, while
+// resolving each script. A script failing one doesn't run.
+func Strict(checks syntax.StrictCheck) Option {
+	return func(engine *Engine) {
+		engine.strict = checks
+	}
+}
+
+func New(options ...Option) *Engine {
+	engine := &Engine{
+		interpreter: syntax.NewInterpreter(),
+		diagnostics: loxerror.NewCollector(&loxerror.ConsoleReporter{Out: os.Stdout}),
+	}
+
+	for _, option := range options {
+		option(engine)
+	}
+
+	return engine
+}
+
+// Run scans, parses, resolves and interprets source. Errors are reported as
+// they are found and summarized by the returned error.
+func (engine *Engine) Run(source string) error {
+	defer loxerror.Use(engine.diagnostics)()
+	engine.diagnostics.Reset()
+	engine.diagnostics.SetSource(source)
+
+	tokens := scanner.NewScanner(source).ScanTokens()
+	parser := syntax.NewAstParser(tokens)
+	parser.SetInterpreter(engine.interpreter)
+	if engine.vfs != nil {
+		parser.SetFile("", engine.vfs.ReadFile)
+	}
+
+	statements := parser.Parse()
+	if engine.diagnostics.HadError() {
+		return ErrCompile
+	}
+
+	resolver := syntax.NewResolver(engine.interpreter)
+	resolver.SetStrict(engine.strict)
+	resolver.Resolve(statements)
+	if engine.diagnostics.HadError() {
+		return ErrCompile
+	}
+
+	syntax.NewChecker().Check(statements)
+	if engine.diagnostics.HadError() {
+		return ErrCompile
+	}
+
+	engine.interpreter.Interpret(statements)
+	if engine.diagnostics.HadRuntimeError() {
+		return ErrRuntime
+	}
+
+	return nil
+}
+
+// Call calls a global function or class defined by a script this engine
+// ran. Go strings, numbers, bools, slices and maps with string keys are
+// converted to Lox values, and the result is converted back: lists become
+// []interface{} and instances map[string]interface{}. A runtime error is
+// returned as a *syntax.RuntimeError, and Diagnostics lists it.
+func (engine *Engine) Call(name string, args ...interface{}) (interface{}, error) {
+	defer loxerror.Use(engine.diagnostics)()
+	engine.diagnostics.Reset()
+	return engine.interpreter.Call(name, args...)
+}
+
+// EvalInGlobals runs source in the globals scripts run by this engine
+// share, as eval() does in a script, and returns the value of its last
+// statement when that is an expression, converted as Call converts results.
+// Source that doesn't compile is returned as a *syntax.RuntimeError.
+func (engine *Engine) EvalInGlobals(source string) (interface{}, error) {
+	defer loxerror.Use(engine.diagnostics)()
+	engine.diagnostics.Reset()
+	return engine.interpreter.Eval(source)
+}
+
+// Define makes a Go value a global that scripts run by this engine can
+// read. Scripts can pass it around but not look inside it.
+func (engine *Engine) Define(name string, value interface{}) {
+	engine.interpreter.Define(name, value)
+}
+
+// Bind makes a Go struct, or a pointer to one, a global that scripts use
+// like an instance: they read its exported fields and call its exported
+// methods, as in server.Port or server.Start(). Through a pointer they can
+// also set its fields. Arguments that don't convert to the Go types are
+// runtime errors, as are errors the methods return.
+func (engine *Engine) Bind(name string, v interface{}) {
+	engine.interpreter.Bind(name, v)
+}
+
+// LoadNatives loads a Go plugin that adds natives through the natives
+// package, as golox --natives does.
+func (engine *Engine) LoadNatives(path string) error {
+	return engine.interpreter.LoadPlugin(path)
+}
+
+// RegisterPrinter controls how scripts print values of example's Go type,
+// for instance to keep secrets out of their output.
+func (engine *Engine) RegisterPrinter(example interface{}, printer func(value interface{}) string) {
+	engine.interpreter.RegisterPrinter(example, printer)
+}
+
+// SetPlotter makes Plot.line and Plot.bar hand each chart to render as JSON
+// instead of writing it to an SVG file, for front ends that draw charts
+// themselves.
+func (engine *Engine) SetPlotter(render func(chart []byte)) {
+	engine.interpreter.SetPlotter(func(chart *syntax.Chart) {
+		data, _ := json.Marshal(chart)
+		render(data)
+	})
+}
+
+// EnableDebugServer lets a debugger client attach over TCP to scripts run by
+// this engine, even while one is already running. It returns once the
+// server is listening.
+func (engine *Engine) EnableDebugServer(addr string) error {
+	_, err := engine.interpreter.ServeDebugger(addr)
+	return err
+}
+
+// SetFilesystem makes scripts run by this engine hermetic. They read and
+// embed only the given files, keyed by path, and what they write is kept
+// in memory for Overlay instead of reaching the disk.
+func (engine *Engine) SetFilesystem(files map[string][]byte) {
+	engine.vfs = syntax.NewVFS(files)
+	engine.interpreter.SetVFS(engine.vfs)
+}
+
+// Overlay returns the files scripts wrote since SetFilesystem, keyed by
+// path. Files they deleted map to nil.
+func (engine *Engine) Overlay() map[string][]byte {
+	if engine.vfs == nil {
+		return nil
+	}
+
+	return engine.vfs.Overlay()
+}
+
+// Diagnostics returns the errors and warnings the last call to Run found,
+// in the order they were found.
+func (engine *Engine) Diagnostics() []*loxerror.Diagnostic {
+	return engine.diagnostics.Diagnostics()
+}
+
+// SetReporter sends the errors and warnings of scripts run by this engine
+// to reporter as they are found, instead of printing them. Passing nil
+// only collects them for Diagnostics.
+func (engine *Engine) SetReporter(reporter loxerror.Reporter) {
+	engine.diagnostics.SetReporter(reporter)
+}
+
+// SetOutput makes print in scripts run by this engine write to out instead
+// of stdout.
+func (engine *Engine) SetOutput(out io.Writer) {
+	engine.interpreter.SetOutput(out)
+}
+
+// SetStepLimit makes a call to Run fail with a runtime error once the
+// script has executed limit statements, so a runaway script can't hang the
+// host. A limit of 0 removes it.
+func (engine *Engine) SetStepLimit(limit int64) {
+	engine.interpreter.SetStepLimit(limit)
+}
+
+// SetContext makes a call to Run fail with a runtime error once ctx is
+// done, and wakes scripts sleeping in sleep() to fail with it. A nil ctx
+// removes it.
+func (engine *Engine) SetContext(ctx context.Context) {
+	engine.interpreter.SetContext(ctx)
+}
+
+// SetOSAccess controls whether scripts run by this engine may read and set
+// environment variables and run programs. They may unless this is passed
+// false, or SetFilesystem made them hermetic.
+func (engine *Engine) SetOSAccess(allowed bool) {
+	engine.interpreter.SetOSAccess(allowed)
+}
+
+// SeedRandom makes random() and randomInt() in scripts run by this engine
+// draw the same numbers on every run given the same seed.
+func (engine *Engine) SeedRandom(seed int64) {
+	engine.interpreter.SeedRandom(seed)
+}
+
+// DefaultStepLimit is the number of statements RunSource lets a script
+// execute.
+const DefaultStepLimit = 10000000
+
+// DefaultTimeLimit is how long RunSource lets a script run, counting time
+// spent in sleep() that the step limit doesn't see.
+const DefaultTimeLimit = 30 * time.Second
+
+// RunSource runs a script in a new engine, for hosts such as a browser
+// playground that have no terminal. It returns what the script printed and
+// the errors and warnings found, which are not printed. It may be called
+// from several goroutines, and the scripts take turns as engines do.
+func RunSource(source string) (string, []*loxerror.Diagnostic) {
+	var out bytes.Buffer
+	engine := New()
+	engine.SetOutput(&out)
+	engine.SetStepLimit(DefaultStepLimit)
+	engine.SetOSAccess(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeLimit)
+	defer cancel()
+	engine.SetContext(ctx)
+
+	engine.SetReporter(nil)
+	engine.Run(source)
+	return out.String(), engine.Diagnostics()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"golox/refactor"
+	"os"
+	"path/filepath"
+)
+
+// runFixImports removes the unused imports of each file, adds the missing
+// ones that a module under the project directory exports, and sorts them,
+// printing the result or rewriting the file with -w.
+func runFixImports(args []string) {
+	flags := flag.NewFlagSet("fix-imports", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the result back to each file instead of printing it")
+	root := flags.String("root", "", "look for missing imports under this directory instead of each file's own")
+	flags.Usage = func() {
+		fmt.Println("Usage: golox fix-imports [-w] [-root dir] <file.lox>...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(64)
+	}
+
+	rewriteFiles(flags.Args(), *write, func(path string, source string) (string, error) {
+		return refactor.FixImports(path, source, importRoot(path, *root))
+	})
+}
+
+// importRoot is the directory missing imports of the file at path are
+// looked for in: root when it is given, or else the file's own.
+func importRoot(path string, root string) string {
+	if root != "" {
+		return root
+	}
+
+	return filepath.Dir(path)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"golox/refactor"
+	"io/ioutil"
+	"os"
+)
+
+// runFmt prints each file in the canonical layout, or rewrites it in place
+// with -w. With -imports, each file's imports are fixed first.
+func runFmt(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the result back to each file instead of printing it")
+	imports := flags.Bool("imports", false, "fix each file's imports first, as golox fix-imports does")
+	root := flags.String("root", "", "with -imports, look for missing imports under this directory instead of each file's own")
+	flags.Usage = func() {
+		fmt.Println("Usage: golox fmt [-w] [-imports [-root dir]] <file.lox>...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(64)
+	}
+
+	rewriteFiles(flags.Args(), *write, func(path string, source string) (string, error) {
+		if *imports {
+			fixed, err := refactor.FixImports(path, source, importRoot(path, *root))
+			if err != nil {
+				return "", err
+			}
+
+			source = fixed
+		}
+
+		return refactor.Format(source)
+	})
+}
+
+// rewriteFiles prints what transform makes of each file, or with write
+// saves it over the files it changes, exiting with 65 when any file can't
+// be transformed.
+func rewriteFiles(paths []string, write bool, transform func(path string, source string) (string, error)) {
+	failed := false
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(74)
+		}
+
+		transformed, err := transform(path, string(data))
+		if err != nil {
+			fmt.Printf("%s: %s\n", path, err.Error())
+			failed = true
+			continue
+		}
+
+		if !write {
+			fmt.Print(transformed)
+			continue
+		}
+
+		if transformed == string(data) {
+			continue
+		}
+
+		if err := writeFileAtomic(path, []byte(transformed)); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(74)
+		}
+	}
+
+	if failed {
+		os.Exit(65)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"golox/refactor"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// runLint prints the warnings for a .lox file or for every .lox file under a
+// directory, exiting with 1 when there are any.
+func runLint(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: golox lint <file.lox|directory>")
+		os.Exit(64)
+	}
+
+	found, failed := false, false
+	err := filepath.Walk(args[0], func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || filepath.Ext(path) != ".lox" {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		warnings, err := refactor.Lint(string(data))
+		if err != nil {
+			fmt.Printf("%s: %s\n", path, err.Error())
+			failed = true
+			return nil
+		}
+
+		for _, warning := range warnings {
+			fmt.Printf("%s:%d:%d: %s\n", path, warning.Token.Line, warning.Token.Column, warning.Message)
+			found = true
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(74)
+	}
+
+	if failed {
+		os.Exit(65)
+	}
+
+	if found {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,270 @@
+package loxerror
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (severity Severity) String() string {
+	if severity == SeverityWarning {
+		return "Warning"
+	}
+
+	return "Error"
+}
+
+// Codes of the diagnostics found before a program runs. Runtime errors
+// use the code of their kind, counting up from E1000.
+const (
+	// CodeScan is a character or literal the scanner can't read.
+	CodeScan = "E0001"
+	// CodeCompile is an error found while parsing, resolving or checking.
+	CodeCompile = "E0002"
+	// CodeWarning is a problem that doesn't stop the program, such as a
+	// use of something deprecated.
+	CodeWarning = "W0001"
+)
+
+// Span is the text a diagnostic points at: the line it starts on, its
+// 1-based column and its length. A zero Column means the position within
+// the line isn't known.
+type Span struct {
+	Line   int
+	Column int
+	Length int
+}
+
+// Diagnostic is one problem found in a program, by the scanner, parser,
+// resolver, checker or interpreter.
+type Diagnostic struct {
+	Severity Severity
+	Code     string
+	// Label names the diagnostic where it is printed, such as "Error" or
+	// "TypeError".
+	Label   string
+	Message string
+	// Lexeme is the token the diagnostic is at, and AtEnd is set when that
+	// is the end of the file.
+	Lexeme string
+	AtEnd  bool
+	Span   Span
+	// File is the module the diagnostic is in, and empty for the program
+	// being run.
+	File string
+	// Runtime is set for errors raised while the program was running.
+	Runtime bool
+	// lines are the source lines of the file the diagnostic is in, for
+	// Render to quote.
+	lines []string
+}
+
+// Reporter receives diagnostics as they are found.
+type Reporter interface {
+	Report(diagnostic *Diagnostic)
+}
+
+// ConsoleReporter prints each diagnostic with the source line it is on.
+type ConsoleReporter struct {
+	Out io.Writer
+}
+
+func (reporter *ConsoleReporter) Report(diagnostic *Diagnostic) {
+	fmt.Fprint(reporter.Out, Render(diagnostic))
+}
+
+// Collector keeps the diagnostics reported since it was last Reset and
+// hands each to its reporter. The package functions report to the
+// collector in use, which is the one that prints to the console unless Use
+// says otherwise.
+type Collector struct {
+	mu          sync.Mutex
+	diagnostics []*Diagnostic
+	reporter    Reporter
+	// source is the program being run, and sourceLines the same split into
+	// lines, for showing where errors are. file names the module source
+	// came from, when it isn't the program itself.
+	source      string
+	sourceLines []string
+	file        string
+}
+
+// NewCollector makes a collector that hands diagnostics to reporter. A nil
+// reporter only collects them.
+func NewCollector(reporter Reporter) *Collector {
+	return &Collector{reporter: reporter}
+}
+
+var console = NewCollector(&ConsoleReporter{Out: os.Stdout})
+
+// inUse is the collector the package functions report to, and useLock is
+// held while one other than the console is.
+var inUse = console
+var inUseMu sync.Mutex
+var useLock sync.Mutex
+
+func active() *Collector {
+	inUseMu.Lock()
+	defer inUseMu.Unlock()
+
+	return inUse
+}
+
+// Use makes the package functions report to collector until the returned
+// function is called. Goroutines take turns: Use waits while another
+// collector is in use. Using the collector already in use doesn't wait, so
+// a host that a running script calls can call back into it.
+func Use(collector *Collector) func() {
+	if active() == collector {
+		return func() {}
+	}
+
+	useLock.Lock()
+	inUseMu.Lock()
+	inUse = collector
+	inUseMu.Unlock()
+
+	return func() {
+		inUseMu.Lock()
+		inUse = console
+		inUseMu.Unlock()
+		useLock.Unlock()
+	}
+}
+
+// SetReporter replaces the console as the place diagnostics go and returns
+// the reporter it replaced. Passing nil only collects them for Diagnostics.
+func SetReporter(r Reporter) Reporter {
+	return active().SetReporter(r)
+}
+
+// SetReporter replaces the collector's reporter and returns the one it
+// replaced.
+func (collector *Collector) SetReporter(r Reporter) Reporter {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	previous := collector.reporter
+	collector.reporter = r
+	return previous
+}
+
+// Diagnostics returns everything reported since the last Reset.
+func Diagnostics() []*Diagnostic {
+	return active().Diagnostics()
+}
+
+func (collector *Collector) Diagnostics() []*Diagnostic {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	return append([]*Diagnostic(nil), collector.diagnostics...)
+}
+
+func (collector *Collector) add(diagnostic *Diagnostic) {
+	collector.mu.Lock()
+	diagnostic.File = collector.file
+	diagnostic.lines = collector.sourceLines
+	collector.diagnostics = append(collector.diagnostics, diagnostic)
+	reporter := collector.reporter
+	collector.mu.Unlock()
+
+	if reporter != nil {
+		reporter.Report(diagnostic)
+	}
+}
+
+// Collect runs fn with what it reports kept from the reporter and from
+// Diagnostics, and returns that instead, for checking source that isn't
+// the program being run.
+func Collect(fn func()) []*Diagnostic {
+	return active().Collect(fn)
+}
+
+func (collector *Collector) Collect(fn func()) []*Diagnostic {
+	collector.mu.Lock()
+	start := len(collector.diagnostics)
+	collector.mu.Unlock()
+
+	previous := collector.SetReporter(nil)
+	defer func() {
+		collector.SetReporter(previous)
+	}()
+
+	fn()
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	collected := append([]*Diagnostic(nil), collector.diagnostics[start:]...)
+	collector.diagnostics = collector.diagnostics[:start]
+	return collected
+}
+
+// Render formats a diagnostic the way the console shows it: a header line
+// and, when its position is known, the source line with carets under it.
+func Render(diagnostic *Diagnostic) string {
+	where := ""
+	if diagnostic.AtEnd {
+		where = " at the end"
+	} else if diagnostic.Lexeme != "" {
+		where = fmt.Sprintf(" at '%s'", diagnostic.Lexeme)
+	}
+
+	in := ""
+	if diagnostic.File != "" {
+		in = " of " + diagnostic.File
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[line %d%s] %s%s: %s\n", diagnostic.Span.Line, in, diagnostic.Label, where, diagnostic.Message)
+	if !diagnostic.AtEnd {
+		sb.WriteString(snippet(diagnostic.lines, diagnostic.Span))
+	}
+
+	return sb.String()
+}
+
+// snippet quotes the line of sourceLines span is on with carets under it.
+// Tokens the interpreter made up have no column, and are left unquoted.
+func snippet(sourceLines []string, span Span) string {
+	if span.Column < 1 || span.Line < 1 || span.Line > len(sourceLines) {
+		return ""
+	}
+
+	text := strings.TrimRight(sourceLines[span.Line-1], "\r")
+	if span.Column > len(text)+1 {
+		return ""
+	}
+
+	// Keep tabs so the carets line up with the quoted line.
+	var pad strings.Builder
+	for _, c := range text[:span.Column-1] {
+		if c == '\t' {
+			pad.WriteRune('\t')
+		} else {
+			pad.WriteRune(' ')
+		}
+	}
+
+	width := span.Length
+	if rest := len(text) - (span.Column - 1); width > rest {
+		width = rest
+	}
+
+	if width < 1 {
+		width = 1
+	}
+
+	gutter := fmt.Sprintf("%5d | ", span.Line)
+	return fmt.Sprintf("%s%s\n%s| %s%s\n", gutter, text, strings.Repeat(" ", len(gutter)-2), pad.String(), strings.Repeat("^", width))
+}
@@ -1,39 +1,140 @@
 package loxerror
 
 import (
-	"fmt"
 	"golox/references"
+	"strings"
 )
 
-var hadError = false
-var hadRuntimeError = false
+// SetSource tells the reporter which program errors refer to, so each
+// error can quote the line it is on. It returns the program it replaced.
+func SetSource(program string) string {
+	return active().SetSource(program)
+}
+
+func (collector *Collector) SetSource(program string) string {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	previous := collector.source
+	collector.source = program
+	collector.sourceLines = strings.Split(program, "\n")
+	return previous
+}
+
+// SetFile names the module the source given to SetSource came from, so
+// errors in it say which file they are in. It returns the name it replaced.
+func SetFile(name string) string {
+	return active().SetFile(name)
+}
+
+func (collector *Collector) SetFile(name string) string {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	previous := collector.file
+	collector.file = name
+	return previous
+}
+
+func Error(line int, column int, message string) {
+	Report(line, column, "", message, false)
+}
+
+func TokenError(t references.TokenType, line int, column int, lexeme string, message string) {
+	TokenRuntimeError(t, line, column, lexeme, message, false)
+}
+
+func TokenRuntimeError(t references.TokenType, line int, column int, lexeme string, message string, isRuntimeError bool) {
+	code := CodeCompile
+	if isRuntimeError {
+		code = "E1000"
+	}
 
-func Error(line int, message string) {
-	Report(line, "", message, false)
+	active().add(tokenDiagnostic("Error", code, t, line, column, lexeme, message, isRuntimeError))
 }
 
-func TokenError(t references.TokenType, line int, lexeme string, message string) {
-	TokenRuntimeError(t, line, lexeme, message, false)
+// Report records an error the scanner found at a position with no token.
+func Report(line int, column int, where string, message string, isRuntimeError bool) {
+	active().add(&Diagnostic{
+		Severity: SeverityError,
+		Code:     CodeScan,
+		Label:    "Error",
+		Message:  message,
+		Span:     Span{Line: line, Column: column, Length: 1},
+		Runtime:  isRuntimeError,
+	})
 }
 
-func TokenRuntimeError(t references.TokenType, line int, lexeme string, message string, isRuntimeError bool) {
-	if t == references.EOF {
-		Report(line, " at the end", message, isRuntimeError)
-	} else {
-		Report(line, fmt.Sprintf(" at '%s'", lexeme), message, isRuntimeError)
+// KindRuntimeError reports a runtime error labelled with its kind and error
+// code, such as "TypeError[E1001]", in place of the plain "Error".
+func KindRuntimeError(kind string, code string, t references.TokenType, line int, column int, lexeme string, message string) {
+	active().add(tokenDiagnostic(kind+"["+code+"]", code, t, line, column, lexeme, message, true))
+}
+
+func tokenDiagnostic(label string, code string, t references.TokenType, line int, column int, lexeme string, message string, isRuntimeError bool) *Diagnostic {
+	// Tokens spanning lines, like multi-line strings, carry the line they
+	// end on.
+	first := strings.SplitN(lexeme, "\n", 2)[0]
+	return &Diagnostic{
+		Severity: SeverityError,
+		Code:     code,
+		Label:    label,
+		Message:  message,
+		Lexeme:   lexeme,
+		AtEnd:    t == references.EOF,
+		Span:     Span{Line: line - strings.Count(lexeme, "\n"), Column: column, Length: len(first)},
+		Runtime:  isRuntimeError,
 	}
 }
 
-func Report(line int, where string, message string, isRuntimeError bool) {
-	fmt.Printf("%s\n", fmt.Errorf("[line %d] Error%s: %s", line, where, message).Error())
-	hadError = !isRuntimeError
-	hadRuntimeError = isRuntimeError
+// Warning reports a problem that doesn't stop the program from running.
+func Warning(line int, column int, lexeme string, message string) {
+	active().add(&Diagnostic{
+		Severity: SeverityWarning,
+		Code:     CodeWarning,
+		Label:    "Warning",
+		Message:  message,
+		Lexeme:   lexeme,
+		Span:     Span{Line: line, Column: column, Length: len(lexeme)},
+	})
 }
 
 func HadError() bool {
-	return hadError
+	return active().HadError()
+}
+
+func (collector *Collector) HadError() bool {
+	for _, diagnostic := range collector.Diagnostics() {
+		if diagnostic.Severity == SeverityError && !diagnostic.Runtime {
+			return true
+		}
+	}
+
+	return false
 }
 
 func HadRuntimeError() bool {
-	return hadRuntimeError
+	return active().HadRuntimeError()
+}
+
+func (collector *Collector) HadRuntimeError() bool {
+	for _, diagnostic := range collector.Diagnostics() {
+		if diagnostic.Runtime {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reset forgets the diagnostics reported so far.
+func Reset() {
+	active().Reset()
+}
+
+func (collector *Collector) Reset() {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	collector.diagnostics = nil
 }
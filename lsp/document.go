@@ -0,0 +1,189 @@
+package lsp
+
+import (
+	"golox/loxerror"
+	"golox/refactor"
+	"golox/syntax"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// document is an open file as the client last described it, along with
+// what analyzing that text found.
+type document struct {
+	uri     string
+	version int
+	text    string
+	// lineStarts holds the offset each line of text starts at.
+	lineStarts  []int
+	diagnostics []*loxerror.Diagnostic
+	// symbols are the symbols of text, or nil when it doesn't resolve.
+	// lastSymbols keeps the ones from the last text that did, which is
+	// close enough to complete names while a line is half typed.
+	symbols     *syntax.SymbolTable
+	lastSymbols *syntax.SymbolTable
+}
+
+func newDocument(uri string, version int, text string) *document {
+	doc := &document{uri: uri, version: version}
+	doc.setText(text)
+	return doc
+}
+
+func (doc *document) setText(text string) {
+	doc.text = text
+	doc.lineStarts = []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			doc.lineStarts = append(doc.lineStarts, i+1)
+		}
+	}
+}
+
+// apply makes the edits of a didChange notification in order.
+func (doc *document) apply(changes []contentChange) {
+	for _, change := range changes {
+		if change.Range == nil {
+			doc.setText(change.Text)
+			continue
+		}
+
+		start, end := doc.offset(change.Range.Start), doc.offset(change.Range.End)
+		if end < start {
+			start, end = end, start
+		}
+
+		doc.setText(doc.text[:start] + change.Text + doc.text[end:])
+	}
+}
+
+// analyze diagnoses the current text and records its symbols.
+func (doc *document) analyze() {
+	doc.symbols, doc.diagnostics = refactor.Diagnose(doc.path(), doc.text)
+	if doc.symbols != nil {
+		doc.lastSymbols = doc.symbols
+	}
+}
+
+// path is where the document lives on disk, for embedText, or "" when its
+// URI isn't a file.
+func (doc *document) path() string {
+	u, err := url.Parse(doc.uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+
+	return u.Path
+}
+
+// offset converts an LSP position to a byte offset into the text, clamping
+// it to the line it names.
+func (doc *document) offset(pos Position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+
+	if pos.Line >= len(doc.lineStarts) {
+		return len(doc.text)
+	}
+
+	offset := doc.lineStarts[pos.Line]
+	for units := 0; units < pos.Character && offset < len(doc.text) && doc.text[offset] != '\n'; {
+		r, size := utf8.DecodeRuneInString(doc.text[offset:])
+		units += utf16Len(r)
+		offset += size
+	}
+
+	return offset
+}
+
+// position converts a byte offset into the text to an LSP position.
+func (doc *document) position(offset int) Position {
+	if offset > len(doc.text) {
+		offset = len(doc.text)
+	}
+
+	line := 0
+	for line+1 < len(doc.lineStarts) && doc.lineStarts[line+1] <= offset {
+		line++
+	}
+
+	character := 0
+	for _, r := range doc.text[doc.lineStarts[line]:offset] {
+		character += utf16Len(r)
+	}
+
+	return Position{Line: line, Character: character}
+}
+
+func (doc *document) span(offset int, length int) Range {
+	return Range{Start: doc.position(offset), End: doc.position(offset + length)}
+}
+
+// lineColumnOffset converts the 1-based line and byte column golox reports
+// to an offset.
+func (doc *document) lineColumnOffset(line int, column int) int {
+	if line < 1 {
+		return 0
+	}
+
+	if line > len(doc.lineStarts) {
+		return len(doc.text)
+	}
+
+	offset := doc.lineStarts[line-1]
+	if column > 1 {
+		offset += column - 1
+	}
+
+	if offset > len(doc.text) {
+		return len(doc.text)
+	}
+
+	return offset
+}
+
+// lspDiagnostics converts what analyzing the text found for the client.
+func (doc *document) lspDiagnostics() []Diagnostic {
+	diagnostics := []Diagnostic{}
+	for _, diagnostic := range doc.diagnostics {
+		// Problems in the modules the document imports are theirs.
+		if diagnostic.File != "" {
+			continue
+		}
+
+		offset := doc.lineColumnOffset(diagnostic.Span.Line, diagnostic.Span.Column)
+		length := diagnostic.Span.Length
+		if diagnostic.AtEnd {
+			offset, length = len(doc.text), 0
+		}
+
+		if end := strings.IndexByte(doc.text[offset:], '\n'); end >= 0 && length > end {
+			length = end
+		}
+
+		severity := severityError
+		if diagnostic.Severity == loxerror.SeverityWarning {
+			severity = severityWarning
+		}
+
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    doc.span(offset, length),
+			Severity: severity,
+			Code:     diagnostic.Code,
+			Source:   "golox",
+			Message:  diagnostic.Message,
+		})
+	}
+
+	return diagnostics
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+
+	return 1
+}
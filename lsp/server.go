@@ -0,0 +1,417 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golox/loxerror"
+	"golox/refactor"
+	"golox/references"
+	"golox/scanner"
+	"golox/syntax"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ErrNoShutdown is returned by Serve when the client exits without asking
+// the server to shut down first.
+var ErrNoShutdown = errors.New("lsp: exit before shutdown")
+
+// Server answers Language Server Protocol requests for Lox files: it
+// publishes diagnostics as documents change, finds definitions and
+// references, completes names, renames symbols and extracts functions.
+type Server struct {
+	in        *bufio.Reader
+	out       io.Writer
+	documents map[string]*document
+	shutdown  bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: map[string]*document{},
+	}
+}
+
+// Serve handles messages until the client sends exit or closes the
+// connection.
+func (server *Server) Serve() error {
+	// Diagnostics go to the client, never to out, which carries the
+	// protocol.
+	loxerror.SetReporter(nil)
+
+	for {
+		body, err := readMessage(server.in)
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			if err := server.fail(nil, codeParseError, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if msg.Method == "exit" {
+			if !server.shutdown {
+				return ErrNoShutdown
+			}
+			return nil
+		}
+
+		if err := server.handle(&msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (server *Server) handle(msg *message) error {
+	var result interface{}
+	var err error
+	switch msg.Method {
+	case "initialize":
+		result = initializeResult()
+	case "shutdown":
+		server.shutdown = true
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			doc := newDocument(params.TextDocument.URI, params.TextDocument.Version, params.TextDocument.Text)
+			server.documents[doc.uri] = doc
+			return server.publish(doc)
+		}
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			if doc, ok := server.documents[params.TextDocument.URI]; ok {
+				doc.version = params.TextDocument.Version
+				doc.apply(params.ContentChanges)
+				return server.publish(doc)
+			}
+		}
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			delete(server.documents, params.TextDocument.URI)
+			return server.notify("textDocument/publishDiagnostics", &publishDiagnosticsParams{
+				URI:         params.TextDocument.URI,
+				Diagnostics: []Diagnostic{},
+			})
+		}
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			result, err = server.definition(&params)
+		}
+	case "textDocument/references":
+		var params referenceParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			result, err = server.references(&params)
+		}
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			result, err = server.completion(&params)
+		}
+	case "textDocument/rename":
+		var params renameParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			result, err = server.rename(&params)
+		}
+	case "textDocument/codeAction":
+		var params codeActionParams
+		if err = json.Unmarshal(msg.Params, &params); err == nil {
+			result, err = server.codeActions(&params)
+		}
+	default:
+		if msg.ID != nil && !strings.HasPrefix(msg.Method, "$/") {
+			return server.fail(msg.ID, codeMethodNotFound, fmt.Sprintf("method '%s' is not supported", msg.Method))
+		}
+	}
+
+	// Notifications get no response, even when they fail.
+	if msg.ID == nil {
+		return nil
+	}
+
+	if _, ok := err.(*json.UnmarshalTypeError); ok {
+		return server.fail(msg.ID, codeInvalidParams, err.Error())
+	}
+
+	if err != nil {
+		return server.fail(msg.ID, codeRequestFailed, err.Error())
+	}
+
+	return writeMessage(server.out, &response{JSONRPC: "2.0", ID: msg.ID, Result: result})
+}
+
+func initializeResult() interface{} {
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync": map[string]interface{}{
+				"openClose": true,
+				// Incremental: clients send only the ranges that changed.
+				"change": 2,
+			},
+			"definitionProvider": true,
+			"referencesProvider": true,
+			"completionProvider": map[string]interface{}{
+				"triggerCharacters": []string{"."},
+			},
+			"renameProvider": true,
+			"codeActionProvider": map[string]interface{}{
+				"codeActionKinds": []string{"refactor.extract"},
+			},
+		},
+		"serverInfo": map[string]interface{}{
+			"name": "golox",
+		},
+	}
+}
+
+func (server *Server) fail(id *json.RawMessage, code int, text string) error {
+	return writeMessage(server.out, &errorResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   &responseError{Code: code, Message: text},
+	})
+}
+
+func (server *Server) notify(method string, params interface{}) error {
+	return writeMessage(server.out, &notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// publish analyzes a document and sends the client what was found.
+func (server *Server) publish(doc *document) error {
+	doc.analyze()
+	return server.notify("textDocument/publishDiagnostics", &publishDiagnosticsParams{
+		URI:         doc.uri,
+		Version:     doc.version,
+		Diagnostics: doc.lspDiagnostics(),
+	})
+}
+
+// symbolAt finds the document a request is about and the symbol named at
+// its position. Both are nil when there is nothing to answer with, as
+// while the document has errors.
+func (server *Server) symbolAt(params *textDocumentPositionParams) (*document, *syntax.Symbol) {
+	doc, ok := server.documents[params.TextDocument.URI]
+	if !ok || doc.symbols == nil {
+		return nil, nil
+	}
+
+	offset := doc.offset(params.Position)
+	line := doc.position(offset).Line
+	return doc, doc.symbols.SymbolAt(line+1, offset-doc.lineStarts[line]+1)
+}
+
+func (server *Server) location(doc *document, token *scanner.Token) Location {
+	return Location{URI: doc.uri, Range: doc.span(token.Offset, len(token.Lexeme))}
+}
+
+func (server *Server) definition(params *textDocumentPositionParams) (interface{}, error) {
+	doc, symbol := server.symbolAt(params)
+	if symbol == nil {
+		return nil, nil
+	}
+
+	return server.location(doc, symbol.Declaration), nil
+}
+
+func (server *Server) references(params *referenceParams) (interface{}, error) {
+	doc, symbol := server.symbolAt(&params.textDocumentPositionParams)
+	if symbol == nil {
+		return nil, nil
+	}
+
+	tokens := sortedTokens(symbol.References)
+	if params.Context.IncludeDeclaration {
+		tokens = sortedTokens(symbol.Tokens())
+	}
+
+	locations := []Location{}
+	for _, token := range tokens {
+		locations = append(locations, server.location(doc, token))
+	}
+
+	return locations, nil
+}
+
+// sortedTokens orders tokens by where they are, dropping a token that is
+// referenced twice, as with the variable in x++.
+func sortedTokens(tokens []*scanner.Token) []*scanner.Token {
+	sorted := append([]*scanner.Token{}, tokens...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Offset < sorted[j].Offset
+	})
+
+	var unique []*scanner.Token
+	for _, token := range sorted {
+		if len(unique) == 0 || unique[len(unique)-1].Offset != token.Offset {
+			unique = append(unique, token)
+		}
+	}
+
+	return unique
+}
+
+// completion offers the variables, functions and classes in scope, or after
+// a '.' the members of the enclosing class for 'this' and of every class
+// otherwise, as Lox doesn't know what type other objects have.
+func (server *Server) completion(params *textDocumentPositionParams) (interface{}, error) {
+	items := []CompletionItem{}
+	doc, ok := server.documents[params.TextDocument.URI]
+	if !ok || doc.lastSymbols == nil {
+		return items, nil
+	}
+
+	symbols := doc.lastSymbols
+	offset := doc.offset(params.Position)
+	start := offset
+	for start > 0 && isIdentifierByte(doc.text[start-1]) {
+		start--
+	}
+
+	if start > 0 && doc.text[start-1] == '.' {
+		receiver := start - 1
+		for receiver > 0 && isIdentifierByte(doc.text[receiver-1]) {
+			receiver--
+		}
+
+		var members []string
+		if doc.text[receiver:start-1] == "this" {
+			if class := symbols.EnclosingClass(offset); class != nil {
+				members = class.AllMembers()
+			}
+		} else {
+			members = allMembers(symbols)
+		}
+
+		for _, member := range members {
+			items = append(items, CompletionItem{Label: member, Kind: completionField})
+		}
+
+		return items, nil
+	}
+
+	for _, symbol := range symbols.Visible(offset) {
+		item := CompletionItem{Label: symbol.Name, Kind: completionVariable}
+		switch symbol.Kind {
+		case references.Function:
+			item.Kind = completionFunction
+		case references.Klass:
+			item.Kind = completionClass
+		}
+
+		if symbol.Deprecated {
+			item.Detail = "deprecated"
+		}
+
+		items = append(items, item)
+	}
+
+	for _, name := range symbols.Globals {
+		items = append(items, CompletionItem{Label: name, Kind: completionVariable, Detail: "built-in"})
+	}
+
+	return items, nil
+}
+
+func allMembers(symbols *syntax.SymbolTable) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, symbol := range symbols.Symbols {
+		for _, member := range symbol.Members {
+			if !seen[member.Lexeme] {
+				seen[member.Lexeme] = true
+				names = append(names, member.Lexeme)
+			}
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// rename edits every token bound to the symbol at the position, once
+// refactor.Rename has checked the new name doesn't clash with another.
+func (server *Server) rename(params *renameParams) (interface{}, error) {
+	doc, symbol := server.symbolAt(&params.textDocumentPositionParams)
+	if symbol == nil {
+		return nil, errors.New("no variable, function or class to rename here")
+	}
+
+	line, column := symbol.Declaration.Line, symbol.Declaration.Column
+	if _, err := refactor.Rename(doc.text, line, column, params.NewName); err != nil {
+		return nil, err
+	}
+
+	edits := []TextEdit{}
+	for _, token := range sortedTokens(symbol.Tokens()) {
+		edits = append(edits, TextEdit{Range: doc.span(token.Offset, len(token.Lexeme)), NewText: params.NewName})
+	}
+
+	return &WorkspaceEdit{Changes: map[string][]TextEdit{doc.uri: edits}}, nil
+}
+
+// codeActions offers to extract the selected lines into a function.
+func (server *Server) codeActions(params *codeActionParams) (interface{}, error) {
+	actions := []CodeAction{}
+	doc, ok := server.documents[params.TextDocument.URI]
+	if !ok || doc.symbols == nil || params.Range.Start == params.Range.End {
+		return actions, nil
+	}
+
+	startLine, endLine := params.Range.Start.Line+1, params.Range.End.Line+1
+	// A selection of whole lines ends at the start of the next one.
+	if params.Range.End.Character == 0 && endLine > startLine {
+		endLine--
+	}
+
+	name := unusedName(doc.symbols, "extracted")
+	extracted, err := refactor.ExtractFunction(doc.text, startLine, endLine, name)
+	if err != nil {
+		return actions, nil
+	}
+
+	edit := TextEdit{Range: doc.span(0, len(doc.text)), NewText: extracted}
+	actions = append(actions, CodeAction{
+		Title: fmt.Sprintf("Extract lines %d-%d into function '%s'", startLine, endLine, name),
+		Kind:  "refactor.extract",
+		Edit:  &WorkspaceEdit{Changes: map[string][]TextEdit{doc.uri: {edit}}},
+	})
+
+	return actions, nil
+}
+
+func unusedName(symbols *syntax.SymbolTable, base string) string {
+	taken := map[string]bool{}
+	for _, symbol := range symbols.Symbols {
+		taken[symbol.Name] = true
+	}
+
+	for _, name := range symbols.Globals {
+		taken[name] = true
+	}
+
+	name := base
+	for i := 2; taken[name]; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+
+	return name
+}
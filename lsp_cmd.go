@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"golox/lsp"
+	"os"
+)
+
+// runLsp serves the Language Server Protocol over stdin and stdout.
+func runLsp(args []string) {
+	if len(args) != 0 {
+		fmt.Println("Usage: golox lsp")
+		os.Exit(64)
+	}
+
+	// Anything printed by accident would corrupt the protocol, so send it
+	// to stderr and keep stdout for the server.
+	out := os.Stdout
+	os.Stdout = os.Stderr
+
+	if err := lsp.NewServer(os.Stdin, out).Serve(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"golox/loxerror"
 	"golox/scanner"
 	"golox/syntax"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -14,13 +16,218 @@ import (
 
 var interpreter = syntax.NewInterpreter()
 
+var postMortem = flag.Bool("post-mortem", false, "open the debugger at the failing frame on an uncaught runtime error")
+var debug = flag.Bool("debug", false, "run the script under the interactive debugger")
+var debugListen = flag.String("debug-listen", "", "accept debugger clients over TCP on this address")
+var hotspots = flag.Bool("hotspots", false, "print the lines where the script spent the most time")
+var hotspotsTop = flag.Int("hotspots-top", 10, "number of lines printed by --hotspots")
+var profile = flag.Bool("profile", false, "print the calls and time spent in each function")
+var profilePprof = flag.String("profile-pprof", "", "with --profile, also write the profile to this file for the pprof tool")
+var coverage = flag.Bool("coverage", false, "list the script with how many times each line ran")
+var coverageLcov = flag.String("coverage-lcov", "", "record which lines ran and write them to this file in LCOV format")
+var trace = flag.Bool("trace", false, "log each statement run and each call and return")
+var traceOut = flag.String("trace-out", "", "with --trace, write the log to this file instead of stderr")
+var dumpTokens = flag.Bool("tokens", false, "print the script's tokens instead of running it")
+var dumpAst = flag.Bool("dump-ast", false, "print the script's syntax tree as JSON instead of running it")
+var vfsArchive = flag.String("vfs", "", "run hermetically, reading files from this tar archive and keeping writes in memory")
+var vfsOut = flag.String("vfs-out", "", "with --vfs, save the files the script wrote to this tar archive")
+var optimize = flag.Bool("O", false, "fold constant expressions and drop dead branches before running")
+var nativePlugins pathList
+var strict strictChecks
+
+func init() {
+	flag.Var(&nativePlugins, "natives", "load native functions from this Go plugin; may be repeated")
+	flag.Var(&strict, "strict", "report unused locals, shadowing, assignments to undeclared globals, non-boolean conditions and wrong argument counts as errors; pick checks with --strict=unused,shadowing,globals,conditions,arity or drop some with --strict=all,-shadowing")
+}
+
+// pathList is a flag that may be given more than once.
+type pathList []string
+
+func (paths *pathList) String() string {
+	return strings.Join(*paths, ",")
+}
+
+func (paths *pathList) Set(path string) error {
+	*paths = append(*paths, path)
+	return nil
+}
+
+// strictChecks is the --strict flag, which alone turns on every check.
+type strictChecks syntax.StrictCheck
+
+func (checks *strictChecks) String() string {
+	return syntax.StrictCheck(*checks).String()
+}
+
+func (checks *strictChecks) Set(spec string) error {
+	if spec == "true" {
+		spec = "all"
+	} else if spec == "false" {
+		spec = "all,-all"
+	}
+
+	parsed, err := syntax.ParseStrictChecks(spec)
+	*checks = strictChecks(parsed)
+	return err
+}
+
+func (checks *strictChecks) IsBoolFlag() bool {
+	return true
+}
+
+// vfs is the virtual filesystem of a hermetic run, or nil.
+var vfs *syntax.VFS
+
 func main() {
-	length := len(os.Args)
-	if length > 2 {
-		fmt.Printf("Usage: golox [script]")
+	flag.Usage = func() {
+		fmt.Println("Usage: golox [run] [-O] [--debug] [--post-mortem] [--debug-listen addr] [--hotspots] [--profile [--profile-pprof file]] [--coverage] [--coverage-lcov file] [--trace [--trace-out file]] [--tokens] [--dump-ast] [--vfs archive.tar [--vfs-out out.tar]] [--natives plugin.so] [--strict[=checks]] [script [arguments...]]")
+		flag.PrintDefaults()
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "refactor" {
+		runRefactor(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		runLint(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		runFmt(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		runDiff(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "test" {
+		runTest(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "compile" {
+		runCompile(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "lsp" {
+		runLsp(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "codemod" {
+		runCodemod(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && (os.Args[1] == "refs" || os.Args[1] == "def") {
+		runRefs(os.Args[1], os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		runCheck(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "fix-imports" {
+		runFixImports(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		flag.CommandLine.Parse(os.Args[2:])
+	} else if len(os.Args) > 1 && os.Args[1] == "debug" {
+		flag.CommandLine.Parse(os.Args[2:])
+		if flag.NArg() == 0 {
+			fmt.Println("Usage: golox debug [flags] script [arguments...]")
+			os.Exit(64)
+		}
+
+		*debug = true
+	} else {
+		flag.Parse()
+	}
+
+	if *dumpTokens {
+		if flag.NArg() == 0 {
+			flag.Usage()
+			os.Exit(64)
+		}
+
+		runTokens(flag.Arg(0))
+		return
+	}
+
+	if *dumpAst {
+		if flag.NArg() == 0 {
+			flag.Usage()
+			os.Exit(64)
+		}
+
+		runDumpAst(flag.Arg(0))
+		return
+	}
+
+	if *debugListen != "" {
+		addr, err := interpreter.ServeDebugger(*debugListen)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(64)
+		}
+
+		fmt.Fprintf(os.Stderr, "Debugger listening on %s\n", addr)
+	}
+
+	if *debug || *postMortem {
+		debugger := syntax.NewConsoleDebugger(interpreter, os.Stdin, os.Stdout)
+		if *debug {
+			debugger.Pause()
+			interpreter.SetDebugger(debugger)
+		}
+
+		if *postMortem {
+			interpreter.SetPostMortem(debugger)
+		}
+	}
+
+	if *hotspots {
+		interpreter.SetHotspots(syntax.NewHotspots())
+	}
+
+	if *profile {
+		interpreter.SetProfiler(syntax.NewProfiler())
+	}
+
+	if *coverage || *coverageLcov != "" {
+		interpreter.SetCoverage(syntax.NewCoverage())
+	}
+
+	if *trace {
+		startTrace()
+	}
+
+	for _, path := range nativePlugins {
+		if err := interpreter.LoadPlugin(path); err != nil {
+			fmt.Printf("Can't load natives from %s: %s\n", path, err.Error())
+			os.Exit(64)
+		}
+	}
+
+	if *vfsArchive != "" {
+		loadVFS(*vfsArchive)
+	} else if *vfsOut != "" {
+		fmt.Println("--vfs-out needs --vfs")
 		os.Exit(64)
-	} else if length == 2 {
-		runFile(os.Args[1])
+	}
+
+	if flag.NArg() > 0 {
+		interpreter.SetArgs(flag.Args())
+		runFile(flag.Arg(0))
 	} else {
 		runPrompt()
 	}
@@ -32,6 +239,11 @@ func runFile(path string) {
 		os.Exit(64)
 	}
 
+	if strings.HasSuffix(path, ".loxc") {
+		runCompiled(path)
+		return
+	}
+
 	if _, filename := filepath.Split(path); !strings.HasSuffix(filename, ".lox") {
 		fmt.Println("Not a Lox file")
 		os.Exit(64)
@@ -43,7 +255,7 @@ func runFile(path string) {
 		os.Exit(64)
 	}
 
-	run(string(data))
+	run(path, string(data))
 
 	if loxerror.HadError() {
 		os.Exit(65)
@@ -67,7 +279,126 @@ func runPrompt() {
 			break
 		}
 
-		run(line)
+		if strings.HasPrefix(line, ":") {
+			runCommand(line[1:])
+			continue
+		}
+
+		run("", line)
+	}
+}
+
+var heapStart *syntax.HeapCensus
+
+// runCommand handles REPL commands, which start with ':'.
+func runCommand(command string) {
+	switch strings.TrimSpace(command) {
+	case "heapdiff start":
+		heapStart = interpreter.TakeHeapCensus()
+		fmt.Println("Heap census taken.")
+	case "heapdiff report":
+		if heapStart == nil {
+			fmt.Println("Run ':heapdiff start' first.")
+			return
+		}
+
+		interpreter.TakeHeapCensus().Report(heapStart, os.Stdout)
+	default:
+		fmt.Printf("Unknown command ':%s'.\n", command)
+	}
+}
+
+// reportCoverage lists the lines a run covered and writes them to
+// --coverage-lcov.
+func reportCoverage() {
+	if *coverage {
+		interpreter.Coverage().Report(os.Stdout)
+	}
+
+	if *coverageLcov == "" {
+		return
+	}
+
+	file, err := os.Create(*coverageLcov)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(74)
+	}
+	defer file.Close()
+
+	interpreter.Coverage().WriteLcov(file)
+}
+
+// reportProfile prints the profile of a run and writes it to --profile-pprof.
+func reportProfile(path string) {
+	interpreter.Profiler().Report(os.Stdout)
+	if *profilePprof == "" {
+		return
+	}
+
+	file, err := os.Create(*profilePprof)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(74)
+	}
+	defer file.Close()
+
+	if err := interpreter.Profiler().WritePprof(file, path); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(74)
+	}
+}
+
+// startTrace logs the run to stderr or --trace-out. The file is written
+// unbuffered, so the log is complete however the script exits.
+func startTrace() {
+	out := io.Writer(os.Stderr)
+	if *traceOut != "" {
+		file, err := os.Create(*traceOut)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(74)
+		}
+
+		out = file
+	}
+
+	interpreter.SetTracer(syntax.NewTracer(out))
+}
+
+func loadVFS(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(64)
+	}
+	defer file.Close()
+
+	vfs, err = syntax.LoadTar(file)
+	if err != nil {
+		fmt.Printf("Can't read %s: %s\n", path, err.Error())
+		os.Exit(64)
+	}
+
+	interpreter.SetVFS(vfs)
+}
+
+// saveVFS writes the files a hermetic run wrote to --vfs-out.
+func saveVFS() {
+	if vfs == nil || *vfsOut == "" {
+		return
+	}
+
+	file, err := os.Create(*vfsOut)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(74)
+	}
+	defer file.Close()
+
+	if err := vfs.WriteTar(file); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(74)
 	}
 }
 
@@ -76,7 +407,7 @@ func fileExists(path string) bool {
 	return !os.IsNotExist(err)
 }
 
-func run(source string) {
+func run(path string, source string) {
 	defer func() {
 		if err := recover(); err != nil {
 
@@ -93,24 +424,82 @@ func run(source string) {
 		}
 	}()
 
+	statements := compile(path, source)
+	execute(path, source, statements)
+}
+
+// compile scans, parses, resolves and checks source, exiting on errors and
+// printing warnings.
+func compile(path string, source string) []syntax.Stmt {
+	loxerror.SetSource(source)
 	scanner := scanner.NewScanner(source)
 	tokens := scanner.ScanTokens()
 
 	parser := syntax.NewAstParser(tokens)
+	parser.SetInterpreter(interpreter)
+	if path != "" && vfs != nil {
+		// Embedded files come from the archive, relative to its root.
+		dir := filepath.Dir(path)
+		parser.SetFile(path, func(name string) ([]byte, error) {
+			if rel, err := filepath.Rel(dir, name); err == nil {
+				name = rel
+			}
+
+			return vfs.ReadFile(name)
+		})
+	} else if path != "" {
+		parser.SetFile(path, ioutil.ReadFile)
+	}
 	statements := parser.Parse()
 
 	if loxerror.HadError() {
 		os.Exit(65)
 	}
 
+	if *optimize {
+		statements = syntax.NewOptimizer().Optimize(statements)
+	}
+
 	resolver := syntax.NewResolver(interpreter)
+	resolver.SetStrict(syntax.StrictCheck(strict))
 	resolver.Resolve(statements)
 
 	if loxerror.HadError() {
 		os.Exit(65)
 	}
 
+	syntax.NewChecker().Check(statements)
+	if loxerror.HadError() {
+		os.Exit(65)
+	}
+
+	for _, warning := range resolver.Warnings() {
+		loxerror.Warning(warning.Token.Line, warning.Token.Column, warning.Token.Lexeme, warning.Message)
+	}
+
+	return statements
+}
+
+// execute runs a compiled script and reports on the run.
+func execute(path string, source string, statements []syntax.Stmt) {
+	if interpreter.Coverage() != nil {
+		interpreter.Coverage().AddFile(path, source, statements)
+	}
+
 	interpreter.Interpret(statements)
+	saveVFS()
+
+	if *hotspots {
+		interpreter.Hotspots().Report(source, *hotspotsTop, os.Stdout)
+	}
+
+	if *profile {
+		reportProfile(path)
+	}
+
+	if interpreter.Coverage() != nil {
+		reportCoverage()
+	}
 
 	if loxerror.HadRuntimeError() {
 		os.Exit(70)
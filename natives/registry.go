@@ -0,0 +1,26 @@
+// Package natives is what golox plugins build against. A plugin is a Go
+// plugin whose package main exports
+//
+//	func Register(r natives.Registry)
+//
+// and is loaded with golox --natives plugin.so. The package only depends on
+// the standard library, but as with any Go plugin, the plugin must be built
+// with the same Go release and version of this package as golox.
+package natives
+
+// Func is a native function. Its arguments arrive as Go values: nil, bool,
+// float64, int64, string, []interface{} for lists and map[string]interface{}
+// for instances. It may return those or any other Go value, and a non-nil
+// error becomes a runtime error in the script that called it.
+type Func func(arguments []interface{}) (interface{}, error)
+
+// Registry adds globals for scripts.
+type Registry interface {
+	// Define adds a native function taking arity arguments.
+	Define(name string, arity int, fn Func)
+	// Bind adds a Go struct, or a pointer to one, whose exported fields and
+	// methods scripts can use.
+	Bind(name string, value interface{})
+	// Value adds a global holding value, converted like a Func's results.
+	Value(name string, value interface{})
+}
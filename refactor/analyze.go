@@ -0,0 +1,78 @@
+package refactor
+
+import (
+	"errors"
+	"golox/loxerror"
+	"golox/references"
+	"golox/scanner"
+	"golox/syntax"
+	"io/ioutil"
+)
+
+var ErrInvalidProgram = errors.New("the program has errors")
+
+// analyze parses and resolves source without running it.
+func analyze(source string) ([]syntax.Stmt, *syntax.SymbolTable, error) {
+	statements, resolver, err := resolve(source)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return statements, resolver.Symbols(), nil
+}
+
+func resolve(source string) ([]syntax.Stmt, *syntax.Resolver, error) {
+	loxerror.Reset()
+	loxerror.SetSource(source)
+
+	statements := syntax.NewAstParser(scanner.NewScanner(source).ScanTokens()).Parse()
+	if loxerror.HadError() {
+		return nil, nil, ErrInvalidProgram
+	}
+
+	resolver := syntax.NewResolver(syntax.NewInterpreter())
+	resolver.Resolve(statements)
+	if loxerror.HadError() {
+		return nil, nil, ErrInvalidProgram
+	}
+
+	return statements, resolver, nil
+}
+
+func isIdentifier(name string) bool {
+	tokens := scanner.NewScanner(name).ScanTokens()
+	return len(tokens) == 2 && tokens[0].Type == references.Identifier && tokens[0].Lexeme == name
+}
+
+// Diagnose parses, resolves and checks source without running it and
+// returns the errors and warnings found along with the program's symbols.
+// Like a run, it stops at the first stage that fails, leaving the symbols
+// nil. path locates the files embedText reads and the modules the program
+// imports, whose diagnostics name their File, and may be empty.
+func Diagnose(path string, source string) (*syntax.SymbolTable, []*loxerror.Diagnostic) {
+	loxerror.Reset()
+	loxerror.SetSource(source)
+
+	parser := syntax.NewAstParser(scanner.NewScanner(source).ScanTokens())
+	if path != "" {
+		parser.SetFile(path, ioutil.ReadFile)
+	}
+
+	statements := parser.Parse()
+	if loxerror.HadError() {
+		return nil, loxerror.Diagnostics()
+	}
+
+	resolver := syntax.NewResolver(syntax.NewInterpreter())
+	resolver.Resolve(statements)
+	if loxerror.HadError() {
+		return nil, loxerror.Diagnostics()
+	}
+
+	syntax.NewChecker().Check(statements)
+	for _, warning := range resolver.Warnings() {
+		loxerror.Warning(warning.Token.Line, warning.Token.Column, warning.Token.Lexeme, warning.Message)
+	}
+
+	return resolver.Symbols(), loxerror.Diagnostics()
+}
@@ -0,0 +1,87 @@
+package refactor
+
+import (
+	"errors"
+	"fmt"
+	"golox/loxerror"
+	"golox/scanner"
+	"golox/syntax"
+	"sort"
+)
+
+var ErrTransformFailed = errors.New("the transform failed")
+
+// Codemod is a transform script written in Lox, loaded once and then applied
+// to any number of programs. See syntax.Codemod for the API the transform
+// is written against.
+type Codemod struct {
+	codemod   *syntax.Codemod
+	transform string
+}
+
+// LoadCodemod runs a transform script so the visitor functions it declares
+// are ready to be applied.
+func LoadCodemod(transform string) (*Codemod, error) {
+	loxerror.Reset()
+	loxerror.SetSource(transform)
+
+	statements := syntax.NewAstParser(scanner.NewScanner(transform).ScanTokens()).Parse()
+	if loxerror.HadError() {
+		return nil, ErrInvalidProgram
+	}
+
+	interpreter := syntax.NewInterpreter()
+	codemod := syntax.NewCodemod(interpreter)
+
+	syntax.NewResolver(interpreter).Resolve(statements)
+	if loxerror.HadError() {
+		return nil, ErrInvalidProgram
+	}
+
+	interpreter.Interpret(statements)
+	if loxerror.HadRuntimeError() {
+		return nil, ErrTransformFailed
+	}
+
+	return &Codemod{codemod: codemod, transform: transform}, nil
+}
+
+// Apply runs the transform over source and returns the edited program.
+func (codemod *Codemod) Apply(source string) (string, error) {
+	statements, _, err := analyze(source)
+	if err != nil {
+		return "", err
+	}
+
+	// Errors from here on are in the transform, not the program.
+	loxerror.SetSource(codemod.transform)
+	edits, err := codemod.codemod.Run(statements, source)
+	if err != nil {
+		return "", ErrTransformFailed
+	}
+
+	if len(edits) == 0 {
+		return source, nil
+	}
+
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].Start > edits[j].Start
+	})
+
+	for i := 1; i < len(edits); i++ {
+		if edits[i].End > edits[i-1].Start {
+			return "", fmt.Errorf("the transform made overlapping edits at offsets %d and %d", edits[i].Start, edits[i-1].Start)
+		}
+	}
+
+	result := source
+	for _, edit := range edits {
+		result = result[:edit.Start] + edit.Text + result[edit.End:]
+	}
+
+	if _, _, err := analyze(result); err != nil {
+		return "", fmt.Errorf("the transform produced an invalid program")
+	}
+
+	return result, nil
+}
@@ -0,0 +1,141 @@
+package refactor
+
+import (
+	"fmt"
+	"golox/scanner"
+	"golox/syntax"
+	"strings"
+)
+
+// Change is one difference Diff found between two versions of a program.
+type Change struct {
+	// Kind is "added", "removed", "signature" or "changed".
+	Kind   string
+	Old    *syntax.Declaration
+	New    *syntax.Declaration
+	Detail string
+}
+
+func (change *Change) String() string {
+	switch change.Kind {
+	case "added":
+		return fmt.Sprintf("+ %s %s", change.New.Kind, signature(change.New))
+	case "removed":
+		return fmt.Sprintf("- %s %s", change.Old.Kind, signature(change.Old))
+	case "signature":
+		return fmt.Sprintf("~ %s %s -> %s", change.New.Kind, signature(change.Old), signature(change.New))
+	}
+
+	return fmt.Sprintf("~ %s %s: %s", change.New.Kind, signature(change.New), change.Detail)
+}
+
+// Diff compares the functions, classes and methods two versions of a program
+// declare. Changes in formatting or comments aren't reported.
+func Diff(oldSource string, newSource string) ([]*Change, error) {
+	oldStatements, _, err := analyze(oldSource)
+	if err != nil {
+		return nil, fmt.Errorf("old version: %s", err.Error())
+	}
+	oldDeclarations := syntax.Declarations(oldStatements)
+
+	newStatements, _, err := analyze(newSource)
+	if err != nil {
+		return nil, fmt.Errorf("new version: %s", err.Error())
+	}
+	newDeclarations := syntax.Declarations(newStatements)
+
+	oldTokens := scanner.NewScanner(oldSource).ScanTokens()
+	newTokens := scanner.NewScanner(newSource).ScanTokens()
+
+	previous := make(map[string]*syntax.Declaration)
+	for _, declaration := range oldDeclarations {
+		previous[declaration.Name] = declaration
+	}
+
+	var changes []*Change
+	current := make(map[string]bool)
+	for _, declaration := range newDeclarations {
+		current[declaration.Name] = true
+
+		old, ok := previous[declaration.Name]
+		if !ok {
+			changes = append(changes, &Change{Kind: "added", New: declaration})
+			continue
+		}
+
+		if old.Kind != declaration.Kind || strings.Join(old.Params, ",") != strings.Join(declaration.Params, ",") {
+			changes = append(changes, &Change{Kind: "signature", Old: old, New: declaration})
+			continue
+		}
+
+		before := fingerprint(oldTokens, old, oldDeclarations)
+		after := fingerprint(newTokens, declaration, newDeclarations)
+		if before != after {
+			detail := "body changed"
+			if declaration.Kind == "class" {
+				detail = "fields changed"
+			}
+
+			changes = append(changes, &Change{Kind: "changed", Old: old, New: declaration, Detail: detail})
+		}
+	}
+
+	for _, declaration := range oldDeclarations {
+		if !current[declaration.Name] {
+			changes = append(changes, &Change{Kind: "removed", Old: declaration})
+		}
+	}
+
+	return changes, nil
+}
+
+// fingerprint joins the lexemes of a declaration's tokens, leaving out
+// the methods of a class since those are compared on their own.
+func fingerprint(tokens []*scanner.Token, declaration *syntax.Declaration, all []*syntax.Declaration) string {
+	if declaration.Start == nil {
+		return ""
+	}
+
+	var methods []*syntax.Declaration
+	if declaration.Kind == "class" {
+		for _, other := range all {
+			if other != declaration && strings.HasPrefix(other.Name, declaration.Name+".") && other.Start != nil {
+				methods = append(methods, other)
+			}
+		}
+	}
+
+	var lexemes []string
+	for _, token := range tokens {
+		if token.Offset < declaration.Start.Offset || token.Offset > declaration.End.Offset {
+			continue
+		}
+
+		inMethod := false
+		for _, method := range methods {
+			inMethod = inMethod || (token.Offset >= method.Start.Offset && token.Offset <= method.End.Offset)
+		}
+
+		if !inMethod {
+			lexemes = append(lexemes, token.Lexeme)
+		}
+	}
+
+	return strings.Join(lexemes, " ")
+}
+
+func signature(declaration *syntax.Declaration) string {
+	if declaration.Kind == "class" {
+		if len(declaration.Params) == 0 {
+			return declaration.Name
+		}
+
+		return fmt.Sprintf("%s < %s", declaration.Name, strings.Join(declaration.Params, ", "))
+	}
+
+	if declaration.Kind == "getter" {
+		return declaration.Name
+	}
+
+	return fmt.Sprintf("%s(%s)", declaration.Name, strings.Join(declaration.Params, ", "))
+}
@@ -0,0 +1,192 @@
+package refactor
+
+import (
+	"fmt"
+	"golox/references"
+	"golox/scanner"
+	"golox/syntax"
+	"strings"
+)
+
+const indentUnit = "  "
+
+// output is a value the extracted function has to hand back to its caller:
+// either a variable it declares that is used after the selection, or an
+// enclosing local it assigns to.
+type output struct {
+	symbol  *syntax.Symbol
+	declare bool
+}
+
+// ExtractFunction moves the statements on lines startLine through endLine
+// into a new top-level function and replaces them with a call to it. Locals
+// read by the selection become parameters, and a value the rest of the code
+// needs back is returned.
+func ExtractFunction(source string, startLine int, endLine int, name string) (string, error) {
+	if !isIdentifier(name) {
+		return "", fmt.Errorf("'%s' is not a valid name", name)
+	}
+
+	statements, symbols, err := analyze(source)
+	if err != nil {
+		return "", err
+	}
+
+	selected := selectStatements(statements, startLine, endLine)
+	if selected == nil {
+		return "", fmt.Errorf("lines %d-%d don't cover whole statements in one block", startLine, endLine)
+	}
+
+	first, _, _ := syntax.StmtTokens(selected[0])
+	_, last, _ := syntax.StmtTokens(selected[len(selected)-1])
+	start, end := first.Offset, last.Offset+len(last.Lexeme)
+
+	if err := checkControlFlow(source, start, end); err != nil {
+		return "", err
+	}
+
+	inside := func(token *scanner.Token) bool {
+		return token.Offset >= start && token.Offset < end
+	}
+
+	var params []string
+	var outputs []output
+	for _, symbol := range symbols.Symbols {
+		usedInside, writtenInside, usedAfter := false, false, false
+		for _, token := range symbol.References {
+			usedInside = usedInside || inside(token)
+			usedAfter = usedAfter || token.Offset >= end
+		}
+		for _, token := range symbol.Writes {
+			writtenInside = writtenInside || inside(token)
+		}
+
+		if inside(symbol.Declaration) {
+			if usedAfter {
+				outputs = append(outputs, output{symbol: symbol, declare: true})
+			}
+		} else if usedInside && symbol.Depth > 0 {
+			params = append(params, symbol.Name)
+			if writtenInside {
+				outputs = append(outputs, output{symbol: symbol, declare: false})
+			}
+		}
+	}
+
+	if len(outputs) > 1 {
+		var names []string
+		for _, o := range outputs {
+			names = append(names, o.symbol.Name)
+		}
+
+		return "", fmt.Errorf("the selection would have to return more than one value: %s", strings.Join(names, ", "))
+	}
+
+	insertAt := lineStart(source, start)
+	for _, stmt := range statements {
+		s, e, ok := syntax.StmtTokens(stmt)
+		if ok && s.Offset <= start && start < e.Offset+len(e.Lexeme) {
+			insertAt = lineStart(source, s.Offset)
+			break
+		}
+	}
+
+	selectionStart := lineStart(source, start)
+	indent := source[selectionStart:start]
+	call := fmt.Sprintf("%s(%s);", name, strings.Join(params, ", "))
+
+	var body strings.Builder
+	body.WriteString(fmt.Sprintf("fun %s(%s) {\n", name, strings.Join(params, ", ")))
+	body.WriteString(reindent(source[selectionStart:end], indent, indentUnit))
+	if len(outputs) == 1 {
+		o := outputs[0]
+		body.WriteString(fmt.Sprintf("%sreturn %s;\n", indentUnit, o.symbol.Name))
+		if o.declare {
+			call = fmt.Sprintf("var %s = %s", o.symbol.Name, call)
+		} else {
+			call = fmt.Sprintf("%s = %s", o.symbol.Name, call)
+		}
+	}
+	body.WriteString("}\n\n")
+
+	result := source[:selectionStart] + indent + call + source[end:]
+	result = result[:insertAt] + body.String() + result[insertAt:]
+
+	if _, _, err := analyze(result); err != nil {
+		return "", fmt.Errorf("extracting lines %d-%d would not produce a valid program", startLine, endLine)
+	}
+
+	return result, nil
+}
+
+// selectStatements finds the consecutive statements of a single block that
+// start within the line range, provided the range holds nothing else.
+func selectStatements(statements []syntax.Stmt, startLine int, endLine int) []syntax.Stmt {
+	for _, list := range syntax.StatementLists(statements) {
+		var selected []syntax.Stmt
+		for _, stmt := range list {
+			first, last, ok := syntax.StmtTokens(stmt)
+			if !ok {
+				continue
+			}
+
+			if first.Line >= startLine && last.Line <= endLine {
+				selected = append(selected, stmt)
+			} else if first.Line <= endLine && last.Line >= startLine {
+				// The statement straddles the range, so look for a
+				// selection inside it instead.
+				selected = nil
+				break
+			}
+		}
+
+		if len(selected) > 0 {
+			return selected
+		}
+	}
+
+	return nil
+}
+
+// checkControlFlow refuses selections that return or defer, use 'this' or
+// 'super', or break and continue loops outside of themselves.
+func checkControlFlow(source string, start int, end int) error {
+	hasLoop := false
+	for _, token := range scanner.NewScanner(source).ScanTokens() {
+		if token.Offset < start || token.Offset >= end {
+			continue
+		}
+
+		switch token.Type {
+		case references.Return, references.Defer:
+			return fmt.Errorf("can't extract a selection containing '%s'", token.Lexeme)
+		case references.This, references.Super:
+			return fmt.Errorf("can't extract a selection using '%s'", token.Lexeme)
+		case references.For, references.While:
+			hasLoop = true
+		case references.Break, references.Continue:
+			if !hasLoop {
+				return fmt.Errorf("can't extract a '%s' without its loop", token.Lexeme)
+			}
+		}
+	}
+
+	return nil
+}
+
+func lineStart(source string, offset int) int {
+	return strings.LastIndex(source[:offset], "\n") + 1
+}
+
+// reindent replaces the old indentation at the start of each line with the
+// new one.
+func reindent(text string, old string, new string) string {
+	var sb strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		sb.WriteString(new)
+		sb.WriteString(strings.TrimPrefix(line, old))
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
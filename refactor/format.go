@@ -0,0 +1,51 @@
+package refactor
+
+import (
+	"errors"
+	"golox/loxerror"
+	"golox/scanner"
+	"golox/syntax"
+)
+
+// ErrFormat means the formatter produced source that no longer parses,
+// which is a bug in the formatter rather than in the program.
+var ErrFormat = errors.New("formatting would break the program")
+
+// Format reprints source in the canonical layout. It only parses the
+// program, so code that would fail to resolve can still be formatted, and
+// it refuses to return output that doesn't parse again.
+func Format(source string) (string, error) {
+	statements, comments, err := parse(source)
+	if err != nil {
+		return "", err
+	}
+
+	formatted := syntax.Format(statements, comments)
+	if _, _, err := parse(formatted); err != nil {
+		return "", ErrFormat
+	}
+
+	return formatted, nil
+}
+
+func parse(source string) ([]syntax.Stmt, []*scanner.Trivia, error) {
+	loxerror.Reset()
+	loxerror.SetSource(source)
+
+	s := scanner.NewScanner(source)
+	s.KeepTrivia = true
+	parser := syntax.NewAstParser(s.ScanTokens())
+	// embedText and imports are printed as written, so the files they name
+	// needn't exist.
+	parser.SetFile("", func(name string) ([]byte, error) {
+		return nil, nil
+	})
+	parser.SkipModules()
+
+	statements := parser.Parse()
+	if loxerror.HadError() {
+		return nil, nil, ErrInvalidProgram
+	}
+
+	return statements, s.Comments, nil
+}
@@ -0,0 +1,84 @@
+package refactor
+
+import (
+	"golox/loxerror"
+	"golox/scanner"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFormatRoundTrip formats every example script twice. The second pass
+// must not change anything, and every comment must come through in the
+// order it was written. Scripts that don't parse, such as the ones showing
+// off error messages, are skipped.
+func TestFormatRoundTrip(t *testing.T) {
+	previous := loxerror.SetReporter(nil)
+	defer loxerror.SetReporter(previous)
+
+	paths, _ := filepath.Glob(filepath.Join("..", "lox_scripts", "*.lox"))
+	modules, _ := filepath.Glob(filepath.Join("..", "lox_scripts", "*", "*.lox"))
+	paths = append(paths, modules...)
+	if len(paths) == 0 {
+		t.Fatal("no scripts found")
+	}
+
+	for _, path := range paths {
+		source, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		once, err := Format(string(source))
+		if err == ErrInvalidProgram {
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+
+		twice, err := Format(once)
+		if err != nil {
+			t.Errorf("%s: formatting again: %v", path, err)
+			continue
+		}
+
+		if twice != once {
+			t.Errorf("%s: a second pass changed the output:\n%s", path, firstDifference(once, twice))
+		}
+
+		want, got := comments(string(source)), comments(once)
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s: comments went from\n%q\nto\n%q", path, want, got)
+		}
+	}
+}
+
+// comments lists the text of each comment in source.
+func comments(source string) []string {
+	s := scanner.NewScanner(source)
+	s.KeepTrivia = true
+	s.ScanTokens()
+
+	var texts []string
+	for _, comment := range s.Comments {
+		texts = append(texts, strings.TrimSpace(comment.Text))
+	}
+
+	return texts
+}
+
+// firstDifference shows the first line where two outputs part ways.
+func firstDifference(a string, b string) string {
+	aLines, bLines := strings.Split(a, "\n"), strings.Split(b, "\n")
+	for i := 0; i < len(aLines) && i < len(bLines); i++ {
+		if aLines[i] != bLines[i] {
+			return "- " + aLines[i] + "\n+ " + bLines[i]
+		}
+	}
+
+	return "the outputs have different lengths"
+}
@@ -0,0 +1,260 @@
+package refactor
+
+import (
+	"fmt"
+	"golox/loxerror"
+	"golox/scanner"
+	"golox/syntax"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FixImports rewrites the imports of the script at path: names it doesn't
+// use are removed, names it uses without declaring are imported from the
+// one module under root that exports them, and the imports are merged by
+// module and sorted, with their names sorted too. Names no module or more
+// than one exports are left for the resolver to report.
+func FixImports(path string, source string, root string) (string, error) {
+	exporters, err := projectExports(path, root)
+	if err != nil {
+		return "", err
+	}
+
+	var classes []string
+	for name := range exporters {
+		classes = append(classes, name)
+	}
+
+	loxerror.Reset()
+	loxerror.SetSource(source)
+
+	parser := syntax.NewAstParser(scanner.NewScanner(source).ScanTokens())
+	// Only this script's syntax matters, so neither the files embedText
+	// names nor the modules it imports are read.
+	parser.SetFile(path, func(name string) ([]byte, error) {
+		return nil, nil
+	})
+	parser.SkipModules()
+	parser.AssumeClasses(classes)
+	statements := parser.Parse()
+	if loxerror.HadError() {
+		return "", ErrInvalidProgram
+	}
+
+	resolver := syntax.NewResolver(syntax.NewInterpreter())
+	resolver.CollectUndefined()
+	resolver.Resolve(statements)
+	if loxerror.HadError() {
+		return "", ErrInvalidProgram
+	}
+
+	used := map[*scanner.Token]bool{}
+	declared := map[string]bool{}
+	for _, symbol := range resolver.Symbols().Symbols {
+		if len(symbol.References) > 0 {
+			used[symbol.Declaration] = true
+		}
+
+		if symbol.Depth == 0 {
+			declared[symbol.Name] = true
+		}
+	}
+
+	dir := filepath.Dir(path)
+	imports := syntax.Imports(statements)
+	modules := map[string]*moduleImport{}
+	for _, stmt := range imports {
+		module := importFrom(modules, dir, stmt.Path)
+		for _, name := range stmt.Names {
+			if used[name] {
+				module.names[name.Lexeme] = true
+			}
+		}
+	}
+
+	// A function may use a global declared after it, which isn't missing.
+	for _, name := range resolver.Undefined() {
+		if files := exporters[name.Lexeme]; len(files) == 1 && !declared[name.Lexeme] {
+			importFrom(modules, dir, modulePath(dir, files[0])).names[name.Lexeme] = true
+		}
+	}
+
+	return rewriteImports(source, statements, imports, importLines(modules)), nil
+}
+
+// moduleImport is what a script imports from one module.
+type moduleImport struct {
+	path  string
+	names map[string]bool
+}
+
+// importFrom returns what is imported from the module path names, keyed by
+// the file it is, so two spellings of the same module are merged.
+func importFrom(modules map[string]*moduleImport, dir string, path string) *moduleImport {
+	file := path
+	if filepath.Ext(file) == "" {
+		file += ".lox"
+	}
+
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+
+	file = filepath.Clean(file)
+	if modules[file] == nil {
+		modules[file] = &moduleImport{path: path, names: map[string]bool{}}
+	}
+
+	return modules[file]
+}
+
+// modulePath is how a script in dir imports the module in file.
+func modulePath(dir string, file string) string {
+	absDir, dirErr := filepath.Abs(dir)
+	absFile, fileErr := filepath.Abs(file)
+	if dirErr == nil && fileErr == nil {
+		if rel, err := filepath.Rel(absDir, absFile); err == nil {
+			file = rel
+		}
+	}
+
+	return filepath.ToSlash(strings.TrimSuffix(file, ".lox"))
+}
+
+// importLines writes one import for each module anything is imported from,
+// sorted by path.
+func importLines(modules map[string]*moduleImport) []string {
+	var sorted []*moduleImport
+	for _, module := range modules {
+		sorted = append(sorted, module)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].path < sorted[j].path
+	})
+
+	var lines []string
+	for _, module := range sorted {
+		if len(module.names) == 0 {
+			continue
+		}
+
+		var names []string
+		for name := range module.names {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+		lines = append(lines, fmt.Sprintf("import { %s } from \"%s\";", strings.Join(names, ", "), module.path))
+	}
+
+	return lines
+}
+
+// rewriteImports removes the imports from source and writes lines where the
+// first of them was, or before the first statement when there were none.
+func rewriteImports(source string, statements []syntax.Stmt, imports []*syntax.Import, lines []string) string {
+	block := ""
+	if len(lines) > 0 {
+		block = strings.Join(lines, "\n") + "\n"
+	}
+
+	if len(imports) == 0 {
+		if block == "" || len(statements) == 0 {
+			return source
+		}
+
+		start, _, _ := syntax.StmtTokens(statements[0])
+		at := lineStart(source, start.Offset)
+		return source[:at] + block + "\n" + source[at:]
+	}
+
+	// Remove from the last import back, so the offsets before it hold.
+	for i := len(imports) - 1; i >= 0; i-- {
+		start := imports[i].Start.Offset
+		end := imports[i].End.Offset + len(imports[i].End.Lexeme)
+		if at := lineStart(source, start); strings.TrimSpace(source[at:start]) == "" {
+			start = at
+		}
+
+		// Drop the line too when nothing but the import was on it. A
+		// comment after the import keeps its line.
+		if rest := strings.IndexByte(source[end:], '\n'); rest >= 0 && strings.TrimSpace(source[end:end+rest]) == "" {
+			end += rest + 1
+		} else if rest < 0 && strings.TrimSpace(source[end:]) == "" {
+			end = len(source)
+		} else {
+			for end < len(source) && source[end] == ' ' {
+				end++
+			}
+		}
+
+		if i == 0 {
+			source = source[:start] + block + source[end:]
+			if block == "" && strings.HasPrefix(source[start:], "\n") && (start == 0 || strings.HasSuffix(source[:start], "\n\n")) {
+				source = source[:start] + source[start+1:]
+			}
+		} else {
+			source = source[:start] + source[end:]
+		}
+	}
+
+	return source
+}
+
+// projectExports maps each name the .lox files under root export to the
+// files exporting it, leaving out the script at path and files that don't
+// parse.
+func projectExports(path string, root string) (map[string][]string, error) {
+	self, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	exporters := map[string][]string{}
+	err = filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || filepath.Ext(file) != ".lox" {
+			return nil
+		}
+
+		if abs, err := filepath.Abs(file); err == nil && abs == self {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		// The errors of files that don't parse are theirs, not the
+		// script's.
+		var statements []syntax.Stmt
+		diagnostics := loxerror.Collect(func() {
+			parser := syntax.NewAstParser(scanner.NewScanner(string(data)).ScanTokens())
+			parser.SetFile(file, func(name string) ([]byte, error) {
+				return nil, nil
+			})
+			parser.SkipModules()
+			statements = parser.Parse()
+		})
+
+		if len(diagnostics) > 0 {
+			return nil
+		}
+
+		for _, name := range syntax.Exports(statements) {
+			exporters[name] = append(exporters[name], file)
+		}
+
+		return nil
+	})
+
+	return exporters, err
+}
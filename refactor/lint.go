@@ -0,0 +1,14 @@
+package refactor
+
+import "golox/syntax"
+
+// Lint resolves source without running it and returns the warnings found,
+// such as uses of deprecated functions, classes and methods.
+func Lint(source string) ([]*syntax.Warning, error) {
+	_, resolver, err := resolve(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolver.Warnings(), nil
+}
@@ -0,0 +1,37 @@
+package refactor
+
+import (
+	"fmt"
+	"golox/scanner"
+	"sort"
+)
+
+// FindReferences returns the declaration of the variable, function or class
+// at a 1-based line and column, followed by every reference to it in source
+// order.
+func FindReferences(source string, line int, column int) ([]*scanner.Token, error) {
+	_, symbols, err := analyze(source)
+	if err != nil {
+		return nil, err
+	}
+
+	symbol := symbols.SymbolAt(line, column)
+	if symbol == nil {
+		return nil, fmt.Errorf("no variable, function or class at %d:%d", line, column)
+	}
+
+	references := append([]*scanner.Token{}, symbol.References...)
+	sort.Slice(references, func(i, j int) bool {
+		return references[i].Offset < references[j].Offset
+	})
+
+	tokens := []*scanner.Token{symbol.Declaration}
+	for _, token := range references {
+		// A token can be referenced twice, as with the variable in x++.
+		if token.Offset != tokens[len(tokens)-1].Offset {
+			tokens = append(tokens, token)
+		}
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,71 @@
+package refactor
+
+import (
+	"fmt"
+	"golox/scanner"
+	"golox/syntax"
+	"sort"
+)
+
+// Rename renames the variable, function or class whose name is at a 1-based
+// line and column, along with every reference the resolver bound to it.
+func Rename(source string, line int, column int, newName string) (string, error) {
+	if !isIdentifier(newName) {
+		return "", fmt.Errorf("'%s' is not a valid name", newName)
+	}
+
+	_, symbols, err := analyze(source)
+	if err != nil {
+		return "", err
+	}
+
+	symbol := symbols.SymbolAt(line, column)
+	if symbol == nil {
+		return "", fmt.Errorf("no variable, function or class at %d:%d", line, column)
+	}
+
+	renamed := replaceTokens(source, symbol.Tokens(), newName)
+
+	// The new name must not capture or be captured by another declaration,
+	// so every symbol has to keep the same number of references.
+	_, after, err := analyze(renamed)
+	if err != nil || !sameShape(symbols, after) {
+		return "", fmt.Errorf("renaming '%s' to '%s' would conflict with another name", symbol.Name, newName)
+	}
+
+	return renamed, nil
+}
+
+func replaceTokens(source string, tokens []*scanner.Token, text string) string {
+	sorted := append([]*scanner.Token{}, tokens...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Offset > sorted[j].Offset
+	})
+
+	// A token can be referenced twice, as with the variable in x++.
+	last := -1
+	for _, token := range sorted {
+		if token.Offset == last {
+			continue
+		}
+
+		source = source[:token.Offset] + text + source[token.Offset+len(token.Lexeme):]
+		last = token.Offset
+	}
+
+	return source
+}
+
+func sameShape(before *syntax.SymbolTable, after *syntax.SymbolTable) bool {
+	if len(before.Symbols) != len(after.Symbols) {
+		return false
+	}
+
+	for i, symbol := range before.Symbols {
+		if len(symbol.References) != len(after.Symbols[i].References) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"golox/refactor"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const refactorUsage = `Usage: golox refactor <command>
+
+Commands:
+  rename <file.lox:line:column> <newName>
+  extract <file.lox:startLine-endLine> <functionName>`
+
+func runRefactor(args []string) {
+	if len(args) != 3 {
+		fmt.Println(refactorUsage)
+		os.Exit(64)
+	}
+
+	var path string
+	var transform func(source string) (string, error)
+	switch args[0] {
+	case "rename":
+		file, line, column, ok := parsePosition(args[1])
+		if !ok {
+			fmt.Printf("Invalid position '%s', expected file.lox:line:column\n", args[1])
+			os.Exit(64)
+		}
+
+		path = file
+		transform = func(source string) (string, error) {
+			return refactor.Rename(source, line, column, args[2])
+		}
+	case "extract":
+		file, start, end, ok := parseLineRange(args[1])
+		if !ok {
+			fmt.Printf("Invalid range '%s', expected file.lox:startLine-endLine\n", args[1])
+			os.Exit(64)
+		}
+
+		path = file
+		transform = func(source string) (string, error) {
+			return refactor.ExtractFunction(source, start, end, args[2])
+		}
+	default:
+		fmt.Println(refactorUsage)
+		os.Exit(64)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(64)
+	}
+
+	result, err := transform(string(data))
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(65)
+	}
+
+	if err := writeFileAtomic(path, []byte(result)); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(74)
+	}
+}
+
+// parsePosition splits "file:line:column", allowing colons in the file name.
+func parsePosition(position string) (string, int, int, bool) {
+	parts := strings.Split(position, ":")
+	if len(parts) < 3 {
+		return "", 0, 0, false
+	}
+
+	line, err := strconv.Atoi(parts[len(parts)-2])
+	if err != nil {
+		return "", 0, 0, false
+	}
+
+	column, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		return "", 0, 0, false
+	}
+
+	return strings.Join(parts[:len(parts)-2], ":"), line, column, true
+}
+
+// parseLineRange splits "file:start-end", allowing colons in the file name.
+func parseLineRange(position string) (string, int, int, bool) {
+	index := strings.LastIndex(position, ":")
+	if index < 0 {
+		return "", 0, 0, false
+	}
+
+	lines := strings.SplitN(position[index+1:], "-", 2)
+	if len(lines) != 2 {
+		return "", 0, 0, false
+	}
+
+	start, err := strconv.Atoi(lines[0])
+	if err != nil {
+		return "", 0, 0, false
+	}
+
+	end, err := strconv.Atoi(lines[1])
+	if err != nil || end < start {
+		return "", 0, 0, false
+	}
+
+	return position[:index], start, end, true
+}
+
+// writeFileAtomic replaces a file by writing a temporary file next to it and
+// renaming it over the original, so readers never see a partial write.
+func writeFileAtomic(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), info.Mode()); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
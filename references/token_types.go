@@ -1,5 +1,7 @@
 package references
 
+import "fmt"
+
 type TokenType int
 
 const (
@@ -8,14 +10,24 @@ const (
 	RightParen
 	LeftBrace
 	RightBrace
+	LeftBracket
+	RightBracket
 	Comma
 	Dot
+	Ellipsis
+	Colon
+	At
 	Minus
 	Plus
 	Semicolon
 	Modulo
 	Slash
 	Star
+	TildeSlash
+	Ampersand
+	Pipe
+	Caret
+	Tilde
 
 	// One or two character tokens
 	Bang
@@ -26,6 +38,11 @@ const (
 	GreaterEqual
 	Less
 	LessEqual
+	LessLess
+	GreaterGreater
+	QuestionQuestion
+	QuestionDot
+	Arrow
 
 	// Literals
 	Identifier
@@ -37,6 +54,7 @@ const (
 	New
 	Static
 	Class
+	Enum
 	Else
 	False
 	Fun
@@ -46,13 +64,27 @@ const (
 	Or
 	Print
 	Return
+	Yield
+	Spawn
+	Defer
 	Super
 	This
 	True
 	Var
+	Const
 	While
+	In
+	Switch
+	Case
+	Default
+	Fallthrough
+	Match
+	Is
+	With
 	Break
 	Continue
+	Import
+	Export
 	Increment
 	Decrement
 	IncrementOne
@@ -60,3 +92,92 @@ const (
 
 	EOF
 )
+
+var tokenNames = map[TokenType]string{
+	LeftParen:        "LeftParen",
+	RightParen:       "RightParen",
+	LeftBrace:        "LeftBrace",
+	RightBrace:       "RightBrace",
+	LeftBracket:      "LeftBracket",
+	RightBracket:     "RightBracket",
+	Comma:            "Comma",
+	Dot:              "Dot",
+	Ellipsis:         "Ellipsis",
+	Colon:            "Colon",
+	At:               "At",
+	Minus:            "Minus",
+	Plus:             "Plus",
+	Semicolon:        "Semicolon",
+	Modulo:           "Modulo",
+	Slash:            "Slash",
+	Star:             "Star",
+	TildeSlash:       "TildeSlash",
+	Ampersand:        "Ampersand",
+	Pipe:             "Pipe",
+	Caret:            "Caret",
+	Tilde:            "Tilde",
+	Bang:             "Bang",
+	BangEqual:        "BangEqual",
+	Equal:            "Equal",
+	EqualEqual:       "EqualEqual",
+	Greater:          "Greater",
+	GreaterEqual:     "GreaterEqual",
+	Less:             "Less",
+	LessEqual:        "LessEqual",
+	LessLess:         "LessLess",
+	GreaterGreater:   "GreaterGreater",
+	QuestionQuestion: "QuestionQuestion",
+	QuestionDot:      "QuestionDot",
+	Arrow:            "Arrow",
+	Identifier:       "Identifier",
+	String:           "String",
+	Number:           "Number",
+	And:              "And",
+	New:              "New",
+	Static:           "Static",
+	Class:            "Class",
+	Enum:             "Enum",
+	Else:             "Else",
+	False:            "False",
+	Fun:              "Fun",
+	For:              "For",
+	If:               "If",
+	Nil:              "Nil",
+	Or:               "Or",
+	Print:            "Print",
+	Return:           "Return",
+	Yield:            "Yield",
+	Spawn:            "Spawn",
+	Defer:            "Defer",
+	Super:            "Super",
+	This:             "This",
+	True:             "True",
+	Var:              "Var",
+	Const:            "Const",
+	While:            "While",
+	In:               "In",
+	Switch:           "Switch",
+	Case:             "Case",
+	Default:          "Default",
+	Fallthrough:      "Fallthrough",
+	Match:            "Match",
+	Is:               "Is",
+	With:             "With",
+	Break:            "Break",
+	Continue:         "Continue",
+	Import:           "Import",
+	Export:           "Export",
+	Increment:        "Increment",
+	Decrement:        "Decrement",
+	IncrementOne:     "IncrementOne",
+	DecrementOne:     "DecrementOne",
+	EOF:              "EOF",
+}
+
+func (t TokenType) String() string {
+	if name, ok := tokenNames[t]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("TokenType(%d)", int(t))
+}
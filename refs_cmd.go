@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"golox/refactor"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// runRefs prints where the symbol at a position is declared and, for
+// "refs", every place it is used.
+func runRefs(command string, args []string) {
+	if len(args) != 1 {
+		fmt.Printf("Usage: golox %s <file.lox:line:column>\n", command)
+		os.Exit(64)
+	}
+
+	path, line, column, ok := parsePosition(args[0])
+	if !ok {
+		fmt.Printf("Invalid position '%s', expected file.lox:line:column\n", args[0])
+		os.Exit(64)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(64)
+	}
+
+	tokens, err := refactor.FindReferences(string(data), line, column)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(65)
+	}
+
+	if command == "def" {
+		tokens = tokens[:1]
+	}
+
+	lines := strings.Split(string(data), "\n")
+	for _, token := range tokens {
+		fmt.Printf("%s:%d:%d: %s\n", path, token.Line, token.Column, strings.TrimSpace(lines[token.Line-1]))
+	}
+}
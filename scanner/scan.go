@@ -1,40 +1,69 @@
 package scanner
 
 import (
+	"fmt"
 	"golox/loxerror"
 	"golox/references"
 	"strconv"
+	"strings"
 )
 
 var keywords = map[string]references.TokenType{
-	"and":      references.And,
-	"new":      references.New,
-	"static":   references.Static,
-	"class":    references.Class,
-	"else":     references.Else,
-	"false":    references.False,
-	"for":      references.For,
-	"fun":      references.Fun,
-	"if":       references.If,
-	"nil":      references.Nil,
-	"or":       references.Or,
-	"print":    references.Print,
-	"return":   references.Return,
-	"super":    references.Super,
-	"this":     references.This,
-	"true":     references.True,
-	"var":      references.Var,
-	"while":    references.While,
-	"continue": references.Continue,
-	"break":    references.Break,
+	"and":         references.And,
+	"new":         references.New,
+	"static":      references.Static,
+	"class":       references.Class,
+	"enum":        references.Enum,
+	"else":        references.Else,
+	"false":       references.False,
+	"for":         references.For,
+	"fun":         references.Fun,
+	"if":          references.If,
+	"nil":         references.Nil,
+	"or":          references.Or,
+	"print":       references.Print,
+	"return":      references.Return,
+	"yield":       references.Yield,
+	"spawn":       references.Spawn,
+	"defer":       references.Defer,
+	"super":       references.Super,
+	"this":        references.This,
+	"true":        references.True,
+	"var":         references.Var,
+	"const":       references.Const,
+	"while":       references.While,
+	"in":          references.In,
+	"switch":      references.Switch,
+	"case":        references.Case,
+	"default":     references.Default,
+	"fallthrough": references.Fallthrough,
+	"match":       references.Match,
+	"is":          references.Is,
+	"with":        references.With,
+	"continue":    references.Continue,
+	"break":       references.Break,
+	"import":      references.Import,
+	"export":      references.Export,
 }
 
 type Scanner struct {
-	Source  string
-	Tokens  []*Token
-	Start   int
-	Current int
-	Line    int
+	Source string
+	Tokens []*Token
+	// KeepTrivia makes the scanner attach whitespace and comments to the
+	// tokens around them and collect the comments in Comments, for tools
+	// that print source back out. The parser doesn't need it.
+	KeepTrivia  bool
+	Comments    []*Trivia
+	Start       int
+	Current     int
+	Line        int
+	lineStart   int
+	startColumn int
+	startLine   int
+	// pending is the trivia waiting to lead the next token, and trailing is
+	// set while trivia still belongs to the previous token's line.
+	pending  []*Trivia
+	trailing bool
 }
 
 func NewScanner(source string) *Scanner {
@@ -49,10 +78,16 @@ func NewScanner(source string) *Scanner {
 func (scanner *Scanner) ScanTokens() []*Token {
 	for !scanner.isAtEnd() {
 		scanner.Start = scanner.Current
+		scanner.startColumn = scanner.Current - scanner.lineStart + 1
+		scanner.startLine = scanner.Line
 		scanner.scanToken()
 	}
 
-	scanner.Tokens = append(scanner.Tokens, NewToken(references.EOF, "", nil, scanner.Line))
+	eof := NewToken(references.EOF, "", nil, scanner.Line)
+	eof.Column = scanner.Current - scanner.lineStart + 1
+	eof.Offset = scanner.Current
+	eof.Leading = scanner.pending
+	scanner.Tokens = append(scanner.Tokens, eof)
 	return scanner.Tokens
 }
 
@@ -75,17 +110,42 @@ func (scanner *Scanner) scanToken() {
 	case '}':
 		scanner.addToken(references.RightBrace)
 		break
+	case '[':
+		scanner.addToken(references.LeftBracket)
+		break
+	case ']':
+		scanner.addToken(references.RightBracket)
+		break
 	case ',':
 		scanner.addToken(references.Comma)
 		break
 	case '.':
+		if scanner.peek() == '.' && scanner.peekNext() == '.' {
+			scanner.advance()
+			scanner.advance()
+			scanner.addToken(references.Ellipsis)
+			break
+		}
+
 		scanner.addToken(references.Dot)
 		break
+	case ':':
+		scanner.addToken(references.Colon)
+		break
+	case '@':
+		scanner.addToken(references.At)
+		break
 	case '%':
 		scanner.addToken(references.Modulo)
 		break
 	case '-':
 		token := references.Minus
+		if scanner.peek() == '>' {
+			scanner.advance()
+			scanner.addToken(references.Arrow)
+			break
+		}
+
 		if scanner.peek() == '-' {
 			scanner.advance()
 			token = references.DecrementOne
@@ -118,6 +178,15 @@ func (scanner *Scanner) scanToken() {
 	case '*':
 		scanner.addToken(references.Star)
 		break
+	case '&':
+		scanner.addToken(references.Ampersand)
+		break
+	case '|':
+		scanner.addToken(references.Pipe)
+		break
+	case '^':
+		scanner.addToken(references.Caret)
+		break
 	case '!':
 		token := references.Bang
 		if scanner.match('=') {
@@ -136,6 +205,8 @@ func (scanner *Scanner) scanToken() {
 		token := references.Less
 		if scanner.match('=') {
 			token = references.LessEqual
+		} else if scanner.match('<') {
+			token = references.LessLess
 		}
 		scanner.addToken(token)
 		break
@@ -143,14 +214,34 @@ func (scanner *Scanner) scanToken() {
 		token := references.Greater
 		if scanner.match('=') {
 			token = references.GreaterEqual
+		} else if scanner.match('>') {
+			token = references.GreaterGreater
 		}
 		scanner.addToken(token)
 		break
+	case '~':
+		if scanner.match('/') {
+			scanner.addToken(references.TildeSlash)
+		} else {
+			scanner.addToken(references.Tilde)
+		}
+		break
+	case '?':
+		if scanner.match('?') {
+			scanner.addToken(references.QuestionQuestion)
+		} else if scanner.match('.') {
+			scanner.addToken(references.QuestionDot)
+		} else {
+			loxerror.Error(scanner.startLine, scanner.startColumn, "Unexpected character.")
+		}
+		break
 	case '/':
 		if scanner.match('/') {
 			for scanner.peek() != '\n' && !scanner.isAtEnd() {
 				scanner.advance()
 			}
+
+			scanner.addTrivia(LineComment)
 		} else if scanner.match('*') {
 			for !scanner.isAtEnd() {
 				if scanner.match('*') && scanner.match('/') {
@@ -158,21 +249,21 @@ func (scanner *Scanner) scanToken() {
 				}
 
 				if c := scanner.advance(); c == '\n' {
-					scanner.Line++
+					scanner.newLine()
 				}
 			}
+
+			scanner.addTrivia(BlockComment)
 		} else {
 			scanner.addToken(references.Slash)
 		}
 		break
-	case ' ':
-		break
-	case '\r':
-		break
-	case '\t':
+	case ' ', '\r', '\t':
+		scanner.addTrivia(Whitespace)
 		break
 	case '\n':
-		scanner.Line++
+		scanner.newLine()
+		scanner.addTrivia(Newline)
 		break
 	case '"':
 		scanner.parseString()
@@ -183,13 +274,18 @@ func (scanner *Scanner) scanToken() {
 		} else if isAlpha(c) {
 			scanner.identifier()
 		} else {
-			loxerror.Error(scanner.Line, "Unexpected character.")
+			loxerror.Error(scanner.startLine, scanner.startColumn, "Unexpected character.")
 		}
 
 		break
 	}
 }
 
+func (scanner *Scanner) newLine() {
+	scanner.Line++
+	scanner.lineStart = scanner.Current
+}
+
 func (scanner *Scanner) advance() rune {
 	scanner.Current++
 	return rune(scanner.Source[scanner.Current-1])
@@ -201,7 +297,50 @@ func (scanner *Scanner) addToken(t references.TokenType) {
 
 func (scanner *Scanner) addTokenLiteral(t references.TokenType, literal interface{}) {
 	text := scanner.Source[scanner.Start:scanner.Current]
-	scanner.Tokens = append(scanner.Tokens, NewToken(t, text, literal, scanner.Line))
+	token := NewToken(t, text, literal, scanner.Line)
+	token.Column = scanner.startColumn
+	token.Offset = scanner.Start
+	token.Leading = scanner.pending
+	scanner.pending = nil
+	scanner.trailing = scanner.KeepTrivia
+	scanner.Tokens = append(scanner.Tokens, token)
+}
+
+func (scanner *Scanner) addTrivia(kind TriviaKind) {
+	if !scanner.KeepTrivia {
+		return
+	}
+
+	list := &scanner.pending
+	if scanner.trailing && kind != Newline {
+		list = &scanner.Tokens[len(scanner.Tokens)-1].Trailing
+	}
+
+	// Runs of spaces and tabs become one piece of trivia.
+	if n := len(*list); kind == Whitespace && n > 0 && (*list)[n-1].Kind == Whitespace {
+		(*list)[n-1].Text += scanner.Source[scanner.Start:scanner.Current]
+		return
+	}
+
+	trivia := &Trivia{
+		Kind:   kind,
+		Text:   scanner.Source[scanner.Start:scanner.Current],
+		Line:   scanner.startLine,
+		Offset: scanner.Start,
+	}
+	if len(scanner.Tokens) > 0 {
+		trivia.After = scanner.Tokens[len(scanner.Tokens)-1]
+	}
+
+	*list = append(*list, trivia)
+
+	if kind == LineComment || kind == BlockComment {
+		scanner.Comments = append(scanner.Comments, trivia)
+	}
+
+	if kind == Newline || scanner.Line != scanner.startLine {
+		scanner.trailing = false
+	}
 }
 
 func (scanner *Scanner) match(expected rune) bool {
@@ -224,15 +363,15 @@ func (scanner *Scanner) peek() rune {
 
 func (scanner *Scanner) parseString() {
 	for scanner.peek() != '"' && !scanner.isAtEnd() {
-		if scanner.peek() == '\n' {
-			scanner.Line++
-		}
-
 		scanner.advance()
+
+		if scanner.Source[scanner.Current-1] == '\n' {
+			scanner.newLine()
+		}
 	}
 
 	if scanner.isAtEnd() {
-		loxerror.Error(scanner.Line, "Unterminated string.")
+		loxerror.Error(scanner.startLine, scanner.startColumn, "Unterminated string.")
 		return
 	}
 
@@ -243,27 +382,129 @@ func (scanner *Scanner) parseString() {
 }
 
 func (scanner *Scanner) number() {
-	for isDigit(scanner.peek()) {
-		scanner.advance()
+	if scanner.Source[scanner.Start] == '0' {
+		switch scanner.peek() {
+		case 'x', 'X':
+			scanner.advance()
+			scanner.radixNumber(16, "hex", isHexDigit)
+			return
+		case 'b', 'B':
+			scanner.advance()
+			scanner.radixNumber(2, "binary", isBinaryDigit)
+			return
+		}
 	}
 
+	if !scanner.digits(isDigit) {
+		return
+	}
+
+	isFloat := false
 	if scanner.peek() == '.' && isDigit(scanner.peekNext()) {
 		scanner.advance()
+		isFloat = true
 
-		for isDigit(scanner.peek()) {
+		if !scanner.digits(isDigit) {
+			return
+		}
+	}
+
+	if p := scanner.peek(); p == 'e' || p == 'E' {
+		scanner.advance()
+		if p := scanner.peek(); p == '+' || p == '-' {
 			scanner.advance()
 		}
+
+		if !isDigit(scanner.peek()) {
+			scanner.malformed("Expect digits in exponent.")
+			return
+		}
+
+		isFloat = true
+		if !scanner.digits(isDigit) {
+			return
+		}
 	}
 
-	number, err := strconv.ParseFloat(scanner.Source[scanner.Start:scanner.Current], 64)
+	if isAlphaNumeric(scanner.peek()) {
+		scanner.malformed(fmt.Sprintf("Unexpected character '%c' in number literal.", scanner.peek()))
+		return
+	}
+
+	// Numbers without a decimal point or exponent are integers.
+	text := strings.Replace(scanner.Source[scanner.Start:scanner.Current], "_", "", -1)
+	if !isFloat {
+		scanner.integer(text, 10)
+		return
+	}
+
+	number, err := strconv.ParseFloat(text, 64)
 	if err != nil {
-		loxerror.Error(scanner.Line, "Invalid number.")
+		loxerror.Error(scanner.startLine, scanner.startColumn, "Number literal is too large.")
 		return
 	}
 
 	scanner.addTokenLiteral(references.Number, number)
 }
 
+// radixNumber scans the digits of a 0x or 0b literal, whose prefix has
+// already been consumed.
+func (scanner *Scanner) radixNumber(base int, name string, valid func(rune) bool) {
+	prefix := scanner.Source[scanner.Start:scanner.Current]
+	if !valid(scanner.peek()) {
+		scanner.malformed(fmt.Sprintf("Expect %s digits after '%s'.", name, prefix))
+		return
+	}
+
+	if !scanner.digits(valid) {
+		return
+	}
+
+	if isAlphaNumeric(scanner.peek()) {
+		scanner.malformed(fmt.Sprintf("Invalid digit '%c' in %s literal.", scanner.peek(), name))
+		return
+	}
+
+	text := strings.Replace(scanner.Source[scanner.Start+len(prefix):scanner.Current], "_", "", -1)
+	scanner.integer(text, base)
+}
+
+func (scanner *Scanner) integer(text string, base int) {
+	integer, err := strconv.ParseInt(text, base, 64)
+	if err != nil {
+		loxerror.Error(scanner.startLine, scanner.startColumn, "Integer literal is too large.")
+		return
+	}
+
+	scanner.addTokenLiteral(references.Number, integer)
+}
+
+// digits consumes a run of digits, allowing '_' separators only between
+// two digits.
+func (scanner *Scanner) digits(valid func(rune) bool) bool {
+	for valid(scanner.peek()) || scanner.peek() == '_' {
+		if scanner.peek() == '_' &&
+			(!valid(rune(scanner.Source[scanner.Current-1])) || !valid(scanner.peekNext())) {
+			scanner.malformed("Digit separator '_' must be between digits.")
+			return false
+		}
+
+		scanner.advance()
+	}
+
+	return true
+}
+
+// malformed reports an error in a number literal and skips the rest of it,
+// so the leftover characters don't scan as an identifier.
+func (scanner *Scanner) malformed(message string) {
+	for isAlphaNumeric(scanner.peek()) {
+		scanner.advance()
+	}
+
+	loxerror.Error(scanner.startLine, scanner.startColumn, message)
+}
+
 func (scanner *Scanner) peekNext() rune {
 	if scanner.Current+1 >= len(scanner.Source) {
 		return '\000'
@@ -10,6 +10,13 @@ type Token struct {
 	Lexeme  string
 	Literal interface{}
 	Line    int
+	Column  int
+	Offset  int
+	// Leading and Trailing hold the whitespace and comments around the
+	// token when the scanner keeps trivia. Trailing trivia is what follows
+	// the token on its own line; everything else leads the next token.
+	Leading  []*Trivia
+	Trailing []*Trivia
 }
 
 func NewToken(t references.TokenType, lexeme string, literal interface{}, line int) *Token {
@@ -24,3 +31,23 @@ func NewToken(t references.TokenType, lexeme string, literal interface{}, line i
 func (token *Token) String() string {
 	return fmt.Sprintf("%d %s %v", int(token.Type), token.Lexeme, token.Literal)
 }
+
+type TriviaKind int
+
+const (
+	Whitespace TriviaKind = iota
+	Newline
+	LineComment
+	BlockComment
+)
+
+// Trivia is source text the parser skips: whitespace, line breaks and
+// comments. Line is the line it starts on, and After is the token it
+// follows, which is nil at the start of the source.
+type Trivia struct {
+	Kind   TriviaKind
+	Text   string
+	Line   int
+	Offset int
+	After  *Token
+}
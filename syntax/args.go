@@ -0,0 +1,196 @@
+package syntax
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SetArgs hands the interpreter the script's command line, starting with the
+// script itself, for Args to parse.
+func (interpreter *Interpreter) SetArgs(args []string) {
+	interpreter.args = args
+}
+
+// defineArgs adds Args, which parses the command line against a spec. The
+// spec is an instance whose class declares a field per option: a boolean,
+// number or string default makes a --flag of that type, and a field
+// without a default is a required positional argument, in the order
+// declared.
+func defineArgs(env *Environment) {
+	env.define("Args", NewLoxNamespace("Args", map[string]interface{}{
+		"parse": NewNativeFunction("parse", 1, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+			spec, ok := arguments[0].(*LoxInstance)
+			if !ok {
+				throwTypedError(TypeError, interpreter.callSite(), "Args.parse expects an instance describing the arguments.")
+			}
+
+			return interpreter.parseArgs(spec)
+		}),
+	}))
+}
+
+func (interpreter *Interpreter) parseArgs(spec *LoxInstance) *LoxInstance {
+	result := NewLoxInstance(spec.class)
+	for name, value := range spec.fields {
+		result.fields[name] = value
+	}
+
+	fields := specFields(spec.class)
+
+	var positionals []string
+	for _, name := range fields {
+		if spec.fields[name] == nil {
+			positionals = append(positionals, name)
+		}
+	}
+
+	var args []string
+	if len(interpreter.args) > 0 {
+		args = interpreter.args[1:]
+	}
+
+	filled := 0
+	flags := true
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if flags && (arg == "--help" || arg == "-h") {
+			fmt.Fprint(interpreter.out, interpreter.usage(spec, fields, positionals))
+			panic(stopScript{})
+		}
+
+		if flags && arg == "--" {
+			flags = false
+			continue
+		}
+
+		if !flags || !strings.HasPrefix(arg, "--") {
+			if filled == len(positionals) {
+				throwRuntimeError(interpreter.callSite(), fmt.Sprintf("Unexpected argument '%s'.", arg))
+			}
+
+			result.fields[positionals[filled]] = arg
+			filled++
+			continue
+		}
+
+		name := arg[2:]
+		value, hasValue := "", false
+		if equals := strings.Index(name, "="); equals >= 0 {
+			name, value, hasValue = name[:equals], name[equals+1:], true
+		}
+
+		var parsed interface{}
+		switch spec.fields[name].(type) {
+		case bool:
+			if !hasValue {
+				parsed = true
+				break
+			}
+
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				throwRuntimeError(interpreter.callSite(), fmt.Sprintf("Flag '--%s' expects true or false.", name))
+			}
+			parsed = b
+		case int64:
+			if !hasValue {
+				i, value = interpreter.flagValue(args, i, name)
+			}
+
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				throwRuntimeError(interpreter.callSite(), fmt.Sprintf("Flag '--%s' expects an integer.", name))
+			}
+			parsed = n
+		case float64:
+			if !hasValue {
+				i, value = interpreter.flagValue(args, i, name)
+			}
+
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				throwRuntimeError(interpreter.callSite(), fmt.Sprintf("Flag '--%s' expects a number.", name))
+			}
+			parsed = f
+		case string:
+			if !hasValue {
+				i, value = interpreter.flagValue(args, i, name)
+			}
+			parsed = value
+		default:
+			throwRuntimeError(interpreter.callSite(), fmt.Sprintf("Unknown flag '--%s'.", name))
+		}
+
+		result.fields[name] = parsed
+	}
+
+	if filled < len(positionals) {
+		throwRuntimeError(interpreter.callSite(), fmt.Sprintf("Missing argument <%s>.", positionals[filled]))
+	}
+
+	return result
+}
+
+// flagValue takes the argument after a flag as its value.
+func (interpreter *Interpreter) flagValue(args []string, i int, name string) (int, string) {
+	if i+1 >= len(args) {
+		throwRuntimeError(interpreter.callSite(), fmt.Sprintf("Flag '--%s' expects a value.", name))
+	}
+
+	return i + 1, args[i+1]
+}
+
+func (interpreter *Interpreter) usage(spec *LoxInstance, fields []string, positionals []string) string {
+	program := "script"
+	if len(interpreter.args) > 0 {
+		program = filepath.Base(interpreter.args[0])
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Usage: " + program + " [options]")
+	for _, name := range positionals {
+		sb.WriteString(" <" + name + ">")
+	}
+
+	sb.WriteString("\n\nOptions:\n")
+	for _, name := range fields {
+		value := spec.fields[name]
+		switch value.(type) {
+		case bool:
+			fmt.Fprintf(&sb, "  --%-20s (default %s)\n", name, stringify(value))
+		case int64:
+			fmt.Fprintf(&sb, "  --%-20s (default %s)\n", name+" <integer>", stringify(value))
+		case float64:
+			fmt.Fprintf(&sb, "  --%-20s (default %s)\n", name+" <number>", stringify(value))
+		case string:
+			fmt.Fprintf(&sb, "  --%-20s (default %q)\n", name+" <string>", value)
+		}
+	}
+
+	fmt.Fprintf(&sb, "  --%-20s Show this help.\n", "help")
+	return sb.String()
+}
+
+// specFields lists the fields a class declares, superclass fields first,
+// naming each once.
+func specFields(class *LoxClass) []string {
+	if class == nil {
+		return nil
+	}
+
+	names := specFields(class.superclass)
+	for _, field := range class.fields {
+		seen := false
+		for _, name := range names {
+			seen = seen || name == field.name.Lexeme
+		}
+
+		if !seen {
+			names = append(names, field.name.Lexeme)
+		}
+	}
+
+	return names
+}
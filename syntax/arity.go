@@ -0,0 +1,73 @@
+package syntax
+
+import (
+	"golox/loxerror"
+	"golox/references"
+	"golox/scanner"
+	"sort"
+)
+
+// lateError records an error Resolve can only find once the whole program
+// is resolved, such as a call to a function reassigned further down.
+// Resolve reports them in source order when it finishes.
+func (resolver *Resolver) lateError(token *scanner.Token, message string) {
+	resolver.lateErrors = append(resolver.lateErrors, &Warning{Token: token, Message: message})
+}
+
+func (resolver *Resolver) reportLateErrors() {
+	resolver.checkArity()
+
+	sort.SliceStable(resolver.lateErrors, func(i, j int) bool {
+		return resolver.lateErrors[i].Token.Offset < resolver.lateErrors[j].Token.Offset
+	})
+
+	for _, err := range resolver.lateErrors {
+		loxerror.TokenError(err.Token.Type, err.Token.Line, err.Token.Column, err.Token.Lexeme, err.Message)
+	}
+
+	resolver.lateErrors, resolver.calls, resolver.callees = nil, nil, nil
+}
+
+// knownCall is a call whose callee names a function, checked once the
+// whole program shows whether the name is ever reassigned.
+type knownCall struct {
+	call *Call
+	data *VariableData
+}
+
+// noteCall remembers a call to check its arity, when its callee is a
+// variable and its arguments can be counted.
+func (resolver *Resolver) noteCall(expr *Call) {
+	if hasSpread(expr.arguments) {
+		return
+	}
+
+	if variable, ok := expr.callee.(*Variable); ok {
+		if data, ok := resolver.callees[variable]; ok {
+			resolver.calls = append(resolver.calls, knownCall{call: expr, data: data})
+		}
+	}
+}
+
+// checkArity reports the calls passing the wrong number of arguments to a
+// function declaration that is never reassigned. Strict mode checks the
+// calls to natives too.
+func (resolver *Resolver) checkArity() {
+	for _, c := range resolver.calls {
+		if c.data.assigned {
+			continue
+		}
+
+		name := c.call.callee.(*Variable).name.Lexeme
+		count := len(c.call.arguments)
+		if c.data.function != nil && c.data.symbol != nil {
+			if message, ok := mismatchedArity(c.data.symbol.MinArgs, c.data.symbol.MaxArgs, count, references.Function, name); ok {
+				resolver.lateError(c.call.paren, message)
+			}
+		} else if native, ok := resolver.interpreter.globals.values[name].(*NativeFunction); ok && resolver.strict&CheckArity != 0 && c.data.global && !resolver.interpreter.scriptGlobals[name] {
+			if message, ok := arityMismatch(native, count); ok {
+				resolver.lateError(c.call.paren, message)
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package syntax
+
+import "fmt"
+
+// defineAssertions adds assert and assertEquals, which fail with an
+// AssertionError at the line of the call.
+func defineAssertions(env *Environment) {
+	env.define("assert", newOptionalNative("assert", 1, 2, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		if isTruthy(arguments[0]) {
+			return nil
+		}
+
+		message := "Assertion failed."
+		if len(arguments) == 2 {
+			message = fmt.Sprintf("Assertion failed: %s", interpreter.display(arguments[1]))
+		}
+
+		throwTypedError(AssertionError, interpreter.callSite(), message)
+		return nil
+	}))
+
+	env.define("assertEquals", newOptionalNative("assertEquals", 2, 3, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		expected, actual := arguments[0], arguments[1]
+		if interpreter.valuesEqual(expected, actual) {
+			return nil
+		}
+
+		message := fmt.Sprintf("Expected %s, got %s.", interpreter.assertedValue(expected), interpreter.assertedValue(actual))
+		if len(arguments) == 3 {
+			message = fmt.Sprintf("%s: %s", interpreter.display(arguments[2]), message)
+		}
+
+		throwTypedError(AssertionError, interpreter.callSite(), message)
+		return nil
+	}))
+}
+
+// valuesEqual compares two values the way '==' does, using an equals method
+// when one of them has it.
+func (interpreter *Interpreter) valuesEqual(a interface{}, b interface{}) bool {
+	return interpreter.equalAt(interpreter.callSite(), a, b)
+}
+
+// assertedValue shows strings quoted, so that "3" and 3 can be told apart
+// in a failed assertion.
+func (interpreter *Interpreter) assertedValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+
+	return interpreter.display(value)
+}
@@ -0,0 +1,384 @@
+package syntax
+
+import (
+	"golox/scanner"
+	"strings"
+)
+
+// AstNode is an exported view of a parsed statement or expression, for
+// tools outside the package. Fields holds the node's attributes and its
+// children, named as in the codemod view of the same node. Start is where
+// the node's first token begins and End is just past its last token; nodes
+// the parser made up, such as the 1 in x++, take their parent's positions.
+type AstNode struct {
+	Kind   string                 `json:"kind"`
+	Start  *Position              `json:"start"`
+	End    *Position              `json:"end"`
+	Fields map[string]interface{} `json:"fields"`
+}
+
+// Position is a place in the source. Lines and columns count from 1 and
+// columns and offsets are in bytes.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+
+// DumpAst converts a parsed program to AstNodes.
+func DumpAst(statements []Stmt) []*AstNode {
+	nodes := dumpStmts(statements)
+	for _, node := range nodes {
+		inheritPositions(node, nil, nil)
+	}
+
+	return nodes
+}
+
+func newAstNode(kind string, start *scanner.Token, end *scanner.Token) *AstNode {
+	node := &AstNode{Kind: kind, Fields: map[string]interface{}{}}
+	if start != nil && end != nil {
+		node.Start = startPosition(start)
+		node.End = endPosition(end)
+	}
+
+	return node
+}
+
+// startPosition is where token begins. The scanner stamps tokens with the
+// line they end on, which differs for strings spanning several lines.
+func startPosition(token *scanner.Token) *Position {
+	line := token.Line - strings.Count(token.Lexeme, "\n")
+	return &Position{Line: line, Column: token.Column, Offset: token.Offset}
+}
+
+// endPosition is just past the last byte of token.
+func endPosition(token *scanner.Token) *Position {
+	column := token.Column + len(token.Lexeme)
+	if i := strings.LastIndex(token.Lexeme, "\n"); i >= 0 {
+		column = len(token.Lexeme) - i
+	}
+
+	return &Position{Line: token.Line, Column: column, Offset: token.Offset + len(token.Lexeme)}
+}
+
+// inheritPositions gives nodes without tokens of their own the positions
+// of the nearest node above them that has some.
+func inheritPositions(node *AstNode, start *Position, end *Position) {
+	if node == nil {
+		return
+	}
+
+	if node.Start == nil {
+		node.Start, node.End = start, end
+	}
+
+	for _, field := range node.Fields {
+		switch child := field.(type) {
+		case *AstNode:
+			inheritPositions(child, node.Start, node.End)
+		case []*AstNode:
+			for _, c := range child {
+				inheritPositions(c, node.Start, node.End)
+			}
+		}
+	}
+}
+
+func dumpStmts(statements []Stmt) []*AstNode {
+	nodes := []*AstNode{}
+	for _, stmt := range statements {
+		nodes = append(nodes, dumpStmt(stmt))
+	}
+
+	return nodes
+}
+
+func dumpExprs(exprs []Expr) []*AstNode {
+	nodes := []*AstNode{}
+	for _, expr := range exprs {
+		nodes = append(nodes, dumpExpr(expr))
+	}
+
+	return nodes
+}
+
+func dumpLexemes(tokens []*scanner.Token) []interface{} {
+	names := []interface{}{}
+	for _, token := range tokens {
+		if token == nil {
+			names = append(names, nil)
+		} else {
+			names = append(names, token.Lexeme)
+		}
+	}
+
+	return names
+}
+
+func dumpLexeme(token *scanner.Token) interface{} {
+	if token == nil {
+		return nil
+	}
+
+	return token.Lexeme
+}
+
+func dumpPattern(pattern Pattern) *AstNode {
+	var node *AstNode
+	switch p := pattern.(type) {
+	case nil:
+		return nil
+	case *BindingPattern:
+		node = newAstNode("BindingPattern", p.name, p.name)
+		node.Fields["name"] = p.name.Lexeme
+	case *ValuePattern:
+		start, end := exprTokens(p.value)
+		node = newAstNode("ValuePattern", start, end)
+		node.Fields["value"] = dumpExpr(p.value)
+	case *TypePattern:
+		end := p.typeName
+		if p.binding != nil {
+			end = p.binding
+		}
+		node = newAstNode("TypePattern", p.keyword, end)
+		node.Fields["type"] = p.typeName.Lexeme
+		node.Fields["binding"] = dumpLexeme(p.binding)
+	case *ListPattern:
+		node = newAstNode("ListPattern", p.bracket, p.closing)
+		elements := []*AstNode{}
+		for _, element := range p.elements {
+			elements = append(elements, dumpPattern(element))
+		}
+		node.Fields["elements"] = elements
+		node.Fields["rest"] = dumpLexeme(p.rest)
+	case *FieldsPattern:
+		node = newAstNode("FieldsPattern", p.brace, p.closing)
+		fields := []*AstNode{}
+		for i, name := range p.names {
+			field := dumpPattern(p.patterns[i])
+			field.Fields["field"] = fieldName(name)
+			fields = append(fields, field)
+		}
+		node.Fields["fields"] = fields
+	}
+
+	return node
+}
+
+func dumpStmt(stmt Stmt) *AstNode {
+	if stmt == nil {
+		return nil
+	}
+
+	start, end, _ := StmtTokens(stmt)
+
+	var node *AstNode
+	switch s := stmt.(type) {
+	case *Block:
+		node = newAstNode("Block", start, end)
+		node.Fields["statements"] = dumpStmts(s.statements)
+	case *Expression:
+		node = newAstNode("Expression", start, end)
+		node.Fields["expression"] = dumpExpr(s.expression)
+	case *Function:
+		node = newAstNode("Function", start, end)
+		node.Fields["name"] = s.name.Lexeme
+		node.Fields["params"] = dumpLexemes(s.params)
+		node.Fields["paramTypes"] = dumpLexemes(s.paramTypes)
+		node.Fields["defaults"] = dumpExprs(s.defaults)
+		node.Fields["returnType"] = dumpLexeme(s.returnType)
+		node.Fields["static"] = s.isStatic
+		node.Fields["getter"] = s.isGetter
+		node.Fields["variadic"] = s.variadic
+		node.Fields["body"] = dumpStmts(s.body)
+	case *IfCmd:
+		node = newAstNode("If", start, end)
+		node.Fields["condition"] = dumpExpr(s.condition)
+		node.Fields["thenBranch"] = dumpStmt(s.thenBranch)
+		node.Fields["elseBranch"] = dumpStmt(s.elseBranch)
+	case *Print:
+		node = newAstNode("Print", start, end)
+		node.Fields["expression"] = dumpExpr(s.expression)
+	case *ReturnCmd:
+		node = newAstNode("Return", start, end)
+		node.Fields["value"] = dumpExpr(s.value)
+	case *VarCmd:
+		node = newAstNode("Var", start, end)
+		node.Fields["name"] = s.name.Lexeme
+		node.Fields["constant"] = s.constant
+		node.Fields["type"] = dumpLexeme(s.annotation)
+		node.Fields["initializer"] = dumpExpr(s.initializer)
+	case *Enum:
+		node = newAstNode("Enum", start, end)
+		node.Fields["name"] = s.name.Lexeme
+		node.Fields["members"] = dumpLexemes(s.members)
+	case *ImportCmd:
+		node = newAstNode("Import", start, end)
+		node.Fields["names"] = dumpLexemes(s.names)
+		node.Fields["path"] = s.path.Literal
+	case *Unpack:
+		node = newAstNode("Unpack", start, end)
+		node.Fields["names"] = dumpLexemes(s.names)
+		node.Fields["constant"] = s.constant
+		node.Fields["initializer"] = dumpExpr(s.initializer)
+	case *WhileLoop:
+		node = newAstNode("While", start, end)
+		node.Fields["label"] = dumpLexeme(s.label)
+		node.Fields["condition"] = dumpExpr(s.condition)
+		node.Fields["body"] = dumpStmt(s.body)
+		node.Fields["increment"] = dumpExpr(s.increment)
+	case *ForIn:
+		node = newAstNode("ForIn", start, end)
+		node.Fields["label"] = dumpLexeme(s.label)
+		node.Fields["name"] = s.name.Lexeme
+		node.Fields["iterable"] = dumpExpr(s.iterable)
+		node.Fields["body"] = dumpStmt(s.body)
+	case *SwitchCmd:
+		node = newAstNode("Switch", start, end)
+		node.Fields["subject"] = dumpExpr(s.subject)
+		cases := []*AstNode{}
+		for _, c := range s.cases {
+			caseNode := newAstNode("Case", c.keyword, c.end)
+			caseNode.Fields["value"] = dumpExpr(c.value)
+			caseNode.Fields["body"] = dumpStmts(c.body)
+			caseNode.Fields["fallsThrough"] = c.fallsThrough
+			cases = append(cases, caseNode)
+		}
+		node.Fields["cases"] = cases
+	case *Match:
+		node = newAstNode("Match", start, end)
+		node.Fields["subject"] = dumpExpr(s.subject)
+		arms := []*AstNode{}
+		for _, arm := range s.arms {
+			_, armEnd, _ := StmtTokens(arm.body)
+			armNode := newAstNode("Arm", arm.keyword, armEnd)
+			armNode.Fields["pattern"] = dumpPattern(arm.pattern)
+			armNode.Fields["body"] = dumpStmt(arm.body)
+			arms = append(arms, armNode)
+		}
+		node.Fields["arms"] = arms
+	case *Yield:
+		node = newAstNode("Yield", start, end)
+		node.Fields["value"] = dumpExpr(s.value)
+	case *DeferCmd:
+		node = newAstNode("Defer", start, end)
+		node.Fields["expression"] = dumpExpr(s.expression)
+	case *BreakCmd:
+		node = newAstNode("Break", start, end)
+		node.Fields["label"] = dumpLexeme(s.label)
+	case *ContinueCmd:
+		node = newAstNode("Continue", start, end)
+		node.Fields["label"] = dumpLexeme(s.label)
+	case *Class:
+		node = newAstNode("Class", start, end)
+		node.Fields["name"] = s.name.Lexeme
+		node.Fields["superclass"] = nil
+		if s.superclass != nil {
+			node.Fields["superclass"] = s.superclass.name.Lexeme
+		}
+		traits := []interface{}{}
+		for _, trait := range s.traits {
+			traits = append(traits, trait.name.Lexeme)
+		}
+		node.Fields["traits"] = traits
+		methods := []*AstNode{}
+		for _, method := range s.methods {
+			methods = append(methods, dumpStmt(method))
+		}
+		node.Fields["methods"] = methods
+		fields := []*AstNode{}
+		for _, field := range s.fields {
+			fields = append(fields, dumpStmt(field))
+		}
+		node.Fields["fields"] = fields
+	default:
+		return nil
+	}
+
+	if hint, ok := deprecation(stmt); ok {
+		node.Fields["deprecated"] = hint
+	}
+
+	if stmt.info().exported {
+		node.Fields["exported"] = true
+	}
+
+	return node
+}
+
+func dumpExpr(expr Expr) *AstNode {
+	if expr == nil {
+		return nil
+	}
+
+	start, end := exprTokens(expr)
+
+	var node *AstNode
+	switch e := expr.(type) {
+	case *Assign:
+		node = newAstNode("Assign", start, end)
+		node.Fields["name"] = e.name.Lexeme
+		node.Fields["value"] = dumpExpr(e.value)
+	case *Binary:
+		node = newAstNode("Binary", start, end)
+		node.Fields["left"] = dumpExpr(e.left)
+		node.Fields["operator"] = e.operator.Lexeme
+		node.Fields["right"] = dumpExpr(e.right)
+	case *Logical:
+		node = newAstNode("Logical", start, end)
+		node.Fields["left"] = dumpExpr(e.left)
+		node.Fields["operator"] = e.operator.Lexeme
+		node.Fields["right"] = dumpExpr(e.right)
+	case *Call:
+		node = newAstNode("Call", start, end)
+		node.Fields["callee"] = dumpExpr(e.callee)
+		node.Fields["arguments"] = dumpExprs(e.arguments)
+	case *Spread:
+		node = newAstNode("Spread", start, end)
+		node.Fields["expression"] = dumpExpr(e.expression)
+	case *Spawn:
+		node = newAstNode("Spawn", start, end)
+		node.Fields["call"] = dumpExpr(e.call)
+	case *GetMethod:
+		node = newAstNode("GetMethod", start, end)
+		node.Fields["object"] = dumpExpr(e.object)
+		node.Fields["name"] = e.name.Lexeme
+		node.Fields["optional"] = e.optional
+	case *GetField:
+		node = newAstNode("GetField", start, end)
+		node.Fields["object"] = dumpExpr(e.object)
+		node.Fields["name"] = e.name.Lexeme
+		node.Fields["optional"] = e.optional
+	case *Set:
+		node = newAstNode("Set", start, end)
+		node.Fields["object"] = dumpExpr(e.object)
+		node.Fields["name"] = e.name.Lexeme
+		node.Fields["value"] = dumpExpr(e.value)
+	case *Super:
+		node = newAstNode("Super", start, end)
+		node.Fields["method"] = e.method.Lexeme
+	case *This:
+		node = newAstNode("This", start, end)
+	case *Grouping:
+		node = newAstNode("Grouping", start, end)
+		node.Fields["expression"] = dumpExpr(e.expression)
+	case *Literal:
+		node = newAstNode("Literal", start, end)
+		node.Fields["value"] = e.value
+		if e.text != "" {
+			node.Fields["text"] = e.text
+		}
+	case *Unary:
+		node = newAstNode("Unary", start, end)
+		node.Fields["operator"] = e.operator.Lexeme
+		node.Fields["right"] = dumpExpr(e.right)
+	case *Variable:
+		node = newAstNode("Variable", start, end)
+		node.Fields["name"] = e.name.Lexeme
+	default:
+		return nil
+	}
+
+	return node
+}
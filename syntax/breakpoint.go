@@ -0,0 +1,253 @@
+package syntax
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type breakpoint struct {
+	id        int
+	line      int
+	condition Expr
+	source    string
+	hitCount  int
+	hits      int
+}
+
+type watchpoint struct {
+	id    int
+	name  string
+	field string
+	value interface{}
+	found bool
+}
+
+// BeforeStatement stops the script when a step finishes or a breakpoint or
+// watchpoint triggers. Blocks are passed over, as the first statement
+// inside stops instead.
+func (debugger *ConsoleDebugger) BeforeStatement(point *StopPoint) {
+	if debugger.evaluating || debugger.detached || point.Token == nil {
+		return
+	}
+
+	if _, ok := point.Stmt.(*Block); ok {
+		return
+	}
+
+	line := point.Line
+	debugger.depth = point.Depth
+	if debugger.stepDone(point.Depth) {
+		debugger.stop(line, fmt.Sprintf("Stopped at line %d.", line))
+		return
+	}
+
+	for _, w := range debugger.watchpoints {
+		if reason, changed := debugger.checkWatchpoint(w); changed {
+			debugger.stop(line, reason)
+			return
+		}
+	}
+
+	for _, b := range debugger.breakpoints {
+		if b.line == line && debugger.shouldBreak(b) {
+			debugger.stop(line, fmt.Sprintf("Breakpoint %d hit at line %d.", b.id, line))
+			return
+		}
+	}
+}
+
+func (debugger *ConsoleDebugger) stepDone(depth int) bool {
+	switch debugger.step {
+	case stepInto:
+		return true
+	case stepOver:
+		return depth <= debugger.stepDepth
+	case stepOut:
+		return depth < debugger.stepDepth
+	}
+
+	return false
+}
+
+func (debugger *ConsoleDebugger) shouldBreak(b *breakpoint) bool {
+	if b.condition != nil {
+		value, ok := debugger.evaluateIn(b.condition, debugger.interpreter.env)
+		if !ok || !isTruthy(value) {
+			return false
+		}
+	}
+
+	b.hits++
+	return b.hitCount == 0 || b.hits == b.hitCount
+}
+
+// checkWatchpoint compares a watched variable or field with the value it had
+// the last time it was checked.
+func (debugger *ConsoleDebugger) checkWatchpoint(w *watchpoint) (string, bool) {
+	value, found := lookupWatched(debugger.interpreter.env, w.name, w.field)
+	previous, wasFound := w.value, w.found
+	w.value, w.found = value, found
+
+	if found == wasFound && (!found || isEqual(value, previous)) {
+		return "", false
+	}
+
+	name := w.name
+	if w.field != "" {
+		name = fmt.Sprintf("%s.%s", w.name, w.field)
+	}
+
+	if !wasFound {
+		return fmt.Sprintf("Watchpoint %d: %s set to %s.", w.id, name, stringify(value)), true
+	}
+
+	if !found {
+		return fmt.Sprintf("Watchpoint %d: %s is no longer in scope.", w.id, name), true
+	}
+
+	return fmt.Sprintf("Watchpoint %d: %s changed from %s to %s.", w.id, name, stringify(previous), stringify(value)), true
+}
+
+// lookupWatched finds a variable, or a field on the instance a variable
+// holds, without reporting errors when it doesn't exist.
+func lookupWatched(env *Environment, name string, field string) (interface{}, bool) {
+	for ; env != nil; env = env.enclosing {
+		value, ok := env.values[name]
+		if !ok {
+			continue
+		}
+
+		if field == "" {
+			return value, true
+		}
+
+		instance, ok := value.(*LoxInstance)
+		if !ok {
+			return nil, false
+		}
+
+		value, ok = instance.fields[field]
+		return value, ok
+	}
+
+	return nil, false
+}
+
+// addBreakpoint parses "<line> [hit <n>] [if <expr>]".
+func (debugger *ConsoleDebugger) addBreakpoint(args string) {
+	b := &breakpoint{}
+
+	var condition string
+	if i := strings.Index(args, " if "); i >= 0 {
+		args, condition = args[:i], strings.TrimSpace(args[i+4:])
+	} else if strings.HasPrefix(args, "if ") {
+		fmt.Fprintln(debugger.out, "Expect a line number before 'if'.")
+		return
+	}
+
+	parts := strings.Fields(args)
+	if len(parts) != 1 && !(len(parts) == 3 && parts[1] == "hit") {
+		fmt.Fprintln(debugger.out, "Usage: break <line> [hit <n>] [if <expr>]")
+		return
+	}
+
+	line, err := strconv.Atoi(parts[0])
+	if err != nil || line < 1 {
+		fmt.Fprintf(debugger.out, "Invalid line '%s'.\n", parts[0])
+		return
+	}
+	b.line = line
+
+	if len(parts) == 3 {
+		hitCount, err := strconv.Atoi(parts[2])
+		if err != nil || hitCount < 1 {
+			fmt.Fprintf(debugger.out, "Invalid hit count '%s'.\n", parts[2])
+			return
+		}
+		b.hitCount = hitCount
+	}
+
+	if condition != "" {
+		expr, ok := debugger.parse(condition)
+		if !ok {
+			return
+		}
+		b.condition = expr
+		b.source = condition
+	}
+
+	b.id = debugger.nextID
+	debugger.nextID++
+	debugger.breakpoints = append(debugger.breakpoints, b)
+	fmt.Fprintf(debugger.out, "Breakpoint %d at line %d.\n", b.id, b.line)
+}
+
+// addWatchpoint parses "<name>" or "<name>.<field>".
+func (debugger *ConsoleDebugger) addWatchpoint(args string) {
+	w := &watchpoint{name: args}
+	if i := strings.Index(args, "."); i >= 0 {
+		w.name, w.field = args[:i], args[i+1:]
+	}
+
+	if w.name == "" || strings.ContainsAny(w.name+w.field, " .") {
+		fmt.Fprintln(debugger.out, "Usage: watch <name> or watch <name>.<field>")
+		return
+	}
+
+	env := debugger.interpreter.env
+	if len(debugger.frames) > 0 {
+		env = debugger.frames[debugger.current].env
+	}
+	w.value, w.found = lookupWatched(env, w.name, w.field)
+
+	w.id = debugger.nextID
+	debugger.nextID++
+	debugger.watchpoints = append(debugger.watchpoints, w)
+	fmt.Fprintf(debugger.out, "Watchpoint %d on %s.\n", w.id, args)
+}
+
+func (debugger *ConsoleDebugger) deletePoint(args string) {
+	id, err := strconv.Atoi(args)
+	if err != nil {
+		fmt.Fprintf(debugger.out, "Invalid id '%s'.\n", args)
+		return
+	}
+
+	for i, b := range debugger.breakpoints {
+		if b.id == id {
+			debugger.breakpoints = append(debugger.breakpoints[:i], debugger.breakpoints[i+1:]...)
+			return
+		}
+	}
+
+	for i, w := range debugger.watchpoints {
+		if w.id == id {
+			debugger.watchpoints = append(debugger.watchpoints[:i], debugger.watchpoints[i+1:]...)
+			return
+		}
+	}
+
+	fmt.Fprintf(debugger.out, "No breakpoint or watchpoint %d.\n", id)
+}
+
+func (debugger *ConsoleDebugger) info() {
+	for _, b := range debugger.breakpoints {
+		fmt.Fprintf(debugger.out, "Breakpoint %d at line %d", b.id, b.line)
+		if b.hitCount > 0 {
+			fmt.Fprintf(debugger.out, " on hit %d", b.hitCount)
+		}
+		if b.condition != nil {
+			fmt.Fprintf(debugger.out, " if %s", b.source)
+		}
+		fmt.Fprintf(debugger.out, " (hit %d times)\n", b.hits)
+	}
+
+	for _, w := range debugger.watchpoints {
+		name := w.name
+		if w.field != "" {
+			name = fmt.Sprintf("%s.%s", w.name, w.field)
+		}
+		fmt.Fprintf(debugger.out, "Watchpoint %d on %s\n", w.id, name)
+	}
+}
@@ -0,0 +1,82 @@
+package syntax
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// stepBudget counts the statements a run executes, shared with the tasks it
+// spawns, so a runaway script can be stopped.
+type stepBudget struct {
+	limit int64
+	steps int64
+}
+
+// SetStepLimit makes each run fail with a runtime error once it has executed
+// limit statements, counting those of the tasks it spawns. A limit of 0
+// removes it.
+func (interpreter *Interpreter) SetStepLimit(limit int64) {
+	interpreter.budget = nil
+	if limit > 0 {
+		interpreter.budget = &stepBudget{limit: limit}
+	}
+}
+
+// SetContext makes runs fail with a runtime error once ctx is done, and wakes
+// scripts sleeping in sleep() early. A nil ctx removes it.
+func (interpreter *Interpreter) SetContext(ctx context.Context) {
+	interpreter.ctx = ctx
+}
+
+// checkCanceled fails the statement about to run when the run's context is
+// done.
+func (interpreter *Interpreter) checkCanceled(stmt Stmt) {
+	select {
+	case <-interpreter.ctx.Done():
+		if token, _, ok := StmtTokens(stmt); ok {
+			throwRuntimeError(token, fmt.Sprintf("Run canceled: %s.", interpreter.ctx.Err()))
+		}
+	default:
+	}
+}
+
+// sleep waits for d, giving other tasks their turn meanwhile, and fails
+// when the run's context is done first.
+func (interpreter *Interpreter) sleep(d time.Duration) {
+	if interpreter.scheduler != nil {
+		interpreter.scheduler.release()
+		defer interpreter.scheduler.acquire()
+	}
+
+	var done <-chan struct{}
+	if interpreter.ctx != nil {
+		done = interpreter.ctx.Done()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-done:
+		throwRuntimeError(interpreter.callSite(), fmt.Sprintf("Run canceled: %s.", interpreter.ctx.Err()))
+	}
+}
+
+func (budget *stepBudget) reset() {
+	atomic.StoreInt64(&budget.steps, 0)
+}
+
+func (budget *stepBudget) spend(stmt Stmt) {
+	if atomic.AddInt64(&budget.steps, 1) <= budget.limit {
+		return
+	}
+
+	// Statements the parser made up have no token to blame, so the next one
+	// the script wrote fails instead.
+	if token, _, ok := StmtTokens(stmt); ok {
+		throwRuntimeError(token, fmt.Sprintf("Step limit of %d exceeded.", budget.limit))
+	}
+}
@@ -0,0 +1,192 @@
+package syntax
+
+import "sort"
+
+// capturePlan lists the environments a closure keeps, innermost first. The
+// last is always the globals. The resolver gives functions and classes one
+// so their closures don't hold on to every enclosing environment, and every
+// value in them, for as long as they live, even those they never use. A
+// declaration without a plan keeps the whole chain.
+type capturePlan []captureLevel
+
+// captureLevel is an environment a closure keeps, depth environments out
+// from the one it is declared in. A level with names is copied into a new
+// environment holding just those variables, which is only done when none
+// of them is ever assigned. Otherwise the closure shares the environment.
+type captureLevel struct {
+	depth int
+	names []string
+}
+
+// closure returns the environment that a function or class with plan,
+// declared in env, closes over.
+func (interpreter *Interpreter) closure(plan capturePlan, env *Environment) *Environment {
+	if plan == nil {
+		return env
+	}
+
+	// The outermost levels that are shared and next to each other are
+	// already linked up in env's chain.
+	last := len(plan) - 1
+	for last > 0 && plan[last-1].names == nil && plan[last-1].depth == plan[last].depth-1 {
+		last--
+	}
+
+	closure := env.ancestor(plan[last].depth)
+	for i := last - 1; i >= 0; i-- {
+		source := env.ancestor(plan[i].depth)
+		if plan[i].names == nil {
+			closure = &Environment{enclosing: closure, values: source.values, name: source.name, constants: source.constants}
+			continue
+		}
+
+		closure = NewEnvironment(closure)
+		for _, name := range plan[i].names {
+			if value, ok := source.values[name]; ok {
+				closure.values[name] = value
+			}
+		}
+	}
+
+	return closure
+}
+
+// captureUnit is a function or class being resolved whose closure can be
+// trimmed. Of the scopes from boundary, the one it is declared in, out to
+// the globals, it keeps those that code inside it uses. Its plan is written
+// to the declaration's capture field.
+type captureUnit struct {
+	plan     *capturePlan
+	parent   *captureUnit
+	boundary int
+	captured map[int]map[string]*VariableData
+}
+
+// captureReference is a variable used from inside a unit but declared
+// outside it, whose depth depends on the scopes the unit keeps.
+type captureReference struct {
+	depth *int
+	from  int
+	to    int
+	unit  *captureUnit
+}
+
+// beginCapture starts the unit for the declaration whose capture field is
+// plan, declared in the innermost scope.
+func (resolver *Resolver) beginCapture(plan *capturePlan) {
+	resolver.unit = &captureUnit{
+		plan:     plan,
+		parent:   resolver.unit,
+		boundary: resolver.scopes.Len() - 1,
+		captured: make(map[int]map[string]*VariableData),
+	}
+	resolver.units = append(resolver.units, resolver.unit)
+}
+
+func (resolver *Resolver) endCapture() {
+	resolver.unit = resolver.unit.parent
+}
+
+// capture records a use, from the innermost scope, of the variable name in
+// scope. Every unit the use reaches out of has to keep that scope.
+func (resolver *Resolver) capture(name string, data *VariableData, scope int, depth *int) {
+	if resolver.unit == nil || scope > resolver.unit.boundary {
+		return
+	}
+
+	resolver.references = append(resolver.references, captureReference{
+		depth: depth,
+		from:  resolver.scopes.Len() - 1,
+		to:    scope,
+		unit:  resolver.unit,
+	})
+
+	for unit := resolver.unit; unit != nil && scope <= unit.boundary; unit = unit.parent {
+		if unit.captured[scope] == nil {
+			unit.captured[scope] = make(map[string]*VariableData)
+		}
+
+		unit.captured[scope][name] = data
+	}
+}
+
+// trimClosures works out the plan for each unit, now that every assignment
+// has been seen, and corrects the depths of the variables used across them.
+func (resolver *Resolver) trimClosures() {
+	kept := make(map[*captureUnit][]int, len(resolver.units))
+
+	// A unit comes before the units nested in it, whose plans count the
+	// environments it keeps.
+	for _, unit := range resolver.units {
+		var scopes []int
+		for scope := range unit.captured {
+			if scope != 0 {
+				scopes = append(scopes, scope)
+			}
+		}
+
+		sort.Sort(sort.Reverse(sort.IntSlice(scopes)))
+		scopes = append(scopes, 0)
+		kept[unit] = scopes
+
+		plan := make(capturePlan, len(scopes))
+		trimmed := false
+		for i, scope := range scopes {
+			plan[i].depth = runtimeDepth(kept, unit.parent, unit.boundary, scope)
+			if scope != 0 {
+				plan[i].names = unassigned(unit.captured[scope])
+			}
+
+			if plan[i].depth != i || plan[i].names != nil {
+				trimmed = true
+			}
+		}
+
+		if trimmed {
+			*unit.plan = plan
+		} else {
+			*unit.plan = nil
+		}
+	}
+
+	for _, reference := range resolver.references {
+		*reference.depth = runtimeDepth(kept, reference.unit, reference.from, reference.to)
+	}
+
+	resolver.units, resolver.references = nil, nil
+}
+
+// runtimeDepth counts the environments between scopes from and to when
+// running inside unit, whose closure skips the scopes it doesn't keep.
+func runtimeDepth(kept map[*captureUnit][]int, unit *captureUnit, from int, to int) int {
+	if unit == nil || to > unit.boundary {
+		return from - to
+	}
+
+	depth := from - unit.boundary
+	for _, scope := range kept[unit] {
+		if scope == to {
+			break
+		}
+
+		depth++
+	}
+
+	return depth
+}
+
+// unassigned returns the sorted names of variables, or nil when any of
+// them is assigned after its declaration.
+func unassigned(variables map[string]*VariableData) []string {
+	names := make([]string, 0, len(variables))
+	for name, data := range variables {
+		if data.assigned {
+			return nil
+		}
+
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,682 @@
+package syntax
+
+import (
+	"fmt"
+	"golox/loxerror"
+	"golox/references"
+	"golox/scanner"
+)
+
+const anyType = "any"
+
+var builtinTypes = map[string]bool{
+	anyType:     true,
+	"nil":       true,
+	"boolean":   true,
+	"number":    true,
+	"string":    true,
+	"list":      true,
+	"range":     true,
+	"generator": true,
+	"task":      true,
+	"channel":   true,
+	"function":  true,
+	"class":     true,
+}
+
+// signature is the declared type of a function. Unannotated parameters and
+// results are "any".
+type signature struct {
+	params   []string
+	result   string
+	variadic bool
+}
+
+type checkedName struct {
+	typeName string
+	function *signature
+}
+
+// Checker verifies type annotations after the program has been resolved.
+// Only annotated variables, parameters and results are checked; everything
+// else is "any" and stays dynamic. Type names are those type() returns,
+// "any", or a class name, which also accepts instances of subclasses.
+type Checker struct {
+	scopes      []map[string]*checkedName
+	superclass  map[string]string
+	function    *Function
+	returnTypes []string
+}
+
+func NewChecker() *Checker {
+	return &Checker{
+		superclass: make(map[string]string),
+	}
+}
+
+// Check reports every annotation the program breaks, carrying on past the
+// first so all of them are listed.
+func (checker *Checker) Check(statements []Stmt) {
+	for _, list := range StatementLists(statements) {
+		for _, stmt := range list {
+			if class, ok := stmt.(*Class); ok {
+				checker.superclass[class.name.Lexeme] = ""
+				if class.superclass != nil {
+					checker.superclass[class.name.Lexeme] = class.superclass.name.Lexeme
+				}
+			}
+		}
+	}
+
+	checker.beginScope()
+
+	// Functions can be called before their declaration, so know their
+	// signatures up front.
+	for _, stmt := range statements {
+		if function, ok := stmt.(*Function); ok {
+			checker.declareFunction(function)
+		}
+	}
+
+	for _, stmt := range statements {
+		checker.checkStatement(stmt)
+	}
+
+	checker.endScope()
+}
+
+func (checker *Checker) checkStatement(stmt Stmt) {
+	stmt.accept(checker)
+}
+
+func (checker *Checker) checkStatements(statements []Stmt) {
+	for _, stmt := range statements {
+		checker.checkStatement(stmt)
+	}
+}
+
+func (checker *Checker) checkExpression(expr Expr) string {
+	if expr == nil {
+		return "nil"
+	}
+
+	return expr.accept(checker).(string)
+}
+
+func (checker *Checker) visitBlockStmt(stmt *Block) interface{} {
+	checker.beginScope()
+	checker.checkStatements(stmt.statements)
+	checker.endScope()
+	return nil
+}
+
+func (checker *Checker) visitExpressionStmt(stmt *Expression) interface{} {
+	checker.checkExpression(stmt.expression)
+	return nil
+}
+
+func (checker *Checker) visitFunctionStmt(stmt *Function) interface{} {
+	signature := checker.declareFunction(stmt)
+	checker.checkFunction(stmt, signature)
+	return nil
+}
+
+func (checker *Checker) visitIfCmdStmt(stmt *IfCmd) interface{} {
+	checker.checkExpression(stmt.condition)
+	checker.checkStatement(stmt.thenBranch)
+	if stmt.elseBranch != nil {
+		checker.checkStatement(stmt.elseBranch)
+	}
+
+	return nil
+}
+
+func (checker *Checker) visitPrintStmt(stmt *Print) interface{} {
+	checker.checkExpression(stmt.expression)
+	return nil
+}
+
+func (checker *Checker) visitReturnCmdStmt(stmt *ReturnCmd) interface{} {
+	got := checker.checkExpression(stmt.value)
+	if len(checker.returnTypes) == 0 {
+		return nil
+	}
+
+	want := checker.returnTypes[len(checker.returnTypes)-1]
+	if !checker.assignable(want, got) {
+		checker.error(stmt.keyword, fmt.Sprintf("Can't return %s from '%s', which returns %s.", got, checker.function.name.Lexeme, want))
+	}
+
+	return nil
+}
+
+func (checker *Checker) visitVarCmdStmt(stmt *VarCmd) interface{} {
+	want := checker.resolveType(stmt.annotation)
+	if stmt.initializer != nil {
+		got := checker.checkExpression(stmt.initializer)
+		if !checker.assignable(want, got) {
+			checker.error(stmt.name, fmt.Sprintf("Can't initialize '%s' of type %s with %s.", stmt.name.Lexeme, want, got))
+		}
+	}
+
+	checker.declare(stmt.name.Lexeme, &checkedName{typeName: want})
+	return nil
+}
+
+func (checker *Checker) visitWhileLoopStmt(stmt *WhileLoop) interface{} {
+	checker.checkExpression(stmt.condition)
+	checker.checkStatement(stmt.body)
+	if stmt.increment != nil {
+		checker.checkExpression(stmt.increment)
+	}
+
+	return nil
+}
+
+func (checker *Checker) visitUnpackStmt(stmt *Unpack) interface{} {
+	checker.checkExpression(stmt.initializer)
+	for _, name := range stmt.names {
+		checker.declare(name.Lexeme, &checkedName{typeName: anyType})
+	}
+
+	return nil
+}
+
+func (checker *Checker) visitEnumStmt(stmt *Enum) interface{} {
+	checker.declare(stmt.name.Lexeme, &checkedName{typeName: anyType})
+	return nil
+}
+
+func (checker *Checker) visitForInStmt(stmt *ForIn) interface{} {
+	checker.checkExpression(stmt.iterable)
+
+	checker.beginScope()
+	checker.declare(stmt.name.Lexeme, &checkedName{typeName: anyType})
+	checker.checkStatement(stmt.body)
+	checker.endScope()
+	return nil
+}
+
+func (checker *Checker) visitSwitchCmdStmt(stmt *SwitchCmd) interface{} {
+	checker.checkExpression(stmt.subject)
+	for _, c := range stmt.cases {
+		if c.value != nil {
+			checker.checkExpression(c.value)
+		}
+
+		checker.beginScope()
+		checker.checkStatements(c.body)
+		checker.endScope()
+	}
+
+	return nil
+}
+
+func (checker *Checker) visitMatchStmt(stmt *Match) interface{} {
+	checker.checkExpression(stmt.subject)
+	for _, arm := range stmt.arms {
+		checker.beginScope()
+		if arm.pattern != nil {
+			checker.checkPattern(arm.pattern)
+		}
+
+		checker.checkStatement(arm.body)
+		checker.endScope()
+	}
+
+	return nil
+}
+
+// checkPattern declares the names a pattern binds, typed when an 'is'
+// pattern names a type the checker knows.
+func (checker *Checker) checkPattern(pattern Pattern) {
+	switch p := pattern.(type) {
+	case *BindingPattern:
+		checker.declare(p.name.Lexeme, &checkedName{typeName: anyType})
+	case *ValuePattern:
+		checker.checkExpression(p.value)
+	case *TypePattern:
+		if p.binding == nil {
+			return
+		}
+
+		t := anyType
+		if name, ok := patternTypes[p.typeName.Lexeme]; ok && builtinTypes[name] {
+			t = name
+		} else if _, ok := checker.superclass[p.typeName.Lexeme]; ok {
+			t = p.typeName.Lexeme
+		}
+
+		checker.declare(p.binding.Lexeme, &checkedName{typeName: t})
+	case *ListPattern:
+		for _, element := range p.elements {
+			checker.checkPattern(element)
+		}
+
+		if p.rest != nil {
+			checker.declare(p.rest.Lexeme, &checkedName{typeName: "list"})
+		}
+	case *FieldsPattern:
+		for _, field := range p.patterns {
+			checker.checkPattern(field)
+		}
+	}
+}
+
+func (checker *Checker) visitBreakCmdStmt(stmt *BreakCmd) interface{} {
+	return nil
+}
+
+func (checker *Checker) visitContinueCmdStmt(stmt *ContinueCmd) interface{} {
+	return nil
+}
+
+func (checker *Checker) visitImportCmdStmt(stmt *ImportCmd) interface{} {
+	for _, name := range stmt.names {
+		checker.declare(name.Lexeme, &checkedName{typeName: anyType})
+	}
+
+	return nil
+}
+
+func (checker *Checker) visitYieldStmt(stmt *Yield) interface{} {
+	checker.checkExpression(stmt.value)
+	return nil
+}
+
+func (checker *Checker) visitDeferCmdStmt(stmt *DeferCmd) interface{} {
+	checker.checkExpression(stmt.expression)
+	return nil
+}
+
+func (checker *Checker) visitClassStmt(stmt *Class) interface{} {
+	// Like an unannotated variable, the name can be reassigned to anything.
+	checker.declare(stmt.name.Lexeme, &checkedName{typeName: anyType})
+
+	checker.beginScope()
+	for _, field := range stmt.fields {
+		want := checker.resolveType(field.annotation)
+		if field.initializer != nil {
+			got := checker.checkExpression(field.initializer)
+			if !checker.assignable(want, got) {
+				checker.error(field.name, fmt.Sprintf("Can't initialize field '%s' of type %s with %s.", field.name.Lexeme, want, got))
+			}
+		}
+	}
+
+	for _, method := range stmt.methods {
+		checker.checkFunction(method, checker.signatureOf(method))
+	}
+	checker.endScope()
+
+	return nil
+}
+
+func (checker *Checker) visitAssignExpr(expr *Assign) interface{} {
+	got := checker.checkExpression(expr.value)
+	if name, ok := checker.lookup(expr.name.Lexeme); ok && !checker.assignable(name.typeName, got) {
+		checker.error(expr.name, fmt.Sprintf("Can't assign %s to '%s' of type %s.", got, expr.name.Lexeme, name.typeName))
+	}
+
+	return got
+}
+
+func (checker *Checker) visitBinaryExpr(expr *Binary) interface{} {
+	left := checker.checkExpression(expr.left)
+	right := checker.checkExpression(expr.right)
+
+	switch expr.operator.Type {
+	case references.Greater, references.GreaterEqual, references.Less, references.LessEqual, references.EqualEqual, references.BangEqual:
+		if builtinTypes[left] && builtinTypes[right] {
+			return "boolean"
+		}
+	case references.Minus, references.Slash, references.Star, references.Modulo, references.TildeSlash,
+		references.Ampersand, references.Pipe, references.Caret, references.LessLess, references.GreaterGreater:
+		if left == "number" && right == "number" {
+			return "number"
+		}
+	case references.Plus:
+		if left == "number" && right == "number" {
+			return "number"
+		}
+
+		if left == "string" || right == "string" {
+			return "string"
+		}
+	}
+
+	return anyType
+}
+
+func (checker *Checker) visitCallExpr(expr *Call) interface{} {
+	var arguments []string
+	for _, argument := range expr.arguments {
+		arguments = append(arguments, checker.checkExpression(argument))
+	}
+
+	variable, ok := expr.callee.(*Variable)
+	if !ok {
+		checker.checkExpression(expr.callee)
+		return anyType
+	}
+
+	if variable.t == references.Klass {
+		if _, ok := checker.superclass[variable.name.Lexeme]; ok {
+			return variable.name.Lexeme
+		}
+
+		return anyType
+	}
+
+	name, ok := checker.lookup(variable.name.Lexeme)
+	if !ok || name.function == nil {
+		return anyType
+	}
+
+	if len(arguments) <= len(name.function.params) && !name.function.variadic && !hasSpread(expr.arguments) {
+		for i, got := range arguments {
+			want := name.function.params[i]
+			if !checker.assignable(want, got) {
+				token, _ := exprTokens(expr.arguments[i])
+				if token == nil {
+					token = expr.paren
+				}
+
+				checker.error(token, fmt.Sprintf("Argument %d to '%s' must be %s, not %s.", i+1, variable.name.Lexeme, want, got))
+			}
+		}
+	}
+
+	return name.function.result
+}
+
+func hasSpread(arguments []Expr) bool {
+	for _, argument := range arguments {
+		if _, ok := argument.(*Spread); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (checker *Checker) visitGetMethodExpr(expr *GetMethod) interface{} {
+	checker.checkExpression(expr.object)
+	return anyType
+}
+
+func (checker *Checker) visitGetFieldExpr(expr *GetField) interface{} {
+	checker.checkExpression(expr.object)
+	return anyType
+}
+
+func (checker *Checker) visitSetExpr(expr *Set) interface{} {
+	checker.checkExpression(expr.object)
+	return checker.checkExpression(expr.value)
+}
+
+func (checker *Checker) visitSuperExpr(expr *Super) interface{} {
+	return anyType
+}
+
+func (checker *Checker) visitThisExpr(expr *This) interface{} {
+	return anyType
+}
+
+func (checker *Checker) visitSpawnExpr(expr *Spawn) interface{} {
+	checker.checkExpression(expr.call)
+	return "task"
+}
+
+func (checker *Checker) visitSpreadExpr(expr *Spread) interface{} {
+	checker.checkExpression(expr.expression)
+	return anyType
+}
+
+func (checker *Checker) visitGroupingExpr(expr *Grouping) interface{} {
+	return checker.checkExpression(expr.expression)
+}
+
+func (checker *Checker) visitLiteralExpr(expr *Literal) interface{} {
+	return typeName(expr.value)
+}
+
+func (checker *Checker) visitLogicalExpr(expr *Logical) interface{} {
+	left := checker.checkExpression(expr.left)
+	right := checker.checkExpression(expr.right)
+	if left == right {
+		return left
+	}
+
+	if expr.operator.Type == references.QuestionQuestion && left == "nil" {
+		return right
+	}
+
+	return anyType
+}
+
+func (checker *Checker) visitUnaryExpr(expr *Unary) interface{} {
+	right := checker.checkExpression(expr.right)
+	if expr.operator.Type == references.Bang {
+		return "boolean"
+	}
+
+	if right == "number" {
+		return "number"
+	}
+
+	return anyType
+}
+
+func (checker *Checker) visitVariableExpr(expr *Variable) interface{} {
+	if name, ok := checker.lookup(expr.name.Lexeme); ok {
+		return name.typeName
+	}
+
+	return anyType
+}
+
+func (checker *Checker) declareFunction(stmt *Function) *signature {
+	signature := checker.signatureOf(stmt)
+	// The name itself is unannotated, so it can be reassigned to anything,
+	// but calls through it are checked against the signature.
+	checker.declare(stmt.name.Lexeme, &checkedName{typeName: anyType, function: signature})
+	return signature
+}
+
+func (checker *Checker) signatureOf(stmt *Function) *signature {
+	signature := &signature{result: checker.resolveType(stmt.returnType), variadic: stmt.variadic}
+	for _, annotation := range stmt.paramTypes {
+		signature.params = append(signature.params, checker.resolveType(annotation))
+	}
+
+	if stmt.variadic {
+		signature.params[len(signature.params)-1] = "list"
+	}
+
+	return signature
+}
+
+func (checker *Checker) checkFunction(stmt *Function, signature *signature) {
+	enclosing := checker.function
+	checker.function = stmt
+	checker.returnTypes = append(checker.returnTypes, signature.result)
+
+	checker.beginScope()
+	for i, param := range stmt.params {
+		if stmt.defaults[i] != nil {
+			got := checker.checkExpression(stmt.defaults[i])
+			if !checker.assignable(signature.params[i], got) {
+				checker.error(param, fmt.Sprintf("Default for '%s' must be %s, not %s.", param.Lexeme, signature.params[i], got))
+			}
+		}
+
+		checker.declare(param.Lexeme, &checkedName{typeName: signature.params[i]})
+	}
+
+	checker.checkStatements(stmt.body)
+	checker.endScope()
+
+	// Falling off the end returns nil, which only a nil or any result allows.
+	result := signature.result
+	if result != anyType && result != "nil" && !stmt.generator && !alwaysReturns(stmt.body) {
+		checker.error(stmt.name, fmt.Sprintf("'%s' must return %s, but it can reach its end without returning.", stmt.name.Lexeme, result))
+	}
+
+	checker.returnTypes = checker.returnTypes[:len(checker.returnTypes)-1]
+	checker.function = enclosing
+}
+
+// alwaysReturns reports whether running statements always ends in a
+// return. It only follows what can be seen without running the program:
+// both branches of an if, a while(true) nothing breaks out of, a switch
+// with a default and a match with an else whose every case returns.
+func alwaysReturns(statements []Stmt) bool {
+	for _, stmt := range statements {
+		if returns(stmt) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func returns(stmt Stmt) bool {
+	switch s := stmt.(type) {
+	case *ReturnCmd:
+		return true
+	case *Block:
+		return alwaysReturns(s.statements)
+	case *IfCmd:
+		return s.elseBranch != nil && returns(s.thenBranch) && returns(s.elseBranch)
+	case *WhileLoop:
+		condition, ok := literal(s.condition)
+		return ok && isTruthy(condition) && !breaksOut(s.body, s.label, true)
+	case *SwitchCmd:
+		hasDefault := false
+		for i, c := range s.cases {
+			hasDefault = hasDefault || c.value == nil
+			for _, stmt := range c.body {
+				if breaksOut(stmt, nil, true) {
+					return false
+				}
+			}
+
+			// A case that falls through returns when the next one does.
+			if !alwaysReturns(c.body) && (!c.fallsThrough || i == len(s.cases)-1) {
+				return false
+			}
+		}
+
+		return hasDefault
+	case *Match:
+		hasElse := false
+		for _, arm := range s.arms {
+			hasElse = hasElse || arm.pattern == nil
+			if !returns(arm.body) {
+				return false
+			}
+		}
+
+		return hasElse
+	}
+
+	return false
+}
+
+// breaksOut reports whether stmt holds a break that leaves the loop or
+// switch around it: one naming label, or an unlabeled one outside any
+// nested loop or switch. nested is true for the loop or switch's own body.
+func breaksOut(stmt Stmt, label *scanner.Token, nested bool) bool {
+	switch s := stmt.(type) {
+	case *BreakCmd:
+		if s.label == nil {
+			return nested
+		}
+
+		return label != nil && s.label.Lexeme == label.Lexeme
+	case *Block:
+		for _, stmt := range s.statements {
+			if breaksOut(stmt, label, nested) {
+				return true
+			}
+		}
+	case *IfCmd:
+		return breaksOut(s.thenBranch, label, nested) || (s.elseBranch != nil && breaksOut(s.elseBranch, label, nested))
+	case *WhileLoop:
+		return breaksOut(s.body, label, false)
+	case *ForIn:
+		return breaksOut(s.body, label, false)
+	case *SwitchCmd:
+		for _, c := range s.cases {
+			for _, stmt := range c.body {
+				if breaksOut(stmt, label, false) {
+					return true
+				}
+			}
+		}
+	case *Match:
+		for _, arm := range s.arms {
+			if breaksOut(arm.body, label, nested) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// resolveType turns an annotation into a type name, treating a missing
+// annotation as "any".
+func (checker *Checker) resolveType(annotation *scanner.Token) string {
+	if annotation == nil {
+		return anyType
+	}
+
+	if _, ok := checker.superclass[annotation.Lexeme]; ok || builtinTypes[annotation.Lexeme] {
+		return annotation.Lexeme
+	}
+
+	checker.error(annotation, fmt.Sprintf("Unknown type '%s'.", annotation.Lexeme))
+	return anyType
+}
+
+func (checker *Checker) assignable(want string, got string) bool {
+	if want == anyType || got == anyType || want == got {
+		return true
+	}
+
+	for class, ok := checker.superclass[got]; ok && class != ""; class, ok = checker.superclass[class] {
+		if class == want {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (checker *Checker) error(token *scanner.Token, message string) {
+	loxerror.TokenError(token.Type, token.Line, token.Column, token.Lexeme, message)
+}
+
+func (checker *Checker) beginScope() {
+	checker.scopes = append(checker.scopes, make(map[string]*checkedName))
+}
+
+func (checker *Checker) endScope() {
+	checker.scopes = checker.scopes[:len(checker.scopes)-1]
+}
+
+func (checker *Checker) declare(name string, checked *checkedName) {
+	checker.scopes[len(checker.scopes)-1][name] = checked
+}
+
+func (checker *Checker) lookup(name string) (*checkedName, bool) {
+	for i := len(checker.scopes) - 1; i >= 0; i-- {
+		if checked, ok := checker.scopes[i][name]; ok {
+			return checked, true
+		}
+	}
+
+	return nil, false
+}
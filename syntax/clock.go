@@ -2,6 +2,7 @@ package syntax
 
 import (
 	"golox/references"
+	"math"
 	"time"
 )
 
@@ -30,3 +31,56 @@ func (clock *Clock) String() string {
 func (clock *Clock) name() string {
 	return "clock"
 }
+
+// defineTime adds the natives for wall-clock time, in milliseconds since the
+// Unix epoch: now(), sleep(ms), which gives other tasks their turn and ends
+// early when the run is canceled, formatTime(millis, layout) and
+// parseTime(text, layout), which use Go's reference-time layouts in UTC and
+// return nil when text doesn't match.
+func defineTime(env *Environment) {
+	env.define("now", NewNativeFunction("now", 0, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		return time.Now().UnixNano() / int64(time.Millisecond)
+	}))
+
+	env.define("sleep", NewNativeFunction("sleep", 1, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		ms, ok := toFloat(arguments[0])
+		if !ok {
+			throwTypedError(TypeError, interpreter.callSite(), "sleep() expects a number of milliseconds.")
+		}
+
+		d := time.Duration(math.MaxInt64)
+		if !(ms > 0) {
+			d = 0
+		} else if ms < float64(d/time.Millisecond) {
+			d = time.Duration(ms * float64(time.Millisecond))
+		}
+
+		interpreter.sleep(d)
+		return nil
+	}))
+
+	env.define("formatTime", NewNativeFunction("formatTime", 2, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		ms, ok := toFloat(arguments[0])
+		layout, layoutOk := arguments[1].(string)
+		if !ok || !layoutOk {
+			throwTypedError(TypeError, interpreter.callSite(), "formatTime() expects milliseconds and a layout string.")
+		}
+
+		return time.Unix(0, int64(ms)*int64(time.Millisecond)).UTC().Format(layout)
+	}))
+
+	env.define("parseTime", NewNativeFunction("parseTime", 2, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		text, ok := arguments[0].(string)
+		layout, layoutOk := arguments[1].(string)
+		if !ok || !layoutOk {
+			throwTypedError(TypeError, interpreter.callSite(), "parseTime() expects a string and a layout string.")
+		}
+
+		t, err := time.Parse(layout, text)
+		if err != nil {
+			return nil
+		}
+
+		return t.UnixNano() / int64(time.Millisecond)
+	}))
+}
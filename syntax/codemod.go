@@ -0,0 +1,440 @@
+package syntax
+
+import (
+	"fmt"
+	"golox/references"
+	"golox/scanner"
+)
+
+// AstEdit replaces the source between two byte offsets with new text.
+type AstEdit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// Codemod runs a transform written in Lox over parsed programs. For every
+// node the transform's global visitX(node) function is called, where X is
+// the node kind such as Call or Var, with a reflected view of the node. The
+// transform edits the program by calling replace(node, text) or
+// remove(node).
+type Codemod struct {
+	interpreter *Interpreter
+	source      string
+	spans       map[*LoxInstance][2]int
+	classes     map[string]*LoxClass
+	edits       []AstEdit
+	visits      []*LoxInstance
+}
+
+func NewCodemod(interpreter *Interpreter) *Codemod {
+	codemod := &Codemod{
+		interpreter: interpreter,
+		classes:     make(map[string]*LoxClass),
+	}
+
+	interpreter.globals.define("replace", &codemodNative{codemod: codemod, nativeName: "replace", params: 2})
+	interpreter.globals.define("remove", &codemodNative{codemod: codemod, nativeName: "remove", params: 1})
+
+	return codemod
+}
+
+// Run visits every node of a program parsed from source and returns the
+// edits the transform asked for.
+func (codemod *Codemod) Run(statements []Stmt, source string) (edits []AstEdit, err error) {
+	codemod.source = source
+	codemod.spans = make(map[*LoxInstance][2]int)
+	codemod.edits = nil
+	codemod.visits = nil
+
+	defer func() {
+		if r := recover(); r != nil {
+			runtimeError, ok := r.(*RuntimeError)
+			if !ok {
+				panic(r)
+			}
+
+			codemod.interpreter.env = codemod.interpreter.globals
+			codemod.interpreter.frames = nil
+			err = runtimeError
+		}
+	}()
+
+	for _, stmt := range statements {
+		codemod.reflectStmt(stmt)
+	}
+
+	for _, node := range codemod.visits {
+		visitor, ok := codemod.interpreter.globals.values["visit"+node.class.name()].(*LoxFunction)
+		if !ok {
+			continue
+		}
+
+		if visitor.arity() != 1 {
+			throwTypedError(ArityError, visitor.declaration.name, fmt.Sprintf("Visitor '%s' must take one parameter.", visitor.name()))
+		}
+
+		visitor.call(codemod.interpreter, []interface{}{node})
+	}
+
+	return codemod.edits, nil
+}
+
+// node creates the reflected view of an AST node, which every node gets the
+// kind, line, column and text fields of, and queues it to be visited.
+func (codemod *Codemod) node(kind string, start *scanner.Token, end *scanner.Token) *LoxInstance {
+	class, ok := codemod.classes[kind]
+	if !ok {
+		class = NewLoxClass(kind, nil, nil, nil, nil, nil, nil)
+		codemod.classes[kind] = class
+	}
+
+	node := NewLoxInstance(class)
+	node.fields["kind"] = kind
+	node.fields["line"] = nil
+	node.fields["column"] = nil
+	node.fields["text"] = nil
+	if start != nil && end != nil {
+		span := [2]int{start.Offset, end.Offset + len(end.Lexeme)}
+		codemod.spans[node] = span
+		node.fields["line"] = int64(start.Line)
+		node.fields["column"] = int64(start.Column)
+		node.fields["text"] = codemod.source[span[0]:span[1]]
+	}
+
+	codemod.visits = append(codemod.visits, node)
+	return node
+}
+
+func (codemod *Codemod) reflectStmt(stmt Stmt) interface{} {
+	if stmt == nil {
+		return nil
+	}
+
+	start, end, _ := StmtTokens(stmt)
+
+	var node *LoxInstance
+	switch s := stmt.(type) {
+	case *Block:
+		node = codemod.node("Block", start, end)
+		node.fields["statements"] = codemod.reflectStmts(s.statements)
+	case *Expression:
+		node = codemod.node("Expression", start, end)
+		node.fields["expression"] = codemod.reflectExpr(s.expression)
+	case *Function:
+		node = codemod.node("Function", start, end)
+		node.fields["name"] = s.name.Lexeme
+		node.fields["params"] = lexemes(s.params)
+		var defaults []interface{}
+		for _, value := range s.defaults {
+			defaults = append(defaults, codemod.reflectExpr(value))
+		}
+		node.fields["defaults"] = NewLoxList(defaults)
+		node.fields["body"] = codemod.reflectStmts(s.body)
+	case *IfCmd:
+		node = codemod.node("If", start, end)
+		node.fields["condition"] = codemod.reflectExpr(s.condition)
+		node.fields["thenBranch"] = codemod.reflectStmt(s.thenBranch)
+		node.fields["elseBranch"] = codemod.reflectStmt(s.elseBranch)
+	case *Print:
+		node = codemod.node("Print", start, end)
+		node.fields["expression"] = codemod.reflectExpr(s.expression)
+	case *ReturnCmd:
+		node = codemod.node("Return", start, end)
+		node.fields["value"] = codemod.reflectExpr(s.value)
+	case *VarCmd:
+		node = codemod.node("Var", start, end)
+		node.fields["name"] = s.name.Lexeme
+		node.fields["constant"] = s.constant
+		node.fields["initializer"] = codemod.reflectExpr(s.initializer)
+	case *Enum:
+		node = codemod.node("Enum", start, end)
+		node.fields["name"] = s.name.Lexeme
+		node.fields["members"] = lexemes(s.members)
+	case *Unpack:
+		node = codemod.node("Unpack", start, end)
+		node.fields["names"] = lexemes(s.names)
+		node.fields["constant"] = s.constant
+		node.fields["initializer"] = codemod.reflectExpr(s.initializer)
+	case *WhileLoop:
+		node = codemod.node("While", start, end)
+		node.fields["condition"] = codemod.reflectExpr(s.condition)
+		node.fields["body"] = codemod.reflectStmt(s.body)
+		node.fields["increment"] = codemod.reflectExpr(s.increment)
+	case *ForIn:
+		node = codemod.node("ForIn", start, end)
+		node.fields["name"] = s.name.Lexeme
+		node.fields["iterable"] = codemod.reflectExpr(s.iterable)
+		node.fields["body"] = codemod.reflectStmt(s.body)
+	case *SwitchCmd:
+		node = codemod.node("Switch", start, end)
+		node.fields["subject"] = codemod.reflectExpr(s.subject)
+		var cases []interface{}
+		for _, c := range s.cases {
+			cases = append(cases, codemod.reflectCase(c))
+		}
+		node.fields["cases"] = NewLoxList(cases)
+	case *Match:
+		node = codemod.node("Match", start, end)
+		node.fields["subject"] = codemod.reflectExpr(s.subject)
+		var arms []interface{}
+		for _, arm := range s.arms {
+			armNode := codemod.node("Arm", arm.keyword, nil)
+			// Patterns aren't nodes of their own, so they read as source.
+			armNode.fields["pattern"] = nil
+			if arm.pattern != nil {
+				armNode.fields["pattern"] = (&formatter{}).pattern(arm.pattern)
+			}
+			armNode.fields["body"] = codemod.reflectStmt(arm.body)
+			arms = append(arms, armNode)
+		}
+		node.fields["arms"] = NewLoxList(arms)
+	case *Yield:
+		node = codemod.node("Yield", start, end)
+		node.fields["value"] = codemod.reflectExpr(s.value)
+	case *DeferCmd:
+		node = codemod.node("Defer", start, end)
+		node.fields["expression"] = codemod.reflectExpr(s.expression)
+	case *BreakCmd:
+		node = codemod.node("Break", start, end)
+		node.fields["label"] = reflectLabel(s.label)
+	case *ContinueCmd:
+		node = codemod.node("Continue", start, end)
+		node.fields["label"] = reflectLabel(s.label)
+	case *ImportCmd:
+		node = codemod.node("Import", start, end)
+		node.fields["names"] = lexemes(s.names)
+		node.fields["path"] = s.path.Literal
+	case *Class:
+		node = codemod.node("Class", start, end)
+		node.fields["name"] = s.name.Lexeme
+		node.fields["superclass"] = nil
+		if s.superclass != nil {
+			node.fields["superclass"] = s.superclass.name.Lexeme
+		}
+		var traits []interface{}
+		for _, trait := range s.traits {
+			traits = append(traits, trait.name.Lexeme)
+		}
+		node.fields["traits"] = NewLoxList(traits)
+		var methods []interface{}
+		for _, method := range s.methods {
+			methods = append(methods, codemod.reflectStmt(method))
+		}
+		node.fields["methods"] = NewLoxList(methods)
+		var fields []interface{}
+		for _, field := range s.fields {
+			fields = append(fields, codemod.reflectStmt(field))
+		}
+		node.fields["fields"] = NewLoxList(fields)
+	default:
+		return nil
+	}
+
+	return node
+}
+
+func (codemod *Codemod) reflectCase(c *SwitchCase) *LoxInstance {
+	node := codemod.node("Case", c.keyword, nil)
+	node.fields["value"] = codemod.reflectExpr(c.value)
+	node.fields["body"] = codemod.reflectStmts(c.body)
+	node.fields["fallsThrough"] = c.fallsThrough
+	return node
+}
+
+func (codemod *Codemod) reflectStmts(statements []Stmt) *LoxList {
+	var nodes []interface{}
+	for _, stmt := range statements {
+		nodes = append(nodes, codemod.reflectStmt(stmt))
+	}
+
+	return NewLoxList(nodes)
+}
+
+func (codemod *Codemod) reflectExpr(expr Expr) interface{} {
+	if expr == nil {
+		return nil
+	}
+
+	start, end := exprTokens(expr)
+
+	var node *LoxInstance
+	switch e := expr.(type) {
+	case *Assign:
+		node = codemod.node("Assign", start, end)
+		node.fields["name"] = e.name.Lexeme
+		node.fields["value"] = codemod.reflectExpr(e.value)
+	case *Binary:
+		node = codemod.node("Binary", start, end)
+		node.fields["left"] = codemod.reflectExpr(e.left)
+		node.fields["operator"] = e.operator.Lexeme
+		node.fields["right"] = codemod.reflectExpr(e.right)
+	case *Logical:
+		node = codemod.node("Logical", start, end)
+		node.fields["left"] = codemod.reflectExpr(e.left)
+		node.fields["operator"] = e.operator.Lexeme
+		node.fields["right"] = codemod.reflectExpr(e.right)
+	case *Call:
+		node = codemod.node("Call", start, end)
+		node.fields["callee"] = codemod.reflectExpr(e.callee)
+		var arguments []interface{}
+		for _, argument := range e.arguments {
+			arguments = append(arguments, codemod.reflectExpr(argument))
+		}
+		node.fields["arguments"] = NewLoxList(arguments)
+	case *Spread:
+		node = codemod.node("Spread", start, end)
+		node.fields["expression"] = codemod.reflectExpr(e.expression)
+	case *Spawn:
+		node = codemod.node("Spawn", start, end)
+		node.fields["call"] = codemod.reflectExpr(e.call)
+	case *GetMethod:
+		node = codemod.node("GetMethod", start, end)
+		node.fields["object"] = codemod.reflectExpr(e.object)
+		node.fields["name"] = e.name.Lexeme
+		node.fields["optional"] = e.optional
+	case *GetField:
+		node = codemod.node("GetField", start, end)
+		node.fields["object"] = codemod.reflectExpr(e.object)
+		node.fields["name"] = e.name.Lexeme
+		node.fields["optional"] = e.optional
+	case *Set:
+		node = codemod.node("Set", start, end)
+		node.fields["object"] = codemod.reflectExpr(e.object)
+		node.fields["name"] = e.name.Lexeme
+		node.fields["value"] = codemod.reflectExpr(e.value)
+	case *Super:
+		node = codemod.node("Super", start, end)
+		node.fields["method"] = e.method.Lexeme
+	case *This:
+		node = codemod.node("This", start, end)
+	case *Grouping:
+		node = codemod.node("Grouping", start, end)
+		node.fields["expression"] = codemod.reflectExpr(e.expression)
+	case *Literal:
+		node = codemod.node("Literal", start, end)
+		node.fields["value"] = e.value
+	case *Unary:
+		node = codemod.node("Unary", start, end)
+		node.fields["operator"] = e.operator.Lexeme
+		node.fields["right"] = codemod.reflectExpr(e.right)
+	case *Variable:
+		node = codemod.node("Variable", start, end)
+		node.fields["name"] = e.name.Lexeme
+	default:
+		return nil
+	}
+
+	return node
+}
+
+// exprTokens finds the first and last tokens of an expression. Literals and
+// groupings keep no tokens, so expressions starting or ending with one have
+// no known position.
+func exprTokens(expr Expr) (*scanner.Token, *scanner.Token) {
+	switch e := expr.(type) {
+	case *Assign:
+		_, end := exprTokens(e.value)
+		return e.name, end
+	case *Binary:
+		start, _ := exprTokens(e.left)
+		_, end := exprTokens(e.right)
+		return start, end
+	case *Logical:
+		start, _ := exprTokens(e.left)
+		_, end := exprTokens(e.right)
+		return start, end
+	case *Call:
+		start, _ := exprTokens(e.callee)
+		return start, e.paren
+	case *Spawn:
+		return e.keyword, e.call.paren
+	case *Spread:
+		_, end := exprTokens(e.expression)
+		return e.ellipsis, end
+	case *GetMethod:
+		start, _ := exprTokens(e.object)
+		return start, e.name
+	case *GetField:
+		start, _ := exprTokens(e.object)
+		return start, e.name
+	case *Set:
+		start, _ := exprTokens(e.object)
+		_, end := exprTokens(e.value)
+		return start, end
+	case *Grouping:
+		return e.opening, e.closing
+	case *Literal:
+		return e.start, e.end
+	case *Super:
+		return e.keyword, e.method
+	case *This:
+		return e.keyword, e.keyword
+	case *Unary:
+		_, end := exprTokens(e.right)
+		return e.operator, end
+	case *Variable:
+		return e.name, e.name
+	}
+
+	return nil, nil
+}
+
+func lexemes(tokens []*scanner.Token) *LoxList {
+	var names []interface{}
+	for _, token := range tokens {
+		names = append(names, token.Lexeme)
+	}
+
+	return NewLoxList(names)
+}
+
+func reflectLabel(label *scanner.Token) interface{} {
+	if label == nil {
+		return nil
+	}
+
+	return label.Lexeme
+}
+
+// codemodNative implements the replace and remove natives available to
+// transforms.
+type codemodNative struct {
+	codemod    *Codemod
+	nativeName string
+	params     int
+}
+
+func (native *codemodNative) arity() int {
+	return native.params
+}
+
+func (native *codemodNative) call(interpreter *Interpreter, arguments []interface{}) interface{} {
+	node, ok := arguments[0].(*LoxInstance)
+	span, known := native.codemod.spans[node]
+	if !ok || !known {
+		throwRuntimeError(interpreter.callSite(), fmt.Sprintf("Can only %s nodes with a known position.", native.nativeName))
+	}
+
+	text := ""
+	if native.nativeName == "replace" {
+		if text, ok = arguments[1].(string); !ok {
+			throwTypedError(TypeError, interpreter.callSite(), "Replacement text must be a string.")
+		}
+	}
+
+	native.codemod.edits = append(native.codemod.edits, AstEdit{Start: span[0], End: span[1], Text: text})
+	return nil
+}
+
+func (native *codemodNative) callableType() references.FunctionType {
+	return references.Function
+}
+
+func (native *codemodNative) String() string {
+	return "<native fn>"
+}
+
+func (native *codemodNative) name() string {
+	return native.nativeName
+}
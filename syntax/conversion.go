@@ -0,0 +1,70 @@
+package syntax
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// defineConversions adds the natives that convert values between strings,
+// numbers and booleans.
+func defineConversions(env *Environment) {
+	env.define("str", NewNativeFunction("str", 1, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		return interpreter.display(arguments[0])
+	}))
+
+	env.define("num", NewNativeFunction("num", 1, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		switch value := arguments[0].(type) {
+		case int64, float64:
+			return value
+		case string:
+			if number, ok := parseNumber(value); ok {
+				return number
+			}
+
+			return nil
+		}
+
+		throwTypedError(TypeError, interpreter.callSite(), "num() expects a string or a number.")
+		return nil
+	}))
+
+	env.define("bool", NewNativeFunction("bool", 1, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		return isTruthy(arguments[0])
+	}))
+}
+
+// parseNumber reads a decimal, 0x or 0b number, as an int64 when it has no
+// decimal point or exponent. Surrounding whitespace and a leading sign are
+// allowed.
+func parseNumber(text string) (interface{}, bool) {
+	text = strings.TrimSpace(text)
+	digits := strings.TrimLeft(text, "+-")
+	if len(text)-len(digits) > 1 || digits == "" {
+		return nil, false
+	}
+
+	if len(digits) > 2 && digits[0] == '0' && strings.ContainsAny(digits[1:2], "xXbB") {
+		// Base 0 reads the 0x and 0b prefixes and their '_' separators.
+		if integer, err := strconv.ParseInt(text, 0, 64); err == nil {
+			return integer, true
+		}
+
+		return nil, false
+	}
+
+	if digits[0] != '.' && (digits[0] < '0' || digits[0] > '9') {
+		return nil, false
+	}
+
+	if integer, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return integer, true
+	}
+
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsInf(number, 0) {
+		return nil, false
+	}
+
+	return number, true
+}
@@ -0,0 +1,184 @@
+package syntax
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type coveredFile struct {
+	path   string
+	source string
+	// statements lists every statement in the file with a source line, so
+	// the ones that never ran are known.
+	statements []Stmt
+}
+
+// Coverage records how many times each statement of the files it was given
+// runs, for a listing of the lines that ran or an LCOV file.
+type Coverage struct {
+	NopHook
+	// lock guards the counts, which the tasks a script spawns add to as
+	// well.
+	lock   sync.Mutex
+	files  []*coveredFile
+	fileOf map[Stmt]*coveredFile
+	counts map[Stmt]int
+}
+
+func NewCoverage() *Coverage {
+	return &Coverage{
+		fileOf: map[Stmt]*coveredFile{},
+		counts: map[Stmt]int{},
+	}
+}
+
+// SetCoverage starts recording which statements run. Passing nil stops it.
+func (interpreter *Interpreter) SetCoverage(coverage *Coverage) {
+	interpreter.coverage = coverage
+	interpreter.collectHooks()
+}
+
+func (interpreter *Interpreter) Coverage() *Coverage {
+	return interpreter.coverage
+}
+
+// AddFile tells the coverage about a parsed file, so that its statements
+// are counted under path.
+func (coverage *Coverage) AddFile(path string, source string, statements []Stmt) {
+	coverage.lock.Lock()
+	defer coverage.lock.Unlock()
+
+	file := &coveredFile{path: path, source: source}
+	walkStatements(statements, func(stmt Stmt) {
+		if _, _, ok := StmtTokens(stmt); ok {
+			file.statements = append(file.statements, stmt)
+			coverage.fileOf[stmt] = file
+		}
+	})
+
+	coverage.files = append(coverage.files, file)
+}
+
+// walkStatements visits statements and the statements nested in them, in
+// source order. Class fields are left out, as they run with the class's
+// initializer rather than as statements.
+func walkStatements(statements []Stmt, visit func(stmt Stmt)) {
+	for _, stmt := range statements {
+		visit(stmt)
+		switch s := stmt.(type) {
+		case *Block:
+			walkStatements(s.statements, visit)
+		case *Function:
+			walkStatements(s.body, visit)
+		case *Class:
+			for _, method := range s.methods {
+				walkStatements(method.body, visit)
+			}
+		case *IfCmd:
+			walkStatements([]Stmt{s.thenBranch}, visit)
+			if s.elseBranch != nil {
+				walkStatements([]Stmt{s.elseBranch}, visit)
+			}
+		case *WhileLoop:
+			walkStatements([]Stmt{s.body}, visit)
+		case *ForIn:
+			walkStatements([]Stmt{s.body}, visit)
+		case *SwitchCmd:
+			for _, c := range s.cases {
+				walkStatements(c.body, visit)
+			}
+		case *Match:
+			for _, arm := range s.arms {
+				walkStatements([]Stmt{arm.body}, visit)
+			}
+		}
+	}
+}
+
+func (coverage *Coverage) BeforeStatement(point *StopPoint) {
+	coverage.lock.Lock()
+	defer coverage.lock.Unlock()
+
+	if _, ok := coverage.fileOf[point.Stmt]; ok {
+		coverage.counts[point.Stmt]++
+	}
+}
+
+// lineCounts returns how many times each line with a statement on it ran,
+// which for a line holding several statements is the most any of them ran.
+func (coverage *Coverage) lineCounts(file *coveredFile) map[int]int {
+	lines := map[int]int{}
+	for _, stmt := range file.statements {
+		start, _, _ := StmtTokens(stmt)
+		if count := coverage.counts[stmt]; count > lines[start.Line] {
+			lines[start.Line] = count
+		} else if _, ok := lines[start.Line]; !ok {
+			lines[start.Line] = 0
+		}
+	}
+
+	return lines
+}
+
+// Report lists each file with how many times each line ran in the margin.
+// Lines that never ran are marked with #####, and lines without statements
+// with a dash.
+func (coverage *Coverage) Report(out io.Writer) {
+	coverage.lock.Lock()
+	defer coverage.lock.Unlock()
+
+	for _, file := range coverage.files {
+		lines := coverage.lineCounts(file)
+		hit := 0
+		for _, count := range lines {
+			if count > 0 {
+				hit++
+			}
+		}
+
+		fmt.Fprintf(out, "%s: %d of %d lines run\n", file.path, hit, len(lines))
+		for i, text := range strings.Split(strings.TrimSuffix(file.source, "\n"), "\n") {
+			count, ok := lines[i+1]
+			margin := "-"
+			if ok && count == 0 {
+				margin = "#####"
+			} else if ok {
+				margin = fmt.Sprintf("%d", count)
+			}
+
+			fmt.Fprintf(out, "%9s %5d | %s\n", margin, i+1, text)
+		}
+	}
+}
+
+// WriteLcov writes the coverage in the LCOV tracefile format.
+func (coverage *Coverage) WriteLcov(out io.Writer) {
+	coverage.lock.Lock()
+	defer coverage.lock.Unlock()
+
+	for _, file := range coverage.files {
+		lines := coverage.lineCounts(file)
+		numbers := make([]int, 0, len(lines))
+		for line := range lines {
+			numbers = append(numbers, line)
+		}
+		sort.Ints(numbers)
+
+		fmt.Fprintln(out, "TN:")
+		fmt.Fprintf(out, "SF:%s\n", file.path)
+		hit := 0
+		for _, line := range numbers {
+			fmt.Fprintf(out, "DA:%d,%d\n", line, lines[line])
+			if lines[line] > 0 {
+				hit++
+			}
+		}
+
+		fmt.Fprintf(out, "LF:%d\n", len(numbers))
+		fmt.Fprintf(out, "LH:%d\n", hit)
+		fmt.Fprintln(out, "end_of_record")
+	}
+}
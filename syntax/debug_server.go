@@ -0,0 +1,32 @@
+package syntax
+
+import (
+	"fmt"
+	"net"
+)
+
+// ServeDebugger listens on addr and attaches a debugger to the interpreter
+// for each client that connects, speaking the same line-based commands as the
+// interactive debugger. A new client replaces the previous one.
+func (interpreter *Interpreter) ServeDebugger(addr string) (net.Addr, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			fmt.Fprintf(conn, "Attached to golox. Type 'help' for a list of commands.\n")
+			debugger := NewConsoleDebugger(interpreter, conn, conn)
+			debugger.Pause()
+			interpreter.Attach(debugger)
+		}
+	}()
+
+	return listener.Addr(), nil
+}
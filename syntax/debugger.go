@@ -0,0 +1,328 @@
+package syntax
+
+import (
+	"bufio"
+	"fmt"
+	"golox/scanner"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type callFrame struct {
+	name  string
+	token *scanner.Token
+	env   *Environment
+}
+
+type stackFrame struct {
+	name string
+	line int
+	env  *Environment
+}
+
+// Debugger is told about each statement before it runs and can hold the
+// script there until it returns. ConsoleDebugger is the line-based one;
+// another frontend, such as one speaking the Debug Adapter Protocol, can
+// implement it instead.
+type Debugger interface {
+	BeforeStatement(point *StopPoint)
+}
+
+// stepMode is how far a step command lets the script run before it stops
+// again.
+type stepMode int
+
+const (
+	stepNone stepMode = iota
+	// stepInto stops at the next statement, even inside a call.
+	stepInto
+	// stepOver stops at the next statement that isn't inside a call.
+	stepOver
+	// stepOut stops once the current call returns.
+	stepOut
+)
+
+// stopScript is thrown to end the script quietly, as when the user quits a
+// live debugging session or asks the script for its --help.
+type stopScript struct{}
+
+type ConsoleDebugger struct {
+	interpreter *Interpreter
+	in          *bufio.Reader
+	out         io.Writer
+	frames      []*stackFrame
+	current     int
+	live        bool
+	step        stepMode
+	stepDepth   int
+	depth       int
+	breakpoints []*breakpoint
+	watchpoints []*watchpoint
+	nextID      int
+	evaluating  bool
+	detached    bool
+	heapStart   *HeapCensus
+}
+
+func NewConsoleDebugger(interpreter *Interpreter, in io.Reader, out io.Writer) *ConsoleDebugger {
+	return &ConsoleDebugger{
+		interpreter: interpreter,
+		in:          bufio.NewReader(in),
+		out:         out,
+		nextID:      1,
+	}
+}
+
+// snapshot builds the debugger's view of the call stack, innermost frame
+// first, from the interpreter's active call frames and the line that is
+// currently executing.
+func (debugger *ConsoleDebugger) snapshot(line int) {
+	interpreter := debugger.interpreter
+	debugger.frames = nil
+	debugger.current = 0
+
+	env := interpreter.env
+	for i := len(interpreter.frames) - 1; i >= 0; i-- {
+		frame := interpreter.frames[i]
+		debugger.frames = append(debugger.frames, &stackFrame{name: frame.name, line: line, env: env})
+		line = frame.token.Line
+		env = frame.env
+	}
+
+	debugger.frames = append(debugger.frames, &stackFrame{name: "<script>", line: line, env: env})
+}
+
+func (debugger *ConsoleDebugger) postMortem(err *RuntimeError) {
+	debugger.live = false
+	debugger.snapshot(err.token.Line)
+
+	fmt.Fprintf(debugger.out, "Post-mortem debugging: %s\n", err.Error())
+	debugger.printFrame(debugger.current)
+	debugger.prompt()
+}
+
+// Pause makes the debugger stop before the next statement runs.
+func (debugger *ConsoleDebugger) Pause() {
+	debugger.step = stepInto
+}
+
+// stop pauses a running script at the given line and hands control to the
+// user until they continue or step.
+func (debugger *ConsoleDebugger) stop(line int, reason string) {
+	debugger.live = true
+	debugger.step = stepNone
+	debugger.snapshot(line)
+
+	fmt.Fprintln(debugger.out, reason)
+	debugger.printFrame(debugger.current)
+	debugger.prompt()
+}
+
+// prompt reads debugger commands until the user asks to continue or quit.
+func (debugger *ConsoleDebugger) prompt() {
+	for {
+		fmt.Fprint(debugger.out, "(debug) ")
+
+		line, err := debugger.in.ReadString('\n')
+		if err != nil && line == "" {
+			// The client went away, so let the script run on untouched.
+			debugger.detached = true
+			return
+		}
+
+		line = strings.TrimSpace(line)
+		command, args := line, ""
+		if i := strings.Index(line, " "); i >= 0 {
+			command, args = line[:i], strings.TrimSpace(line[i+1:])
+		}
+
+		switch command {
+		case "":
+			break
+		case "bt", "backtrace":
+			debugger.backtrace()
+		case "frame", "f":
+			n, err := strconv.Atoi(args)
+			if err != nil || n < 0 || n >= len(debugger.frames) {
+				fmt.Fprintf(debugger.out, "Invalid frame '%s'.\n", args)
+				break
+			}
+
+			debugger.current = n
+			debugger.printFrame(n)
+		case "up":
+			if debugger.current+1 < len(debugger.frames) {
+				debugger.current++
+			}
+			debugger.printFrame(debugger.current)
+		case "down":
+			if debugger.current > 0 {
+				debugger.current--
+			}
+			debugger.printFrame(debugger.current)
+		case "locals":
+			debugger.locals()
+		case "print", "p":
+			debugger.print(args)
+		case "break", "b":
+			debugger.addBreakpoint(args)
+		case "watch", "w":
+			debugger.addWatchpoint(args)
+		case "delete", "d":
+			debugger.deletePoint(args)
+		case "info", "i":
+			debugger.info()
+		case "heapdiff":
+			debugger.heapDiff(args)
+		case "help", "h":
+			debugger.help()
+		case "step", "s":
+			debugger.step, debugger.stepDepth = stepInto, debugger.depth
+			return
+		case "next", "n":
+			debugger.step, debugger.stepDepth = stepOver, debugger.depth
+			return
+		case "finish":
+			debugger.step, debugger.stepDepth = stepOut, debugger.depth
+			return
+		case "continue", "c":
+			return
+		case "quit", "q":
+			if debugger.live {
+				panic(stopScript{})
+			}
+			return
+		default:
+			fmt.Fprintf(debugger.out, "Unknown command '%s'. Type 'help' for a list of commands.\n", command)
+		}
+	}
+}
+
+func (debugger *ConsoleDebugger) help() {
+	fmt.Fprintln(debugger.out, "bt, backtrace    show the call stack")
+	fmt.Fprintln(debugger.out, "frame <n>        select frame n")
+	fmt.Fprintln(debugger.out, "up, down         move to the calling or called frame")
+	fmt.Fprintln(debugger.out, "locals           show the variables in the selected frame")
+	fmt.Fprintln(debugger.out, "print <expr>     evaluate an expression in the selected frame")
+	fmt.Fprintln(debugger.out, "break <line> [hit <n>] [if <expr>]")
+	fmt.Fprintln(debugger.out, "                 stop at a line, optionally on the nth hit or when expr is truthy")
+	fmt.Fprintln(debugger.out, "watch <name>     stop when a variable or field (name.field) changes value")
+	fmt.Fprintln(debugger.out, "delete <id>      remove a breakpoint or watchpoint")
+	fmt.Fprintln(debugger.out, "info             list breakpoints and watchpoints")
+	fmt.Fprintln(debugger.out, "heapdiff start   count live instances and environments")
+	fmt.Fprintln(debugger.out, "heapdiff report  show how those counts changed since 'heapdiff start'")
+	fmt.Fprintln(debugger.out, "step             run to the next statement, going into calls")
+	fmt.Fprintln(debugger.out, "next             run to the next statement, stepping over calls")
+	fmt.Fprintln(debugger.out, "finish           run until the current call returns")
+	fmt.Fprintln(debugger.out, "continue         resume the script")
+	fmt.Fprintln(debugger.out, "quit             stop the script and leave the debugger")
+}
+
+func (debugger *ConsoleDebugger) heapDiff(args string) {
+	switch args {
+	case "start":
+		debugger.heapStart = debugger.interpreter.TakeHeapCensus()
+		fmt.Fprintln(debugger.out, "Heap census taken.")
+	case "report":
+		if debugger.heapStart == nil {
+			fmt.Fprintln(debugger.out, "Run 'heapdiff start' first.")
+			return
+		}
+
+		debugger.interpreter.TakeHeapCensus().Report(debugger.heapStart, debugger.out)
+	default:
+		fmt.Fprintln(debugger.out, "Usage: heapdiff start|report")
+	}
+}
+
+func (debugger *ConsoleDebugger) backtrace() {
+	for i := range debugger.frames {
+		marker := " "
+		if i == debugger.current {
+			marker = "*"
+		}
+
+		fmt.Fprintf(debugger.out, "%s", marker)
+		debugger.printFrame(i)
+	}
+}
+
+func (debugger *ConsoleDebugger) printFrame(n int) {
+	frame := debugger.frames[n]
+	fmt.Fprintf(debugger.out, "#%d %s at line %d\n", n, frame.name, frame.line)
+}
+
+func (debugger *ConsoleDebugger) locals() {
+	// The script frame's locals are the globals.
+	last := debugger.current == len(debugger.frames)-1
+	for env := debugger.frames[debugger.current].env; env != nil && (last || env != debugger.interpreter.globals); env = env.enclosing {
+		names := make([]string, 0, len(env.values))
+		for name := range env.values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			fmt.Fprintf(debugger.out, "%s = %s\n", name, stringify(env.values[name]))
+		}
+	}
+}
+
+func (debugger *ConsoleDebugger) print(source string) {
+	if value, ok := debugger.evaluate(source); ok {
+		fmt.Fprintln(debugger.out, stringify(value))
+	}
+}
+
+// evaluate parses and evaluates a Lox expression in the selected frame's
+// environment. Variables are looked up dynamically since the expression is
+// never resolved. Errors have already been reported when ok is false.
+func (debugger *ConsoleDebugger) evaluate(source string) (value interface{}, ok bool) {
+	expr, ok := debugger.parse(source)
+	if !ok {
+		return nil, false
+	}
+
+	return debugger.evaluateIn(expr, debugger.frames[debugger.current].env)
+}
+
+func (debugger *ConsoleDebugger) parse(source string) (expr Expr, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+		}
+	}()
+
+	parser := NewAstParser(scanner.NewScanner(source).ScanTokens())
+	parser.SetInterpreter(debugger.interpreter)
+	expr = parser.expression()
+	if !parser.isAtEnd() {
+		throwError(parser.peek(), "Expect end of expression.")
+	}
+
+	return expr, true
+}
+
+func (debugger *ConsoleDebugger) evaluateIn(expr Expr, env *Environment) (value interface{}, ok bool) {
+	interpreter := debugger.interpreter
+	previous := interpreter.env
+	frames := len(interpreter.frames)
+	debugger.evaluating = true
+
+	defer func() {
+		interpreter.env = previous
+		interpreter.frames = interpreter.frames[:frames]
+		debugger.evaluating = false
+		if r := recover(); r != nil {
+			if _, isErr := r.(error); !isErr {
+				fmt.Fprintln(debugger.out, "Could not evaluate expression.")
+			}
+			ok = false
+		}
+	}()
+
+	interpreter.env = env
+	return interpreter.evaluate(expr), true
+}
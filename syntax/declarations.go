@@ -0,0 +1,72 @@
+package syntax
+
+import "golox/scanner"
+
+// Declaration describes a function, class or method declared at the top
+// level of a program, for tools that list or compare what a program
+// defines.
+type Declaration struct {
+	// Kind is "function", "class", "method", "static method" or "getter".
+	Kind string
+	// Name is qualified with the class name for methods, as in Point.move.
+	Name string
+	// Params holds parameter names for functions and methods, and the
+	// superclass followed by any traits for classes.
+	Params []string
+	Start  *scanner.Token
+	End    *scanner.Token
+}
+
+// Declarations lists the top-level functions and classes of a program in
+// source order, each class followed by its methods.
+func Declarations(statements []Stmt) []*Declaration {
+	var declarations []*Declaration
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *Function:
+			declarations = append(declarations, newDeclaration("function", s.name.Lexeme, lexemeList(s.params), s))
+		case *Class:
+			var bases []string
+			if s.superclass != nil {
+				bases = append(bases, s.superclass.name.Lexeme)
+			}
+			for _, trait := range s.traits {
+				bases = append(bases, trait.name.Lexeme)
+			}
+
+			declarations = append(declarations, newDeclaration("class", s.name.Lexeme, bases, s))
+			for _, method := range s.methods {
+				kind := "method"
+				if method.isStatic {
+					kind = "static method"
+				} else if method.isGetter {
+					kind = "getter"
+				}
+
+				declarations = append(declarations, newDeclaration(kind, s.name.Lexeme+"."+method.name.Lexeme, lexemeList(method.params), method))
+			}
+		}
+	}
+
+	return declarations
+}
+
+func newDeclaration(kind string, name string, params []string, stmt Stmt) *Declaration {
+	start, end, _ := StmtTokens(stmt)
+	return &Declaration{
+		Kind:   kind,
+		Name:   name,
+		Params: params,
+		Start:  start,
+		End:    end,
+	}
+}
+
+func lexemeList(tokens []*scanner.Token) []string {
+	var names []string
+	for _, token := range tokens {
+		names = append(names, token.Lexeme)
+	}
+
+	return names
+}
@@ -0,0 +1,34 @@
+package syntax
+
+// deferredAction is an expression a defer statement put off until its
+// function returns, along with the scope it was deferred in.
+type deferredAction struct {
+	expression Expr
+	env        *Environment
+}
+
+func (interpreter *Interpreter) visitDeferCmdStmt(stmt *DeferCmd) interface{} {
+	interpreter.deferred = append(interpreter.deferred, &deferredAction{
+		expression: stmt.expression,
+		env:        interpreter.env,
+	})
+
+	return nil
+}
+
+// runDeferred runs the current call's deferred expressions, newest first.
+// The rest still run if one of them fails.
+func (interpreter *Interpreter) runDeferred() {
+	if len(interpreter.deferred) == 0 {
+		return
+	}
+
+	action := interpreter.deferred[len(interpreter.deferred)-1]
+	interpreter.deferred = interpreter.deferred[:len(interpreter.deferred)-1]
+	defer interpreter.runDeferred()
+
+	previous := interpreter.env
+	interpreter.env = action.env
+	interpreter.evaluate(action.expression)
+	interpreter.env = previous
+}
@@ -0,0 +1,150 @@
+package syntax
+
+import (
+	"fmt"
+	"golox/references"
+	"golox/scanner"
+	"sort"
+)
+
+// Warning is a problem the resolver found that doesn't stop the program
+// from running.
+type Warning struct {
+	Token   *scanner.Token
+	Message string
+}
+
+// markDeprecated records the hint of a function, class or method marked
+// @deprecated. The hint is empty when the annotation has no message.
+func markDeprecated(stmt Stmt, hint string) {
+	switch s := stmt.(type) {
+	case *Function:
+		s.deprecated, s.deprecation = true, hint
+	case *Class:
+		s.deprecated, s.deprecation = true, hint
+	}
+}
+
+// deprecation returns the hint markDeprecated recorded for stmt.
+func deprecation(stmt Stmt) (string, bool) {
+	switch s := stmt.(type) {
+	case *Function:
+		return s.deprecation, s.deprecated
+	case *Class:
+		return s.deprecation, s.deprecated
+	}
+
+	return "", false
+}
+
+func deprecationMessage(name string, hint string) string {
+	if hint == "" {
+		return fmt.Sprintf("'%s' is deprecated.", name)
+	}
+
+	return fmt.Sprintf("'%s' is deprecated: %s", name, hint)
+}
+
+// propertyRead is a property read by name. class names the class the
+// receiver is known to be, or one of its instances, and is empty when the
+// resolver can't tell. static is set when the receiver is the class itself.
+type propertyRead struct {
+	name   *scanner.Token
+	class  string
+	static bool
+}
+
+// readProperty records a read of name from object for Warnings. The
+// receiver's class is known for 'this', a class named directly and an
+// instance made with 'new' on the spot.
+func (resolver *Resolver) readProperty(object Expr, name *scanner.Token) {
+	read := &propertyRead{name: name}
+	switch o := object.(type) {
+	case *This:
+		read.class = resolver.class.name.Lexeme
+	case *Call:
+		if callee, ok := o.callee.(*Variable); ok && callee.t == references.Klass {
+			read.class = callee.name.Lexeme
+		}
+	case *Variable:
+		read.class, read.static = resolver.className(o.name.Lexeme), true
+	}
+
+	resolver.properties = append(resolver.properties, read)
+}
+
+// className returns name when the innermost declaration of name in scope
+// is a class, and otherwise an empty string.
+func (resolver *Resolver) className(name string) string {
+	for i := resolver.scopes.Len() - 1; i >= 0; i-- {
+		scope := resolver.scopes.Get(i).(map[string]*VariableData)
+		if _, ok := scope[buildKey(name, references.Klass)]; ok {
+			return name
+		}
+
+		if _, ok := lookupKey(scope, name, references.None); ok {
+			return ""
+		}
+	}
+
+	return ""
+}
+
+// findMethod looks a method up the way the interpreter would: in the class,
+// then the traits it includes, then its superclass. It returns nil when the
+// class or the method isn't declared in the program.
+func (resolver *Resolver) findMethod(class string, name string, static bool, seen map[string]bool) *Function {
+	stmt, ok := resolver.classes[class]
+	if !ok || seen[class] {
+		return nil
+	}
+
+	seen[class] = true
+	for _, method := range stmt.methods {
+		if method.name.Lexeme == name && method.isStatic == static {
+			return method
+		}
+	}
+
+	for _, trait := range stmt.traits {
+		if method := resolver.findMethod(trait.name.Lexeme, name, static, seen); method != nil {
+			return method
+		}
+	}
+
+	if stmt.superclass != nil {
+		return resolver.findMethod(stmt.superclass.name.Lexeme, name, static, seen)
+	}
+
+	return nil
+}
+
+// Warnings lists the uses of deprecated functions, classes and methods in
+// the program last resolved, in source order. A method is only reported
+// when the class of its receiver is known and the method it finds there
+// is deprecated.
+func (resolver *Resolver) Warnings() []*Warning {
+	var warnings []*Warning
+	for _, symbol := range resolver.symbols.Symbols {
+		if !symbol.Deprecated {
+			continue
+		}
+
+		for _, token := range symbol.References {
+			warnings = append(warnings, &Warning{Token: token, Message: deprecationMessage(symbol.Name, symbol.DeprecationHint)})
+		}
+	}
+
+	for _, read := range resolver.properties {
+		method := resolver.findMethod(read.class, read.name.Lexeme, read.static, map[string]bool{})
+		if method != nil && method.deprecated {
+			warnings = append(warnings, &Warning{Token: read.name, Message: deprecationMessage(read.name.Lexeme, method.deprecation)})
+		}
+	}
+
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return warnings[i].Token.Offset < warnings[j].Token.Offset
+	})
+
+	return warnings
+}
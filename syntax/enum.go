@@ -0,0 +1,98 @@
+package syntax
+
+import (
+	"fmt"
+	"golox/scanner"
+)
+
+// LoxEnum is the value an enum declaration defines. Its members are read
+// as properties, such as Color.Red, and for-in visits them in the order
+// they were declared.
+type LoxEnum struct {
+	enumName string
+	members  []*LoxEnumMember
+	byName   map[string]*LoxEnumMember
+}
+
+// LoxEnumMember is one of an enum's constants. Each is a single value, so
+// members compare equal only to themselves.
+type LoxEnumMember struct {
+	enum    *LoxEnum
+	name    string
+	ordinal int
+}
+
+func NewLoxEnum(name string, members []string) *LoxEnum {
+	enum := &LoxEnum{
+		enumName: name,
+		byName:   make(map[string]*LoxEnumMember, len(members)),
+	}
+
+	for i, member := range members {
+		m := &LoxEnumMember{enum: enum, name: member, ordinal: i}
+		enum.members = append(enum.members, m)
+		enum.byName[member] = m
+	}
+
+	return enum
+}
+
+func (interpreter *Interpreter) visitEnumStmt(stmt *Enum) interface{} {
+	members := make([]string, len(stmt.members))
+	for i, member := range stmt.members {
+		members[i] = member.Lexeme
+	}
+
+	enum := NewLoxEnum(stmt.name.Lexeme, members)
+	if interpreter.env == interpreter.globals {
+		interpreter.env.defineConstant(stmt.name.Lexeme, enum)
+	} else {
+		interpreter.env.define(stmt.name.Lexeme, enum)
+	}
+
+	return nil
+}
+
+func (enum *LoxEnum) get(name *scanner.Token) interface{} {
+	if member, ok := enum.byName[name.Lexeme]; ok {
+		return member
+	}
+
+	throwTypedError(NameError, name, fmt.Sprintf("Undefined member '%s' in enum %s.", name.Lexeme, enum.enumName))
+	return nil
+}
+
+func (enum *LoxEnum) iterator() loxIterator {
+	elements := make([]interface{}, len(enum.members))
+	for i, member := range enum.members {
+		elements[i] = member
+	}
+
+	return NewLoxList(elements).iterator()
+}
+
+func (enum *LoxEnum) String() string {
+	return "<enum " + enum.enumName + ">"
+}
+
+// get returns the member's methods: name(), the name it was declared with,
+// and ordinal(), its position in the enum counting from 0.
+func (member *LoxEnumMember) get(name *scanner.Token) interface{} {
+	switch name.Lexeme {
+	case "name":
+		return NewNativeFunction("name", 0, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+			return member.name
+		})
+	case "ordinal":
+		return NewNativeFunction("ordinal", 0, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+			return int64(member.ordinal)
+		})
+	}
+
+	throwTypedError(NameError, name, fmt.Sprintf("Undefined property '%s' in %s.", name.Lexeme, member.enum.enumName))
+	return nil
+}
+
+func (member *LoxEnumMember) String() string {
+	return member.enum.enumName + "." + member.name
+}
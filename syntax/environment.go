@@ -8,26 +8,29 @@ import (
 var level = -1
 
 type Environment struct {
-	enclosing  *Environment
-	exit       bool
-	continuing bool
-	values     map[string]interface{}
-	name       string
+	enclosing *Environment
+	values    map[string]interface{}
+	name      string
+	// constants marks the global constants, whose assignments the resolver
+	// may not have seen when they come from a later REPL line.
+	constants map[string]bool
 }
 
 func NewEnvironment(enclosing *Environment) *Environment {
 	level++
 	return &Environment{
-		enclosing:  enclosing,
-		exit:       false,
-		continuing: false,
-		values:     make(map[string]interface{}),
-		name:       fmt.Sprintf("env: %d", level),
+		enclosing: enclosing,
+		values:    make(map[string]interface{}),
+		name:      fmt.Sprintf("env: %d", level),
 	}
 }
 
 func (env *Environment) assign(name *scanner.Token, value interface{}) {
 	if _, ok := env.values[name.Lexeme]; ok {
+		if env.constants[name.Lexeme] {
+			throwRuntimeError(name, fmt.Sprintf("Can't assign to constant '%s'.", name.Lexeme))
+		}
+
 		env.values[name.Lexeme] = value
 		return
 	}
@@ -37,13 +40,13 @@ func (env *Environment) assign(name *scanner.Token, value interface{}) {
 		return
 	}
 
-	throwRuntimeError(name, fmt.Sprintf("Undefined variable '%s'.", name.Lexeme))
+	throwTypedError(NameError, name, fmt.Sprintf("Undefined variable '%s'.", name.Lexeme))
 }
 
 func (env *Environment) get(name *scanner.Token) interface{} {
 	if value, ok := env.values[name.Lexeme]; ok {
 		if value == nil {
-			throwRuntimeError(name, fmt.Sprintf("Variable '%s' is uninitialized.", name.Lexeme))
+			throwTypedError(NameError, name, fmt.Sprintf("Variable '%s' is uninitialized.", name.Lexeme))
 			return nil
 		}
 
@@ -54,12 +57,22 @@ func (env *Environment) get(name *scanner.Token) interface{} {
 		return env.enclosing.get(name)
 	}
 
-	throwRuntimeError(name, fmt.Sprintf("Undefined variable '%s'.", name.Lexeme))
+	throwTypedError(NameError, name, fmt.Sprintf("Undefined variable '%s'.", name.Lexeme))
 	return nil
 }
 
 func (env *Environment) define(name string, value interface{}) {
 	env.values[name] = value
+	delete(env.constants, name)
+}
+
+func (env *Environment) defineConstant(name string, value interface{}) {
+	env.define(name, value)
+	if env.constants == nil {
+		env.constants = make(map[string]bool)
+	}
+
+	env.constants[name] = true
 }
 
 func (env *Environment) print() {
@@ -0,0 +1,92 @@
+package syntax
+
+import (
+	"fmt"
+	"golox/loxerror"
+	"golox/references"
+	"golox/scanner"
+)
+
+// evalNative is eval(source), which runs source at the top level, where it
+// reads and defines globals like the script calling it. It returns the
+// value of the last statement when that is an expression and nil
+// otherwise. Source that doesn't compile is a runtime error at the call.
+// Globals it defines are there for later calls to eval and later runs, but
+// not for the calling script, which was resolved before they existed.
+var evalNative = NewNativeFunction("eval", 1, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+	source, ok := arguments[0].(string)
+	if !ok {
+		throwTypedError(TypeError, interpreter.callSite(), "eval() expects a string of source.")
+	}
+
+	return interpreter.eval(source)
+})
+
+func defineEval(env *Environment) {
+	env.define("eval", evalNative)
+}
+
+// Eval runs source as eval() does, converting the result with FromLox. A
+// runtime error, including source that doesn't compile, is reported like
+// any other and returned as a *RuntimeError.
+func (interpreter *Interpreter) Eval(source string) (interface{}, error) {
+	return interpreter.callFromHost("eval", evalNative, []interface{}{source})
+}
+
+func (interpreter *Interpreter) eval(source string) interface{} {
+	var statements []Stmt
+	stages := []func(){
+		func() {
+			parser := NewAstParser(evalTokens(source))
+			parser.SetInterpreter(interpreter)
+			statements = parser.Parse()
+		},
+		func() { NewResolver(interpreter).Resolve(statements) },
+		func() { NewChecker().Check(statements) },
+	}
+
+	for _, stage := range stages {
+		for _, diagnostic := range loxerror.Collect(stage) {
+			if diagnostic.Severity == loxerror.SeverityError {
+				throwRuntimeError(interpreter.callSite(), fmt.Sprintf("Error in eval() source at line %d: %s", diagnostic.Span.Line, diagnostic.Message))
+			}
+		}
+	}
+
+	// Errors in the source quote it rather than the calling script.
+	previousSource := loxerror.SetSource(source)
+	previous := interpreter.env
+	interpreter.env = interpreter.globals
+	defer func() {
+		interpreter.env = previous
+		loxerror.SetSource(previousSource)
+	}()
+
+	var value interface{}
+	for i, stmt := range statements {
+		if expression, ok := stmt.(*Expression); ok && i == len(statements)-1 {
+			value = interpreter.evaluate(expression.expression)
+		} else {
+			interpreter.execute(stmt)
+		}
+	}
+
+	return value
+}
+
+// evalTokens scans source, ending it with the ';' an expression such as
+// "a + 1" leaves out.
+func evalTokens(source string) []*scanner.Token {
+	tokens := scanner.NewScanner(source).ScanTokens()
+	if n := len(tokens); n > 1 {
+		switch last := tokens[n-2]; last.Type {
+		case references.Semicolon, references.RightBrace:
+		default:
+			semicolon := scanner.NewToken(references.Semicolon, ";", nil, last.Line)
+			semicolon.Column = last.Column + len(last.Lexeme)
+			tokens = append(tokens[:n-1:n-1], semicolon, tokens[n-1])
+		}
+	}
+
+	return tokens
+}
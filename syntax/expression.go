@@ -14,6 +14,8 @@ type ExprVisitor interface {
 	visitAssignExpr(expr *Assign) interface{}
 	visitBinaryExpr(expr *Binary) interface{}
 	visitCallExpr(expr *Call) interface{}
+	visitSpawnExpr(expr *Spawn) interface{}
+	visitSpreadExpr(expr *Spread) interface{}
 	visitGetMethodExpr(expr *GetMethod) interface{}
 	visitGetFieldExpr(expr *GetField) interface{}
 	visitSetExpr(expr *Set) interface{}
@@ -27,8 +29,11 @@ type ExprVisitor interface {
 }
 
 type Assign struct {
-	name  *scanner.Token
-	value Expr
+	name     *scanner.Token
+	value    Expr
+	depth    *int
+	resolved bool
+	compound *scanner.Token
 }
 
 func NewAssign(name *scanner.Token, value Expr) Expr {
@@ -72,6 +77,7 @@ type Call struct {
 	callee    Expr
 	paren     *scanner.Token
 	arguments []Expr
+	tail      bool
 }
 
 func NewCall(callee Expr, paren *scanner.Token, arguments []Expr) Expr {
@@ -90,15 +96,57 @@ func (call *Call) String() string {
 	return "Call"
 }
 
+type Spawn struct {
+	keyword *scanner.Token
+	call    *Call
+}
+
+func NewSpawn(keyword *scanner.Token, call *Call) Expr {
+	return &Spawn{
+		keyword: keyword,
+		call:    call,
+	}
+}
+
+func (spawn *Spawn) accept(visitor ExprVisitor) interface{} {
+	return visitor.visitSpawnExpr(spawn)
+}
+
+func (spawn *Spawn) String() string {
+	return "Spawn"
+}
+
+type Spread struct {
+	ellipsis   *scanner.Token
+	expression Expr
+}
+
+func NewSpread(ellipsis *scanner.Token, expression Expr) Expr {
+	return &Spread{
+		ellipsis:   ellipsis,
+		expression: expression,
+	}
+}
+
+func (spread *Spread) accept(visitor ExprVisitor) interface{} {
+	return visitor.visitSpreadExpr(spread)
+}
+
+func (spread *Spread) String() string {
+	return "Spread"
+}
+
 type GetMethod struct {
-	object Expr
-	name   *scanner.Token
+	object   Expr
+	name     *scanner.Token
+	optional bool
 }
 
-func NewGetMethod(object Expr, name *scanner.Token) Expr {
+func NewGetMethod(object Expr, name *scanner.Token, optional bool) Expr {
 	return &GetMethod{
-		object: object,
-		name:   name,
+		object:   object,
+		name:     name,
+		optional: optional,
 	}
 }
 
@@ -111,14 +159,16 @@ func (getmethod *GetMethod) String() string {
 }
 
 type GetField struct {
-	object Expr
-	name   *scanner.Token
+	object   Expr
+	name     *scanner.Token
+	optional bool
 }
 
-func NewGetField(object Expr, name *scanner.Token) Expr {
+func NewGetField(object Expr, name *scanner.Token, optional bool) Expr {
 	return &GetField{
-		object: object,
-		name:   name,
+		object:   object,
+		name:     name,
+		optional: optional,
 	}
 }
 
@@ -153,8 +203,10 @@ func (set *Set) String() string {
 }
 
 type Super struct {
-	keyword *scanner.Token
-	method  *scanner.Token
+	keyword  *scanner.Token
+	method   *scanner.Token
+	depth    *int
+	resolved bool
 }
 
 func NewSuper(keyword *scanner.Token, method *scanner.Token) Expr {
@@ -173,7 +225,9 @@ func (super *Super) String() string {
 }
 
 type This struct {
-	keyword *scanner.Token
+	keyword  *scanner.Token
+	depth    *int
+	resolved bool
 }
 
 func NewThis(keyword *scanner.Token) Expr {
@@ -192,6 +246,8 @@ func (this *This) String() string {
 
 type Grouping struct {
 	expression Expr
+	opening    *scanner.Token
+	closing    *scanner.Token
 }
 
 func NewGrouping(expression Expr) Expr {
@@ -210,6 +266,9 @@ func (grouping *Grouping) String() string {
 
 type Literal struct {
 	value interface{}
+	text  string
+	start *scanner.Token
+	end   *scanner.Token
 }
 
 func NewLiteral(value interface{}) Expr {
@@ -269,8 +328,10 @@ func (unary *Unary) String() string {
 }
 
 type Variable struct {
-	name *scanner.Token
-	t    references.FunctionType
+	name     *scanner.Token
+	t        references.FunctionType
+	depth    *int
+	resolved bool
 }
 
 func NewVariable(name *scanner.Token, t references.FunctionType) Expr {
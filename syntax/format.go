@@ -0,0 +1,687 @@
+package syntax
+
+import (
+	"fmt"
+	"golox/references"
+	"golox/scanner"
+	"sort"
+	"strings"
+)
+
+// Format prints a parsed program back as source in the canonical layout:
+// two-space indentation, one statement per line and single spaces around
+// binary operators. Comments stay before or after the statements they were
+// written next to, comments inside a statement stay next to the tokens they
+// follow, and single blank lines between statements are kept.
+func Format(statements []Stmt, comments []*scanner.Trivia) string {
+	f := &formatter{comments: comments, opened: true, methods: map[Stmt]bool{}}
+	f.statements(statements)
+	f.commentsBefore(-1)
+	return f.sb.String()
+}
+
+type formatter struct {
+	sb       strings.Builder
+	indent   int
+	comments []*scanner.Trivia
+	// lastLine is the source line of the last statement or comment written,
+	// and opened is set at the start of the file and of every block. Both
+	// decide where blank lines go.
+	lastLine int
+	opened   bool
+	// breakLine is set after a line comment ends the output, so that what
+	// comes next starts on a new line.
+	breakLine bool
+	// methods holds the functions being printed as class members.
+	methods map[Stmt]bool
+}
+
+func (f *formatter) write(text string) {
+	if f.breakLine && text != "" {
+		f.breakLine = false
+		if !strings.HasPrefix(text, "\n") {
+			f.sb.WriteString("\n" + strings.Repeat("  ", f.indent))
+			text = strings.TrimLeft(text, " ")
+		}
+	}
+
+	f.sb.WriteString(text)
+}
+
+func (f *formatter) newLine() {
+	f.write("\n")
+	f.write(strings.Repeat("  ", f.indent))
+}
+
+// blankLine keeps one blank line before source line when the source had
+// at least one there.
+func (f *formatter) blankLine(line int) {
+	if !f.opened && line > f.lastLine+1 {
+		f.write("\n")
+	}
+
+	f.opened = false
+}
+
+// commentsBefore writes, each on its own line, the comments that come before
+// offset in the source. A negative offset writes all that are left.
+func (f *formatter) commentsBefore(offset int) {
+	for len(f.comments) > 0 && (offset < 0 || f.comments[0].Offset < offset) {
+		comment := f.comments[0]
+		f.comments = f.comments[1:]
+
+		f.blankLine(comment.Line)
+		f.write(strings.Repeat("  ", f.indent))
+		f.write(comment.Text)
+		f.write("\n")
+		f.lastLine = comment.Line + strings.Count(comment.Text, "\n")
+	}
+}
+
+// trailing writes the comments that follow token on its line.
+func (f *formatter) trailing(token *scanner.Token) {
+	for len(f.comments) > 0 && f.comments[0].After == token && f.comments[0].Line == token.Line {
+		comment := f.comments[0]
+		f.comments = f.comments[1:]
+
+		f.write(" " + comment.Text)
+		f.breakLine = comment.Kind == scanner.LineComment
+	}
+}
+
+// opening writes the comments on the line of the opening brace just written.
+func (f *formatter) opening() {
+	if len(f.comments) > 0 && f.comments[0].After != nil && f.comments[0].After.Type == references.LeftBrace {
+		f.trailing(f.comments[0].After)
+	}
+}
+
+// inline returns the comments before offset for writing inside a
+// statement, each followed by a space or, for line comments, a line break
+// and the indentation of a continued line. Before a closing token they are
+// preceded by a space instead, and the token lines up with the statement.
+func (f *formatter) inline(offset int, closing bool) string {
+	text := ""
+	for len(f.comments) > 0 && f.comments[0].Offset < offset {
+		comment := f.comments[0]
+		f.comments = f.comments[1:]
+
+		if closing {
+			text += " "
+		}
+
+		text += comment.Text
+		if comment.Kind == scanner.LineComment && closing {
+			text += "\n" + strings.Repeat("  ", f.indent)
+		} else if comment.Kind == scanner.LineComment {
+			text += "\n" + strings.Repeat("  ", f.indent+1)
+		} else if !closing {
+			text += " "
+		}
+	}
+
+	return text
+}
+
+func (f *formatter) statements(statements []Stmt) {
+	for _, stmt := range statements {
+		f.statementLine(stmt)
+		f.write("\n")
+	}
+}
+
+// statementLine writes a statement on its own line, after the comments
+// above it and followed by one on the same line, without ending the line.
+func (f *formatter) statementLine(stmt Stmt) {
+	start, end, ok := StmtTokens(stmt)
+	if ok {
+		f.commentsBefore(start.Offset)
+		f.blankLine(start.Line)
+	} else {
+		f.opened = false
+	}
+
+	f.write(strings.Repeat("  ", f.indent))
+	f.stmt(stmt)
+
+	if ok {
+		f.trailing(end)
+		f.lastLine = end.Line
+	}
+}
+
+// block writes statements between braces. close is the closing brace, which
+// comments inside the block come before.
+func (f *formatter) block(statements []Stmt, close *scanner.Token) {
+	f.write("{")
+	if len(statements) == 0 && (close == nil || len(f.comments) == 0 || f.comments[0].Offset > close.Offset) {
+		f.write("}")
+		return
+	}
+
+	f.opening()
+	f.write("\n")
+	f.indent++
+	f.opened = true
+	f.statements(statements)
+	if close != nil {
+		f.commentsBefore(close.Offset)
+	}
+	f.indent--
+	f.write(strings.Repeat("  ", f.indent))
+	f.write("}")
+	if close != nil {
+		f.trailing(close)
+	}
+}
+
+func closingBrace(stmt Stmt) *scanner.Token {
+	_, end, ok := StmtTokens(stmt)
+	if !ok || end.Type != references.RightBrace {
+		return nil
+	}
+
+	return end
+}
+
+// body writes the statement a loop or if controls, on the same line when it
+// is a block and indented on the next line otherwise.
+func (f *formatter) body(stmt Stmt) {
+	if block, ok := stmt.(*Block); ok && !isForLoop(stmt) {
+		f.write(" ")
+		f.block(block.statements, closingBrace(stmt))
+		return
+	}
+
+	f.write("\n")
+	f.indent++
+	f.opened = true
+	f.statementLine(stmt)
+	f.indent--
+}
+
+func (f *formatter) stmt(stmt Stmt) {
+	if isForLoop(stmt) {
+		f.forLoop(stmt)
+		return
+	}
+
+	// An annotation comes before 'export', so deprecation writes it.
+	if _, ok := deprecation(stmt); stmt.info().exported && !ok {
+		f.write("export ")
+	}
+
+	switch s := stmt.(type) {
+	case *Block:
+		f.block(s.statements, closingBrace(s))
+	case *Expression:
+		f.write(f.expr(s.expression) + ";")
+	case *Print:
+		f.write("print " + f.expr(s.expression) + ";")
+	case *VarCmd:
+		f.write(f.varCmd(s))
+	case *Unpack:
+		f.write(f.unpack(s))
+	case *Enum:
+		f.enum(s)
+	case *ImportCmd:
+		f.write("import { " + strings.Join(lexemeList(s.names), ", ") + " } from " + s.path.Lexeme + ";")
+	case *ReturnCmd:
+		f.write(f.keywordValue("return", s.value))
+	case *Yield:
+		f.write(f.keywordValue("yield", s.value))
+	case *DeferCmd:
+		f.write("defer " + f.expr(s.expression) + ";")
+	case *BreakCmd:
+		f.write("break" + formatLabel(s.label, " ") + ";")
+	case *ContinueCmd:
+		f.write("continue" + formatLabel(s.label, " ") + ";")
+	case *WhileLoop:
+		f.write(formatLabel(s.label, "") + "while (" + f.expr(s.condition) + ")")
+		f.body(s.body)
+	case *ForIn:
+		f.write(formatLabel(s.label, "") + "for (" + s.name.Lexeme + " in " + f.expr(s.iterable) + ")")
+		f.body(s.body)
+	case *IfCmd:
+		f.ifCmd(s)
+	case *SwitchCmd:
+		f.switchCmd(s)
+	case *Match:
+		f.match(s)
+	case *Function:
+		f.function(s)
+	case *Class:
+		f.class(s)
+	}
+}
+
+func formatLabel(label *scanner.Token, space string) string {
+	if label == nil {
+		return ""
+	}
+
+	if space != "" {
+		return space + label.Lexeme
+	}
+
+	return label.Lexeme + ": "
+}
+
+func (f *formatter) keywordValue(keyword string, value Expr) string {
+	if value == nil {
+		return keyword + ";"
+	}
+
+	return keyword + " " + f.expr(value) + ";"
+}
+
+func (f *formatter) varCmd(s *VarCmd) string {
+	text := "var "
+	if s.constant {
+		text = "const "
+	}
+
+	text += s.name.Lexeme
+	if s.annotation != nil {
+		text += ": " + s.annotation.Lexeme
+	}
+
+	if s.initializer != nil {
+		text += " = " + f.expr(s.initializer)
+	}
+
+	return text + ";"
+}
+
+func (f *formatter) unpack(s *Unpack) string {
+	names := make([]string, len(s.names))
+	for i, name := range s.names {
+		names[i] = name.Lexeme
+	}
+
+	return s.keyword.Lexeme + " (" + strings.Join(names, ", ") + ") = " + f.expr(s.initializer) + ";"
+}
+
+// enum writes an enum with each member on its own line, followed by a
+// comma.
+func (f *formatter) enum(s *Enum) {
+	f.write("enum " + s.name.Lexeme + " {")
+	if len(s.members) == 0 {
+		f.write("}")
+		return
+	}
+
+	f.indent++
+	for _, member := range s.members {
+		f.newLine()
+		f.write(member.Lexeme + ",")
+	}
+
+	f.indent--
+	f.newLine()
+	f.write("}")
+}
+
+// forLoop writes a for loop, which the parser turned into a while loop with
+// an increment, inside a block when it has an initializer.
+func (f *formatter) forLoop(stmt Stmt) {
+	initializer := ";"
+	loop, ok := stmt.(*WhileLoop)
+	if !ok {
+		block := stmt.(*Block)
+		switch s := block.statements[0].(type) {
+		case *VarCmd:
+			initializer = f.varCmd(s)
+		case *Expression:
+			initializer = f.expr(s.expression) + ";"
+		}
+
+		loop = block.statements[1].(*WhileLoop)
+	}
+
+	// A loop without a condition gets a true literal nobody wrote.
+	text := formatLabel(loop.label, "") + "for (" + initializer
+	if literal, ok := loop.condition.(*Literal); ok && literal.text != "" || !isLiteral(loop.condition) {
+		text += " " + f.expr(loop.condition)
+	}
+
+	text += ";"
+	if loop.increment != nil {
+		text += " " + f.expr(loop.increment)
+	}
+
+	f.write(text + ")")
+	f.body(loop.body)
+}
+
+func isLiteral(expr Expr) bool {
+	_, ok := expr.(*Literal)
+	return ok
+}
+
+func (f *formatter) ifCmd(s *IfCmd) {
+	f.write("if (" + f.expr(s.condition) + ")")
+	f.body(s.thenBranch)
+	if s.elseBranch == nil {
+		return
+	}
+
+	if block, ok := s.thenBranch.(*Block); ok && !block.forLoop {
+		f.write(" else")
+	} else {
+		f.newLine()
+		f.write("else")
+	}
+
+	if elseIf, ok := s.elseBranch.(*IfCmd); ok {
+		f.write(" ")
+		f.ifCmd(elseIf)
+		return
+	}
+
+	f.body(s.elseBranch)
+}
+
+func (f *formatter) switchCmd(s *SwitchCmd) {
+	f.write("switch (" + f.expr(s.subject) + ") {")
+	f.opening()
+	f.write("\n")
+	f.indent++
+	f.opened = true
+	for _, c := range s.cases {
+		f.commentsBefore(c.keyword.Offset)
+		f.blankLine(c.keyword.Line)
+		f.write(strings.Repeat("  ", f.indent))
+		if c.value == nil {
+			f.write("default:\n")
+		} else {
+			f.write("case " + f.expr(c.value) + ":\n")
+		}
+		f.lastLine = c.keyword.Line
+
+		f.indent++
+		f.opened = true
+		f.statements(c.body)
+		if c.fallsThrough {
+			// The parser keeps no token for it, but it can only end a case.
+			f.write(strings.Repeat("  ", f.indent) + "fallthrough;\n")
+			f.lastLine++
+		}
+		f.indent--
+	}
+
+	close := closingBrace(s)
+	if close != nil {
+		f.commentsBefore(close.Offset)
+	}
+	f.indent--
+	f.write(strings.Repeat("  ", f.indent) + "}")
+	if close != nil {
+		f.trailing(close)
+	}
+}
+
+func (f *formatter) deprecation(stmt Stmt) {
+	hint, ok := deprecation(stmt)
+	if !ok {
+		return
+	}
+
+	if hint == "" {
+		f.write("@deprecated")
+	} else {
+		f.write(fmt.Sprintf("@deprecated(\"%s\")", hint))
+	}
+
+	f.newLine()
+	if stmt.info().exported {
+		f.write("export ")
+	}
+}
+
+func (f *formatter) function(s *Function) {
+	f.deprecation(s)
+	if !f.methods[s] {
+		f.write("fun ")
+	} else if s.isStatic {
+		f.write("static ")
+	}
+
+	f.write(s.name.Lexeme)
+	if s.isGetter {
+		f.write(" ")
+		f.block(s.body, closingBrace(s))
+		return
+	}
+
+	var params []string
+	for i, param := range s.params {
+		if s.variadic && i == len(s.params)-1 {
+			params = append(params, "..."+param.Lexeme)
+			continue
+		}
+
+		text := f.inline(param.Offset, false) + param.Lexeme
+		if s.paramTypes[i] != nil {
+			text += ": " + s.paramTypes[i].Lexeme
+		}
+
+		if s.defaults[i] != nil {
+			text += " = " + f.expr(s.defaults[i])
+		}
+
+		params = append(params, text)
+	}
+
+	f.write("(" + strings.Join(params, ", ") + ")")
+	if s.returnType != nil {
+		f.write(": " + s.returnType.Lexeme)
+	}
+
+	f.write(" ")
+	f.block(s.body, closingBrace(s))
+}
+
+func (f *formatter) class(s *Class) {
+	f.deprecation(s)
+	f.write("class " + s.name.Lexeme)
+	if s.superclass != nil {
+		f.write(" < " + s.superclass.name.Lexeme)
+	}
+
+	if len(s.traits) > 0 {
+		var traits []string
+		for _, trait := range s.traits {
+			traits = append(traits, trait.name.Lexeme)
+		}
+
+		f.write(" with " + strings.Join(traits, ", "))
+	}
+
+	// Fields and methods are kept apart, so put them back in source order.
+	var members []Stmt
+	for _, field := range s.fields {
+		members = append(members, field)
+	}
+
+	for _, method := range s.methods {
+		members = append(members, method)
+		f.methods[method] = true
+	}
+
+	sort.SliceStable(members, func(i, j int) bool {
+		a, _, aOk := StmtTokens(members[i])
+		b, _, bOk := StmtTokens(members[j])
+		return aOk && bOk && a.Offset < b.Offset
+	})
+
+	f.write(" ")
+	f.block(members, closingBrace(s))
+}
+
+// match writes each arm of a match on its own line, with its body after the
+// arrow.
+func (f *formatter) match(s *Match) {
+	f.write("match (" + f.expr(s.subject) + ") {")
+	f.opening()
+	f.write("\n")
+	f.indent++
+	f.opened = true
+	for _, arm := range s.arms {
+		f.commentsBefore(arm.keyword.Offset)
+		f.blankLine(arm.keyword.Line)
+		f.write(strings.Repeat("  ", f.indent))
+		if arm.pattern == nil {
+			f.write("else -> ")
+		} else {
+			f.write(f.pattern(arm.pattern) + " -> ")
+		}
+
+		f.stmt(arm.body)
+		f.write("\n")
+		if _, end, ok := StmtTokens(arm.body); ok {
+			f.lastLine = end.Line
+		}
+	}
+
+	close := closingBrace(s)
+	if close != nil {
+		f.commentsBefore(close.Offset)
+	}
+	f.indent--
+	f.write(strings.Repeat("  ", f.indent) + "}")
+	if close != nil {
+		f.trailing(close)
+	}
+}
+
+func (f *formatter) pattern(pattern Pattern) string {
+	switch p := pattern.(type) {
+	case *BindingPattern:
+		return p.name.Lexeme
+	case *ValuePattern:
+		return f.expr(p.value)
+	case *TypePattern:
+		text := "is " + p.typeName.Lexeme
+		if p.binding != nil {
+			text += " " + p.binding.Lexeme
+		}
+
+		return text
+	case *ListPattern:
+		var elements []string
+		for _, element := range p.elements {
+			elements = append(elements, f.pattern(element))
+		}
+
+		if p.rest != nil {
+			elements = append(elements, "..."+p.rest.Lexeme)
+		}
+
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *FieldsPattern:
+		var fields []string
+		for i, name := range p.names {
+			if binding, ok := p.patterns[i].(*BindingPattern); ok && binding.name == name {
+				fields = append(fields, name.Lexeme)
+			} else {
+				fields = append(fields, name.Lexeme+": "+f.pattern(p.patterns[i]))
+			}
+		}
+
+		return "{" + strings.Join(fields, ", ") + "}"
+	}
+
+	return ""
+}
+
+func (f *formatter) expr(expr Expr) string {
+	// Comments written before the expression come first, and then the
+	// expression itself, whose parts write the comments inside it.
+	if start, _ := exprTokens(expr); start != nil {
+		if comments := f.inline(start.Offset, false); comments != "" {
+			return comments + f.expr(expr)
+		}
+	}
+
+	switch e := expr.(type) {
+	case *Assign:
+		if operator := e.compound; operator != nil {
+			switch operator.Type {
+			case references.IncrementOne, references.DecrementOne:
+				return e.name.Lexeme + operator.Lexeme
+			}
+
+			return e.name.Lexeme + " " + operator.Lexeme + " " + f.expr(e.value.(*Binary).right)
+		}
+
+		return e.name.Lexeme + " = " + f.expr(e.value)
+	case *Binary:
+		return f.expr(e.left) + " " + e.operator.Lexeme + " " + f.expr(e.right)
+	case *Logical:
+		return f.expr(e.left) + " " + e.operator.Lexeme + " " + f.expr(e.right)
+	case *Call:
+		callee := f.expr(e.callee)
+		if v, ok := e.callee.(*Variable); ok && v.t == references.Klass {
+			callee = "new " + callee
+		}
+
+		var arguments []string
+		for _, argument := range e.arguments {
+			arguments = append(arguments, f.expr(argument))
+		}
+
+		return callee + "(" + strings.Join(arguments, ", ") + f.inline(e.paren.Offset, true) + ")"
+	case *Spawn:
+		return "spawn " + f.expr(e.call)
+	case *Spread:
+		return "..." + f.expr(e.expression)
+	case *GetMethod:
+		return f.expr(e.object) + formatDot(e.optional) + e.name.Lexeme
+	case *GetField:
+		return f.expr(e.object) + formatDot(e.optional) + e.name.Lexeme
+	case *Set:
+		return f.expr(e.object) + "." + e.name.Lexeme + " = " + f.expr(e.value)
+	case *Super:
+		return "super." + e.method.Lexeme
+	case *This:
+		return "this"
+	case *Grouping:
+		text := "(" + f.expr(e.expression)
+		if e.closing != nil {
+			text += f.inline(e.closing.Offset, true)
+		}
+
+		return text + ")"
+	case *Literal:
+		if e.text != "" {
+			return e.text
+		}
+
+		if text, ok := e.value.(string); ok {
+			return "\"" + text + "\""
+		}
+
+		return stringify(e.value)
+	case *Unary:
+		right := f.expr(e.right)
+		// '- -x' must not become the '--' operator.
+		if e.operator.Type == references.Minus && strings.HasPrefix(right, "-") {
+			return e.operator.Lexeme + " " + right
+		}
+
+		return e.operator.Lexeme + right
+	case *Variable:
+		return e.name.Lexeme
+	}
+
+	return ""
+}
+
+func formatDot(optional bool) string {
+	if optional {
+		return "?."
+	}
+
+	return "."
+}
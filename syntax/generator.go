@@ -0,0 +1,242 @@
+package syntax
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// generatorResult is what a generator's goroutine hands back each time it
+// stops: a yielded value, or the end of the body along with any panic that
+// ended it.
+type generatorResult struct {
+	value    interface{}
+	finished bool
+	panicked interface{}
+}
+
+// interpreterState is the part of the interpreter a generator and its
+// caller each need their own copy of while control passes between them.
+type interpreterState struct {
+	env       *Environment
+	frames    []*callFrame
+	generator *generatorBody
+	deferred  []*deferredAction
+}
+
+// LoxGenerator is what calling a function returns when the resolver marked
+// it a generator, because its body yields. The body runs on its own
+// goroutine. Only one side runs at a time: the caller blocks until the body
+// yields or ends, and the body blocks at each yield until the caller asks
+// for the next value.
+type LoxGenerator struct {
+	body     *generatorBody
+	started  bool
+	finished bool
+	hasValue bool
+	value    interface{}
+}
+
+// generatorBody is the part of a generator its goroutine holds on to. The
+// goroutine never refers to the LoxGenerator, so a generator the script
+// drops before it ends can be collected, and its finalizer has the body
+// closed.
+type generatorBody struct {
+	interpreter *Interpreter
+	function    *LoxFunction
+	arguments   []interface{}
+	resume      chan struct{}
+	results     chan generatorResult
+	// cancel is closed to make a body parked at a yield unwind.
+	cancel chan struct{}
+}
+
+func NewLoxGenerator(interpreter *Interpreter, function *LoxFunction, arguments []interface{}) *LoxGenerator {
+	generator := &LoxGenerator{
+		body: &generatorBody{
+			interpreter: interpreter,
+			function:    function,
+			arguments:   arguments,
+			resume:      make(chan struct{}),
+			results:     make(chan generatorResult),
+			cancel:      make(chan struct{}),
+		},
+	}
+
+	runtime.SetFinalizer(generator, (*LoxGenerator).abandon)
+	return generator
+}
+
+func (generator *LoxGenerator) iterator() loxIterator {
+	return generator
+}
+
+func (generator *LoxGenerator) hasNext() bool {
+	if !generator.hasValue && !generator.finished {
+		generator.advance()
+	}
+
+	return generator.hasValue
+}
+
+func (generator *LoxGenerator) next() interface{} {
+	if !generator.hasValue && !generator.finished {
+		generator.advance()
+	}
+
+	value := generator.value
+	generator.value, generator.hasValue = nil, false
+	return value
+}
+
+func (generator *LoxGenerator) String() string {
+	return "<generator " + generator.body.function.name() + ">"
+}
+
+// advance runs the body until it yields or ends, then restores the caller's
+// view of the interpreter. A panic in the body, such as a runtime error, is
+// raised again in the caller.
+func (generator *LoxGenerator) advance() {
+	body := generator.body
+	caller := body.interpreter.saveState()
+	if !generator.started {
+		generator.started = true
+		go body.run()
+	} else {
+		body.resume <- struct{}{}
+	}
+
+	result := <-body.results
+	body.interpreter.restoreState(caller)
+
+	if result.finished {
+		generator.finished = true
+		if result.panicked != nil {
+			panic(result.panicked)
+		}
+
+		return
+	}
+
+	generator.value, generator.hasValue = result.value, true
+}
+
+// abandon runs once the script can no longer reach generator. A body that
+// is still parked at a yield is queued for the interpreter to close, since
+// this runs on the finalizer goroutine.
+func (generator *LoxGenerator) abandon() {
+	if generator.started && !generator.finished {
+		generator.body.interpreter.abandoned.add(generator.body)
+	}
+}
+
+func (body *generatorBody) run() {
+	defer func() {
+		body.results <- generatorResult{finished: true, panicked: recover()}
+	}()
+
+	// The body starts with a copy of the caller's frames, so the two
+	// never append into the same backing array. It starts from its closure
+	// rather than the caller's environment, which would otherwise stay
+	// reachable from this goroutine, and with it the generator.
+	body.interpreter.generator = body
+	body.interpreter.env = body.function.closure
+	body.interpreter.deferred = nil
+	body.interpreter.frames = append([]*callFrame{}, body.interpreter.frames...)
+	body.function.run(body.interpreter, body.arguments)
+}
+
+// yield hands a value to the caller and waits to be resumed or closed.
+func (body *generatorBody) yield(value interface{}) {
+	// The body takes the caller's frames afresh when it resumes instead
+	// of keeping those it last ran under, which may hold the generator.
+	state := body.interpreter.saveState()
+	state.frames = nil
+	body.results <- generatorResult{value: value}
+	canceled := false
+	select {
+	case <-body.resume:
+	case <-body.cancel:
+		canceled = true
+	}
+
+	state.frames = append([]*callFrame{}, body.interpreter.frames...)
+	body.interpreter.restoreState(state)
+	if canceled {
+		// Deferred calls still run as the goroutine unwinds, but recover
+		// sees nothing, so the exit isn't mistaken for a return value.
+		runtime.Goexit()
+	}
+}
+
+// close ends a body parked at a yield, running its deferred calls, and
+// waits for its goroutine to exit. Like advance, it runs in the caller's
+// turn. Errors the deferred calls raise are dropped, as nothing is left to
+// catch them.
+func (body *generatorBody) close() {
+	caller := body.interpreter.saveState()
+	close(body.cancel)
+	<-body.results
+	body.interpreter.restoreState(caller)
+}
+
+// abandonedGenerators queues the bodies of generators dropped before they
+// ended. An interpreter shares its queue with the tasks it spawns, and
+// whichever of them runs next closes the bodies between statements.
+type abandonedGenerators struct {
+	lock    sync.Mutex
+	pending int32
+	bodies  []*generatorBody
+}
+
+func (abandoned *abandonedGenerators) add(body *generatorBody) {
+	abandoned.lock.Lock()
+	defer abandoned.lock.Unlock()
+
+	abandoned.bodies = append(abandoned.bodies, body)
+	atomic.StoreInt32(&abandoned.pending, 1)
+}
+
+func (abandoned *abandonedGenerators) take() []*generatorBody {
+	abandoned.lock.Lock()
+	defer abandoned.lock.Unlock()
+
+	bodies := abandoned.bodies
+	abandoned.bodies = nil
+	atomic.StoreInt32(&abandoned.pending, 0)
+	return bodies
+}
+
+// closeAbandoned closes the generators the finalizers queued since it last
+// ran.
+func (interpreter *Interpreter) closeAbandoned() {
+	for _, body := range interpreter.abandoned.take() {
+		body.close()
+	}
+}
+
+func (interpreter *Interpreter) saveState() interpreterState {
+	return interpreterState{
+		env:       interpreter.env,
+		frames:    interpreter.frames,
+		generator: interpreter.generator,
+		deferred:  interpreter.deferred,
+	}
+}
+
+func (interpreter *Interpreter) restoreState(state interpreterState) {
+	interpreter.env = state.env
+	interpreter.frames = state.frames
+	interpreter.generator = state.generator
+	interpreter.deferred = state.deferred
+}
+
+func (interpreter *Interpreter) visitYieldStmt(stmt *Yield) interface{} {
+	var value interface{}
+	if stmt.value != nil {
+		value = interpreter.evaluate(stmt.value)
+	}
+
+	interpreter.generator.yield(value)
+	return nil
+}
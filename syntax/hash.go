@@ -0,0 +1,178 @@
+package syntax
+
+import (
+	"encoding/binary"
+	"fmt"
+	"golox/references"
+	"golox/scanner"
+	"hash/fnv"
+	"math"
+)
+
+// Equality and hashing keep one contract, which hash() and anything keyed
+// by values rely on: values that are equal have the same hash.
+//
+// nil, booleans and strings are equal by value, and numbers too, so that
+// 1 == 1.0, while NaN equals nothing. Lists are equal when their elements
+// are, in order. Instances are only equal to themselves unless their class
+// defines equals(other), which must return a boolean; such a class must
+// also define hashCode(), returning an integer that is the same for any
+// two instances equals() finds equal. Everything else, such as functions,
+// classes and enum members, is only equal to itself.
+//
+// Hashes are the same on every run, except for instances without
+// hashCode(), which hash by the order they were made in.
+
+// equal compares two values as '==' does once neither operand overloads
+// it, calling the equals methods of instances in lists.
+func (interpreter *Interpreter) equal(operator *scanner.Token, a interface{}, b interface{}) bool {
+	return equalValues(interpreter, operator, a, b)
+}
+
+// equalAt compares two values as an '==' written at site would, using an
+// equals method when one of them has it, for switch cases and match
+// patterns as well as assertions.
+func (interpreter *Interpreter) equalAt(site *scanner.Token, a interface{}, b interface{}) bool {
+	operator := &scanner.Token{Type: references.EqualEqual, Lexeme: "==", Line: site.Line, Column: site.Column}
+	if result, ok := interpreter.overloadedOperator(operator, a, b); ok {
+		return isTruthy(result)
+	}
+
+	return interpreter.equal(operator, a, b)
+}
+
+// isEqual compares two values like equal, but without calling methods,
+// for comparing constants.
+func isEqual(a interface{}, b interface{}) bool {
+	return equalValues(nil, nil, a, b)
+}
+
+func equalValues(interpreter *Interpreter, operator *scanner.Token, a interface{}, b interface{}) bool {
+	switch l := a.(type) {
+	case nil:
+		return b == nil
+	case int64, float64:
+		return isNumber(b) && numbersEqual(a, b)
+	case *LoxList:
+		r, ok := b.(*LoxList)
+		if !ok || len(l.elements) != len(r.elements) {
+			return false
+		}
+
+		for i, element := range l.elements {
+			if interpreter != nil {
+				// operator may be '!=', whose overload negates equals().
+				if result, ok := interpreter.overloadedOperator(operator, element, r.elements[i]); ok {
+					if isTruthy(result) == (operator.Type == references.BangEqual) {
+						return false
+					}
+
+					continue
+				}
+			}
+
+			if !equalValues(interpreter, operator, element, r.elements[i]) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return a == b
+}
+
+func defineHash(env *Environment) {
+	env.define("hash", NewNativeFunction("hash", 1, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		return interpreter.hash(interpreter.callSite(), arguments[0])
+	}))
+}
+
+// hash returns a value's hash, reporting instances that break the
+// contract at token.
+func (interpreter *Interpreter) hash(token *scanner.Token, value interface{}) int64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	writeInt := func(n uint64) {
+		binary.LittleEndian.PutUint64(buf[:], n)
+		h.Write(buf[:])
+	}
+
+	switch v := value.(type) {
+	case nil:
+		h.Write([]byte{'z'})
+	case bool:
+		h.Write([]byte{'b'})
+		if v {
+			writeInt(1)
+		} else {
+			writeInt(0)
+		}
+	case int64, float64:
+		// Integers hash as the float they are compared as, and every NaN
+		// and zero alike.
+		f, _ := toFloat(v)
+		switch {
+		case math.IsNaN(f):
+			f = math.NaN()
+		case f == 0:
+			f = 0
+		}
+
+		h.Write([]byte{'n'})
+		writeInt(math.Float64bits(f))
+	case string:
+		h.Write([]byte{'s'})
+		h.Write([]byte(v))
+	case *LoxList:
+		h.Write([]byte{'l'})
+		for _, element := range v.elements {
+			writeInt(uint64(interpreter.hash(token, element)))
+		}
+	case *LoxInstance:
+		return interpreter.hashInstance(token, v)
+	case *LoxEnumMember:
+		h.Write([]byte{'e'})
+		h.Write([]byte(v.enum.enumName))
+		writeInt(uint64(v.ordinal))
+	case *LoxClass:
+		h.Write([]byte{'c'})
+		h.Write([]byte(v.name()))
+	case LoxCallable:
+		h.Write([]byte{'f'})
+		h.Write([]byte(v.name()))
+	default:
+		h.Write([]byte{'t'})
+		h.Write([]byte(typeName(v)))
+	}
+
+	return int64(h.Sum64())
+}
+
+func (interpreter *Interpreter) hashInstance(token *scanner.Token, instance *LoxInstance) int64 {
+	class := instance.class
+	method := class.findMethod("hashCode")
+	if method == nil {
+		if class.findMethod("equals") != nil {
+			throwTypedError(TypeError, token, fmt.Sprintf("Class '%s' defines equals() but not hashCode(), so its instances can't be hashed.", class.name()))
+		}
+
+		h := fnv.New64a()
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], instance.id)
+		h.Write([]byte{'i'})
+		h.Write(buf[:])
+		return int64(h.Sum64())
+	}
+
+	if method.arity() != 0 {
+		throwTypedError(ArityError, token, "hashCode() must take no arguments.")
+	}
+
+	result, ok := integral(method.bind(instance).call(interpreter, nil))
+	if !ok {
+		throwTypedError(TypeError, token, "hashCode() must return an integer.")
+	}
+
+	return result
+}
@@ -0,0 +1,138 @@
+package syntax
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// HeapCensus counts the Lox instances, by class, and the environments that
+// are reachable from the interpreter at one point in time.
+type HeapCensus struct {
+	instances    map[string]int
+	environments int
+}
+
+type heapWalker struct {
+	census  *HeapCensus
+	visited map[interface{}]bool
+}
+
+// TakeHeapCensus walks everything reachable from the globals, the current
+// environment and the active call frames.
+func (interpreter *Interpreter) TakeHeapCensus() *HeapCensus {
+	walker := &heapWalker{
+		census:  &HeapCensus{instances: map[string]int{}},
+		visited: map[interface{}]bool{},
+	}
+
+	walker.walkEnvironment(interpreter.globals)
+	walker.walkEnvironment(interpreter.env)
+	for _, frame := range interpreter.frames {
+		walker.walkEnvironment(frame.env)
+	}
+
+	return walker.census
+}
+
+func (walker *heapWalker) walkEnvironment(env *Environment) {
+	for ; env != nil && !walker.visited[env]; env = env.enclosing {
+		walker.visited[env] = true
+		walker.census.environments++
+
+		for _, value := range env.values {
+			walker.walkValue(value)
+		}
+	}
+}
+
+func (walker *heapWalker) walkValue(value interface{}) {
+	switch v := value.(type) {
+	case *LoxInstance:
+		if v == nil || walker.visited[v] {
+			return
+		}
+
+		walker.visited[v] = true
+		walker.census.instances[v.class.name()]++
+		walker.walkValue(v.class)
+		for _, field := range v.fields {
+			walker.walkValue(field)
+		}
+	case *LoxList:
+		if v == nil || walker.visited[v] {
+			return
+		}
+
+		walker.visited[v] = true
+		for _, element := range v.elements {
+			walker.walkValue(element)
+		}
+	case *LoxFunction:
+		if v == nil || walker.visited[v] {
+			return
+		}
+
+		walker.visited[v] = true
+		walker.walkEnvironment(v.closure)
+	case *LoxClass:
+		if v == nil || walker.visited[v] {
+			return
+		}
+
+		walker.visited[v] = true
+		for _, method := range v.methods {
+			walker.walkValue(method)
+		}
+		for _, method := range v.staticMethods {
+			walker.walkValue(method)
+		}
+		for _, getter := range v.getters {
+			walker.walkValue(getter)
+		}
+		walker.walkEnvironment(v.closure)
+		walker.walkValue(v.superclass)
+	}
+}
+
+// Report prints how the counts changed since an earlier census, listing the
+// classes that grew the most first.
+func (census *HeapCensus) Report(since *HeapCensus, out io.Writer) {
+	fmt.Fprintf(out, "%-20s %8s %8s %8s\n", "", "before", "after", "change")
+	printCensusLine(out, "<environments>", since.environments, census.environments)
+
+	names := map[string]bool{}
+	for name := range since.instances {
+		names[name] = true
+	}
+	for name := range census.instances {
+		names[name] = true
+	}
+
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		gi := census.instances[sorted[i]] - since.instances[sorted[i]]
+		gj := census.instances[sorted[j]] - since.instances[sorted[j]]
+		if gi != gj {
+			return gi > gj
+		}
+
+		return sorted[i] < sorted[j]
+	})
+
+	for _, name := range sorted {
+		printCensusLine(out, name, since.instances[name], census.instances[name])
+	}
+}
+
+func printCensusLine(out io.Writer, name string, before int, after int) {
+	marker := ""
+	if after > before {
+		marker = "  <- grew"
+	}
+
+	fmt.Fprintf(out, "%-20s %8d %8d %+8d%s\n", name, before, after, after-before, marker)
+}
@@ -0,0 +1,144 @@
+package syntax
+
+import "golox/scanner"
+
+// Hook observes a running script at the points the interpreter instruments:
+// around each statement and each call. The debugger, the hotspot profiler
+// and the tracer are all hooks, and a hook can hold the script by not
+// returning.
+type Hook interface {
+	BeforeStatement(point *StopPoint)
+	AfterStatement(point *StopPoint)
+	Call(call *CallPoint)
+	Return(call *CallPoint, result interface{})
+}
+
+// NopHook ignores everything, for hooks to embed and override only the
+// points they care about.
+type NopHook struct{}
+
+func (NopHook) BeforeStatement(point *StopPoint)           {}
+func (NopHook) AfterStatement(point *StopPoint)            {}
+func (NopHook) Call(call *CallPoint)                       {}
+func (NopHook) Return(call *CallPoint, result interface{}) {}
+
+// StopPoint is a statement about to run: the statement, the token it starts
+// with and its line, the environment it runs in and how many calls deep it
+// is. Token is nil and Line 0 for statements the parser made up.
+type StopPoint struct {
+	Stmt  Stmt
+	Token *scanner.Token
+	Line  int
+	Env   *Environment
+	Depth int
+}
+
+// CallPoint is a call about to be made: the function and its name, the
+// closing parenthesis of the call, the arguments and how many calls are
+// already active. Failed is set by the time a call that ended in an error
+// returns.
+type CallPoint struct {
+	Callee    LoxCallable
+	Name      string
+	Token     *scanner.Token
+	Arguments []interface{}
+	Depth     int
+	Failed    bool
+}
+
+// debuggerHook tells a debugger about statements.
+type debuggerHook struct {
+	NopHook
+	debugger Debugger
+}
+
+func (hook *debuggerHook) BeforeStatement(point *StopPoint) {
+	hook.debugger.BeforeStatement(point)
+}
+
+// AddHook starts telling hook about the statements and calls the script
+// runs, after the hooks already added.
+func (interpreter *Interpreter) AddHook(hook Hook) {
+	interpreter.extraHooks = append(interpreter.extraHooks, hook)
+	interpreter.collectHooks()
+}
+
+// collectHooks lists the hooks to run: the debugger first, so that the time
+// it holds the script isn't counted against a statement, then the
+// profilers, coverage, the tracer and any others.
+func (interpreter *Interpreter) collectHooks() {
+	var hooks []Hook
+	if interpreter.debugger != nil {
+		hooks = append(hooks, &debuggerHook{debugger: interpreter.debugger})
+	}
+
+	if interpreter.hotspots != nil {
+		hooks = append(hooks, interpreter.hotspots)
+	}
+
+	if interpreter.profiler != nil {
+		hooks = append(hooks, interpreter.profiler)
+	}
+
+	if interpreter.coverage != nil {
+		hooks = append(hooks, interpreter.coverage)
+	}
+
+	if interpreter.tracer != nil {
+		hooks = append(hooks, interpreter.tracer)
+	}
+
+	interpreter.hooks = append(hooks, interpreter.extraHooks...)
+}
+
+func (interpreter *Interpreter) stopPoint(stmt Stmt) *StopPoint {
+	point := &StopPoint{Stmt: stmt, Env: interpreter.env, Depth: len(interpreter.frames)}
+	if start, _, ok := StmtTokens(stmt); ok {
+		point.Token, point.Line = start, start.Line
+	}
+
+	return point
+}
+
+// executeHooked runs a statement between the hooks' BeforeStatement and
+// AfterStatement, which runs even when the statement panics.
+func (interpreter *Interpreter) executeHooked(stmt Stmt) {
+	point := interpreter.stopPoint(stmt)
+	hooks := interpreter.hooks
+	for _, hook := range hooks {
+		hook.BeforeStatement(point)
+	}
+
+	defer func() {
+		for i := len(hooks) - 1; i >= 0; i-- {
+			hooks[i].AfterStatement(point)
+		}
+	}()
+
+	if interpreter.scheduler != nil {
+		interpreter.scheduler.tick()
+	}
+
+	stmt.accept(interpreter)
+}
+
+// callHooked makes a call between the hooks' Call and Return, which runs
+// even when the call panics.
+func (interpreter *Interpreter) callHooked(function LoxCallable, paren *scanner.Token, arguments []interface{}) (result interface{}) {
+	call := &CallPoint{Callee: function, Name: function.name(), Token: paren, Arguments: arguments, Depth: len(interpreter.frames) - 1}
+	hooks := interpreter.hooks
+	for _, hook := range hooks {
+		hook.Call(call)
+	}
+
+	call.Failed = true
+	defer func() {
+		for i := len(hooks) - 1; i >= 0; i-- {
+			hooks[i].Return(call, result)
+		}
+	}()
+
+	result = function.call(interpreter, arguments)
+	call.Failed = false
+	return result
+}
@@ -0,0 +1,213 @@
+package syntax
+
+import (
+	"fmt"
+	"golox/references"
+	"golox/scanner"
+	"math"
+	"reflect"
+)
+
+// objectClass is the class of the instances Go maps become, whose fields
+// are the map's entries.
+var objectClass = NewLoxClass("Object", nil, nil, nil, nil, nil, nil)
+
+// Call calls the global function or class name from Go. Arguments are
+// converted with ToLox and the result with FromLox. A runtime error in the
+// call is reported like any other and returned as a *RuntimeError.
+func (interpreter *Interpreter) Call(name string, arguments ...interface{}) (result interface{}, err error) {
+	value, ok := interpreter.globals.values[name]
+	if !ok {
+		return nil, fmt.Errorf("lox: undefined function '%s'", name)
+	}
+
+	function, ok := value.(LoxCallable)
+	if _, instance := value.(*LoxInstance); !ok || instance {
+		return nil, fmt.Errorf("lox: '%s' is not a function or class", name)
+	}
+
+	min, max := arityRange(function)
+	if len(arguments) < min || max != -1 && len(arguments) > max {
+		return nil, fmt.Errorf("lox: wrong number of arguments for '%s': got %d", name, len(arguments))
+	}
+
+	converted := make([]interface{}, len(arguments))
+	for i, argument := range arguments {
+		converted[i] = ToLox(argument)
+	}
+
+	return interpreter.callFromHost(name, function, converted)
+}
+
+// callFromHost runs a call Go made, taking the scheduler's turn while it
+// runs and turning what the call raised into an error.
+func (interpreter *Interpreter) callFromHost(name string, function LoxCallable, arguments []interface{}) (result interface{}, err error) {
+	if interpreter.budget != nil {
+		interpreter.budget.reset()
+	}
+
+	if interpreter.scheduler != nil {
+		interpreter.scheduler.acquire()
+	}
+
+	defer func() {
+		interpreter.removeTemporaries()
+		if interpreter.scheduler != nil {
+			interpreter.scheduler.release()
+		}
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			interpreter.env = interpreter.globals
+			interpreter.frames = nil
+			interpreter.deferred = nil
+			interpreter.toStringDepth = 0
+
+			switch e := r.(type) {
+			case *RuntimeError:
+				err = e
+			case stopScript:
+				err = fmt.Errorf("lox: '%s' stopped the script", name)
+			case error:
+				err = e
+			default:
+				err = fmt.Errorf("lox: %v", r)
+			}
+		}
+	}()
+
+	// Natives report errors at the innermost call, which has no place in
+	// the source when Go made it.
+	token := scanner.NewToken(references.Identifier, name, nil, 0)
+	interpreter.frames = append(interpreter.frames, &callFrame{name: function.name(), token: token, env: interpreter.env})
+	if len(interpreter.hooks) > 0 {
+		result = interpreter.callHooked(function, token, arguments)
+	} else {
+		result = function.call(interpreter, arguments)
+	}
+	interpreter.frames = interpreter.frames[:len(interpreter.frames)-1]
+
+	return FromLox(result)
+}
+
+// ToLox converts a Go value to the Lox value scripts see. Integers become
+// integers, other numbers floats, slices and arrays lists, and maps with
+// string keys instances whose fields are the entries. Values it can't
+// convert are handed over as they are, like values passed to Define.
+func ToLox(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	switch v := value.(type) {
+	case bool, string, int64, float64:
+		return v
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.String:
+		return rv.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > math.MaxInt64 {
+			return float64(rv.Uint())
+		}
+
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil
+		}
+
+		elements := make([]interface{}, rv.Len())
+		for i := range elements {
+			elements[i] = ToLox(rv.Index(i).Interface())
+		}
+
+		return NewLoxList(elements)
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return value
+		}
+
+		if rv.IsNil() {
+			return nil
+		}
+
+		instance := NewLoxInstance(objectClass)
+		iter := rv.MapRange()
+		for iter.Next() {
+			instance.fields[iter.Key().String()] = ToLox(iter.Value().Interface())
+		}
+
+		return instance
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+	}
+
+	return value
+}
+
+// FromLox converts a Lox value to Go. Lists become []interface{},
+// instances map[string]interface{} holding their fields, and bound structs
+// the values passed to Bind. Functions, classes and values the host defined
+// are returned as they are.
+func FromLox(value interface{}) (interface{}, error) {
+	return fromLox(value, map[interface{}]bool{})
+}
+
+func fromLox(value interface{}, seen map[interface{}]bool) (interface{}, error) {
+	switch v := value.(type) {
+	case *LoxList:
+		if seen[v] {
+			return nil, fmt.Errorf("lox: can't convert a list that contains itself")
+		}
+
+		seen[v] = true
+		defer delete(seen, v)
+
+		elements := make([]interface{}, len(v.elements))
+		for i, element := range v.elements {
+			converted, err := fromLox(element, seen)
+			if err != nil {
+				return nil, err
+			}
+
+			elements[i] = converted
+		}
+
+		return elements, nil
+	case *LoxInstance:
+		if seen[v] {
+			return nil, fmt.Errorf("lox: can't convert a %s that refers to itself", v.name())
+		}
+
+		seen[v] = true
+		defer delete(seen, v)
+
+		fields := make(map[string]interface{}, len(v.fields))
+		for name, field := range v.fields {
+			converted, err := fromLox(field, seen)
+			if err != nil {
+				return nil, err
+			}
+
+			fields[name] = converted
+		}
+
+		return fields, nil
+	case *LoxHostObject:
+		return v.value.Interface(), nil
+	}
+
+	return value, nil
+}
@@ -0,0 +1,323 @@
+package syntax
+
+import (
+	"fmt"
+	"golox/references"
+	"golox/scanner"
+	"math"
+	"reflect"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// LoxHostObject is a Go struct bound with Bind. Scripts read its exported
+// fields, call its exported methods and, when it was bound by pointer, set
+// its fields. Values are converted as for ToLox, and structs it holds are
+// bound in turn.
+type LoxHostObject struct {
+	value reflect.Value
+}
+
+// Bind makes v, a struct or a pointer to one, a global that scripts can use
+// like an instance. Other values are defined as Define would.
+func (interpreter *Interpreter) Bind(name string, v interface{}) {
+	if object, ok := newHostObject(reflect.ValueOf(v)); ok {
+		interpreter.globals.define(name, object)
+		return
+	}
+
+	interpreter.globals.define(name, ToLox(v))
+}
+
+func newHostObject(value reflect.Value) (*LoxHostObject, bool) {
+	if value.Kind() == reflect.Ptr && !value.IsNil() && value.Elem().Kind() == reflect.Struct {
+		return &LoxHostObject{value: value}, true
+	}
+
+	if value.Kind() == reflect.Struct {
+		return &LoxHostObject{value: value}, true
+	}
+
+	return nil, false
+}
+
+// hostValue converts a field or result to Lox, binding structs rather than
+// handing them over opaque.
+func hostValue(value reflect.Value) interface{} {
+	if object, ok := newHostObject(value); ok {
+		return object
+	}
+
+	if value.Kind() == reflect.Interface && value.IsNil() {
+		return nil
+	}
+
+	return ToLox(value.Interface())
+}
+
+// fields returns the struct the object wraps, addressable when it was bound
+// by pointer.
+func (object *LoxHostObject) fields() reflect.Value {
+	return reflect.Indirect(object.value)
+}
+
+func (object *LoxHostObject) typeName() string {
+	return object.fields().Type().Name()
+}
+
+func (object *LoxHostObject) getField(name *scanner.Token) interface{} {
+	if field := object.fields().FieldByName(name.Lexeme); field.IsValid() && isExported(name.Lexeme) {
+		if field.Kind() == reflect.Func && !field.IsNil() {
+			return newHostMethod(object.typeName()+"."+name.Lexeme, field)
+		}
+
+		return hostValue(field)
+	}
+
+	if method := object.value.MethodByName(name.Lexeme); method.IsValid() {
+		return newHostMethod(object.typeName()+"."+name.Lexeme, method)
+	}
+
+	throwTypedError(NameError, name, fmt.Sprintf("Undefined property '%s' on %s.", name.Lexeme, object.typeName()))
+	return nil
+}
+
+func (object *LoxHostObject) getMethod(name *scanner.Token) interface{} {
+	if method := object.value.MethodByName(name.Lexeme); method.IsValid() {
+		return newHostMethod(object.typeName()+"."+name.Lexeme, method)
+	}
+
+	// A field can hold a func too.
+	return object.getField(name)
+}
+
+func (object *LoxHostObject) set(name *scanner.Token, value interface{}) {
+	field := object.fields().FieldByName(name.Lexeme)
+	if !field.IsValid() || !isExported(name.Lexeme) {
+		throwTypedError(NameError, name, fmt.Sprintf("Undefined field '%s' on %s.", name.Lexeme, object.typeName()))
+	}
+
+	if !field.CanSet() {
+		throwTypedError(TypeError, name, fmt.Sprintf("Can't set '%s' on a %s that was bound by value.", name.Lexeme, object.typeName()))
+	}
+
+	converted, err := toGo(value, field.Type())
+	if err != nil {
+		throwTypedError(TypeError, name, fmt.Sprintf("Can't set '%s': %s", name.Lexeme, err.Error()))
+	}
+
+	field.Set(converted)
+}
+
+func (object *LoxHostObject) String() string {
+	return "<" + object.typeName() + ">"
+}
+
+func isExported(name string) bool {
+	return name != "" && name[0] >= 'A' && name[0] <= 'Z'
+}
+
+// hostMethod is a method of a bound struct, or a func held in one of its
+// fields.
+type hostMethod struct {
+	methodName string
+	fn         reflect.Value
+}
+
+func newHostMethod(name string, fn reflect.Value) *hostMethod {
+	return &hostMethod{methodName: name, fn: fn}
+}
+
+func (method *hostMethod) arity() int {
+	return method.fn.Type().NumIn()
+}
+
+func (method *hostMethod) requiredArity() int {
+	if method.isVariadic() {
+		return method.arity() - 1
+	}
+
+	return method.arity()
+}
+
+func (method *hostMethod) isVariadic() bool {
+	return method.fn.Type().IsVariadic()
+}
+
+// call converts the arguments to the method's parameter types. A method
+// whose last result is an error raises it as a runtime error.
+func (method *hostMethod) call(interpreter *Interpreter, arguments []interface{}) interface{} {
+	t := method.fn.Type()
+	in := make([]reflect.Value, len(arguments))
+	for i, argument := range arguments {
+		var param reflect.Type
+		if t.IsVariadic() && i >= t.NumIn()-1 {
+			param = t.In(t.NumIn() - 1).Elem()
+		} else {
+			param = t.In(i)
+		}
+
+		converted, err := toGo(argument, param)
+		if err != nil {
+			throwTypedError(TypeError, interpreter.callSite(), fmt.Sprintf("Argument %d to %s: %s", i+1, method.methodName, err.Error()))
+		}
+
+		in[i] = converted
+	}
+
+	out := method.fn.Call(in)
+	if len(out) > 0 && t.Out(len(out)-1) == errorType {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			throwRuntimeError(interpreter.callSite(), err.Error())
+		}
+
+		out = out[:len(out)-1]
+	}
+
+	switch len(out) {
+	case 0:
+		return nil
+	case 1:
+		return hostValue(out[0])
+	}
+
+	results := make([]interface{}, len(out))
+	for i, result := range out {
+		results[i] = hostValue(result)
+	}
+
+	return NewLoxList(results)
+}
+
+func (method *hostMethod) callableType() references.FunctionType {
+	return references.Method
+}
+
+func (method *hostMethod) name() string {
+	return method.methodName
+}
+
+func (method *hostMethod) String() string {
+	return "<host fn " + method.methodName + ">"
+}
+
+// toGo converts a Lox value to a Go value of type t, the reverse of ToLox.
+func toGo(value interface{}, t reflect.Type) (reflect.Value, error) {
+	if object, ok := value.(*LoxHostObject); ok {
+		if object.value.Type().AssignableTo(t) {
+			return object.value, nil
+		}
+
+		if object.fields().Type().AssignableTo(t) {
+			return object.fields(), nil
+		}
+	}
+
+	if value == nil {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map, reflect.Func:
+			return reflect.Zero(t), nil
+		}
+
+		return reflect.Value{}, fmt.Errorf("expected %s but got nil.", t)
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		converted, err := FromLox(value)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		if converted == nil {
+			return reflect.Zero(t), nil
+		}
+
+		if rv := reflect.ValueOf(converted); rv.Type().Implements(t) {
+			return rv, nil
+		}
+	case reflect.Bool:
+		if b, ok := value.(bool); ok {
+			return reflect.ValueOf(b).Convert(t), nil
+		}
+	case reflect.String:
+		if s, ok := value.(string); ok {
+			return reflect.ValueOf(s).Convert(t), nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := integral(value); ok {
+			rv := reflect.New(t).Elem()
+			if !rv.OverflowInt(n) {
+				rv.SetInt(n)
+				return rv, nil
+			}
+
+			return reflect.Value{}, fmt.Errorf("%d doesn't fit in %s.", n, t)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n, ok := integral(value); ok {
+			rv := reflect.New(t).Elem()
+			if n >= 0 && !rv.OverflowUint(uint64(n)) {
+				rv.SetUint(uint64(n))
+				return rv, nil
+			}
+
+			return reflect.Value{}, fmt.Errorf("%d doesn't fit in %s.", n, t)
+		}
+	case reflect.Float32, reflect.Float64:
+		switch n := value.(type) {
+		case float64:
+			return reflect.ValueOf(n).Convert(t), nil
+		case int64:
+			return reflect.ValueOf(float64(n)).Convert(t), nil
+		}
+	case reflect.Slice:
+		if list, ok := value.(*LoxList); ok {
+			slice := reflect.MakeSlice(t, len(list.elements), len(list.elements))
+			for i, element := range list.elements {
+				converted, err := toGo(element, t.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+
+				slice.Index(i).Set(converted)
+			}
+
+			return slice, nil
+		}
+	case reflect.Map:
+		if instance, ok := value.(*LoxInstance); ok && t.Key().Kind() == reflect.String {
+			m := reflect.MakeMapWithSize(t, len(instance.fields))
+			for name, field := range instance.fields {
+				converted, err := toGo(field, t.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+
+				m.SetMapIndex(reflect.ValueOf(name).Convert(t.Key()), converted)
+			}
+
+			return m, nil
+		}
+	}
+
+	if rv := reflect.ValueOf(value); rv.Type().AssignableTo(t) {
+		return rv, nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("expected %s but got %s.", t, typeName(value))
+}
+
+// integral returns a number as an int64 when it has no fractional part.
+func integral(value interface{}) (int64, bool) {
+	switch n := value.(type) {
+	case int64:
+		return n, true
+	case float64:
+		if n == math.Trunc(n) && n >= math.MinInt64 && n < math.MaxInt64 {
+			return int64(n), true
+		}
+	}
+
+	return 0, false
+}
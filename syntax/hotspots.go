@@ -0,0 +1,149 @@
+package syntax
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type lineStats struct {
+	line        int
+	executions  int
+	evaluations int
+	self        time.Duration
+}
+
+type hotspotFrame struct {
+	stats    *lineStats
+	start    time.Time
+	children time.Duration
+}
+
+// Hotspots counts statement executions and expression evaluations per
+// source line and the time spent in each line's own statements, excluding
+// the statements they run in turn.
+type Hotspots struct {
+	NopHook
+	// lock guards lines, which the tasks a script spawns add to as well.
+	// Each task has a stack of its own.
+	lock  *sync.Mutex
+	lines map[int]*lineStats
+	stack []*hotspotFrame
+}
+
+func NewHotspots() *Hotspots {
+	return &Hotspots{
+		lock:  &sync.Mutex{},
+		lines: map[int]*lineStats{},
+	}
+}
+
+// forTask returns the hotspots a spawned task records into: the same
+// lines, with a stack of the task's own statements.
+func (hotspots *Hotspots) forTask() *Hotspots {
+	return &Hotspots{lock: hotspots.lock, lines: hotspots.lines}
+}
+
+// SetHotspots starts recording execution statistics. Passing nil stops it.
+func (interpreter *Interpreter) SetHotspots(hotspots *Hotspots) {
+	interpreter.hotspots = hotspots
+	interpreter.collectHooks()
+}
+
+func (interpreter *Interpreter) Hotspots() *Hotspots {
+	return interpreter.hotspots
+}
+
+// BeforeStatement starts timing a statement. Statements the parser made
+// up, such as the loop a for statement becomes, have no line, and count
+// toward the statement around them.
+func (hotspots *Hotspots) BeforeStatement(point *StopPoint) {
+	if point.Line == 0 {
+		return
+	}
+
+	hotspots.lock.Lock()
+	defer hotspots.lock.Unlock()
+
+	line := point.Line
+	stats, ok := hotspots.lines[line]
+	if !ok {
+		stats = &lineStats{line: line}
+		hotspots.lines[line] = stats
+	}
+
+	stats.executions++
+	hotspots.stack = append(hotspots.stack, &hotspotFrame{stats: stats, start: time.Now()})
+}
+
+func (hotspots *Hotspots) AfterStatement(point *StopPoint) {
+	if point.Line == 0 {
+		return
+	}
+
+	hotspots.lock.Lock()
+	defer hotspots.lock.Unlock()
+
+	frame := hotspots.stack[len(hotspots.stack)-1]
+	hotspots.stack = hotspots.stack[:len(hotspots.stack)-1]
+
+	elapsed := time.Since(frame.start)
+	frame.stats.self += elapsed - frame.children
+	if len(hotspots.stack) > 0 {
+		hotspots.stack[len(hotspots.stack)-1].children += elapsed
+	}
+}
+
+func (hotspots *Hotspots) evaluated() {
+	hotspots.lock.Lock()
+	defer hotspots.lock.Unlock()
+
+	if len(hotspots.stack) > 0 {
+		hotspots.stack[len(hotspots.stack)-1].stats.evaluations++
+	}
+}
+
+// Report prints the n lines where the most time was spent, with their code.
+func (hotspots *Hotspots) Report(source string, n int, out io.Writer) {
+	hotspots.lock.Lock()
+	defer hotspots.lock.Unlock()
+
+	code := strings.Split(source, "\n")
+
+	var total time.Duration
+	var sorted []*lineStats
+	for _, stats := range hotspots.lines {
+		total += stats.self
+		sorted = append(sorted, stats)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].self != sorted[j].self {
+			return sorted[i].self > sorted[j].self
+		}
+
+		return sorted[i].line < sorted[j].line
+	})
+
+	if n < len(sorted) {
+		sorted = sorted[:n]
+	}
+
+	fmt.Fprintf(out, "%6s %10s %12s %12s %6s  %s\n", "line", "executed", "evaluations", "time", "%", "code")
+	for _, stats := range sorted {
+		percent := 0.0
+		if total > 0 {
+			percent = float64(stats.self) / float64(total) * 100
+		}
+
+		text := ""
+		if stats.line >= 1 && stats.line <= len(code) {
+			text = strings.TrimSpace(code[stats.line-1])
+		}
+
+		fmt.Fprintf(out, "%6d %10d %12d %12s %5.1f%%  %s\n", stats.line, stats.executions, stats.evaluations, stats.self.Round(time.Microsecond), percent, text)
+	}
+}
@@ -1,42 +1,204 @@
 package syntax
 
 import (
+	"context"
 	"fmt"
 	"golox/loxerror"
 	"golox/references"
 	"golox/scanner"
-	"math"
-	"strconv"
+	"io"
+	"math/rand"
+	"os"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
-var globals = NewEnvironment(nil)
-var locals = map[Expr]*int{}
-
 type Interpreter struct {
-	env  *Environment
-	prev *Environment
+	env        *Environment
+	frames     []*callFrame
+	postMortem *ConsoleDebugger
+	debugger   Debugger
+	attaching  int32
+	attachLock sync.Mutex
+	pending    Debugger
+	hotspots   *Hotspots
+	tracer     *Tracer
+	profiler   *Profiler
+	coverage   *Coverage
+	// hooks are the debugger, profilers, coverage, tracer and extraHooks, in
+	// the order they run.
+	hooks      []Hook
+	extraHooks []Hook
+	// out is where print writes.
+	out io.Writer
+	// budget, when set, limits how many statements a run may execute, and
+	// ctx, when set, stops runs once it is done.
+	budget *stepBudget
+	ctx    context.Context
+	// toStringDepth counts the toString methods being run, so one that
+	// prints itself fails instead of recursing forever.
+	toStringDepth int
+	// generator is the generator whose body is running, which yield
+	// statements hand their values to.
+	generator *generatorBody
+	// deferred holds the expressions the running call has deferred.
+	deferred []*deferredAction
+	// args is the command line Args parses, starting with the script.
+	args []string
+	// plotter receives the charts Plot draws, and plots counts the ones
+	// written to files when there is no plotter.
+	plotter func(chart *Chart)
+	plots   int
+	// temporaries are the paths Tmp handed out during this run.
+	temporaries *temporaryPaths
+	// vfs, when set, takes the place of the real filesystem.
+	vfs *VFS
+	// scheduler takes turns running the tasks started with spawn. It is
+	// nil until the first task starts.
+	scheduler *scheduler
+	// random is the generator random() and randomInt() draw from.
+	random *rand.Rand
+	// noOS denies scripts the natives that reach the environment and other
+	// processes.
+	noOS bool
+	// globals holds the natives and everything the scripts this
+	// interpreter ran declared at the top level.
+	globals *Environment
+	// classes are the names of the classes those scripts declared, which
+	// the parser needs to tell instantiations from calls.
+	classes map[string]bool
+	// scriptGlobals are the globals declared by scripts, including earlier
+	// REPL lines, as opposed to natives and values the host defined.
+	scriptGlobals map[string]bool
+	// modules are the modules those scripts imported.
+	modules *moduleSet
+	// abandoned holds the generators to close, which the garbage collector
+	// found the scripts dropped while they were parked at a yield.
+	abandoned *abandonedGenerators
+	// printers holds the formatters the host registered for its types.
+	printers map[reflect.Type]Printer
 }
 
 func NewInterpreter() *Interpreter {
+	globals := NewEnvironment(nil)
 	globals.define("clock", NewClock())
+	defineTime(globals)
+	globals.define("range", NewRange())
+	defineReflection(globals)
+	defineConversions(globals)
+	defineConcurrency(globals)
+	defineTemporaries(globals)
+	defineArgs(globals)
+	definePlot(globals)
+	defineAssertions(globals)
+	defineStringBuilder(globals)
+	defineRegex(globals)
+	defineRandom(globals)
+	defineOS(globals)
+	definePrintf(globals)
+	defineEval(globals)
+	defineHash(globals)
 
 	return &Interpreter{
-		env:  globals,
-		prev: nil,
+		env:           globals,
+		globals:       globals,
+		classes:       map[string]bool{},
+		scriptGlobals: map[string]bool{},
+		modules:       newModuleSet(),
+		temporaries:   &temporaryPaths{},
+		abandoned:     &abandonedGenerators{},
+		printers:      map[reflect.Type]Printer{},
+		out:           os.Stdout,
+		random:        newRandom(),
 	}
 }
 
+// SetOutput makes print, and the messages of errors the script doesn't
+// report itself, write to out instead of stdout.
+func (interpreter *Interpreter) SetOutput(out io.Writer) {
+	interpreter.out = out
+}
+
+// SetOSAccess controls whether scripts may use getEnv, setEnv, platform
+// and exec. They may unless this is passed false.
+func (interpreter *Interpreter) SetOSAccess(allowed bool) {
+	interpreter.noOS = !allowed
+}
+
+// SetPostMortem makes the interpreter open the given debugger at the failing
+// frame when a runtime error is not caught. Passing nil disables it.
+func (interpreter *Interpreter) SetPostMortem(debugger *ConsoleDebugger) {
+	interpreter.postMortem = debugger
+}
+
+// SetDebugger attaches a debugger, which is told about each statement before
+// it runs. Passing nil detaches it.
+func (interpreter *Interpreter) SetDebugger(debugger Debugger) {
+	interpreter.debugger = debugger
+	interpreter.collectHooks()
+}
+
+// Attach hands a debugger to the interpreter from another goroutine. It
+// takes over before the next statement runs.
+func (interpreter *Interpreter) Attach(debugger Debugger) {
+	interpreter.attachLock.Lock()
+	interpreter.pending = debugger
+	interpreter.attachLock.Unlock()
+
+	atomic.StoreInt32(&interpreter.attaching, 1)
+}
+
+func (interpreter *Interpreter) acceptAttach() {
+	interpreter.attachLock.Lock()
+	defer interpreter.attachLock.Unlock()
+
+	interpreter.SetDebugger(interpreter.pending)
+	interpreter.pending = nil
+	atomic.StoreInt32(&interpreter.attaching, 0)
+}
+
 func (interpreter *Interpreter) Interpret(statements []Stmt) {
+	if interpreter.budget != nil {
+		interpreter.budget.reset()
+	}
+
+	if interpreter.scheduler != nil {
+		interpreter.scheduler.acquire()
+	}
+
+	defer func() {
+		interpreter.removeTemporaries()
+		if interpreter.scheduler != nil {
+			interpreter.scheduler.release()
+		}
+	}()
+
 	defer func() {
 		if r := recover(); r != nil {
+			if _, ok := r.(stopScript); ok {
+				interpreter.env = interpreter.globals
+				interpreter.frames = nil
+				return
+			}
+
 			if !loxerror.HadRuntimeError() {
 				if err, ok := r.(error); ok {
-					fmt.Println(err.Error())
+					fmt.Fprintln(interpreter.out, err.Error())
 				} else {
-					fmt.Println("Runtime error occurred.")
+					fmt.Fprintln(interpreter.out, "Runtime error occurred.")
 				}
 			}
+
+			if err, ok := r.(*RuntimeError); ok && interpreter.postMortem != nil {
+				interpreter.postMortem.postMortem(err)
+			}
+
+			interpreter.env = interpreter.globals
+			interpreter.frames = nil
+			interpreter.deferred = nil
+			interpreter.toStringDepth = 0
 		}
 	}()
 
@@ -46,14 +208,73 @@ func (interpreter *Interpreter) Interpret(statements []Stmt) {
 }
 
 func (interpreter *Interpreter) execute(stmt Stmt) {
+	if atomic.LoadInt32(&interpreter.attaching) == 1 {
+		interpreter.acceptAttach()
+	}
+
+	if interpreter.budget != nil {
+		interpreter.budget.spend(stmt)
+	}
+
+	if interpreter.ctx != nil {
+		interpreter.checkCanceled(stmt)
+	}
+
+	if atomic.LoadInt32(&interpreter.abandoned.pending) == 1 {
+		interpreter.closeAbandoned()
+	}
+
+	if len(interpreter.hooks) > 0 {
+		interpreter.executeHooked(stmt)
+		return
+	}
+
+	if interpreter.scheduler != nil {
+		interpreter.scheduler.tick()
+	}
+
 	stmt.accept(interpreter)
 }
 
+// resolve records where the resolver found the variable expr refers to:
+// depth scopes out, or the globals when depth is nil. Variables it never
+// resolved are looked up by name, from the current environment out.
 func (interpreter *Interpreter) resolve(expr Expr, depth *int) {
-	locals[expr] = depth
+	switch e := expr.(type) {
+	case *Variable:
+		e.depth, e.resolved = depth, true
+	case *Assign:
+		e.depth, e.resolved = depth, true
+	case *This:
+		e.depth, e.resolved = depth, true
+	case *Super:
+		e.depth, e.resolved = depth, true
+	}
+}
+
+// resolution returns what resolve recorded for expr.
+func resolution(expr Expr) (*int, bool) {
+	switch e := expr.(type) {
+	case *Variable:
+		return e.depth, e.resolved
+	case *Assign:
+		return e.depth, e.resolved
+	case *This:
+		return e.depth, e.resolved
+	case *Super:
+		return e.depth, e.resolved
+	}
+
+	return nil, false
 }
 
 func (interpreter *Interpreter) visitReturnCmdStmt(stmt *ReturnCmd) interface{} {
+	// Hooks see every frame, so tail calls are made the usual way under
+	// them.
+	if call, ok := stmt.value.(*Call); ok && call.tail && len(interpreter.hooks) == 0 {
+		throwReturn(interpreter.evaluateTailCall(call))
+	}
+
 	var value interface{}
 	if stmt.value != nil {
 		value = interpreter.evaluate(stmt.value)
@@ -64,43 +285,122 @@ func (interpreter *Interpreter) visitReturnCmdStmt(stmt *ReturnCmd) interface{}
 }
 
 func (interpreter *Interpreter) visitFunctionStmt(stmt *Function) interface{} {
-	function := NewLoxFunction(stmt, interpreter.env, false, false)
-	globals.define(stmt.name.Lexeme, function)
+	// The function is defined before its closure is made, so a closure
+	// trimmed to what it uses can still hold the function for recursion.
+	function := NewLoxFunction(stmt, nil, false, false)
+	interpreter.env.define(stmt.name.Lexeme, function)
+	function.closure = interpreter.closure(stmt.capture, interpreter.env)
 
 	return nil
 }
 
 func (interpreter *Interpreter) visitContinueCmdStmt(continueCmd *ContinueCmd) interface{} {
-	env := interpreter.env
-	for depth := continueCmd.envDepth; depth > 0; depth-- {
-		env.continuing = true
-		env = env.enclosing
-	}
-
+	throwContinue(labelName(continueCmd.label))
 	return nil
 }
 
 func (interpreter *Interpreter) visitBreakCmdStmt(breakCmd *BreakCmd) interface{} {
-	env := interpreter.env
-	for depth := breakCmd.envDepth; depth > 0; depth-- {
-		env.exit = true
-		env = env.enclosing
+	throwBreak(labelName(breakCmd.label))
+	return nil
+}
+
+func labelName(label *scanner.Token) string {
+	if label == nil {
+		return ""
 	}
 
-	return nil
+	return label.Lexeme
 }
 
 func (interpreter *Interpreter) visitWhileLoopStmt(whileLoop *WhileLoop) interface{} {
 	for isTruthy(interpreter.evaluate(whileLoop.condition)) {
-		interpreter.execute(whileLoop.body)
+		if interpreter.executeLoopBody(whileLoop.body, labelName(whileLoop.label)) {
+			break
+		}
 
-		if interpreter.env.continuing {
-			interpreter.env = interpreter.prev
-			continue
+		if whileLoop.increment != nil {
+			interpreter.evaluate(whileLoop.increment)
 		}
+	}
 
-		if interpreter.env.exit {
-			interpreter.env = interpreter.prev
+	return nil
+}
+
+func (interpreter *Interpreter) visitForInStmt(forIn *ForIn) interface{} {
+	iterable := interpreter.evaluate(forIn.iterable)
+	iterator := getIterator(interpreter, forIn.name, iterable)
+	if iterator == nil {
+		throwTypedError(TypeError, forIn.name, fmt.Sprintf("Can't iterate over '%s'.", stringify(iterable)))
+	}
+
+	previous := interpreter.env
+	for iterator.hasNext() {
+		env := NewEnvironment(previous)
+		env.define(forIn.name.Lexeme, iterator.next())
+
+		interpreter.env = env
+		broke := interpreter.executeLoopBody(forIn.body, labelName(forIn.label))
+		interpreter.env = previous
+
+		if broke {
+			break
+		}
+	}
+
+	return nil
+}
+
+// executeLoopBody runs one iteration of a loop and reports whether it ended
+// with a break. A continue just ends the iteration. Signals labeled for an
+// outer loop end this loop and carry on unwinding.
+func (interpreter *Interpreter) executeLoopBody(body Stmt, label string) (broke bool) {
+	previous := interpreter.env
+	defer func() {
+		if r := recover(); r != nil {
+			switch signal := r.(type) {
+			case breakSignal:
+				if signal.label != "" && signal.label != label {
+					panic(r)
+				}
+				broke = true
+			case continueSignal:
+				if signal.label != "" && signal.label != label {
+					panic(r)
+				}
+				broke = false
+			default:
+				panic(r)
+			}
+
+			interpreter.env = previous
+		}
+	}()
+
+	interpreter.execute(body)
+	return false
+}
+
+func (interpreter *Interpreter) visitSwitchCmdStmt(stmt *SwitchCmd) interface{} {
+	subject := interpreter.evaluate(stmt.subject)
+
+	start := -1
+	for i, c := range stmt.cases {
+		if c.value != nil && interpreter.equalAt(c.keyword, subject, interpreter.evaluate(c.value)) {
+			start = i
+			break
+		}
+	}
+
+	if start < 0 {
+		for i, c := range stmt.cases {
+			if c.value == nil {
+				start = i
+			}
+		}
+	}
+
+	for i := start; i >= 0 && i < len(stmt.cases); i++ {
+		if interpreter.executeSwitchCase(stmt.cases[i]) || !stmt.cases[i].fallsThrough {
 			break
 		}
 	}
@@ -108,6 +408,25 @@ func (interpreter *Interpreter) visitWhileLoopStmt(whileLoop *WhileLoop) interfa
 	return nil
 }
 
+// executeSwitchCase runs a case body in its own scope and reports whether it
+// ended with a break. A continue is left for the enclosing loop.
+func (interpreter *Interpreter) executeSwitchCase(c *SwitchCase) (broke bool) {
+	previous := interpreter.env
+	defer func() {
+		if r := recover(); r != nil {
+			if signal, ok := r.(breakSignal); !ok || signal.label != "" {
+				panic(r)
+			}
+
+			interpreter.env = previous
+			broke = true
+		}
+	}()
+
+	interpreter.executeBlock(c.body, NewEnvironment(previous))
+	return false
+}
+
 func (interpreter *Interpreter) visitLogicalExpr(expr *Logical) interface{} {
 	left := interpreter.evaluate(expr.left)
 
@@ -115,6 +434,10 @@ func (interpreter *Interpreter) visitLogicalExpr(expr *Logical) interface{} {
 		if isTruthy(left) {
 			return left
 		}
+	} else if expr.operator.Type == references.QuestionQuestion {
+		if left != nil {
+			return left
+		}
 	} else {
 		if !isTruthy(left) {
 			return left
@@ -136,6 +459,9 @@ func (interpreter *Interpreter) visitIfCmdStmt(stmt *IfCmd) interface{} {
 
 func (interpreter *Interpreter) visitGetMethodExpr(expr *GetMethod) interface{} {
 	object := interpreter.evaluate(expr.object)
+	if object == nil && expr.optional {
+		return nil
+	}
 	if val, ok := object.(*LoxInstance); ok {
 		return val.getMethod(expr.name)
 	}
@@ -144,26 +470,74 @@ func (interpreter *Interpreter) visitGetMethodExpr(expr *GetMethod) interface{}
 		return val.getStaticMethod(expr.name)
 	}
 
-	throwRuntimeError(expr.name, "Only instances have properties.")
+	if val, ok := object.(*LoxNamespace); ok {
+		return val.get(expr.name)
+	}
+
+	if val, ok := object.(*LoxHostObject); ok {
+		return val.getMethod(expr.name)
+	}
+
+	if val, ok := object.(*LoxStringBuilder); ok {
+		return val.get(expr.name)
+	}
+
+	if val, ok := object.(*LoxEnum); ok {
+		return val.get(expr.name)
+	}
+
+	if val, ok := object.(*LoxEnumMember); ok {
+		return val.get(expr.name)
+	}
+
+	throwTypedError(TypeError, expr.name, "Only instances have properties.")
 	return nil
 }
 
 func (interpreter *Interpreter) visitGetFieldExpr(expr *GetField) interface{} {
 	object := interpreter.evaluate(expr.object)
+	if object == nil && expr.optional {
+		return nil
+	}
 	if val, ok := object.(*LoxInstance); ok {
+		if getter := val.class.findGetter(expr.name.Lexeme); getter != nil {
+			return getter.bind(val).call(interpreter, nil)
+		}
+
 		return val.getField(expr.name)
 	}
 
-	throwRuntimeError(expr.name, "Only instances have properties.")
+	if val, ok := object.(*LoxNamespace); ok {
+		return val.get(expr.name)
+	}
+
+	if val, ok := object.(*LoxHostObject); ok {
+		return val.getField(expr.name)
+	}
+
+	if val, ok := object.(*LoxEnum); ok {
+		return val.get(expr.name)
+	}
+
+	throwTypedError(TypeError, expr.name, "Only instances have properties.")
 	return nil
 }
 
 func (interpreter *Interpreter) visitSetExpr(expr *Set) interface{} {
 	object := interpreter.evaluate(expr.object)
+	if host, ok := object.(*LoxHostObject); ok {
+		value := interpreter.evaluate(expr.value)
+		host.set(expr.name, value)
+		return value
+	}
 
 	val, ok := object.(*LoxInstance)
 	if !ok {
-		throwRuntimeError(expr.name, "Only instances have fields.")
+		throwTypedError(TypeError, expr.name, "Only instances have fields.")
+	}
+
+	if val.class.findGetter(expr.name.Lexeme) != nil {
+		throwRuntimeError(expr.name, fmt.Sprintf("Can't assign to getter '%s'.", expr.name.Lexeme))
 	}
 
 	value := interpreter.evaluate(expr.value)
@@ -173,25 +547,16 @@ func (interpreter *Interpreter) visitSetExpr(expr *Set) interface{} {
 }
 
 func (interpreter *Interpreter) visitBlockStmt(stmt *Block) interface{} {
-	interpreter.executeBlock(stmt.statements, NewEnvironment(interpreter.env), stmt)
+	interpreter.executeBlock(stmt.statements, NewEnvironment(interpreter.env))
 	return nil
 }
 
-func (interpreter *Interpreter) executeBlock(statements []Stmt, env *Environment, block *Block) {
+func (interpreter *Interpreter) executeBlock(statements []Stmt, env *Environment) {
 	previous := interpreter.env
 
 	interpreter.env = env
 	for _, statement := range statements {
 		interpreter.execute(statement)
-		if interpreter.env.continuing && block != nil && block.isLoopIncrementer {
-			interpreter.env.continuing = false
-			continue
-		}
-
-		if interpreter.env.exit || interpreter.env.continuing {
-			interpreter.prev = previous
-			return
-		}
 	}
 
 	interpreter.env = previous
@@ -200,7 +565,7 @@ func (interpreter *Interpreter) executeBlock(statements []Stmt, env *Environment
 func (interpreter *Interpreter) visitAssignExpr(expr *Assign) interface{} {
 	value := interpreter.evaluate(expr.value)
 
-	distance, ok := locals[expr]
+	distance, ok := expr.depth, expr.resolved
 	if !ok {
 		interpreter.env.assign(expr.name, value)
 		return value
@@ -209,7 +574,7 @@ func (interpreter *Interpreter) visitAssignExpr(expr *Assign) interface{} {
 	if distance != nil {
 		interpreter.env.assignAt(*distance, expr.name, value)
 	} else {
-		globals.assign(expr.name, value)
+		interpreter.globals.assign(expr.name, value)
 	}
 
 	return value
@@ -221,7 +586,38 @@ func (interpreter *Interpreter) visitVarCmdStmt(stmt *VarCmd) interface{} {
 		value = interpreter.evaluate(stmt.initializer)
 	}
 
-	interpreter.env.define(stmt.name.Lexeme, value)
+	// Only globals need checking at runtime, since the resolver sees every
+	// assignment to a local.
+	if stmt.constant && interpreter.env == interpreter.globals {
+		interpreter.env.defineConstant(stmt.name.Lexeme, value)
+	} else {
+		interpreter.env.define(stmt.name.Lexeme, value)
+	}
+
+	return nil
+}
+
+// visitUnpackStmt defines a variable for each element of a list, which
+// must have exactly as many elements as there are names.
+func (interpreter *Interpreter) visitUnpackStmt(stmt *Unpack) interface{} {
+	value := interpreter.evaluate(stmt.initializer)
+	list, ok := value.(*LoxList)
+	if !ok {
+		throwTypedError(TypeError, stmt.keyword, fmt.Sprintf("Can only unpack a list, not %s.", typeName(value)))
+	}
+
+	if len(list.elements) != len(stmt.names) {
+		throwTypedError(IndexError, stmt.keyword, fmt.Sprintf("Expected %d values to unpack but got %d.", len(stmt.names), len(list.elements)))
+	}
+
+	for i, name := range stmt.names {
+		if stmt.constant && interpreter.env == interpreter.globals {
+			interpreter.env.defineConstant(name.Lexeme, list.elements[i])
+		} else {
+			interpreter.env.define(name.Lexeme, list.elements[i])
+		}
+	}
+
 	return nil
 }
 
@@ -231,39 +627,65 @@ func (interpreter *Interpreter) visitClassStmt(stmt *Class) interface{} {
 		s := interpreter.evaluate(stmt.superclass)
 		ok := false
 		if superclass, ok = s.(*LoxClass); !ok {
-			throwRuntimeError(stmt.superclass.name, "Superclass must be a class.")
+			throwTypedError(TypeError, stmt.superclass.name, "Superclass must be a class.")
+		}
+	}
+
+	var traits []*LoxClass
+	for _, trait := range stmt.traits {
+		t, ok := interpreter.evaluate(trait).(*LoxClass)
+		if !ok {
+			throwTypedError(TypeError, trait.name, "Trait must be a class.")
 		}
+
+		traits = append(traits, t)
 	}
 
 	interpreter.env.define(stmt.name.Lexeme, nil)
 
+	previous := interpreter.env
 	if stmt.superclass != nil {
 		interpreter.env = NewEnvironment(interpreter.env)
 		interpreter.env.define("super", interpreter.env.get(stmt.superclass.name))
 	}
 
 	methods := make(map[string]*LoxFunction)
-	for _, method := range stmt.methods {
-		methods[method.name.Lexeme] = NewLoxFunction(method, interpreter.env, method.name.Lexeme == "init" && !method.isStatic, method.isStatic)
-	}
-
-	fields := make(map[string]interface{})
-	for _, field := range stmt.fields {
-		var value interface{}
-		if field.initializer != nil {
-			value = interpreter.evaluate(field.initializer)
+	staticMethods := make(map[string]*LoxFunction)
+	getters := make(map[string]*LoxFunction)
+	for _, trait := range traits {
+		// A trait brings what it inherits too, its own methods winning.
+		for _, ancestor := range trait.lineage() {
+			for name, method := range ancestor.methods {
+				methods[name] = method
+			}
+			for name, method := range ancestor.staticMethods {
+				staticMethods[name] = method
+			}
+			for name, getter := range ancestor.getters {
+				getters[name] = getter
+			}
 		}
-
-		fields[field.name.Lexeme] = value
 	}
 
-	class := NewLoxClass(stmt.name.Lexeme, superclass, methods, fields)
+	// The class is assigned before its closure is made, so a closure
+	// trimmed to what the methods use can still hold the class itself.
+	class := NewLoxClass(stmt.name.Lexeme, superclass, methods, staticMethods, getters, stmt.fields, nil)
+	previous.assign(stmt.name, class)
+	class.closure = interpreter.closure(stmt.capture, interpreter.env)
 
-	if stmt.superclass != nil {
-		interpreter.env = interpreter.env.enclosing
+	for _, method := range stmt.methods {
+		if method.isStatic {
+			// Static methods aren't bound, so an empty environment stands
+			// in for the one other methods get with 'this'.
+			staticMethods[method.name.Lexeme] = NewLoxFunction(method, NewEnvironment(class.closure), false, true)
+		} else if method.isGetter {
+			getters[method.name.Lexeme] = NewLoxFunction(method, class.closure, false, false)
+		} else {
+			methods[method.name.Lexeme] = NewLoxFunction(method, class.closure, method.name.Lexeme == "init", false)
+		}
 	}
 
-	interpreter.env.assign(stmt.name, class)
+	interpreter.env = previous
 	return nil
 }
 
@@ -272,7 +694,7 @@ func (interpreter *Interpreter) visitVariableExpr(expr *Variable) interface{} {
 }
 
 func (interpreter *Interpreter) lookupVariable(name *scanner.Token, expr Expr) interface{} {
-	distance, ok := locals[expr]
+	distance, ok := resolution(expr)
 	if !ok {
 		return interpreter.env.get(name)
 	}
@@ -281,7 +703,7 @@ func (interpreter *Interpreter) lookupVariable(name *scanner.Token, expr Expr) i
 		return interpreter.env.getAt(*distance, name.Lexeme)
 	}
 
-	return globals.get(name)
+	return interpreter.globals.get(name)
 }
 
 func (interpreter *Interpreter) visitExpressionStmt(stmt *Expression) interface{} {
@@ -291,7 +713,7 @@ func (interpreter *Interpreter) visitExpressionStmt(stmt *Expression) interface{
 
 func (interpreter *Interpreter) visitPrintStmt(stmt *Print) interface{} {
 	value := interpreter.evaluate(stmt.expression)
-	fmt.Println(stringify(value))
+	fmt.Fprintln(interpreter.out, interpreter.display(value))
 	return nil
 }
 
@@ -311,7 +733,10 @@ func (interpreter *Interpreter) visitUnaryExpr(expr *Unary) interface{} {
 		return !isTruthy(right)
 	case references.Minus:
 		checkNumberOperand(expr.operator, right)
-		return -(right.(float64))
+		return negate(right)
+	case references.Tilde:
+		checkNumberOperand(expr.operator, right)
+		return ^toInteger(expr.operator, right)
 	}
 
 	return nil
@@ -321,69 +746,70 @@ func (interpreter *Interpreter) visitBinaryExpr(expr *Binary) interface{} {
 	left := interpreter.evaluate(expr.left)
 	right := interpreter.evaluate(expr.right)
 
+	if result, ok := interpreter.overloadedOperator(expr.operator, left, right); ok {
+		return result
+	}
+
 	switch expr.operator.Type {
-	case references.Greater:
-		checkNumberOperand(expr.operator, left, right)
-		return left.(float64) > right.(float64)
-	case references.GreaterEqual:
-		checkNumberOperand(expr.operator, left, right)
-		return left.(float64) >= right.(float64)
-	case references.Less:
-		checkNumberOperand(expr.operator, left, right)
-		return left.(float64) < right.(float64)
-	case references.LessEqual:
-		checkNumberOperand(expr.operator, left, right)
-		return left.(float64) <= right.(float64)
+	case references.Greater, references.GreaterEqual, references.Less, references.LessEqual:
+		l, lString := left.(string)
+		r, rString := right.(string)
+		if lString && rString {
+			return compareStrings(expr.operator, l, r)
+		}
+
+		if (lString && isNumber(right)) || (isNumber(left) && rString) {
+			throwTypedError(TypeError, expr.operator, fmt.Sprintf("Can't compare a string with a number using '%s'.", expr.operator.Lexeme))
+		}
+
+		if !isNumber(left) || !isNumber(right) {
+			throwTypedError(TypeError, expr.operator, "Operands must be two numbers or two strings.")
+		}
+
+		return compareNumbers(expr.operator, left, right)
 	case references.BangEqual:
-		return !isEqual(left, right)
+		return !interpreter.equal(expr.operator, left, right)
 	case references.EqualEqual:
-		return isEqual(left, right)
-	case references.Minus:
-		checkNumberOperand(expr.operator, left, right)
-		return left.(float64) - right.(float64)
-	case references.Slash:
-		checkNumberOperand(expr.operator, left, right)
-		if right.(float64) == 0 {
-			throwRuntimeError(expr.operator, "Cannot divide by zero.")
-		}
-		return left.(float64) / right.(float64)
-	case references.Star:
+		return interpreter.equal(expr.operator, left, right)
+	case references.Minus, references.Slash, references.Star, references.Modulo, references.TildeSlash:
 		checkNumberOperand(expr.operator, left, right)
-		return left.(float64) * right.(float64)
-	case references.Modulo:
+		return arithmetic(expr.operator, left, right)
+	case references.Ampersand, references.Pipe, references.Caret, references.LessLess, references.GreaterGreater:
 		checkNumberOperand(expr.operator, left, right)
-		return math.Mod(left.(float64), right.(float64))
+		return bitwise(expr.operator, left, right)
 	case references.Plus:
-		lFl, lOk := left.(float64)
-		rFl, rOk := right.(float64)
-		if lOk && rOk {
-			return lFl + rFl
+		if isNumber(left) && isNumber(right) {
+			return arithmetic(expr.operator, left, right)
 		}
 
-		_, lOk = left.(string)
-		_, rOk = right.(string)
+		_, lOk := left.(string)
+		_, rOk := right.(string)
 		if lOk || rOk {
-			return fmt.Sprintf("%v%v", left, right)
+			return interpreter.display(left) + interpreter.display(right)
 		}
 
-		throwRuntimeError(expr.operator, "Operands must be two numbers or two strings.")
+		throwTypedError(TypeError, expr.operator, "Operands must be two numbers or two strings.")
 	}
 
 	return nil
 }
 
 func (interpreter *Interpreter) evaluate(expr Expr) interface{} {
+	if interpreter.hotspots != nil {
+		interpreter.hotspots.evaluated()
+	}
+
 	return expr.accept(interpreter)
 }
 
 func (interpreter *Interpreter) visitSuperExpr(expr *Super) interface{} {
-	distance := locals[expr]
+	distance := expr.depth
 	superclass := interpreter.env.getAt(*distance, "super").(*LoxClass)
 	object := interpreter.env.getAt(*distance-1, "this").(*LoxInstance)
 
 	method := superclass.findMethod(expr.method.Lexeme)
 	if method == nil {
-		throwRuntimeError(expr.method, fmt.Sprintf("Undefined property '%s'.", expr.method.Lexeme))
+		throwTypedError(NameError, expr.method, fmt.Sprintf("Undefined property '%s'.", expr.method.Lexeme))
 	}
 
 	return method.bind(object)
@@ -394,32 +820,112 @@ func (interpreter *Interpreter) visitThisExpr(expr *This) interface{} {
 }
 
 func (interpreter *Interpreter) visitCallExpr(expr *Call) interface{} {
-	callee := interpreter.evaluate(expr.callee)
+	return interpreter.finishCall(expr, interpreter.evaluate(expr.callee))
+}
+
+// finishCall calls the evaluated callee of a call expression.
+func (interpreter *Interpreter) finishCall(expr *Call, callee interface{}) interface{} {
+	if method, ok := expr.callee.(*GetMethod); ok && method.optional && callee == nil {
+		return nil
+	}
+
 	if v, ok := callee.(*LoxFunction); ok && v == nil {
-		throwRuntimeError(expr.paren, "Could not find function or method.")
+		throwTypedError(TypeError, expr.paren, "Could not find function or method.")
 	}
 
-	var arguments []interface{}
-	for _, arg := range expr.arguments {
-		arguments = append(arguments, interpreter.evaluate(arg))
+	arguments := interpreter.evaluateArguments(expr.arguments)
+	function := checkCallable(expr.paren, callee, arguments)
+	interpreter.frames = append(interpreter.frames, &callFrame{
+		name:  function.name(),
+		token: expr.paren,
+		env:   interpreter.env,
+	})
+	var result interface{}
+	if len(interpreter.hooks) > 0 {
+		result = interpreter.callHooked(function, expr.paren, arguments)
+	} else {
+		result = function.call(interpreter, arguments)
+	}
+	interpreter.frames = interpreter.frames[:len(interpreter.frames)-1]
+
+	return result
+}
+
+// checkCallable makes sure callee can be called with the arguments.
+func checkCallable(paren *scanner.Token, callee interface{}, arguments []interface{}) LoxCallable {
+	function, ok := callee.(LoxCallable)
+	if !ok {
+		throwTypedError(TypeError, paren, fmt.Sprintf("Can only call functions and classes but tried to call '%v'.", callee))
+	}
+
+	if message, ok := arityMismatch(function, len(arguments)); ok {
+		throwTypedError(ArityError, paren, message)
 	}
 
-	if _, ok := callee.(LoxCallable); !ok {
-		throwRuntimeError(expr.paren, fmt.Sprintf("Can only call functions and classes but tried to call '%v'.", callee))
+	return function
+}
+
+// arityMismatch describes the mismatch when function can't take count
+// arguments.
+func arityMismatch(function LoxCallable, count int) (string, bool) {
+	min, max := arityRange(function)
+	return mismatchedArity(min, max, count, function.callableType(), function.name())
+}
+
+// mismatchedArity describes the mismatch when a callable of the given kind
+// and name, taking min to max arguments, is passed count.
+func mismatchedArity(min int, max int, count int, kind references.FunctionType, name string) (string, bool) {
+	if count >= min && (max == -1 || count <= max) {
+		return "", false
 	}
 
-	function := callee.(LoxCallable)
-	if len(arguments) != function.arity() {
-		throwRuntimeError(expr.paren, fmt.Sprintf("Expected %d arguments but got %d for %s '%s'.", function.arity(), len(arguments), strings.ToLower(references.GetFunctionTypeName(function.callableType())), function.name()))
+	expected := fmt.Sprintf("%d", min)
+	if max == -1 {
+		expected = fmt.Sprintf("at least %d", min)
+	} else if min != max {
+		expected = fmt.Sprintf("%d to %d", min, max)
+	}
+
+	return fmt.Sprintf("Expected %s arguments but got %d for %s '%s'.", expected, count, strings.ToLower(references.GetFunctionTypeName(kind)), name), true
+}
+
+// evaluateArguments evaluates a call's arguments, spreading the elements of
+// any list marked with '...' into separate arguments.
+func (interpreter *Interpreter) evaluateArguments(expressions []Expr) []interface{} {
+	var arguments []interface{}
+	for _, arg := range expressions {
+		spread, ok := arg.(*Spread)
+		if !ok {
+			arguments = append(arguments, interpreter.evaluate(arg))
+			continue
+		}
+
+		list, ok := interpreter.evaluate(spread.expression).(*LoxList)
+		if !ok {
+			throwTypedError(TypeError, spread.ellipsis, "Can only spread a list.")
+		}
+
+		arguments = append(arguments, list.elements...)
 	}
 
-	return function.call(interpreter, arguments)
+	return arguments
+}
+
+func (interpreter *Interpreter) visitSpreadExpr(expr *Spread) interface{} {
+	throwRuntimeError(expr.ellipsis, "Can only spread a list into call arguments.")
+	return nil
+}
+
+// callSite returns the token of the innermost active call so natives can
+// report runtime errors at the line that called them.
+func (interpreter *Interpreter) callSite() *scanner.Token {
+	return interpreter.frames[len(interpreter.frames)-1].token
 }
 
 func checkNumberOperand(operator *scanner.Token, operands ...interface{}) {
 	good := true
 	for _, val := range operands {
-		if _, ok := val.(float64); !ok {
+		if !isNumber(val) {
 			good = false
 			break
 		}
@@ -430,7 +936,7 @@ func checkNumberOperand(operator *scanner.Token, operands ...interface{}) {
 		if len(operands) > 1 {
 			s = "s"
 		}
-		throwRuntimeError(operator, fmt.Sprintf("Operand%s must be a number.", s))
+		throwTypedError(TypeError, operator, fmt.Sprintf("Operand%s must be a number.", s))
 	}
 
 }
@@ -447,16 +953,65 @@ func isTruthy(obj interface{}) bool {
 	return true
 }
 
-func isEqual(a interface{}, b interface{}) bool {
-	if a == nil && b == nil {
-		return true
+// compareStrings applies <, <=, > or >= to two strings, ordering them
+// byte by byte.
+func compareStrings(operator *scanner.Token, left string, right string) bool {
+	order := strings.Compare(left, right)
+	switch operator.Type {
+	case references.Greater:
+		return order > 0
+	case references.GreaterEqual:
+		return order >= 0
+	case references.Less:
+		return order < 0
 	}
 
-	if a == nil {
-		return false
+	return order <= 0
+}
+
+const maxToStringDepth = 100
+
+// display converts a value to the text print and string concatenation show,
+// calling toString() on instances whose class defines it and the printers
+// the host registered for its values, in lists too.
+func (interpreter *Interpreter) display(obj interface{}) string {
+	if text, ok := interpreter.hostString(obj); ok {
+		return text
+	}
+
+	if list, ok := obj.(*LoxList); ok {
+		items := make([]string, len(list.elements))
+		for i, element := range list.elements {
+			items[i] = interpreter.display(element)
+		}
+
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+
+	instance, ok := obj.(*LoxInstance)
+	if !ok {
+		return stringify(obj)
+	}
+
+	method := instance.class.findMethod("toString")
+	if method == nil || method.arity() != 0 {
+		return stringify(obj)
+	}
+
+	if interpreter.toStringDepth >= maxToStringDepth {
+		throwRuntimeError(method.declaration.name, "toString() recursed too deeply.")
+	}
+
+	interpreter.toStringDepth++
+	result := method.bind(instance).call(interpreter, nil)
+	interpreter.toStringDepth--
+
+	text, ok := result.(string)
+	if !ok {
+		throwTypedError(TypeError, method.declaration.name, "toString() must return a string.")
 	}
 
-	return a == b
+	return text
 }
 
 func stringify(obj interface{}) string {
@@ -464,8 +1019,8 @@ func stringify(obj interface{}) string {
 		return "nil"
 	}
 
-	if f, ok := obj.(float64); ok {
-		return strconv.FormatFloat(f, 'f', -1, 64)
+	if isNumber(obj) {
+		return formatNumber(obj)
 	}
 
 	if val, ok := obj.(LoxCallable); ok {
@@ -0,0 +1,110 @@
+package syntax
+
+import (
+	"fmt"
+	"golox/scanner"
+)
+
+// loxIterable is implemented by runtime values that can be looped over with
+// for-in.
+type loxIterable interface {
+	iterator() loxIterator
+}
+
+type loxIterator interface {
+	hasNext() bool
+	next() interface{}
+}
+
+func getIterator(interpreter *Interpreter, token *scanner.Token, value interface{}) loxIterator {
+	if s, ok := value.(string); ok {
+		return newStringIterator(s)
+	}
+
+	if iterable, ok := value.(loxIterable); ok {
+		return iterable.iterator()
+	}
+
+	if instance, ok := value.(*LoxInstance); ok {
+		return newInstanceIterator(interpreter, token, instance)
+	}
+
+	return nil
+}
+
+type stringIterator struct {
+	chars   []rune
+	current int
+}
+
+func newStringIterator(s string) *stringIterator {
+	return &stringIterator{
+		chars:   []rune(s),
+		current: 0,
+	}
+}
+
+func (iterator *stringIterator) hasNext() bool {
+	return iterator.current < len(iterator.chars)
+}
+
+func (iterator *stringIterator) next() interface{} {
+	c := iterator.chars[iterator.current]
+	iterator.current++
+	return string(c)
+}
+
+// instanceIterator drives a class that implements the iterator protocol: an
+// optional iterate() called once before looping, then done() and next(). A
+// class can also define iterator() returning an object with those methods.
+type instanceIterator struct {
+	interpreter *Interpreter
+	token       *scanner.Token
+	instance    *LoxInstance
+}
+
+func newInstanceIterator(interpreter *Interpreter, token *scanner.Token, instance *LoxInstance) loxIterator {
+	iterator := &instanceIterator{
+		interpreter: interpreter,
+		token:       token,
+		instance:    instance,
+	}
+
+	if instance.class.findMethod("iterator") != nil {
+		target, ok := iterator.invoke("iterator").(*LoxInstance)
+		if !ok {
+			throwTypedError(TypeError, token, "iterator() must return an instance.")
+		}
+
+		iterator.instance = target
+	}
+
+	if iterator.instance.class.findMethod("iterate") != nil {
+		iterator.invoke("iterate")
+	}
+
+	for _, name := range []string{"next", "done"} {
+		if iterator.instance.class.findMethod(name) == nil {
+			throwTypedError(TypeError, token, fmt.Sprintf("Can't iterate over '%s' without a '%s()' method.", iterator.instance.name(), name))
+		}
+	}
+
+	return iterator
+}
+
+func (iterator *instanceIterator) invoke(name string) interface{} {
+	method := iterator.instance.class.findMethod(name)
+	if method.arity() != 0 {
+		throwTypedError(ArityError, iterator.token, fmt.Sprintf("Iterator method '%s' can't take parameters.", name))
+	}
+
+	return method.bind(iterator.instance).call(iterator.interpreter, nil)
+}
+
+func (iterator *instanceIterator) hasNext() bool {
+	return !isTruthy(iterator.invoke("done"))
+}
+
+func (iterator *instanceIterator) next() interface{} {
+	return iterator.invoke("next")
+}
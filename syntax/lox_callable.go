@@ -8,3 +8,26 @@ type LoxCallable interface {
 	name() string
 	callableType() references.FunctionType
 }
+
+// flexibleCallable is a callable that takes a range of argument counts:
+// parameters with defaults can be left out, and a variadic last parameter
+// collects any extra arguments into a list.
+type flexibleCallable interface {
+	requiredArity() int
+	isVariadic() bool
+}
+
+// arityRange returns the fewest and most arguments a callable takes, with a
+// most of -1 when there is no limit.
+func arityRange(callable LoxCallable) (int, int) {
+	flexible, ok := callable.(flexibleCallable)
+	if !ok {
+		return callable.arity(), callable.arity()
+	}
+
+	if flexible.isVariadic() {
+		return flexible.requiredArity(), -1
+	}
+
+	return flexible.requiredArity(), callable.arity()
+}
@@ -1,45 +1,86 @@
 package syntax
 
 import (
+	"fmt"
 	"golox/references"
 	"golox/scanner"
 )
 
 type LoxClass struct {
-	className  string
-	superclass *LoxClass
-	methods    map[string]*LoxFunction
-	fields     map[string]interface{}
+	className     string
+	superclass    *LoxClass
+	methods       map[string]*LoxFunction
+	staticMethods map[string]*LoxFunction
+	getters       map[string]*LoxFunction
+	fields        []*VarCmd
+	closure       *Environment
 }
 
-func NewLoxClass(name string, superclass *LoxClass, methods map[string]*LoxFunction, fields map[string]interface{}) *LoxClass {
+func NewLoxClass(name string, superclass *LoxClass, methods map[string]*LoxFunction, staticMethods map[string]*LoxFunction, getters map[string]*LoxFunction, fields []*VarCmd, closure *Environment) *LoxClass {
 	return &LoxClass{
-		className:  name,
-		superclass: superclass,
-		methods:    methods,
-		fields:     fields,
+		className:     name,
+		superclass:    superclass,
+		methods:       methods,
+		staticMethods: staticMethods,
+		getters:       getters,
+		fields:        fields,
+		closure:       closure,
 	}
 }
 
+// lineage returns class and its superclasses, the most distant first.
+func (class *LoxClass) lineage() []*LoxClass {
+	var classes []*LoxClass
+	for ; class != nil; class = class.superclass {
+		classes = append([]*LoxClass{class}, classes...)
+	}
+
+	return classes
+}
+
 func (class *LoxClass) findMethod(name string) *LoxFunction {
 	if method, ok := class.methods[name]; ok {
 		return method
 	}
 
 	if class.superclass != nil {
-		method := class.superclass.findMethod(name)
-		if method == nil || method.isStatic {
-			return nil
-		}
+		return class.superclass.findMethod(name)
+	}
 
+	return nil
+}
+
+// findStaticMethod looks up a method declared with 'class' or 'static',
+// which subclasses inherit too.
+func (class *LoxClass) findStaticMethod(name string) *LoxFunction {
+	if method, ok := class.staticMethods[name]; ok {
 		return method
 	}
 
+	if class.superclass != nil {
+		return class.superclass.findStaticMethod(name)
+	}
+
+	return nil
+}
+
+// findGetter looks up a property declared without a parameter list, which
+// runs whenever the property is read.
+func (class *LoxClass) findGetter(name string) *LoxFunction {
+	if getter, ok := class.getters[name]; ok {
+		return getter
+	}
+
+	if class.superclass != nil {
+		return class.superclass.findGetter(name)
+	}
+
 	return nil
 }
 
 func (class *LoxClass) call(interpreter *Interpreter, arguments []interface{}) interface{} {
 	instance := NewLoxInstance(class)
+	class.initFields(interpreter, instance)
 
 	initializer := class.findMethod("init")
 	if initializer != nil {
@@ -49,10 +90,38 @@ func (class *LoxClass) call(interpreter *Interpreter, arguments []interface{}) i
 	return instance
 }
 
+// initFields runs the field initializers from the class body against a new
+// instance, superclass first so that subclasses can override the defaults.
+func (class *LoxClass) initFields(interpreter *Interpreter, instance *LoxInstance) {
+	if class.superclass != nil {
+		class.superclass.initFields(interpreter, instance)
+	}
+
+	if len(class.fields) == 0 {
+		return
+	}
+
+	env := NewEnvironment(class.closure)
+	env.define("this", instance)
+
+	previous := interpreter.env
+	interpreter.env = env
+	for _, field := range class.fields {
+		var value interface{}
+		if field.initializer != nil {
+			value = interpreter.evaluate(field.initializer)
+		}
+
+		instance.fields[field.name.Lexeme] = value
+	}
+
+	interpreter.env = previous
+}
+
 func (class *LoxClass) getStaticMethod(name *scanner.Token) *LoxFunction {
-	method := class.findMethod(name.Lexeme)
-	if method == nil || !method.isStatic {
-		return nil
+	method := class.findStaticMethod(name.Lexeme)
+	if method == nil {
+		throwTypedError(NameError, name, fmt.Sprintf("Undefined static method '%s'.", name.Lexeme))
 	}
 
 	return method
@@ -67,6 +136,20 @@ func (class *LoxClass) arity() int {
 	return init.arity()
 }
 
+func (class *LoxClass) isVariadic() bool {
+	init := class.findMethod("init")
+	return init != nil && init.isVariadic()
+}
+
+func (class *LoxClass) requiredArity() int {
+	init := class.findMethod("init")
+	if init == nil {
+		return 0
+	}
+
+	return init.requiredArity()
+}
+
 func (class *LoxClass) name() string {
 	return class.className
 }
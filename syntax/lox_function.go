@@ -2,6 +2,7 @@ package syntax
 
 import (
 	"fmt"
+	"golox/loxerror"
 	"golox/references"
 )
 
@@ -32,20 +33,57 @@ func (fun *LoxFunction) bind(instance *LoxInstance) *LoxFunction {
 }
 
 func (fun *LoxFunction) call(interpreter *Interpreter, arguments []interface{}) interface{} {
-	env := NewEnvironment(fun.closure)
-	for i := 0; i < len(fun.declaration.params); i++ {
-		env.define(fun.declaration.params[i].Lexeme, arguments[i])
+	if fun.declaration.generator {
+		return NewLoxGenerator(interpreter, fun, arguments)
 	}
 
+	result := fun.run(interpreter, arguments)
+
+	// A tail call returns the call to make instead of a value, once the
+	// frame it was made from is gone. Its callee takes over that frame.
+	for {
+		tail, ok := result.(*tailCall)
+		if !ok {
+			return result
+		}
+
+		if n := len(interpreter.frames); n > 0 {
+			interpreter.frames[n-1] = &callFrame{name: tail.function.name(), token: tail.paren, env: interpreter.env}
+		}
+
+		result = tail.function.run(interpreter, tail.arguments)
+	}
+}
+
+// run executes the function's body, even for a generator.
+func (fun *LoxFunction) run(interpreter *Interpreter, arguments []interface{}) interface{} {
+	env := NewEnvironment(fun.closure)
+
 	var resp interface{}
 
 	previous := interpreter.env
+	enclosingDeferred := interpreter.deferred
 	interpreter.env = env
+	interpreter.deferred = nil
 	func() {
+		// Errors in a module's function name the module, including the
+		// line reported below.
+		if module := fun.declaration.module; module != nil {
+			defer module.enter()()
+		}
+
 		defer func() {
 			if r := recover(); r != nil {
+				if err, ok := r.(*RuntimeError); ok {
+					name := fun.declaration.name
+					loxerror.KindRuntimeError(err.kind.String(), err.kind.Code(), name.Type, name.Line, name.Column, name.Lexeme, err.Error())
+					panic(err)
+				}
+
 				if err, ok := r.(error); ok {
-					throwRuntimeError(fun.declaration.name, err.Error())
+					name := fun.declaration.name
+					loxerror.TokenRuntimeError(name.Type, name.Line, name.Column, name.Lexeme, err.Error(), true)
+					panic(err)
 				}
 
 				if fun.isInitializer {
@@ -56,7 +94,13 @@ func (fun *LoxFunction) call(interpreter *Interpreter, arguments []interface{})
 			}
 		}()
 
-		interpreter.executeBlock(fun.declaration.body, env, nil)
+		defer func() {
+			interpreter.runDeferred()
+			interpreter.deferred = enclosingDeferred
+		}()
+
+		fun.bindParameters(interpreter, arguments)
+		interpreter.executeBlock(fun.declaration.body, env)
 	}()
 
 	interpreter.env = previous
@@ -68,10 +112,51 @@ func (fun *LoxFunction) call(interpreter *Interpreter, arguments []interface{})
 	return resp
 }
 
+// bindParameters defines the parameters in the call's environment, which
+// must be the current one. Defaults for omitted arguments are evaluated
+// there, so they can use the parameters before them.
+func (fun *LoxFunction) bindParameters(interpreter *Interpreter, arguments []interface{}) {
+	params := fun.declaration.params
+	for i := 0; i < len(params); i++ {
+		if fun.declaration.variadic && i == len(params)-1 {
+			var rest []interface{}
+			if i < len(arguments) {
+				rest = append(rest, arguments[i:]...)
+			}
+
+			interpreter.env.define(params[i].Lexeme, NewLoxList(rest))
+			break
+		}
+
+		if i < len(arguments) {
+			interpreter.env.define(params[i].Lexeme, arguments[i])
+		} else {
+			interpreter.env.define(params[i].Lexeme, interpreter.evaluate(fun.declaration.defaults[i]))
+		}
+	}
+}
+
 func (fun *LoxFunction) arity() int {
 	return len(fun.declaration.params)
 }
 
+func (fun *LoxFunction) isVariadic() bool {
+	return fun.declaration.variadic
+}
+
+func (fun *LoxFunction) requiredArity() int {
+	required := 0
+	for i := range fun.declaration.params {
+		if fun.declaration.defaults[i] != nil || (fun.declaration.variadic && i == len(fun.declaration.params)-1) {
+			break
+		}
+
+		required++
+	}
+
+	return required
+}
+
 func (fun *LoxFunction) String() string {
 	return fmt.Sprintf("<fn %s>", fun.declaration.name.Lexeme)
 }
@@ -4,17 +4,25 @@ import (
 	"fmt"
 	"golox/references"
 	"golox/scanner"
+	"sync/atomic"
 )
 
 type LoxInstance struct {
 	class  *LoxClass
 	fields map[string]interface{}
+	// id counts the instances made before this one, for hashing it by
+	// identity.
+	id uint64
 }
 
+// instanceCount is how many instances have been made.
+var instanceCount uint64
+
 func NewLoxInstance(class *LoxClass) *LoxInstance {
 	return &LoxInstance{
 		class:  class,
-		fields: class.fields,
+		fields: make(map[string]interface{}),
+		id:     atomic.AddUint64(&instanceCount, 1),
 	}
 }
 
@@ -35,11 +43,11 @@ func (instance *LoxInstance) callableType() references.FunctionType {
 }
 
 func (instance *LoxInstance) getMethod(name *scanner.Token) interface{} {
-	if method := instance.class.findMethod(name.Lexeme); method != nil && !method.isStatic {
+	if method := instance.class.findMethod(name.Lexeme); method != nil {
 		return method.bind(instance)
 	}
 
-	throwRuntimeError(name, fmt.Sprintf("Undefined method '%s'.", name.Lexeme))
+	throwTypedError(NameError, name, fmt.Sprintf("Undefined method '%s'.", name.Lexeme))
 	return nil
 }
 
@@ -48,7 +56,7 @@ func (instance *LoxInstance) getField(name *scanner.Token) interface{} {
 		return val
 	}
 
-	throwRuntimeError(name, fmt.Sprintf("Undefined field '%s'.", name.Lexeme))
+	throwTypedError(NameError, name, fmt.Sprintf("Undefined field '%s'.", name.Lexeme))
 	return nil
 }
 
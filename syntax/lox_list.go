@@ -0,0 +1,43 @@
+package syntax
+
+import "strings"
+
+// LoxList is an ordered sequence of values handed to scripts by natives.
+// Scripts loop over it with for-in.
+type LoxList struct {
+	elements []interface{}
+}
+
+func NewLoxList(elements []interface{}) *LoxList {
+	return &LoxList{
+		elements: elements,
+	}
+}
+
+func (list *LoxList) iterator() loxIterator {
+	return &listIterator{list: list}
+}
+
+func (list *LoxList) String() string {
+	var items []string
+	for _, element := range list.elements {
+		items = append(items, stringify(element))
+	}
+
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+type listIterator struct {
+	list    *LoxList
+	current int
+}
+
+func (iterator *listIterator) hasNext() bool {
+	return iterator.current < len(iterator.list.elements)
+}
+
+func (iterator *listIterator) next() interface{} {
+	value := iterator.list.elements[iterator.current]
+	iterator.current++
+	return value
+}
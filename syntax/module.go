@@ -0,0 +1,387 @@
+package syntax
+
+import (
+	"fmt"
+	"golox/loxerror"
+	"golox/references"
+	"golox/scanner"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// loxModule is a file scripts import names from. It is parsed once however
+// many scripts import it, resolved where it is first imported, and run the
+// first time one of those imports runs.
+type loxModule struct {
+	path       string
+	source     string
+	statements []Stmt
+	// declared holds every name the module declares at its top level, and
+	// classes the classes among them, which importers may instantiate.
+	declared map[string]*moduleName
+	classes  map[string]bool
+	// env holds the module's globals once it is resolved, and ran is set
+	// once its statements have run there.
+	env *Environment
+	ran bool
+}
+
+// moduleName is a name declared at the top level of a module.
+type moduleName struct {
+	token    *scanner.Token
+	t        references.FunctionType
+	exported bool
+	stmt     Stmt
+}
+
+// moduleSet holds the modules parsed so far, by path.
+type moduleSet struct {
+	modules map[string]*loxModule
+	// loading are the paths of the scripts being parsed, each imported by
+	// the one before it, for finding import cycles.
+	loading []string
+}
+
+func newModuleSet() *moduleSet {
+	return &moduleSet{modules: map[string]*loxModule{}}
+}
+
+// enter makes errors refer to the module's file until the returned function
+// is called.
+func (module *loxModule) enter() func() {
+	source := loxerror.SetSource(module.source)
+	file := loxerror.SetFile(module.path)
+	return func() {
+		loxerror.SetSource(source)
+		loxerror.SetFile(file)
+	}
+}
+
+// export returns the name the module exports as name, or an error saying
+// why it can't be imported.
+func (module *loxModule) export(name string) (*moduleName, string) {
+	declared, ok := module.declared[name]
+	if !ok {
+		return nil, fmt.Sprintf("%s has no export named '%s'.", module.path, name)
+	}
+
+	if !declared.exported {
+		return nil, fmt.Sprintf("'%s' isn't exported by %s, which declares it at line %d.", name, module.path, declared.token.Line)
+	}
+
+	return declared, ""
+}
+
+// declareModuleNames lists the names declared by a module's top-level
+// statements.
+func declareModuleNames(statements []Stmt) map[string]*moduleName {
+	names := map[string]*moduleName{}
+	add := func(stmt Stmt, token *scanner.Token, t references.FunctionType) {
+		names[token.Lexeme] = &moduleName{token: token, t: t, exported: stmt.info().exported, stmt: stmt}
+	}
+
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *Function:
+			add(s, s.name, references.Function)
+		case *Class:
+			add(s, s.name, references.Klass)
+		case *VarCmd:
+			add(s, s.name, references.None)
+		case *Unpack:
+			for _, name := range s.names {
+				add(s, name, references.None)
+			}
+		case *Enum:
+			add(s, s.name, references.None)
+		}
+	}
+
+	return names
+}
+
+// importDeclaration parses 'import { a, b } from "path";' and the module it
+// names.
+func (parser *AstParser) importDeclaration() Stmt {
+	keyword := parser.previous()
+	if parser.braces > 0 {
+		parser.report(keyword, "Can only import at the top level.")
+	}
+
+	parser.consume(references.LeftBrace, "Expect '{' after 'import'.")
+
+	var names []*scanner.Token
+	seen := map[string]bool{}
+	for !parser.check(references.RightBrace) && !parser.isAtEnd() {
+		name := parser.consume(references.Identifier, "Expect name to import.")
+		if seen[name.Lexeme] {
+			parser.report(name, fmt.Sprintf("'%s' is already imported.", name.Lexeme))
+		}
+
+		seen[name.Lexeme] = true
+		names = append(names, name)
+		if !parser.match(references.Comma) {
+			break
+		}
+	}
+
+	parser.consume(references.RightBrace, "Expect '}' after imported names.")
+	if from := parser.consume(references.Identifier, "Expect 'from' after imported names."); from.Lexeme != "from" {
+		parser.error(from, "Expect 'from' after imported names.")
+	}
+
+	path := parser.consume(references.String, "Expect module path.")
+	parser.consume(references.Semicolon, "Expect ';' after import.")
+
+	stmt := NewImportCmd(keyword, names, path)
+	module := parser.loadModule(path)
+	stmt.(*ImportCmd).module = module
+	for _, name := range names {
+		if module == nil {
+			parser.imported[name.Lexeme] = true
+		} else if module.classes[name.Lexeme] {
+			parser.classes[name.Lexeme] = true
+		}
+	}
+
+	return stmt
+}
+
+// exportDeclaration parses a top-level declaration marked with 'export',
+// which other scripts may import.
+func (parser *AstParser) exportDeclaration() Stmt {
+	keyword := parser.previous()
+	if parser.braces > 0 {
+		parser.report(keyword, "Can only export at the top level.")
+	}
+
+	switch parser.peek().Type {
+	case references.At, references.Class, references.Fun, references.Enum, references.Var, references.Const:
+	default:
+		parser.error(parser.peek(), "Expect declaration after 'export'.")
+	}
+
+	stmt := parser.declaration()
+	if stmt != nil {
+		stmt.info().exported = true
+	}
+
+	return stmt
+}
+
+// loadModule parses the module at the path an import names, relative to the
+// importing script, or returns the one parsed already. When modules aren't
+// read here it returns nil, and the import fails if it runs.
+func (parser *AstParser) loadModule(path *scanner.Token) *loxModule {
+	if parser.readFile == nil || parser.skipModules {
+		return nil
+	}
+
+	name := path.Literal.(string)
+	if filepath.Ext(name) == "" {
+		name += ".lox"
+	}
+
+	if !filepath.IsAbs(name) && parser.path != "" {
+		name = filepath.Join(filepath.Dir(parser.path), name)
+	}
+
+	name = filepath.Clean(name)
+	if len(parser.modules.loading) == 0 && parser.path != "" {
+		parser.modules.loading = []string{filepath.Clean(parser.path)}
+		defer func() {
+			parser.modules.loading = nil
+		}()
+	}
+
+	for i, loading := range parser.modules.loading {
+		if loading == name {
+			cycle := append(append([]string(nil), parser.modules.loading[i:]...), name)
+			parser.error(path, fmt.Sprintf("Import cycle: %s.", strings.Join(cycle, " -> ")))
+		}
+	}
+
+	if module, ok := parser.modules.modules[name]; ok {
+		return module
+	}
+
+	data, err := parser.readFile(name)
+	if err != nil {
+		parser.error(path, fmt.Sprintf("Can't import '%s': %s", path.Literal, err.Error()))
+	}
+
+	module := &loxModule{path: name, source: string(data)}
+	parser.modules.modules[name] = module
+	parser.modules.loading = append(parser.modules.loading, name)
+	defer func() {
+		parser.modules.loading = parser.modules.loading[:len(parser.modules.loading)-1]
+	}()
+
+	restore := module.enter()
+	defer restore()
+
+	moduleParser := NewAstParser(scanner.NewScanner(module.source).ScanTokens())
+	moduleParser.SetFile(name, parser.readFile)
+	moduleParser.modules = parser.modules
+	moduleParser.module = module
+	module.statements = moduleParser.Parse()
+	module.declared = declareModuleNames(module.statements)
+	module.classes = moduleParser.classes
+	return module
+}
+
+// inModule records that a function parsed in a module belongs to it.
+func (parser *AstParser) inModule(function Stmt) Stmt {
+	function.(*Function).module = parser.module
+	return function
+}
+
+// visitImportCmdStmt resolves the module the first time it is imported, then
+// declares the names imported from it as constants.
+func (resolver *Resolver) visitImportCmdStmt(stmt *ImportCmd) interface{} {
+	module := stmt.module
+	if module != nil && module.env == nil {
+		resolver.resolveModule(module)
+	}
+
+	// Every name the module doesn't export is reported before giving up.
+	var failed error
+	for _, name := range stmt.names {
+		t := references.None
+		var exported *moduleName
+		if module != nil {
+			var message string
+			if exported, message = module.export(name.Lexeme); exported == nil {
+				loxerror.TokenError(name.Type, name.Line, name.Column, name.Lexeme, message)
+				failed = fmt.Errorf(message)
+				continue
+			}
+
+			t = exported.t
+		}
+
+		resolver.declare(name, t)
+		resolver.define(name, t)
+		if !resolver.scopes.IsEmpty() {
+			resolver.scopes.Peek().(map[string]*VariableData)[buildKey(name.Lexeme, t)].constant = true
+		}
+
+		if exported != nil {
+			resolver.markDeprecated(exported.stmt, name, t)
+		}
+	}
+
+	if failed != nil {
+		panic(failed)
+	}
+
+	return nil
+}
+
+// resolveModule resolves and checks a module in a scope of its own, which
+// holds the natives but none of the importing script's globals.
+func (resolver *Resolver) resolveModule(module *loxModule) {
+	module.env = NewEnvironment(nil)
+	globals := resolver.interpreter.globals
+	for name, value := range globals.values {
+		if resolver.interpreter.scriptGlobals[name] {
+			continue
+		}
+
+		if globals.constants[name] {
+			module.env.defineConstant(name, value)
+		} else {
+			module.env.define(name, value)
+		}
+	}
+
+	restore := module.enter()
+	defer restore()
+
+	// The module's resolver sees an interpreter holding only the module's
+	// globals, so its declarations aren't taken for the importer's.
+	moduleResolver := NewResolver(&Interpreter{globals: module.env, classes: module.classes, scriptGlobals: map[string]bool{}})
+	moduleResolver.SetStrict(resolver.strict)
+	moduleResolver.Resolve(module.statements)
+	if loxerror.HadError() {
+		return
+	}
+
+	NewChecker().Check(module.statements)
+	for _, warning := range moduleResolver.Warnings() {
+		loxerror.Warning(warning.Token.Line, warning.Token.Column, warning.Token.Lexeme, warning.Message)
+	}
+}
+
+// visitImportCmdStmt runs the module the first time it is imported, then
+// defines the names imported from it.
+func (interpreter *Interpreter) visitImportCmdStmt(stmt *ImportCmd) interface{} {
+	module := stmt.module
+	if module == nil || module.env == nil {
+		throwRuntimeError(stmt.keyword, fmt.Sprintf("Can't import %s here.", stmt.path.Lexeme))
+	}
+
+	if !module.ran {
+		module.ran = true
+		interpreter.runModule(module)
+	}
+
+	for _, name := range stmt.names {
+		interpreter.env.defineConstant(name.Lexeme, module.env.values[name.Lexeme])
+	}
+
+	return nil
+}
+
+// runModule runs a module's statements with its globals in place of the
+// importer's.
+func (interpreter *Interpreter) runModule(module *loxModule) {
+	env, globals := interpreter.env, interpreter.globals
+	restore := module.enter()
+	defer func() {
+		interpreter.env, interpreter.globals = env, globals
+		restore()
+	}()
+
+	interpreter.env, interpreter.globals = module.env, module.env
+	for _, stmt := range module.statements {
+		interpreter.execute(stmt)
+	}
+}
+
+// Import describes an import statement, for tools that rewrite imports.
+// Path is the module's path as written, and Start and End the first and
+// last tokens of the statement.
+type Import struct {
+	Path  string
+	Names []*scanner.Token
+	Start *scanner.Token
+	End   *scanner.Token
+}
+
+// Imports lists the import statements of a program in source order.
+func Imports(statements []Stmt) []*Import {
+	var imports []*Import
+	for _, stmt := range statements {
+		if s, ok := stmt.(*ImportCmd); ok {
+			start, end, _ := StmtTokens(s)
+			imports = append(imports, &Import{Path: s.path.Literal.(string), Names: s.names, Start: start, End: end})
+		}
+	}
+
+	return imports
+}
+
+// Exports lists the names a module's top-level statements export, sorted.
+func Exports(statements []Stmt) []string {
+	var names []string
+	for name, declared := range declareModuleNames(statements) {
+		if declared.exported {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
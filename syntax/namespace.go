@@ -0,0 +1,33 @@
+package syntax
+
+import (
+	"fmt"
+	"golox/scanner"
+)
+
+// LoxNamespace groups related natives under one global name, such as
+// Tmp.dir().
+type LoxNamespace struct {
+	name    string
+	members map[string]interface{}
+}
+
+func NewLoxNamespace(name string, members map[string]interface{}) *LoxNamespace {
+	return &LoxNamespace{
+		name:    name,
+		members: members,
+	}
+}
+
+func (namespace *LoxNamespace) get(name *scanner.Token) interface{} {
+	if member, ok := namespace.members[name.Lexeme]; ok {
+		return member
+	}
+
+	throwTypedError(NameError, name, fmt.Sprintf("Undefined property '%s' in %s.", name.Lexeme, namespace.name))
+	return nil
+}
+
+func (namespace *LoxNamespace) String() string {
+	return "<namespace " + namespace.name + ">"
+}
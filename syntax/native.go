@@ -0,0 +1,70 @@
+package syntax
+
+import "golox/references"
+
+// NativeFunction is a built-in function implemented in Go. Runtime errors
+// should be reported at interpreter.callSite().
+type NativeFunction struct {
+	nativeName string
+	params     int
+	// required is how many of the parameters must be passed. Arguments left
+	// out are not in the slice fn gets.
+	required int
+	// variadic natives take any number of arguments after the required ones.
+	variadic bool
+	fn       func(interpreter *Interpreter, arguments []interface{}) interface{}
+}
+
+func NewNativeFunction(name string, arity int, fn func(interpreter *Interpreter, arguments []interface{}) interface{}) LoxCallable {
+	return newOptionalNative(name, arity, arity, fn)
+}
+
+// newOptionalNative makes a native whose last parameters may be left out.
+func newOptionalNative(name string, required int, arity int, fn func(interpreter *Interpreter, arguments []interface{}) interface{}) LoxCallable {
+	return &NativeFunction{
+		nativeName: name,
+		params:     arity,
+		required:   required,
+		fn:         fn,
+	}
+}
+
+// newVariadicNative makes a native taking required arguments and then any
+// number more.
+func newVariadicNative(name string, required int, fn func(interpreter *Interpreter, arguments []interface{}) interface{}) LoxCallable {
+	return &NativeFunction{
+		nativeName: name,
+		params:     required,
+		required:   required,
+		variadic:   true,
+		fn:         fn,
+	}
+}
+
+func (native *NativeFunction) arity() int {
+	return native.params
+}
+
+func (native *NativeFunction) requiredArity() int {
+	return native.required
+}
+
+func (native *NativeFunction) isVariadic() bool {
+	return native.variadic
+}
+
+func (native *NativeFunction) call(interpreter *Interpreter, arguments []interface{}) interface{} {
+	return native.fn(interpreter, arguments)
+}
+
+func (native *NativeFunction) callableType() references.FunctionType {
+	return references.Function
+}
+
+func (native *NativeFunction) String() string {
+	return "<native fn>"
+}
+
+func (native *NativeFunction) name() string {
+	return native.nativeName
+}
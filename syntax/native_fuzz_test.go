@@ -0,0 +1,162 @@
+package syntax
+
+import (
+	"context"
+	"golox/loxerror"
+	"golox/references"
+	"golox/scanner"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// FuzzNatives calls every native defined in the global environment or in
+// a namespace there with arguments drawn from the edges of what Lox can
+// represent. A native may return anything or fail with a runtime error,
+// but any other panic fails the test. Scripts can't reach the environment,
+// other processes or the disk while it runs.
+func FuzzNatives(f *testing.F) {
+	for seed := int64(1); seed <= 20; seed++ {
+		f.Add(seed)
+	}
+
+	previous := loxerror.SetReporter(nil)
+	defer loxerror.SetReporter(previous)
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		interpreter := NewInterpreter()
+		interpreter.SetOutput(ioutil.Discard)
+		interpreter.SetOSAccess(false)
+		interpreter.SetVFS(NewVFS(nil))
+		defer interpreter.removeTemporaries()
+
+		// Natives that block, such as sleep, give up at once.
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		interpreter.SetContext(ctx)
+
+		// Charts are thrown away rather than written to files.
+		interpreter.SetPlotter(func(chart *Chart) {})
+
+		random := rand.New(rand.NewSource(seed))
+		natives := globalNatives(interpreter)
+		for _, name := range sortedNames(natives) {
+			native := natives[name]
+			arguments := make([]interface{}, native.arity())
+			for i := range arguments {
+				arguments[i] = fuzzValue(random, 3)
+			}
+
+			if r := fuzzCall(interpreter, name, native, arguments); r != nil {
+				var shown []string
+				for _, argument := range arguments {
+					shown = append(shown, stringify(argument))
+				}
+
+				t.Errorf("%s(%s) panicked: %v", name, strings.Join(shown, ", "), r)
+			}
+		}
+	})
+}
+
+func globalNatives(interpreter *Interpreter) map[string]LoxCallable {
+	natives := map[string]LoxCallable{}
+	for name, value := range interpreter.globals.values {
+		if namespace, ok := value.(*LoxNamespace); ok {
+			for member, value := range namespace.members {
+				addNative(natives, name+"."+member, value)
+			}
+		}
+
+		addNative(natives, name, value)
+	}
+
+	return natives
+}
+
+func addNative(natives map[string]LoxCallable, name string, value interface{}) {
+	switch native := value.(type) {
+	case *LoxFunction, *LoxClass:
+	case LoxCallable:
+		natives[name] = native
+	}
+}
+
+func sortedNames(natives map[string]LoxCallable) []string {
+	var names []string
+	for name := range natives {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// fuzzCall calls native as a script would and returns what it panicked
+// with, unless that was a runtime error.
+func fuzzCall(interpreter *Interpreter, name string, native LoxCallable, arguments []interface{}) (panicked interface{}) {
+	token := &scanner.Token{Type: references.RightParen, Lexeme: ")", Line: 1}
+
+	previous := interpreter.saveState()
+	interpreter.frames = []*callFrame{{name: name, token: token, env: interpreter.globals}}
+
+	defer func() {
+		interpreter.restoreState(previous)
+
+		r := recover()
+		if _, ok := r.(*RuntimeError); !ok {
+			panicked = r
+		}
+	}()
+
+	native.call(interpreter, arguments)
+	return nil
+}
+
+// fuzzValue picks a value from the edges of what Lox can represent, with
+// lists nested up to depth deep.
+func fuzzValue(random *rand.Rand, depth int) interface{} {
+	class := NewLoxClass("Fuzz", nil, nil, nil, nil, nil, nil)
+
+	values := []func() interface{}{
+		func() interface{} { return nil },
+		func() interface{} { return random.Intn(2) == 0 },
+		func() interface{} { return int64(0) },
+		func() interface{} { return int64(math.MaxInt64) },
+		func() interface{} { return int64(math.MinInt64) },
+		func() interface{} { return random.Int63n(2001) - 1000 },
+		func() interface{} { return 0.0 },
+		func() interface{} { return math.Copysign(0, -1) },
+		func() interface{} { return math.MaxFloat64 },
+		func() interface{} { return -math.MaxFloat64 },
+		func() interface{} { return math.SmallestNonzeroFloat64 },
+		func() interface{} { return math.Inf(1) },
+		func() interface{} { return math.Inf(-1) },
+		func() interface{} { return math.NaN() },
+		func() interface{} { return random.NormFloat64() * 1e6 },
+		func() interface{} { return "" },
+		func() interface{} { return "é\x00☃" },
+		func() interface{} { return strings.Repeat("x", 1<<16) },
+		func() interface{} { return class },
+		func() interface{} { return NewLoxInstance(class) },
+		func() interface{} { return NewClock() },
+		func() interface{} { return NewLoxRange(0, math.Inf(1), 1) },
+		func() interface{} {
+			if depth == 0 {
+				return NewLoxList(nil)
+			}
+
+			elements := make([]interface{}, random.Intn(4))
+			for i := range elements {
+				elements[i] = fuzzValue(random, depth-1)
+			}
+
+			return NewLoxList(elements)
+		},
+	}
+
+	return values[random.Intn(len(values))]()
+}
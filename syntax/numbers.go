@@ -0,0 +1,232 @@
+package syntax
+
+import (
+	"fmt"
+	"golox/references"
+	"golox/scanner"
+	"math"
+	"strconv"
+)
+
+// Numbers are int64 when written without a decimal point and float64
+// otherwise. Arithmetic on two integers stays an integer unless it
+// overflows; any float operand makes the result a float.
+
+func isNumber(value interface{}) bool {
+	switch value.(type) {
+	case int64, float64:
+		return true
+	}
+
+	return false
+}
+
+// toFloat widens a number to a float64.
+func toFloat(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+
+	return 0, false
+}
+
+// formatNumber is how print, string concatenation and str() write numbers.
+// Floats use the shortest form that reads back as the same value, switching
+// to an exponent when plain digits would be very long.
+func formatNumber(value interface{}) string {
+	if i, ok := value.(int64); ok {
+		return strconv.FormatInt(i, 10)
+	}
+
+	f := value.(float64)
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case f != 0 && (math.Abs(f) >= 1e21 || math.Abs(f) < 1e-6):
+		return strconv.FormatFloat(f, 'e', -1, 64)
+	}
+
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func negate(value interface{}) interface{} {
+	if i, ok := value.(int64); ok && i != math.MinInt64 {
+		return -i
+	}
+
+	f, _ := toFloat(value)
+	return -f
+}
+
+// arithmetic applies +, -, *, /, % or ~/ to two numbers. '/' always divides
+// exactly, giving a float, while '~/' rounds the quotient down.
+func arithmetic(operator *scanner.Token, left interface{}, right interface{}) interface{} {
+	l, lInt := left.(int64)
+	r, rInt := right.(int64)
+	if lInt && rInt {
+		if result, ok := integerArithmetic(operator, l, r); ok {
+			return result
+		}
+	}
+
+	lf, _ := toFloat(left)
+	rf, _ := toFloat(right)
+	switch operator.Type {
+	case references.Plus:
+		return lf + rf
+	case references.Minus:
+		return lf - rf
+	case references.Star:
+		return lf * rf
+	case references.Slash:
+		checkDivisor(operator, rf)
+		return lf / rf
+	case references.Modulo:
+		checkDivisor(operator, rf)
+		return math.Mod(lf, rf)
+	case references.TildeSlash:
+		checkDivisor(operator, rf)
+		return math.Floor(lf / rf)
+	}
+
+	return nil
+}
+
+// integerArithmetic reports false when the result doesn't fit in an int64
+// or isn't a whole number, so the operation is redone with floats.
+func integerArithmetic(operator *scanner.Token, l int64, r int64) (int64, bool) {
+	switch operator.Type {
+	case references.Plus:
+		sum := l + r
+		return sum, (sum > l) == (r > 0)
+	case references.Minus:
+		difference := l - r
+		return difference, (difference < l) == (r > 0)
+	case references.Star:
+		if l == 0 || r == 0 {
+			return 0, true
+		}
+
+		product := l * r
+		return product, product/r == l && !(l == -1 && r == math.MinInt64) && !(r == -1 && l == math.MinInt64)
+	case references.Modulo:
+		checkDivisor(operator, float64(r))
+		if r == -1 {
+			return 0, true
+		}
+
+		return l % r, true
+	case references.TildeSlash:
+		checkDivisor(operator, float64(r))
+		if l == math.MinInt64 && r == -1 {
+			return 0, false
+		}
+
+		quotient := l / r
+		if (l%r != 0) && ((l < 0) != (r < 0)) {
+			quotient--
+		}
+
+		return quotient, true
+	}
+
+	return 0, false
+}
+
+// bitwise applies &, |, ^, << or >> to two integers.
+func bitwise(operator *scanner.Token, left interface{}, right interface{}) interface{} {
+	l := toInteger(operator, left)
+	r := toInteger(operator, right)
+	switch operator.Type {
+	case references.Ampersand:
+		return l & r
+	case references.Pipe:
+		return l | r
+	case references.Caret:
+		return l ^ r
+	}
+
+	if r < 0 {
+		throwRuntimeError(operator, "Shift count can't be negative.")
+	}
+
+	if operator.Type == references.LessLess {
+		return l << uint64(r)
+	}
+
+	return l >> uint64(r)
+}
+
+// toInteger converts a bitwise operand to an int64. Floats are accepted only
+// when they hold a whole number, since truncating 1.5 would hide a bug.
+func toInteger(operator *scanner.Token, value interface{}) int64 {
+	switch n := value.(type) {
+	case int64:
+		return n
+	case float64:
+		if n == math.Trunc(n) && n >= math.MinInt64 && n < math.MaxInt64 {
+			return int64(n)
+		}
+	}
+
+	throwTypedError(TypeError, operator, fmt.Sprintf("Operands of '%s' must be integers.", operator.Lexeme))
+	return 0
+}
+
+func checkDivisor(operator *scanner.Token, divisor float64) {
+	if divisor == 0 {
+		throwRuntimeError(operator, "Cannot divide by zero.")
+	}
+}
+
+// compareNumbers applies <, <=, > or >= to two numbers, comparing integers
+// exactly.
+func compareNumbers(operator *scanner.Token, left interface{}, right interface{}) bool {
+	l, lInt := left.(int64)
+	r, rInt := right.(int64)
+	if lInt && rInt {
+		switch operator.Type {
+		case references.Greater:
+			return l > r
+		case references.GreaterEqual:
+			return l >= r
+		case references.Less:
+			return l < r
+		}
+
+		return l <= r
+	}
+
+	lf, _ := toFloat(left)
+	rf, _ := toFloat(right)
+	switch operator.Type {
+	case references.Greater:
+		return lf > rf
+	case references.GreaterEqual:
+		return lf >= rf
+	case references.Less:
+		return lf < rf
+	}
+
+	return lf <= rf
+}
+
+// numbersEqual compares two numbers by value, so 1 == 1.0.
+func numbersEqual(left interface{}, right interface{}) bool {
+	l, lInt := left.(int64)
+	r, rInt := right.(int64)
+	if lInt && rInt {
+		return l == r
+	}
+
+	lf, _ := toFloat(left)
+	rf, _ := toFloat(right)
+	return lf == rf
+}
@@ -0,0 +1,88 @@
+package syntax
+
+import (
+	"fmt"
+	"golox/references"
+	"golox/scanner"
+)
+
+// operatorMethods names the method a class defines to overload each binary
+// operator. '!=' is the negation of 'equals'.
+var operatorMethods = map[references.TokenType]string{
+	references.Plus:           "plus",
+	references.Minus:          "minus",
+	references.Star:           "times",
+	references.Slash:          "divide",
+	references.Modulo:         "modulo",
+	references.TildeSlash:     "floorDivide",
+	references.Ampersand:      "bitAnd",
+	references.Pipe:           "bitOr",
+	references.Caret:          "bitXor",
+	references.LessLess:       "shiftLeft",
+	references.GreaterGreater: "shiftRight",
+	references.Less:           "less",
+	references.LessEqual:      "lessEqual",
+	references.Greater:        "greater",
+	references.GreaterEqual:   "greaterEqual",
+	references.EqualEqual:     "equals",
+	references.BangEqual:      "equals",
+}
+
+// reflectedMethods names the method tried on the right operand when only it
+// is an instance, for operators that still make sense with the operands
+// swapped, as in 2 * vector. A string on the left of '+' is concatenated
+// with the instance as before instead.
+var reflectedMethods = map[references.TokenType]string{
+	references.Plus:         "plus",
+	references.Star:         "times",
+	references.Less:         "greater",
+	references.LessEqual:    "greaterEqual",
+	references.Greater:      "less",
+	references.GreaterEqual: "lessEqual",
+	references.EqualEqual:   "equals",
+	references.BangEqual:    "equals",
+}
+
+// overloadedOperator applies a binary operator through a method on one of
+// its operands, reporting false when neither of them overloads it.
+func (interpreter *Interpreter) overloadedOperator(operator *scanner.Token, left interface{}, right interface{}) (interface{}, bool) {
+	instance, other, name := (*LoxInstance)(nil), right, operatorMethods[operator.Type]
+	if val, ok := left.(*LoxInstance); ok && val.class.findMethod(name) != nil {
+		instance = val
+	} else if val, ok := right.(*LoxInstance); ok && reflectedMethods[operator.Type] != "" && !isConcatenation(operator, left) {
+		instance, other, name = val, left, reflectedMethods[operator.Type]
+	}
+
+	if instance == nil {
+		return nil, false
+	}
+
+	method := instance.class.findMethod(name)
+	if method == nil {
+		return nil, false
+	}
+
+	if method.arity() != 1 {
+		throwTypedError(ArityError, operator, fmt.Sprintf("Method '%s' must take one argument to overload '%s'.", name, operator.Lexeme))
+	}
+
+	result := method.bind(instance).call(interpreter, []interface{}{other})
+	if name == "equals" {
+		if _, ok := result.(bool); !ok {
+			throwTypedError(TypeError, operator, "equals() must return a boolean.")
+		}
+	}
+
+	if operator.Type == references.BangEqual {
+		return !isTruthy(result), true
+	}
+
+	return result, true
+}
+
+// isConcatenation reports whether operator joins left, a string, with
+// whatever is on its right.
+func isConcatenation(operator *scanner.Token, left interface{}) bool {
+	_, ok := left.(string)
+	return ok && operator.Type == references.Plus
+}
@@ -0,0 +1,428 @@
+package syntax
+
+import (
+	"golox/references"
+	"golox/scanner"
+)
+
+// Optimizer rewrites a parsed program before it is resolved. It folds
+// operators whose operands are literals, short-circuits logical operators
+// with a literal on the left, and drops the branches of ifs and the while
+// loops whose conditions are literals that never let them run. Anything
+// that would raise a runtime error, such as dividing by zero, is left for
+// the interpreter to report, and so is integer arithmetic that overflows
+// into a float.
+type Optimizer struct{}
+
+func NewOptimizer() *Optimizer {
+	return &Optimizer{}
+}
+
+// Optimize returns the optimized program. The statements are rewritten in
+// place, so the original list shouldn't be used afterwards.
+func (optimizer *Optimizer) Optimize(statements []Stmt) []Stmt {
+	return optimizer.stmts(statements)
+}
+
+func (optimizer *Optimizer) stmts(statements []Stmt) []Stmt {
+	optimized := statements[:0]
+	for _, stmt := range statements {
+		if stmt = optimizer.stmt(stmt); stmt != nil {
+			optimized = append(optimized, stmt)
+		}
+	}
+
+	return optimized
+}
+
+// stmt returns the optimized statement, or nil when it does nothing.
+func (optimizer *Optimizer) stmt(stmt Stmt) Stmt {
+	if stmt == nil {
+		return nil
+	}
+
+	optimized, _ := stmt.accept(optimizer).(Stmt)
+	return optimized
+}
+
+// body is stmt for a statement another one needs, such as a loop's body,
+// which becomes an empty block rather than nil.
+func (optimizer *Optimizer) body(stmt Stmt) Stmt {
+	if optimized := optimizer.stmt(stmt); optimized != nil {
+		return optimized
+	}
+
+	return NewBlock(nil)
+}
+
+func (optimizer *Optimizer) expr(expr Expr) Expr {
+	if expr == nil {
+		return nil
+	}
+
+	return expr.accept(optimizer).(Expr)
+}
+
+func (optimizer *Optimizer) exprs(exprs []Expr) {
+	for i, expr := range exprs {
+		exprs[i] = optimizer.expr(expr)
+	}
+}
+
+// literal reports the value of expr when it is a literal.
+func literal(expr Expr) (interface{}, bool) {
+	if l, ok := expr.(*Literal); ok {
+		return l.value, true
+	}
+
+	return nil, false
+}
+
+func (optimizer *Optimizer) visitBlockStmt(stmt *Block) interface{} {
+	stmt.statements = optimizer.stmts(stmt.statements)
+	return stmt
+}
+
+func (optimizer *Optimizer) visitExpressionStmt(stmt *Expression) interface{} {
+	stmt.expression = optimizer.expr(stmt.expression)
+	return stmt
+}
+
+func (optimizer *Optimizer) visitFunctionStmt(stmt *Function) interface{} {
+	optimizer.exprs(stmt.defaults)
+	stmt.body = optimizer.stmts(stmt.body)
+	return stmt
+}
+
+func (optimizer *Optimizer) visitIfCmdStmt(stmt *IfCmd) interface{} {
+	stmt.condition = optimizer.expr(stmt.condition)
+	if value, ok := literal(stmt.condition); ok {
+		if isTruthy(value) {
+			return optimizer.stmt(stmt.thenBranch)
+		}
+
+		return optimizer.stmt(stmt.elseBranch)
+	}
+
+	stmt.thenBranch = optimizer.body(stmt.thenBranch)
+	stmt.elseBranch = optimizer.stmt(stmt.elseBranch)
+	return stmt
+}
+
+func (optimizer *Optimizer) visitPrintStmt(stmt *Print) interface{} {
+	stmt.expression = optimizer.expr(stmt.expression)
+	return stmt
+}
+
+func (optimizer *Optimizer) visitReturnCmdStmt(stmt *ReturnCmd) interface{} {
+	stmt.value = optimizer.expr(stmt.value)
+	return stmt
+}
+
+func (optimizer *Optimizer) visitVarCmdStmt(stmt *VarCmd) interface{} {
+	stmt.initializer = optimizer.expr(stmt.initializer)
+	return stmt
+}
+
+func (optimizer *Optimizer) visitUnpackStmt(stmt *Unpack) interface{} {
+	stmt.initializer = optimizer.expr(stmt.initializer)
+	return stmt
+}
+
+func (optimizer *Optimizer) visitWhileLoopStmt(stmt *WhileLoop) interface{} {
+	stmt.condition = optimizer.expr(stmt.condition)
+	if value, ok := literal(stmt.condition); ok && !isTruthy(value) {
+		return nil
+	}
+
+	stmt.body = optimizer.body(stmt.body)
+	stmt.increment = optimizer.expr(stmt.increment)
+	return stmt
+}
+
+func (optimizer *Optimizer) visitForInStmt(stmt *ForIn) interface{} {
+	stmt.iterable = optimizer.expr(stmt.iterable)
+	stmt.body = optimizer.body(stmt.body)
+	return stmt
+}
+
+func (optimizer *Optimizer) visitSwitchCmdStmt(stmt *SwitchCmd) interface{} {
+	stmt.subject = optimizer.expr(stmt.subject)
+	for _, c := range stmt.cases {
+		c.value = optimizer.expr(c.value)
+		c.body = optimizer.stmts(c.body)
+	}
+
+	return stmt
+}
+
+func (optimizer *Optimizer) visitMatchStmt(stmt *Match) interface{} {
+	stmt.subject = optimizer.expr(stmt.subject)
+	for _, arm := range stmt.arms {
+		optimizer.pattern(arm.pattern)
+		arm.body = optimizer.body(arm.body)
+	}
+
+	return stmt
+}
+
+func (optimizer *Optimizer) pattern(pattern Pattern) {
+	switch p := pattern.(type) {
+	case *ValuePattern:
+		p.value = optimizer.expr(p.value)
+	case *ListPattern:
+		for _, element := range p.elements {
+			optimizer.pattern(element)
+		}
+	case *FieldsPattern:
+		for _, field := range p.patterns {
+			optimizer.pattern(field)
+		}
+	}
+}
+
+func (optimizer *Optimizer) visitBreakCmdStmt(stmt *BreakCmd) interface{} {
+	return stmt
+}
+
+func (optimizer *Optimizer) visitContinueCmdStmt(stmt *ContinueCmd) interface{} {
+	return stmt
+}
+
+func (optimizer *Optimizer) visitYieldStmt(stmt *Yield) interface{} {
+	stmt.value = optimizer.expr(stmt.value)
+	return stmt
+}
+
+func (optimizer *Optimizer) visitDeferCmdStmt(stmt *DeferCmd) interface{} {
+	stmt.expression = optimizer.expr(stmt.expression)
+	return stmt
+}
+
+func (optimizer *Optimizer) visitEnumStmt(stmt *Enum) interface{} {
+	return stmt
+}
+
+func (optimizer *Optimizer) visitImportCmdStmt(stmt *ImportCmd) interface{} {
+	return stmt
+}
+
+func (optimizer *Optimizer) visitClassStmt(stmt *Class) interface{} {
+	for _, method := range stmt.methods {
+		optimizer.visitFunctionStmt(method)
+	}
+
+	for _, field := range stmt.fields {
+		optimizer.visitVarCmdStmt(field)
+	}
+
+	return stmt
+}
+
+func (optimizer *Optimizer) visitAssignExpr(expr *Assign) interface{} {
+	expr.value = optimizer.expr(expr.value)
+	return expr
+}
+
+func (optimizer *Optimizer) visitBinaryExpr(expr *Binary) interface{} {
+	expr.left = optimizer.expr(expr.left)
+	expr.right = optimizer.expr(expr.right)
+
+	left, lOk := literal(expr.left)
+	right, rOk := literal(expr.right)
+	if !lOk || !rOk {
+		return expr
+	}
+
+	if value, ok := foldBinary(expr, left, right); ok {
+		return folded(value, expr)
+	}
+
+	return expr
+}
+
+// folded is a literal holding value that stands where expr was written.
+func folded(value interface{}, expr Expr) Expr {
+	literal := NewLiteral(value).(*Literal)
+	literal.start, literal.end = exprTokens(expr)
+	return literal
+}
+
+// foldBinary works out a binary operator on two literals the way the
+// interpreter would, reporting false when it would raise an error instead.
+func foldBinary(expr *Binary, left interface{}, right interface{}) (interface{}, bool) {
+	operator := expr.operator
+	_, lString := left.(string)
+	_, rString := right.(string)
+	numbers := isNumber(left) && isNumber(right)
+
+	switch operator.Type {
+	case references.EqualEqual:
+		return isEqual(left, right), true
+	case references.BangEqual:
+		return !isEqual(left, right), true
+	case references.Greater, references.GreaterEqual, references.Less, references.LessEqual:
+		if lString && rString {
+			return compareStrings(operator, left.(string), right.(string)), true
+		}
+
+		if numbers {
+			return compareNumbers(operator, left, right), true
+		}
+	case references.Plus:
+		if numbers {
+			return arithmetic(operator, left, right), !overflows(operator, left, right)
+		}
+
+		if lString || rString {
+			return stringify(left) + stringify(right), true
+		}
+	case references.Minus, references.Star:
+		if numbers {
+			return arithmetic(operator, left, right), !overflows(operator, left, right)
+		}
+	case references.Slash, references.Modulo, references.TildeSlash:
+		if divisor, ok := toFloat(right); ok && numbers && divisor != 0 {
+			return arithmetic(operator, left, right), true
+		}
+	case references.Ampersand, references.Pipe, references.Caret:
+		if isWholeNumber(left) && isWholeNumber(right) {
+			return bitwise(operator, left, right), true
+		}
+	case references.LessLess, references.GreaterGreater:
+		if isWholeNumber(left) && isWholeNumber(right) {
+			if count, _ := toFloat(right); count >= 0 {
+				return bitwise(operator, left, right), true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// overflows reports whether an integer +, - or * leaves the int64 range,
+// so the interpreter would redo it with floats. Those are left unfolded so
+// the program keeps the integers it was written with.
+func overflows(operator *scanner.Token, left interface{}, right interface{}) bool {
+	l, lInt := left.(int64)
+	r, rInt := right.(int64)
+	if !lInt || !rInt {
+		return false
+	}
+
+	_, ok := integerArithmetic(operator, l, r)
+	return !ok
+}
+
+// isWholeNumber reports whether toInteger accepts value.
+func isWholeNumber(value interface{}) bool {
+	_, ok := integral(value)
+	return ok
+}
+
+func (optimizer *Optimizer) visitCallExpr(expr *Call) interface{} {
+	expr.callee = optimizer.expr(expr.callee)
+	optimizer.exprs(expr.arguments)
+	return expr
+}
+
+func (optimizer *Optimizer) visitSpawnExpr(expr *Spawn) interface{} {
+	optimizer.visitCallExpr(expr.call)
+	return expr
+}
+
+func (optimizer *Optimizer) visitSpreadExpr(expr *Spread) interface{} {
+	expr.expression = optimizer.expr(expr.expression)
+	return expr
+}
+
+func (optimizer *Optimizer) visitGetMethodExpr(expr *GetMethod) interface{} {
+	expr.object = optimizer.expr(expr.object)
+	return expr
+}
+
+func (optimizer *Optimizer) visitGetFieldExpr(expr *GetField) interface{} {
+	expr.object = optimizer.expr(expr.object)
+	return expr
+}
+
+func (optimizer *Optimizer) visitSetExpr(expr *Set) interface{} {
+	expr.object = optimizer.expr(expr.object)
+	expr.value = optimizer.expr(expr.value)
+	return expr
+}
+
+func (optimizer *Optimizer) visitSuperExpr(expr *Super) interface{} {
+	return expr
+}
+
+func (optimizer *Optimizer) visitThisExpr(expr *This) interface{} {
+	return expr
+}
+
+func (optimizer *Optimizer) visitGroupingExpr(expr *Grouping) interface{} {
+	expr.expression = optimizer.expr(expr.expression)
+	if _, ok := literal(expr.expression); ok {
+		return expr.expression
+	}
+
+	return expr
+}
+
+func (optimizer *Optimizer) visitLiteralExpr(expr *Literal) interface{} {
+	return expr
+}
+
+func (optimizer *Optimizer) visitLogicalExpr(expr *Logical) interface{} {
+	expr.left = optimizer.expr(expr.left)
+	expr.right = optimizer.expr(expr.right)
+
+	left, ok := literal(expr.left)
+	if !ok {
+		return expr
+	}
+
+	switch expr.operator.Type {
+	case references.Or:
+		if isTruthy(left) {
+			return expr.left
+		}
+	case references.QuestionQuestion:
+		if left != nil {
+			return expr.left
+		}
+	default:
+		if !isTruthy(left) {
+			return expr.left
+		}
+	}
+
+	return expr.right
+}
+
+func (optimizer *Optimizer) visitUnaryExpr(expr *Unary) interface{} {
+	expr.right = optimizer.expr(expr.right)
+	right, ok := literal(expr.right)
+	if !ok {
+		return expr
+	}
+
+	switch expr.operator.Type {
+	case references.Bang:
+		return folded(!isTruthy(right), expr)
+	case references.Minus:
+		if isNumber(right) {
+			return folded(negate(right), expr)
+		}
+	case references.Tilde:
+		if isWholeNumber(right) {
+			return folded(^toInteger(expr.operator, right), expr)
+		}
+	}
+
+	return expr
+}
+
+func (optimizer *Optimizer) visitVariableExpr(expr *Variable) interface{} {
+	return expr
+}
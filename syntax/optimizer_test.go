@@ -0,0 +1,67 @@
+package syntax
+
+import (
+	"golox/loxerror"
+	"golox/scanner"
+	"strings"
+	"testing"
+)
+
+// TestOptimizer runs the optimizer over small programs and compares the
+// formatted result. The parser already rejects dividing by a literal zero,
+// so those cases reach a zero by folding first. Anything with an effect,
+// an error or an overflow the interpreter has to see is left as written.
+func TestOptimizer(t *testing.T) {
+	previous := loxerror.SetReporter(nil)
+	defer loxerror.SetReporter(previous)
+
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"integer arithmetic", "print 1 + 2 * 3;", "print 7;"},
+		{"float arithmetic", "print 1.5 * 2;", "print 3;"},
+		{"division", "print 7 / 2;", "print 3.5;"},
+		{"floor division", "print 7 ~/ 2;", "print 3;"},
+		{"modulo", "print 7 % 3;", "print 1;"},
+		{"grouping", "print (1 + 2) * 3;", "print 9;"},
+		{"negation", "print -(3);", "print -3;"},
+		{"not", "print !true;", "print false;"},
+		{"bitwise", "print ~0 & 6 | 1;", "print 7;"},
+		{"concatenation", `print "a" + "b" + 1;`, `print "ab1";`},
+		{"comparison", `print 1 < 2 and "a" == "a";`, "print true;"},
+		{"logical", "print nil ?? 4;", "print 4;"},
+		{"if true", "if (1 < 2) print 1; else print 2;", "print 1;"},
+		{"if false", "if (false) print 1; else print 2;", "print 2;"},
+		{"if false without else", "if (nil) print 1;\nprint 2;", "print 2;"},
+		{"while false", "while (1 > 2) print 1;\nprint 2;", "print 2;"},
+		{"for false", "for (;false;) print 1;\nprint 2;", "print 2;"},
+		{"function body", "fun f() {\n  return 2 * 3;\n}", "fun f() {\n  return 6;\n}"},
+
+		{"call", "fun f() {\n  return 1;\n}\nprint f() * 0;", "fun f() {\n  return 1;\n}\nprint f() * 0;"},
+		{"assignment", "var a = 1;\nprint (a = 2) + 1;", "var a = 1;\nprint (a = 2) + 1;"},
+		{"while true", "while (true) print 1;", "while (true)\n  print 1;"},
+		{"floor division by zero", "print 1 ~/ (1 - 1);", "print 1 ~/ 0;"},
+		{"modulo by zero", "print 1 % 0;", "print 1 % 0;"},
+		{"division by zero", "print 1 / (2 - 2.0);", "print 1 / 0;"},
+		{"addition overflow", "print 9223372036854775807 + 1;", "print 9223372036854775807 + 1;"},
+		{"multiplication overflow", "print 4611686018427387904 * 2;", "print 4611686018427387904 * 2;"},
+		{"string minus", `print "a" - 1;`, `print "a" - 1;`},
+		{"negative shift", "print 1 << -1;", "print 1 << -1;"},
+	}
+
+	for _, test := range tests {
+		statements := NewAstParser(scanner.NewScanner(test.source).ScanTokens()).Parse()
+		if loxerror.HadError() {
+			loxerror.Reset()
+			t.Errorf("%s: %q didn't parse", test.name, test.source)
+			continue
+		}
+
+		got := strings.TrimSpace(Format(NewOptimizer().Optimize(statements), nil))
+		if got != test.want {
+			t.Errorf("%s: optimizing %q gave %q, want %q", test.name, test.source, got, test.want)
+		}
+	}
+}
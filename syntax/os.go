@@ -0,0 +1,111 @@
+//go:build !js
+// +build !js
+
+package syntax
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// defineOS adds the natives that reach outside the interpreter, which
+// SetOSAccess and hermetic runs deny: getEnv(name), which returns nil for
+// unset variables, setEnv(name, value), platform(), such as "linux/amd64",
+// and exec(cmd, args), which runs a program and returns its stdout and exit
+// code as a list. Browser builds leave them out.
+func defineOS(env *Environment) {
+	env.define("getEnv", NewNativeFunction("getEnv", 1, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		interpreter.checkOSAccess("getEnv")
+		name, ok := arguments[0].(string)
+		if !ok {
+			throwTypedError(TypeError, interpreter.callSite(), "getEnv() expects a variable name.")
+		}
+
+		if value, ok := os.LookupEnv(name); ok {
+			return value
+		}
+
+		return nil
+	}))
+
+	env.define("setEnv", NewNativeFunction("setEnv", 2, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		interpreter.checkOSAccess("setEnv")
+		name, ok := arguments[0].(string)
+		value, valueOk := arguments[1].(string)
+		if !ok || !valueOk {
+			throwTypedError(TypeError, interpreter.callSite(), "setEnv() expects a variable name and a string.")
+		}
+
+		if err := os.Setenv(name, value); err != nil {
+			throwTypedError(IoError, interpreter.callSite(), err.Error())
+		}
+
+		return nil
+	}))
+
+	env.define("platform", NewNativeFunction("platform", 0, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		interpreter.checkOSAccess("platform")
+		return runtime.GOOS + "/" + runtime.GOARCH
+	}))
+
+	env.define("exec", NewNativeFunction("exec", 2, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		interpreter.checkOSAccess("exec")
+		name, ok := arguments[0].(string)
+		list, listOk := arguments[1].(*LoxList)
+		if !ok || !listOk {
+			throwTypedError(TypeError, interpreter.callSite(), "exec() expects a command and a list of arguments.")
+		}
+
+		args := make([]string, len(list.elements))
+		for i, element := range list.elements {
+			if args[i], ok = element.(string); !ok {
+				throwTypedError(TypeError, interpreter.callSite(), fmt.Sprintf("exec() expects string arguments, not %s.", typeName(element)))
+			}
+		}
+
+		ctx := interpreter.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		var stdout bytes.Buffer
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Stdout = &stdout
+		cmd.Stderr = os.Stderr
+
+		// Other tasks go on running while the command does.
+		var err error
+		if interpreter.scheduler != nil {
+			interpreter.wait(func() {
+				err = cmd.Run()
+			})
+		} else {
+			err = cmd.Run()
+		}
+
+		if ctx.Err() != nil {
+			throwRuntimeError(interpreter.callSite(), fmt.Sprintf("Run canceled: %s.", ctx.Err()))
+		}
+
+		if _, exited := err.(*exec.ExitError); err != nil && !exited {
+			throwTypedError(IoError, interpreter.callSite(), err.Error())
+		}
+
+		return NewLoxList([]interface{}{stdout.String(), int64(cmd.ProcessState.ExitCode())})
+	}))
+}
+
+// checkOSAccess fails a call to an OS native the interpreter doesn't allow.
+func (interpreter *Interpreter) checkOSAccess(name string) {
+	if interpreter.noOS {
+		throwTypedError(PermissionError, interpreter.callSite(), fmt.Sprintf("%s() isn't allowed here.", name))
+	}
+
+	if interpreter.vfs != nil {
+		throwTypedError(PermissionError, interpreter.callSite(), fmt.Sprintf("%s() isn't allowed in a hermetic run.", name))
+	}
+}
@@ -0,0 +1,5 @@
+package syntax
+
+// defineOS adds nothing in browser builds, which have no environment or
+// processes to reach.
+func defineOS(env *Environment) {}
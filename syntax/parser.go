@@ -1,29 +1,100 @@
 package syntax
 
 import (
+	"errors"
 	"fmt"
 	"golox/loxerror"
 	"golox/references"
 	"golox/scanner"
+	"path/filepath"
 )
 
-var declaredClasses map[string]bool = map[string]bool{}
-var staticContext bool = false
+// maxNesting bounds how deeply the syntax tree can nest. The resolver,
+// checker and interpreter all recurse over the tree, so a machine-generated
+// script much deeper than this would overflow the Go stack instead of
+// getting an error.
+const maxNesting = 10000
+
+// errTooDeep abandons the whole parse, since every enclosing block would
+// otherwise report its own missing '}'.
+var errTooDeep = errors.New("too deeply nested")
 
 type AstParser struct {
-	Tokens  []*scanner.Token
-	Current int
+	Tokens   []*scanner.Token
+	Current  int
+	path     string
+	readFile func(name string) ([]byte, error)
+	// depth is how deeply the node being parsed is nested.
+	depth int
+	// braces counts the '{' consumed and not yet closed, which tells
+	// synchronize where the statement it is skipping ends.
+	braces int
+	// reported is the token of the last error, so the errors it causes at
+	// the same token aren't reported too.
+	reported *scanner.Token
+	// classes holds the names of the classes declared so far, and imported
+	// the names imported from modules that couldn't be read, which may be
+	// classes too.
+	classes  map[string]bool
+	imported map[string]bool
+	// modules are the modules parsed so far, and module the one being
+	// parsed, or nil for the program itself. skipModules leaves the modules
+	// imports name unread.
+	modules     *moduleSet
+	module      *loxModule
+	skipModules bool
 }
 
 func NewAstParser(tokens []*scanner.Token) *AstParser {
 	return &AstParser{
-		Tokens:  tokens,
-		Current: 0,
+		Tokens:   tokens,
+		Current:  0,
+		classes:  map[string]bool{},
+		imported: map[string]bool{},
+		modules:  newModuleSet(),
 	}
 }
 
-func (parser *AstParser) Parse() []Stmt {
-	var statements []Stmt
+// SetInterpreter makes the parser share the class names declared by the
+// scripts interpreter ran, and record the ones it declares there, so a
+// later script or REPL line can instantiate them. Modules those scripts
+// imported aren't parsed again.
+func (parser *AstParser) SetInterpreter(interpreter *Interpreter) {
+	parser.classes = interpreter.classes
+	parser.modules = interpreter.modules
+}
+
+// SetFile tells the parser the path of the script for __file__ and for
+// finding the files embedText reads and the modules it imports. readFile is
+// how those reach the filesystem; while it is nil, embedding is refused and
+// imported modules aren't read.
+func (parser *AstParser) SetFile(path string, readFile func(name string) ([]byte, error)) {
+	parser.path = path
+	parser.readFile = readFile
+}
+
+// AssumeClasses makes the parser accept instantiations of the named
+// classes without seeing them declared, for tools that may add the imports
+// declaring them.
+func (parser *AstParser) AssumeClasses(names []string) {
+	for _, name := range names {
+		parser.imported[name] = true
+	}
+}
+
+// SkipModules makes imports leave the modules they name unread, for tools
+// that only need the importing script's own syntax.
+func (parser *AstParser) SkipModules() {
+	parser.skipModules = true
+}
+
+func (parser *AstParser) Parse() (statements []Stmt) {
+	defer func() {
+		if r := recover(); r != nil && r != errTooDeep {
+			panic(r)
+		}
+	}()
+
 	for !parser.isAtEnd() {
 		statements = append(statements, parser.declaration())
 	}
@@ -31,13 +102,34 @@ func (parser *AstParser) Parse() []Stmt {
 	return statements
 }
 
-func (parser *AstParser) declaration() Stmt {
+func (parser *AstParser) declaration() (stmt Stmt) {
+	start, index, braces := parser.peek(), parser.Current, parser.braces
 	defer func() {
 		if r := recover(); r != nil {
-			parser.synchronize()
+			if r == errTooDeep {
+				panic(r)
+			}
+
+			parser.synchronize(index, braces)
+		}
+
+		if stmt != nil {
+			recordSpan(stmt, start, parser.previous())
 		}
 	}()
 
+	if parser.match(references.Export) {
+		return parser.exportDeclaration()
+	}
+
+	if parser.match(references.Import) {
+		return parser.importDeclaration()
+	}
+
+	if parser.match(references.At) {
+		return parser.annotatedDeclaration()
+	}
+
 	if parser.match(references.Class) {
 		return parser.classDeclaration()
 	}
@@ -46,85 +138,275 @@ func (parser *AstParser) declaration() Stmt {
 		return parser.function("function")
 	}
 
+	if parser.match(references.Enum) {
+		return parser.enumDeclaration()
+	}
+
 	if parser.match(references.Var) {
+		if parser.check(references.LeftParen) {
+			return parser.unpackDeclaration(false)
+		}
+
 		return parser.varDeclaration()
 	}
 
+	if parser.match(references.Const) {
+		if parser.check(references.LeftParen) {
+			return parser.unpackDeclaration(true)
+		}
+
+		return parser.constDeclaration()
+	}
+
 	return parser.statement()
 }
 
+// annotatedDeclaration parses a function or class marked with an
+// annotation, which may be exported after it.
+func (parser *AstParser) annotatedDeclaration() Stmt {
+	hint := parser.deprecation()
+	exported := parser.match(references.Export)
+	if exported && parser.braces > 0 {
+		parser.report(parser.previous(), "Can only export at the top level.")
+	}
+
+	var stmt Stmt
+	if parser.match(references.Class) {
+		stmt = parser.classDeclaration()
+	} else if parser.match(references.Fun) {
+		stmt = parser.function("function")
+	} else {
+		parser.error(parser.peek(), "Expect function or class after annotation.")
+	}
+
+	markDeprecated(stmt, hint)
+	if stmt != nil {
+		stmt.info().exported = exported
+	}
+
+	return stmt
+}
+
+// deprecation parses the annotation after an '@'. The only one is
+// @deprecated, with an optional hint such as @deprecated("use newFn").
+func (parser *AstParser) deprecation() string {
+	name := parser.consume(references.Identifier, "Expect annotation name after '@'.")
+	if name.Lexeme != "deprecated" {
+		parser.report(name, fmt.Sprintf("Unknown annotation '@%s'.", name.Lexeme))
+	}
+
+	hint := ""
+	if parser.match(references.LeftParen) {
+		hint = parser.consume(references.String, "Expect deprecation message.").Literal.(string)
+		parser.consume(references.RightParen, "Expect ')' after deprecation message.")
+	}
+
+	return hint
+}
+
+// enumDeclaration parses 'enum Name { A, B, C }'. A comma may follow the
+// last member.
+func (parser *AstParser) enumDeclaration() Stmt {
+	name := parser.consume(references.Identifier, "Expect enum name.")
+	parser.consume(references.LeftBrace, "Expect '{' before enum body.")
+
+	var members []*scanner.Token
+	seen := map[string]bool{}
+	for !parser.check(references.RightBrace) && !parser.isAtEnd() {
+		member := parser.consume(references.Identifier, "Expect enum member name.")
+		if seen[member.Lexeme] {
+			parser.report(member, fmt.Sprintf("Enum member '%s' is already defined.", member.Lexeme))
+		}
+
+		seen[member.Lexeme] = true
+		members = append(members, member)
+		if !parser.match(references.Comma) {
+			break
+		}
+	}
+
+	parser.consume(references.RightBrace, "Expect '}' after enum body.")
+	return NewEnum(name, members)
+}
+
 func (parser *AstParser) classDeclaration() Stmt {
 	name := parser.consume(references.Identifier, "Expect class name.")
 
+	// Declare the class before its body so methods can instantiate it.
+	if _, ok := parser.classes[name.Lexeme]; ok {
+		parser.report(name, fmt.Sprintf("Class '%s' has already been defined.", name.Lexeme))
+	}
+
+	parser.classes[name.Lexeme] = true
+
 	var superclass *Variable
 	if parser.match(references.Less) {
 		parser.consume(references.Identifier, "Expect superclass name.")
 		superclass = NewVariable(parser.previous(), references.Klass).(*Variable)
 	}
 
+	var traits []*Variable
+	if parser.match(references.With) {
+		for ok := true; ok; ok = parser.match(references.Comma) {
+			parser.consume(references.Identifier, "Expect trait name.")
+			traits = append(traits, NewVariable(parser.previous(), references.Klass).(*Variable))
+		}
+	}
+
 	parser.consume(references.LeftBrace, "Expect '{' before class body.")
 
 	var methods []*Function
 	var fields []*VarCmd
 	for !parser.check(references.RightBrace) && !parser.isAtEnd() {
-		method := parser.function("method")
-		if method == nil {
-			fields = append(fields, parser.varDeclaration().(*VarCmd))
-		} else {
-			methods = append(methods, method.(*Function))
+		method, field := parser.classMember()
+		if method != nil {
+			methods = append(methods, method)
+		}
+
+		if field != nil {
+			fields = append(fields, field)
 		}
 	}
 
 	parser.consume(references.RightBrace, "Expect '}' after class body.")
 
-	if _, ok := declaredClasses[name.Lexeme]; ok {
-		throwError(name, fmt.Sprintf("Class '%s' has already been defined.", name.Lexeme))
+	return NewClass(name, superclass, traits, methods, fields)
+}
+
+// classMember parses a method or field in a class body. After an error it
+// skips to the next member, so the rest of the class is still checked.
+func (parser *AstParser) classMember() (method *Function, field *VarCmd) {
+	index, braces := parser.Current, parser.braces
+	defer func() {
+		if r := recover(); r != nil {
+			if r == errTooDeep {
+				panic(r)
+			}
+
+			parser.synchronize(index, braces)
+			method, field = nil, nil
+		}
+	}()
+
+	annotation := parser.peek()
+	deprecated, hint := false, ""
+	if parser.match(references.At) {
+		deprecated, hint = true, parser.deprecation()
 	}
 
-	declaredClasses[name.Lexeme] = true
+	start := parser.peek()
+	if deprecated && start.Type == references.Var {
+		parser.report(start, "Only methods can be deprecated.")
+	}
 
-	return NewClass(name, superclass, methods, fields)
+	if parser.match(references.Var) {
+		field := parser.varDeclaration()
+		recordSpan(field, start, parser.previous())
+		return nil, field.(*VarCmd)
+	}
+
+	stmt := parser.function("method")
+	if stmt == nil {
+		if deprecated {
+			parser.report(start, "Only methods can be deprecated.")
+		}
+
+		field := parser.varDeclaration()
+		recordSpan(field, start, parser.previous())
+		return nil, field.(*VarCmd)
+	}
+
+	recordSpan(stmt, annotation, parser.previous())
+	if deprecated {
+		markDeprecated(stmt, hint)
+	}
+
+	return stmt.(*Function), nil
 }
 
 func (parser *AstParser) function(kind string) Stmt {
+	defer parser.unnest(parser.depth)
+	parser.nest(parser.peek())
+
 	isStatic := false
 	if parser.peek().Type == references.Static {
 		isStatic = true
 		parser.consume(references.Static, "Expect static declaration for static method.")
+	} else if kind == "method" && parser.match(references.Class) {
+		isStatic = true
 	}
 
 	name := parser.consume(references.Identifier, fmt.Sprintf("Expect %s name.", kind))
-	if parser.peek().Type == references.Equal {
+	if parser.peek().Type == references.Equal || (kind == "method" && parser.peek().Type == references.Colon) {
 		parser.rewind()
 		return nil
 	}
 
+	// A method name followed straight by its body declares a getter, which
+	// runs when the property is read.
+	if kind == "method" && !isStatic && parser.match(references.LeftBrace) {
+		body := parser.block()
+		if name.Lexeme == "init" {
+			parser.report(name, "Can't declare 'init' as a getter.")
+		}
+
+		return parser.inModule(NewFunction(name, nil, body, false, true, nil, nil, false, nil))
+	}
+
 	parser.consume(references.LeftParen, fmt.Sprintf("Expect '(' after %s name", kind))
 
 	var params []*scanner.Token
+	var paramTypes []*scanner.Token
+	var defaults []Expr
+	variadic := false
 	if !parser.check(references.RightParen) {
 		for ok := true; ok; ok = parser.match(references.Comma) {
 			if len(params) > 255 {
-				throwError(parser.peek(), "Can't have more than 255 parameters.")
+				parser.report(parser.peek(), "Can't have more than 255 parameters.")
+			}
+
+			if variadic {
+				parser.error(parser.previous(), "The '...' parameter must be the last one.")
 			}
 
-			params = append(params, parser.consume(references.Identifier, "Expect parameter name."))
+			// A '...' parameter collects the remaining arguments into a
+			// list, so it takes no annotation.
+			if parser.match(references.Ellipsis) {
+				variadic = true
+				params = append(params, parser.consume(references.Identifier, "Expect parameter name after '...'."))
+				paramTypes = append(paramTypes, nil)
+				defaults = append(defaults, nil)
+				continue
+			}
+
+			param := parser.consume(references.Identifier, "Expect parameter name.")
+			params = append(params, param)
+			paramTypes = append(paramTypes, parser.typeAnnotation())
+
+			// Once one parameter has a default, so must the rest, since
+			// arguments can only be left off the end.
+			var value Expr
+			if parser.match(references.Equal) {
+				value = parser.expression()
+			} else if len(defaults) > 0 && defaults[len(defaults)-1] != nil {
+				parser.report(param, "Parameters after one with a default need defaults too.")
+			}
+			defaults = append(defaults, value)
 		}
 	}
 
 	parser.consume(references.RightParen, "Expect ')' after parameters.")
+	returnType := parser.typeAnnotation()
 	parser.consume(references.LeftBrace, fmt.Sprintf("Expect '{' before %s body.", kind))
 
-	ctx := staticContext
-	staticContext = isStatic
 	body := parser.block()
-	staticContext = ctx
 
-	return NewFunction(name, params, body, isStatic)
+	return parser.inModule(NewFunction(name, params, body, isStatic, false, paramTypes, returnType, variadic, defaults))
 }
 
 func (parser *AstParser) varDeclaration() Stmt {
 	name := parser.consume(references.Identifier, "Expect variable name.")
+	annotation := parser.typeAnnotation()
 
 	var initializer Expr
 	if parser.match(references.Equal) {
@@ -132,12 +414,72 @@ func (parser *AstParser) varDeclaration() Stmt {
 	}
 
 	parser.consume(references.Semicolon, "Expect ';' after variable declaration.")
-	return NewVarCmd(name, initializer)
+	return NewVarCmd(name, initializer, false, annotation)
 }
 
-func (parser *AstParser) statement() Stmt {
+func (parser *AstParser) constDeclaration() Stmt {
+	name := parser.consume(references.Identifier, "Expect constant name.")
+	annotation := parser.typeAnnotation()
+	parser.consume(references.Equal, "Expect '=' after constant name.")
+	initializer := parser.expression()
+
+	parser.consume(references.Semicolon, "Expect ';' after constant declaration.")
+	return NewVarCmd(name, initializer, true, annotation)
+}
+
+// unpackDeclaration parses 'var (a, b) = list;', which declares a variable
+// for each element of the list.
+func (parser *AstParser) unpackDeclaration(constant bool) Stmt {
+	keyword := parser.previous()
+	parser.consume(references.LeftParen, "Expect '(' before variable names.")
+
+	var names []*scanner.Token
+	for {
+		names = append(names, parser.consume(references.Identifier, "Expect variable name."))
+		if !parser.match(references.Comma) {
+			break
+		}
+	}
+
+	parser.consume(references.RightParen, "Expect ')' after variable names.")
+	parser.consume(references.Equal, "Expect '=' after variable names.")
+	initializer := parser.expression()
+
+	parser.consume(references.Semicolon, "Expect ';' after variable declaration.")
+	return NewUnpack(keyword, names, initializer, constant)
+}
+
+// typeAnnotation parses an optional ': type' after a variable, parameter or
+// parameter list, returning nil when there is none.
+func (parser *AstParser) typeAnnotation() *scanner.Token {
+	if !parser.match(references.Colon) {
+		return nil
+	}
+
+	if parser.match(references.Nil) {
+		return parser.previous()
+	}
+
+	return parser.consume(references.Identifier, "Expect type name after ':'.")
+}
+
+func (parser *AstParser) statement() (stmt Stmt) {
+	start := parser.peek()
+	defer parser.unnest(parser.depth)
+	parser.nest(start)
+
+	defer func() {
+		if stmt != nil {
+			recordSpan(stmt, start, parser.previous())
+		}
+	}()
+
+	if parser.check(references.Identifier) && parser.peekNext().Type == references.Colon {
+		return parser.labeledStatement()
+	}
+
 	if parser.match(references.For) {
-		return parser.forStatement()
+		return parser.forStatement(nil)
 	}
 
 	if parser.match(references.If) {
@@ -153,11 +495,19 @@ func (parser *AstParser) statement() Stmt {
 	}
 
 	if parser.match(references.While) {
-		return parser.whileStatement()
+		return parser.whileStatement(nil)
+	}
+
+	if parser.match(references.Switch) {
+		return parser.switchStatement()
+	}
+
+	if parser.match(references.Match) {
+		return parser.matchStatement()
 	}
 
 	if parser.match(references.LeftBrace) {
-		return NewBlock(parser.block(), false)
+		return NewBlock(parser.block())
 	}
 
 	if parser.match(references.Break) {
@@ -168,9 +518,33 @@ func (parser *AstParser) statement() Stmt {
 		return parser.continueStatement()
 	}
 
+	if parser.match(references.Yield) {
+		return parser.yieldStatement()
+	}
+
+	if parser.match(references.Defer) {
+		return parser.deferStatement()
+	}
+
 	return parser.expressionStatement()
 }
 
+func (parser *AstParser) labeledStatement() Stmt {
+	label := parser.advance()
+	parser.consume(references.Colon, "Expect ':' after label.")
+
+	if parser.match(references.For) {
+		return parser.forStatement(label)
+	}
+
+	if parser.match(references.While) {
+		return parser.whileStatement(label)
+	}
+
+	parser.error(parser.peek(), "Expect a loop after label.")
+	return nil
+}
+
 func (parser *AstParser) returnStatement() Stmt {
 	keyword := parser.previous()
 
@@ -183,33 +557,56 @@ func (parser *AstParser) returnStatement() Stmt {
 	return NewReturnCmd(keyword, value)
 }
 
+func (parser *AstParser) yieldStatement() Stmt {
+	keyword := parser.previous()
+
+	var value Expr
+	if !parser.check(references.Semicolon) {
+		value = parser.expression()
+	}
+
+	parser.consume(references.Semicolon, "Expect ';' after yield value.")
+	return NewYield(keyword, value)
+}
+
+func (parser *AstParser) deferStatement() Stmt {
+	keyword := parser.previous()
+	expr := parser.expression()
+	parser.consume(references.Semicolon, "Expect ';' after deferred expression.")
+	return NewDeferCmd(keyword, expr)
+}
+
 func (parser *AstParser) continueStatement() Stmt {
 	keyword := parser.previous()
-	depth, found := parser.calculateDepth()
 
-	if !found {
-		throwError(parser.previous(), "Expect 'continue' in a loop.")
+	var label *scanner.Token
+	if parser.match(references.Identifier) {
+		label = parser.previous()
 	}
 
 	parser.consume(references.Semicolon, "Expect ';' after continue.")
-	return NewContinueCmd(keyword, depth)
+	return NewContinueCmd(keyword, label)
 }
 
 func (parser *AstParser) breakStatement() Stmt {
 	keyword := parser.previous()
-	depth, found := parser.calculateDepth()
 
-	if !found {
-		throwError(parser.previous(), "Expect 'break' in a loop.")
+	var label *scanner.Token
+	if parser.match(references.Identifier) {
+		label = parser.previous()
 	}
 
 	parser.consume(references.Semicolon, "Expect ';' after break.")
-	return NewBreakCmd(keyword, depth)
+	return NewBreakCmd(keyword, label)
 }
 
-func (parser *AstParser) forStatement() Stmt {
+func (parser *AstParser) forStatement(label *scanner.Token) Stmt {
 	parser.consume(references.LeftParen, "Expect '(' after for.")
 
+	if parser.check(references.Identifier) && parser.peekNext().Type == references.In {
+		return parser.forInStatement(label)
+	}
+
 	var initializer Stmt
 	if parser.match(references.Semicolon) {
 		initializer = nil
@@ -233,30 +630,219 @@ func (parser *AstParser) forStatement() Stmt {
 
 	body := parser.statement()
 
-	if increment != nil {
-		body = NewBlock([]Stmt{body, NewExpression(increment)}, true)
-	}
-
 	if conditional == nil {
 		conditional = NewLiteral(true)
 	}
-	body = NewWhileLoop(conditional, body)
+	body = NewWhileLoop(conditional, body, increment, label)
 
 	if initializer != nil {
-		body = NewBlock([]Stmt{initializer, body}, false)
+		body = NewBlock([]Stmt{initializer, body})
 	}
 
+	body.info().forLoop = true
 	return body
 }
 
-func (parser *AstParser) whileStatement() Stmt {
+func (parser *AstParser) forInStatement(label *scanner.Token) Stmt {
+	name := parser.consume(references.Identifier, "Expect loop variable name.")
+	parser.consume(references.In, "Expect 'in' after loop variable.")
+	iterable := parser.expression()
+	parser.consume(references.RightParen, "Expect ')' after for-in clause.")
+
+	body := parser.statement()
+
+	return NewForIn(name, iterable, body, label)
+}
+
+func (parser *AstParser) whileStatement(label *scanner.Token) Stmt {
 	parser.consume(references.LeftParen, "Expect '(' after while.")
 	condition := parser.expression()
 	parser.consume(references.RightParen, "Expect ')' after while condition.")
 
 	body := parser.statement()
 
-	return NewWhileLoop(condition, body)
+	return NewWhileLoop(condition, body, nil, label)
+}
+
+func (parser *AstParser) switchStatement() Stmt {
+	keyword := parser.previous()
+	parser.consume(references.LeftParen, "Expect '(' after switch.")
+	subject := parser.expression()
+	parser.consume(references.RightParen, "Expect ')' after switch value.")
+	parser.consume(references.LeftBrace, "Expect '{' before switch body.")
+
+	var cases []*SwitchCase
+	hasDefault := false
+	for !parser.check(references.RightBrace) && !parser.isAtEnd() {
+		caseKeyword := parser.peek()
+		var value Expr
+		if parser.match(references.Case) {
+			value = parser.expression()
+		} else if parser.match(references.Default) {
+			if hasDefault {
+				parser.report(parser.previous(), "Switch can't have more than one default.")
+			}
+
+			hasDefault = true
+		} else {
+			parser.error(parser.peek(), "Expect 'case' or 'default' in switch body.")
+		}
+
+		parser.consume(references.Colon, "Expect ':' after case.")
+
+		var body []Stmt
+		fallsThrough := false
+		for !parser.check(references.Case) && !parser.check(references.Default) && !parser.check(references.RightBrace) && !parser.isAtEnd() {
+			if parser.match(references.Fallthrough) {
+				fallthroughKeyword := parser.previous()
+				parser.consume(references.Semicolon, "Expect ';' after fallthrough.")
+
+				if parser.check(references.RightBrace) {
+					parser.report(fallthroughKeyword, "Can't fall through from the last case.")
+				} else if !parser.check(references.Case) && !parser.check(references.Default) {
+					parser.report(fallthroughKeyword, "Expect 'fallthrough' to be the last statement in a case.")
+				}
+
+				fallsThrough = true
+				break
+			}
+
+			body = append(body, parser.declaration())
+		}
+
+		switchCase := NewSwitchCase(caseKeyword, value, body, fallsThrough)
+		switchCase.end = parser.previous()
+		cases = append(cases, switchCase)
+	}
+
+	parser.consume(references.RightBrace, "Expect '}' after switch body.")
+	return NewSwitchCmd(keyword, subject, cases)
+}
+
+// matchStatement parses 'match (value) { pattern -> statement ... }'. The
+// first arm whose pattern fits runs, and 'else' fits anything.
+func (parser *AstParser) matchStatement() Stmt {
+	keyword := parser.previous()
+	parser.consume(references.LeftParen, "Expect '(' after match.")
+	subject := parser.expression()
+	parser.consume(references.RightParen, "Expect ')' after match value.")
+	parser.consume(references.LeftBrace, "Expect '{' before match body.")
+
+	var arms []*MatchArm
+	hasElse, unreachable := false, false
+	for !parser.check(references.RightBrace) && !parser.isAtEnd() {
+		start := parser.peek()
+		if hasElse && !unreachable {
+			parser.report(start, "Unreachable arm after 'else'.")
+			unreachable = true
+		}
+
+		var pattern Pattern
+		if parser.match(references.Else) {
+			hasElse = true
+		} else {
+			pattern = parser.pattern()
+		}
+
+		parser.consume(references.Arrow, "Expect '->' after pattern.")
+		arms = append(arms, NewMatchArm(start, pattern, parser.statement()))
+	}
+
+	parser.consume(references.RightBrace, "Expect '}' after match body.")
+	return NewMatch(keyword, subject, arms)
+}
+
+// pattern parses a match arm's pattern: a name to bind, '_', a literal, a
+// dotted constant such as Color.Red, 'is Type name', '[a, b, ...rest]' or
+// '{field: pattern}', where '{field}' is short for '{field: field}'.
+func (parser *AstParser) pattern() Pattern {
+	if parser.match(references.Is) {
+		keyword := parser.previous()
+		typeName := parser.consume(references.Identifier, "Expect type name after 'is'.")
+
+		var binding *scanner.Token
+		if parser.match(references.Identifier) {
+			binding = parser.previous()
+		}
+
+		return NewTypePattern(keyword, typeName, binding)
+	}
+
+	if parser.match(references.LeftBracket) {
+		bracket := parser.previous()
+		var elements []Pattern
+		var rest *scanner.Token
+		for !parser.check(references.RightBracket) && !parser.isAtEnd() {
+			if parser.match(references.Ellipsis) {
+				rest = parser.consume(references.Identifier, "Expect name after '...'.")
+				break
+			}
+
+			elements = append(elements, parser.pattern())
+			if !parser.match(references.Comma) {
+				break
+			}
+		}
+
+		closing := parser.consume(references.RightBracket, "Expect ']' after list pattern.")
+		return &ListPattern{bracket: bracket, elements: elements, rest: rest, closing: closing}
+	}
+
+	if parser.match(references.LeftBrace) {
+		brace := parser.previous()
+		var names []*scanner.Token
+		var patterns []Pattern
+		for !parser.check(references.RightBrace) && !parser.isAtEnd() {
+			var name *scanner.Token
+			if parser.match(references.String) {
+				name = parser.previous()
+			} else {
+				name = parser.consume(references.Identifier, "Expect field name.")
+			}
+
+			if parser.match(references.Colon) {
+				patterns = append(patterns, parser.pattern())
+			} else if name.Type == references.Identifier {
+				patterns = append(patterns, &BindingPattern{name: name})
+			} else {
+				parser.error(parser.peek(), "Expect ':' after field name.")
+			}
+
+			names = append(names, name)
+			if !parser.match(references.Comma) {
+				break
+			}
+		}
+
+		closing := parser.consume(references.RightBrace, "Expect '}' after fields pattern.")
+		return &FieldsPattern{brace: brace, names: names, patterns: patterns, closing: closing}
+	}
+
+	if parser.match(references.Identifier) {
+		name := parser.previous()
+		if !parser.check(references.Dot) {
+			return &BindingPattern{name: name}
+		}
+
+		value := NewVariable(name, references.None)
+		for parser.match(references.Dot) {
+			value = NewGetField(value, parser.consume(references.Identifier, "Expect property name after '.'."), false)
+		}
+
+		return &ValuePattern{value: value}
+	}
+
+	if parser.check(references.Minus) && parser.peekNext().Type == references.Number {
+		return &ValuePattern{value: parser.unary()}
+	}
+
+	if parser.check(references.Number) || parser.check(references.String) || parser.check(references.True) ||
+		parser.check(references.False) || parser.check(references.Nil) {
+		return &ValuePattern{value: parser.primary()}
+	}
+
+	parser.error(parser.peek(), "Expect pattern.")
+	return nil
 }
 
 func (parser *AstParser) ifStatement() Stmt {
@@ -302,7 +888,10 @@ func (parser *AstParser) expression() Expr {
 }
 
 func (parser *AstParser) assignment() Expr {
-	expr := parser.or()
+	defer parser.unnest(parser.depth)
+	parser.nest(parser.peek())
+
+	expr := parser.nilCoalescing()
 
 	// TODO - Add in ++ and -- here
 	switch parser.peek().Type {
@@ -313,23 +902,27 @@ func (parser *AstParser) assignment() Expr {
 
 		if v, ok := expr.(*Variable); ok {
 			return NewAssign(v.name, value)
-		} else if val, ok := expr.(*GetMethod); ok {
+		} else if val, ok := expr.(*GetMethod); ok && !val.optional {
 			return NewSet(val.object, val.name, value)
-		} else if val, ok := expr.(*GetField); ok {
+		} else if val, ok := expr.(*GetField); ok && !val.optional {
 			return NewSet(val.object, val.name, value)
 		}
 
-		throwError(equals, "Invalid assignment target.")
+		parser.report(equals, "Invalid assignment target.")
 		break
 	case references.IncrementOne:
 		parser.advance()
 		equals := parser.previous()
 
 		if v, ok := expr.(*Variable); ok {
-			return NewAssign(v.name, NewBinary(v, scanner.NewToken(references.Plus, "+", nil, equals.Line), NewLiteral(float64(1))))
+			one := NewLiteral(int64(1))
+			one.(*Literal).start, one.(*Literal).end = equals, equals
+			assign := NewAssign(v.name, NewBinary(v, scanner.NewToken(references.Plus, "+", nil, equals.Line), one))
+			assign.(*Assign).compound = equals
+			return assign
 		}
 
-		throwError(equals, "Invalid assignment target.")
+		parser.report(equals, "Invalid assignment target.")
 		break
 	case references.Increment:
 		parser.advance()
@@ -337,20 +930,26 @@ func (parser *AstParser) assignment() Expr {
 		value := parser.assignment()
 
 		if v, ok := expr.(*Variable); ok {
-			return NewAssign(v.name, NewBinary(v, scanner.NewToken(references.Plus, "+", nil, equals.Line), value))
+			assign := NewAssign(v.name, NewBinary(v, scanner.NewToken(references.Plus, "+", nil, equals.Line), value))
+			assign.(*Assign).compound = equals
+			return assign
 		}
 
-		throwError(equals, "Invalid assignment target.")
+		parser.report(equals, "Invalid assignment target.")
 		break
 	case references.DecrementOne:
 		parser.advance()
 		equals := parser.previous()
 
 		if v, ok := expr.(*Variable); ok {
-			return NewAssign(v.name, NewBinary(v, scanner.NewToken(references.Minus, "-", nil, equals.Line), NewLiteral(float64(1))))
+			one := NewLiteral(int64(1))
+			one.(*Literal).start, one.(*Literal).end = equals, equals
+			assign := NewAssign(v.name, NewBinary(v, scanner.NewToken(references.Minus, "-", nil, equals.Line), one))
+			assign.(*Assign).compound = equals
+			return assign
 		}
 
-		throwError(equals, "Invalid assignment target.")
+		parser.report(equals, "Invalid assignment target.")
 		break
 	case references.Decrement:
 		parser.advance()
@@ -358,21 +957,39 @@ func (parser *AstParser) assignment() Expr {
 		value := parser.assignment()
 
 		if v, ok := expr.(*Variable); ok {
-			return NewAssign(v.name, NewBinary(v, scanner.NewToken(references.Minus, "-", nil, equals.Line), value))
+			assign := NewAssign(v.name, NewBinary(v, scanner.NewToken(references.Minus, "-", nil, equals.Line), value))
+			assign.(*Assign).compound = equals
+			return assign
 		}
 
-		throwError(equals, "Invalid assignment target.")
+		parser.report(equals, "Invalid assignment target.")
 		break
 	}
 
 	return expr
 }
 
+func (parser *AstParser) nilCoalescing() Expr {
+	defer parser.unnest(parser.depth)
+	expr := parser.or()
+
+	for parser.match(references.QuestionQuestion) {
+		operator := parser.previous()
+		parser.nest(operator)
+		right := parser.or()
+		expr = NewLogical(expr, operator, right)
+	}
+
+	return expr
+}
+
 func (parser *AstParser) or() Expr {
+	defer parser.unnest(parser.depth)
 	expr := parser.and()
 
 	for parser.match(references.Or) {
 		operator := parser.previous()
+		parser.nest(operator)
 		right := parser.and()
 		expr = NewLogical(expr, operator, right)
 	}
@@ -381,22 +998,68 @@ func (parser *AstParser) or() Expr {
 }
 
 func (parser *AstParser) and() Expr {
-	expr := parser.equality()
+	defer parser.unnest(parser.depth)
+	expr := parser.bitOr()
 
 	for parser.match(references.And) {
 		operator := parser.previous()
-		right := parser.equality()
+		parser.nest(operator)
+		right := parser.bitOr()
 		expr = NewLogical(expr, operator, right)
 	}
 
 	return expr
 }
 
+func (parser *AstParser) bitOr() Expr {
+	defer parser.unnest(parser.depth)
+	expr := parser.bitXor()
+
+	for parser.match(references.Pipe) {
+		operator := parser.previous()
+		parser.nest(operator)
+		right := parser.bitXor()
+		expr = NewBinary(expr, operator, right)
+	}
+
+	return expr
+}
+
+func (parser *AstParser) bitXor() Expr {
+	defer parser.unnest(parser.depth)
+	expr := parser.bitAnd()
+
+	for parser.match(references.Caret) {
+		operator := parser.previous()
+		parser.nest(operator)
+		right := parser.bitAnd()
+		expr = NewBinary(expr, operator, right)
+	}
+
+	return expr
+}
+
+func (parser *AstParser) bitAnd() Expr {
+	defer parser.unnest(parser.depth)
+	expr := parser.equality()
+
+	for parser.match(references.Ampersand) {
+		operator := parser.previous()
+		parser.nest(operator)
+		right := parser.equality()
+		expr = NewBinary(expr, operator, right)
+	}
+
+	return expr
+}
+
 func (parser *AstParser) equality() Expr {
+	defer parser.unnest(parser.depth)
 	expr := parser.comparison()
 
 	for parser.match(references.BangEqual, references.EqualEqual) {
 		operator := parser.previous()
+		parser.nest(operator)
 		right := parser.comparison()
 		expr = NewBinary(expr, operator, right)
 	}
@@ -405,10 +1068,26 @@ func (parser *AstParser) equality() Expr {
 }
 
 func (parser *AstParser) comparison() Expr {
-	expr := parser.addition()
+	defer parser.unnest(parser.depth)
+	expr := parser.shift()
 
 	for parser.match(references.Greater, references.GreaterEqual, references.Less, references.LessEqual) {
 		operator := parser.previous()
+		parser.nest(operator)
+		right := parser.shift()
+		expr = NewBinary(expr, operator, right)
+	}
+
+	return expr
+}
+
+func (parser *AstParser) shift() Expr {
+	defer parser.unnest(parser.depth)
+	expr := parser.addition()
+
+	for parser.match(references.LessLess, references.GreaterGreater) {
+		operator := parser.previous()
+		parser.nest(operator)
 		right := parser.addition()
 		expr = NewBinary(expr, operator, right)
 	}
@@ -417,10 +1096,12 @@ func (parser *AstParser) comparison() Expr {
 }
 
 func (parser *AstParser) addition() Expr {
+	defer parser.unnest(parser.depth)
 	expr := parser.multiplication()
 
 	for parser.match(references.Minus, references.Plus) {
 		operator := parser.previous()
+		parser.nest(operator)
 		right := parser.multiplication()
 		expr = NewBinary(expr, operator, right)
 	}
@@ -429,16 +1110,19 @@ func (parser *AstParser) addition() Expr {
 }
 
 func (parser *AstParser) multiplication() Expr {
+	defer parser.unnest(parser.depth)
 	expr := parser.unary()
 
-	for parser.match(references.Slash, references.Star, references.Modulo) {
+	for parser.match(references.Slash, references.Star, references.Modulo, references.TildeSlash) {
 		operator := parser.previous()
+		parser.nest(operator)
 		right := parser.unary()
 
 		val := parser.previous().Literal
 		if val != nil {
-			if f, ok := val.(float64); operator.Type == references.Slash && ok && f == 0 {
-				throwError(operator, "Cannot divide by zero.")
+			isDivision := operator.Type == references.Slash || operator.Type == references.TildeSlash
+			if f, ok := toFloat(val); isDivision && ok && f == 0 {
+				parser.report(operator, "Cannot divide by zero.")
 			}
 		}
 
@@ -449,12 +1133,24 @@ func (parser *AstParser) multiplication() Expr {
 }
 
 func (parser *AstParser) unary() Expr {
-	if parser.match(references.Bang, references.Minus) {
+	defer parser.unnest(parser.depth)
+	if parser.match(references.Bang, references.Minus, references.Tilde) {
 		operator := parser.previous()
+		parser.nest(operator)
 		right := parser.unary()
 		return NewUnary(operator, right)
 	}
 
+	if parser.match(references.Spawn) {
+		keyword := parser.previous()
+		call, ok := parser.call().(*Call)
+		if !ok {
+			parser.error(keyword, "Expect function call after 'spawn'.")
+		}
+
+		return NewSpawn(keyword, call)
+	}
+
 	return parser.call()
 }
 
@@ -464,35 +1160,41 @@ func (parser *AstParser) call() Expr {
 		isInstance = true
 	}
 
+	defer parser.unnest(parser.depth)
 	expr := parser.primary()
 
 	for {
+		if parser.check(references.LeftParen) || parser.check(references.Dot) || parser.check(references.QuestionDot) {
+			parser.nest(parser.peek())
+		}
+
 		if parser.match(references.LeftParen) {
 			prev := parser.previousIndex(parser.Current - 2)
+			// These mistakes leave the call readable, so the parse goes on
+			// past them rather than skipping to the end of the statement.
 			if isInstance {
 				isInstance = false
 
-				if _, ok := expr.(*Variable); !ok {
-					throwError(prev, "Expected class name after 'new'.")
-				}
-
-				if _, ok := declaredClasses[prev.Lexeme]; !ok {
-					throwError(prev, fmt.Sprintf("Undefined class '%s'.", prev.Lexeme))
+				if variable, ok := expr.(*Variable); !ok {
+					parser.report(prev, "Expected class name after 'new'.")
+				} else if _, ok := parser.classes[prev.Lexeme]; !ok && !parser.imported[prev.Lexeme] {
+					parser.report(prev, fmt.Sprintf("Undefined class '%s'.", prev.Lexeme))
 				} else {
-					expr.(*Variable).t = references.Klass
+					variable.t = references.Klass
 				}
 			} else {
-				if _, ok := declaredClasses[prev.Lexeme]; ok {
-					throwError(prev, "Expected 'new' before instantiation.")
+				if _, ok := parser.classes[prev.Lexeme]; ok {
+					parser.report(prev, "Expected 'new' before instantiation.")
 				}
 			}
 			expr = parser.finishCall(expr)
-		} else if parser.match(references.Dot) {
-			name := parser.consume(references.Identifier, "Expect property name after '.'.")
+		} else if parser.match(references.Dot, references.QuestionDot) {
+			optional := parser.previous().Type == references.QuestionDot
+			name := parser.consume(references.Identifier, fmt.Sprintf("Expect property name after '%s'.", parser.previous().Lexeme))
 			if parser.peek().Type == references.LeftParen {
-				expr = NewGetMethod(expr, name)
+				expr = NewGetMethod(expr, name, optional)
 			} else {
-				expr = NewGetField(expr, name)
+				expr = NewGetField(expr, name, optional)
 			}
 		} else {
 			break
@@ -507,9 +1209,10 @@ func (parser *AstParser) finishCall(callee Expr) Expr {
 	if !parser.check(references.RightParen) {
 		for ok := true; ok; ok = parser.match(references.Comma) {
 			if len(arguments) > 255 {
-				throwError(parser.peek(), "Can't have more than 255 arguments.")
+				parser.report(parser.peek(), "Can't have more than 255 arguments.")
 			}
-			arguments = append(arguments, parser.expression())
+
+			arguments = append(arguments, parser.argument())
 		}
 	}
 
@@ -517,21 +1220,85 @@ func (parser *AstParser) finishCall(callee Expr) Expr {
 	return NewCall(callee, paren, arguments)
 }
 
-func (parser *AstParser) primary() Expr {
-	if parser.match(references.False) {
-		return NewLiteral(false)
+// argument parses one argument of a call. After an error it skips to the
+// next ',' or the closing ')', so the arguments after it are still checked
+// and the statement goes on after the call.
+func (parser *AstParser) argument() (argument Expr) {
+	depth, braces := parser.depth, parser.braces
+	defer func() {
+		if r := recover(); r != nil {
+			if r == errTooDeep || !parser.skipArgument(braces) {
+				panic(r)
+			}
+
+			parser.unnest(depth)
+			if argument == nil {
+				argument = NewLiteral(nil)
+			}
+		}
+	}()
+
+	if parser.match(references.Ellipsis) {
+		ellipsis := parser.previous()
+		argument = NewSpread(ellipsis, parser.expression())
+	} else {
+		argument = parser.expression()
 	}
 
-	if parser.match(references.True) {
-		return NewLiteral(true)
+	if !parser.check(references.Comma) && !parser.check(references.RightParen) {
+		parser.error(parser.peek(), "Expect ')' after arguments.")
 	}
 
-	if parser.match(references.Nil) {
-		return NewLiteral(nil)
+	return argument
+}
+
+// skipArgument skips to the ',' or ')' ending the argument being parsed,
+// reporting false when the statement ends first.
+func (parser *AstParser) skipArgument(braces int) bool {
+	parens := 0
+	for !parser.isAtEnd() {
+		if parser.braces == braces && parens == 0 {
+			switch parser.peek().Type {
+			case references.Comma, references.RightParen:
+				return true
+			case references.Semicolon, references.RightBrace:
+				return false
+			}
+		}
+
+		switch parser.advance().Type {
+		case references.LeftParen:
+			parens++
+		case references.RightParen:
+			parens--
+		}
+
+		if parser.braces < braces {
+			return false
+		}
 	}
 
-	if parser.match(references.Number, references.String) {
-		return NewLiteral(parser.previous().Literal)
+	return false
+}
+
+func (parser *AstParser) primary() Expr {
+	if parser.match(references.False, references.True, references.Nil, references.Number, references.String) {
+		var literal Expr
+		switch token := parser.previous(); token.Type {
+		case references.False:
+			literal = NewLiteral(false)
+		case references.True:
+			literal = NewLiteral(true)
+		case references.Nil:
+			literal = NewLiteral(nil)
+		default:
+			literal = NewLiteral(token.Literal)
+		}
+
+		literal.(*Literal).text = parser.previous().Lexeme
+		literal.(*Literal).start = parser.previous()
+		literal.(*Literal).end = parser.previous()
+		return literal
 	}
 
 	if parser.match(references.Super) {
@@ -542,60 +1309,136 @@ func (parser *AstParser) primary() Expr {
 	}
 
 	if parser.match(references.This) {
-		if staticContext {
-			throwError(parser.peek(), "Can't access 'this' in a static context.")
-		}
-
 		return NewThis(parser.previous())
 	}
 
 	if parser.match(references.Identifier) {
-		return NewVariable(parser.previous(), references.None)
+		name := parser.previous()
+		var literal Expr
+		switch name.Lexeme {
+		case "__file__":
+			if parser.path == "" {
+				literal = NewLiteral(nil)
+			} else {
+				literal = NewLiteral(parser.path)
+			}
+		case "__line__":
+			literal = NewLiteral(int64(name.Line))
+		case "embedText":
+			if parser.check(references.LeftParen) {
+				literal = parser.embedText(name)
+			}
+		}
+
+		if literal != nil {
+			literal.(*Literal).text = parser.source(name, parser.previous())
+			literal.(*Literal).start = name
+			literal.(*Literal).end = parser.previous()
+			return literal
+		}
+
+		return NewVariable(name, references.None)
 	}
 
 	if parser.match(references.LeftParen) {
+		opening := parser.previous()
 		expr := parser.expression()
-		parser.consume(references.RightParen, "Expected ')' after expression.")
-		return NewGrouping(expr)
+		closing := parser.consume(references.RightParen, "Expected ')' after expression.")
+		grouping := NewGrouping(expr)
+		grouping.(*Grouping).opening = opening
+		grouping.(*Grouping).closing = closing
+		return grouping
 	}
 
-	throwError(parser.peek(), "Expect expression.")
+	parser.error(parser.peek(), "Expect expression.")
 	return nil
 }
 
+// embedText reads a file while parsing and becomes a string literal holding
+// its contents. Relative paths are relative to the script's directory.
+func (parser *AstParser) embedText(keyword *scanner.Token) Expr {
+	parser.consume(references.LeftParen, "Expect '(' after 'embedText'.")
+	file := parser.consume(references.String, "Expect a file name string in embedText.")
+	parser.consume(references.RightParen, "Expect ')' after file name.")
+
+	if parser.readFile == nil {
+		parser.error(keyword, "Embedding files isn't allowed here.")
+	}
+
+	name := file.Literal.(string)
+	if !filepath.IsAbs(name) && parser.path != "" {
+		name = filepath.Join(filepath.Dir(parser.path), name)
+	}
+
+	data, err := parser.readFile(name)
+	if err != nil {
+		parser.error(file, fmt.Sprintf("Can't embed '%s': %s", file.Literal, err.Error()))
+	}
+
+	return NewLiteral(string(data))
+}
+
+// source joins the lexemes from start to end, for folded syntax such as
+// embedText("a.txt") that has no whitespace inside it worth keeping.
+func (parser *AstParser) source(start *scanner.Token, end *scanner.Token) string {
+	text := ""
+	for _, token := range parser.Tokens {
+		if token.Offset >= start.Offset && token.Offset <= end.Offset {
+			text += token.Lexeme
+		}
+	}
+
+	return text
+}
+
 func (parser *AstParser) consume(tokenType references.TokenType, message string) *scanner.Token {
 	if parser.check(tokenType) {
 		return parser.advance()
 	}
 
-	throwError(parser.peek(), message)
+	parser.error(parser.peek(), message)
 	return nil
 }
 
-func (parser *AstParser) synchronize() {
-	parser.advance()
+// nest enters one more level of the syntax tree, failing once the tree
+// gets too deep to walk.
+func (parser *AstParser) nest(token *scanner.Token) {
+	parser.depth++
+	if parser.depth > maxNesting {
+		loxerror.TokenError(token.Type, token.Line, token.Column, token.Lexeme, fmt.Sprintf("Can't nest more than %d levels deep.", maxNesting))
+		panic(errTooDeep)
+	}
+}
 
+// unnest returns to an earlier depth, including when an error unwinds the
+// parse.
+func (parser *AstParser) unnest(depth int) {
+	parser.depth = depth
+}
+
+// synchronize skips the rest of a statement that failed to parse, which
+// began at index with braces unclosed. It stops where the next statement
+// seems to start, at the same nesting, so an error doesn't cascade into
+// errors about the tokens after it. Braces opened in the statement are
+// skipped along with it, and a '}' closing the enclosing block is left for
+// the block.
+func (parser *AstParser) synchronize(index int, braces int) {
 	for !parser.isAtEnd() {
-		if parser.previous().Type == references.Semicolon {
-			return
+		if parser.Current > index && parser.braces == braces {
+			switch parser.previous().Type {
+			case references.Semicolon, references.RightBrace:
+				return
+			}
+
+			switch parser.peek().Type {
+			case references.Class, references.Enum, references.Fun, references.Var, references.Const, references.At, references.Static,
+				references.For, references.If, references.While, references.Switch, references.Match, references.Case, references.Default,
+				references.Print, references.Return, references.Break, references.Continue, references.Yield, references.Defer:
+				return
+			}
 		}
 
-		switch parser.peek().Type {
-		case references.Class:
-			return
-		case references.Fun:
-			return
-		case references.Var:
-			return
-		case references.For:
-			return
-		case references.If:
-			return
-		case references.While:
-			return
-		case references.Print:
-			return
-		case references.Return:
+		if parser.braces == braces && braces > 0 && parser.check(references.RightBrace) {
 			return
 		}
 
@@ -625,6 +1468,14 @@ func (parser *AstParser) check(t references.TokenType) bool {
 func (parser *AstParser) advance() *scanner.Token {
 	if !parser.isAtEnd() {
 		parser.Current++
+		switch parser.previous().Type {
+		case references.LeftBrace:
+			parser.braces++
+		case references.RightBrace:
+			if parser.braces > 0 {
+				parser.braces--
+			}
+		}
 	}
 
 	return parser.previous()
@@ -638,11 +1489,26 @@ func (parser *AstParser) peek() *scanner.Token {
 	return parser.Tokens[parser.Current]
 }
 
+func (parser *AstParser) peekNext() *scanner.Token {
+	if parser.isAtEnd() {
+		return parser.peek()
+	}
+
+	return parser.Tokens[parser.Current+1]
+}
+
 func (parser *AstParser) previous() *scanner.Token {
 	return parser.Tokens[parser.Current-1]
 }
 
 func (parser *AstParser) rewind() {
+	switch parser.previous().Type {
+	case references.LeftBrace:
+		parser.braces--
+	case references.RightBrace:
+		parser.braces++
+	}
+
 	parser.Current--
 }
 
@@ -654,70 +1520,58 @@ func (parser *AstParser) previousIndex(index int) *scanner.Token {
 	return parser.Tokens[index]
 }
 
-func (parser *AstParser) calculateDepth() (int, bool) {
-	curr := parser.Current - 1
-	depth := 0
-	leftBraces := 0
-	rightBraces := 0
-	prev := parser.previousIndex(curr)
-	found := false
-	for prev != nil {
-		if prev.Type == references.RightBrace {
-			rightBraces++
-		}
-
-		if prev.Type == references.LeftBrace {
-			leftBraces++
-			if leftBraces > rightBraces {
-				depth++
-			}
-		}
-
-		if leftBraces > rightBraces && (prev.Type == references.For || prev.Type == references.While) {
-			// if type is for loop then look for the initializer and increment the depth
-			if prev.Type == references.For {
-				forCurr := curr + 1
-				forPrev := parser.previousIndex(forCurr)
-				forFound := false
-				for forPrev != nil && forPrev.Type != references.Semicolon && forPrev.Type != references.RightParen {
-					if forPrev.Type == references.Var {
-						forFound = true
-						break
-					}
-
-					forCurr++
-					forPrev = parser.previousIndex(forCurr)
-				}
-
-				// increment depth because an initializer means a second enclosing block
-				if forFound {
-					depth++
-				}
-			}
-
-			found = true
-			break
-		}
+// error reports a syntax error at token and abandons what is being parsed.
+func (parser *AstParser) error(token *scanner.Token, message string) {
+	parser.report(token, message)
+	panic(errors.New(message))
+}
 
-		curr--
-		prev = parser.previousIndex(curr)
+// report reports a syntax error at token without abandoning the parse, for
+// mistakes that leave the rest of the statement readable. An error at the
+// same token as the last one is left out, since it is usually caused by it.
+func (parser *AstParser) report(token *scanner.Token, message string) {
+	if token == parser.reported {
+		return
 	}
 
-	return depth, found
+	parser.reported = token
+	loxerror.TokenError(token.Type, token.Line, token.Column, token.Lexeme, message)
 }
 
 func throwError(token *scanner.Token, message string) {
-	loxerror.TokenError(token.Type, token.Line, token.Lexeme, message)
+	loxerror.TokenError(token.Type, token.Line, token.Column, token.Lexeme, message)
 
 	panic(fmt.Errorf(message))
 }
 
 func throwRuntimeError(token *scanner.Token, message string) {
-	loxerror.TokenRuntimeError(token.Type, token.Line, token.Lexeme, message, true)
+	throwTypedError(GenericError, token, message)
+}
 
-	panic(fmt.Errorf(message))
+func throwTypedError(kind ErrorKind, token *scanner.Token, message string) {
+	loxerror.KindRuntimeError(kind.String(), kind.Code(), token.Type, token.Line, token.Column, token.Lexeme, message)
+
+	panic(NewRuntimeError(kind, token, message))
 }
 
 func throwReturn(obj interface{}) {
 	panic(obj)
 }
+
+// breakSignal and continueSignal unwind to the loop they target. An empty
+// label targets the innermost loop.
+type breakSignal struct {
+	label string
+}
+
+type continueSignal struct {
+	label string
+}
+
+func throwBreak(label string) {
+	panic(breakSignal{label: label})
+}
+
+func throwContinue(label string) {
+	panic(continueSignal{label: label})
+}
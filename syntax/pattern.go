@@ -0,0 +1,289 @@
+package syntax
+
+import (
+	"fmt"
+	"golox/references"
+	"golox/scanner"
+)
+
+// MatchArm is one arm of a match statement. The else arm has no pattern.
+type MatchArm struct {
+	keyword *scanner.Token
+	pattern Pattern
+	body    Stmt
+}
+
+func NewMatchArm(keyword *scanner.Token, pattern Pattern, body Stmt) *MatchArm {
+	return &MatchArm{
+		keyword: keyword,
+		pattern: pattern,
+		body:    body,
+	}
+}
+
+// Pattern is the shape a match arm tests its subject against. The names a
+// pattern binds are only visible in its arm.
+type Pattern interface {
+	isPattern()
+}
+
+// BindingPattern matches anything and binds it to name, unless the name
+// is _.
+type BindingPattern struct {
+	name *scanner.Token
+}
+
+// ValuePattern matches values equal to a literal or to a constant named
+// by a dotted path, such as Color.Red.
+type ValuePattern struct {
+	value Expr
+}
+
+// TypePattern is 'is Type name', matching values of a built-in type such
+// as Number, instances of a class and its subclasses, or members of an
+// enum. class is nil for the built-in types, and binding is optional.
+type TypePattern struct {
+	keyword  *scanner.Token
+	typeName *scanner.Token
+	class    *Variable
+	binding  *scanner.Token
+}
+
+// ListPattern matches lists whose elements match its own, binding any
+// elements after them to rest. Without a rest the lengths must be equal.
+type ListPattern struct {
+	bracket  *scanner.Token
+	elements []Pattern
+	rest     *scanner.Token
+	closing  *scanner.Token
+}
+
+// FieldsPattern matches instances with the named fields, each matching its
+// pattern. Other fields are ignored.
+type FieldsPattern struct {
+	brace    *scanner.Token
+	names    []*scanner.Token
+	patterns []Pattern
+	closing  *scanner.Token
+}
+
+func (*BindingPattern) isPattern() {}
+func (*ValuePattern) isPattern()   {}
+func (*TypePattern) isPattern()    {}
+func (*ListPattern) isPattern()    {}
+func (*FieldsPattern) isPattern()  {}
+
+// patternTypes maps the built-in type names 'is' accepts to the names
+// typeName gives their values.
+var patternTypes = map[string]string{
+	"Nil":           "nil",
+	"Boolean":       "boolean",
+	"Number":        "number",
+	"String":        "string",
+	"List":          "list",
+	"Range":         "range",
+	"Generator":     "generator",
+	"Task":          "task",
+	"Channel":       "channel",
+	"Function":      "function",
+	"Class":         "class",
+	"Enum":          "enum",
+	"StringBuilder": "StringBuilder",
+}
+
+func NewTypePattern(keyword *scanner.Token, typeName *scanner.Token, binding *scanner.Token) *TypePattern {
+	pattern := &TypePattern{keyword: keyword, typeName: typeName, binding: binding}
+	if _, ok := patternTypes[typeName.Lexeme]; !ok {
+		pattern.class = NewVariable(typeName, references.None).(*Variable)
+	}
+
+	return pattern
+}
+
+// fieldName is the field a FieldsPattern names, which may be written as an
+// identifier or a string.
+func fieldName(name *scanner.Token) string {
+	if name.Type == references.String {
+		return name.Literal.(string)
+	}
+
+	return name.Lexeme
+}
+
+// visitMatchStmt runs the first arm whose pattern matches, in a scope
+// holding the names the pattern bound.
+func (interpreter *Interpreter) visitMatchStmt(stmt *Match) interface{} {
+	subject := interpreter.evaluate(stmt.subject)
+	previous := interpreter.env
+	for _, arm := range stmt.arms {
+		env := NewEnvironment(previous)
+		if arm.pattern != nil && !interpreter.matchesIn(env, stmt.keyword, arm.pattern, subject) {
+			continue
+		}
+
+		interpreter.executeBlock([]Stmt{arm.body}, env)
+		break
+	}
+
+	return nil
+}
+
+// matchesIn matches a pattern in env, where it binds its names and where
+// the values it compares against are evaluated. Errors from equals methods
+// are reported at site.
+func (interpreter *Interpreter) matchesIn(env *Environment, site *scanner.Token, pattern Pattern, value interface{}) bool {
+	previous := interpreter.env
+	interpreter.env = env
+	defer func() {
+		interpreter.env = previous
+	}()
+
+	return interpreter.matches(site, pattern, value)
+}
+
+func (interpreter *Interpreter) matches(site *scanner.Token, pattern Pattern, value interface{}) bool {
+	switch p := pattern.(type) {
+	case *BindingPattern:
+		interpreter.bind(p.name, value)
+		return true
+	case *ValuePattern:
+		return interpreter.equalAt(site, value, interpreter.evaluate(p.value))
+	case *TypePattern:
+		if !interpreter.isType(p, value) {
+			return false
+		}
+
+		if p.binding != nil {
+			interpreter.bind(p.binding, value)
+		}
+
+		return true
+	case *ListPattern:
+		list, ok := value.(*LoxList)
+		if !ok || len(list.elements) < len(p.elements) || p.rest == nil && len(list.elements) != len(p.elements) {
+			return false
+		}
+
+		for i, element := range p.elements {
+			if !interpreter.matches(site, element, list.elements[i]) {
+				return false
+			}
+		}
+
+		if p.rest != nil {
+			rest := append([]interface{}{}, list.elements[len(p.elements):]...)
+			interpreter.bind(p.rest, NewLoxList(rest))
+		}
+
+		return true
+	case *FieldsPattern:
+		instance, ok := value.(*LoxInstance)
+		if !ok {
+			return false
+		}
+
+		for i, name := range p.names {
+			field, ok := instance.fields[fieldName(name)]
+			if !ok || !interpreter.matches(site, p.patterns[i], field) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+func (interpreter *Interpreter) bind(name *scanner.Token, value interface{}) {
+	if name.Lexeme != "_" {
+		interpreter.env.define(name.Lexeme, value)
+	}
+}
+
+// isType reports whether value has the type a TypePattern names.
+func (interpreter *Interpreter) isType(pattern *TypePattern, value interface{}) bool {
+	if pattern.class == nil {
+		return typeName(value) == patternTypes[pattern.typeName.Lexeme]
+	}
+
+	switch t := interpreter.evaluate(pattern.class).(type) {
+	case *LoxClass:
+		instance, ok := value.(*LoxInstance)
+		if !ok {
+			return false
+		}
+
+		for class := instance.class; class != nil; class = class.superclass {
+			if class == t {
+				return true
+			}
+		}
+
+		return false
+	case *LoxEnum:
+		member, ok := value.(*LoxEnumMember)
+		return ok && member.enum == t
+	}
+
+	throwTypedError(TypeError, pattern.typeName, fmt.Sprintf("'%s' isn't a type.", pattern.typeName.Lexeme))
+	return false
+}
+
+func (resolver *Resolver) visitMatchStmt(stmt *Match) interface{} {
+	resolver.resolveExpression(stmt.subject)
+	for _, arm := range stmt.arms {
+		end := arm.keyword
+		if _, last, ok := StmtTokens(arm.body); ok {
+			end = last
+		}
+
+		resolver.beginScope(arm.keyword, end)
+		if arm.pattern != nil {
+			resolver.resolvePattern(arm.pattern)
+		}
+
+		resolver.resolveStatement(arm.body)
+		resolver.endScope()
+	}
+
+	return nil
+}
+
+// resolvePattern declares the names a pattern binds, in the order the
+// interpreter binds them, so a value later in the pattern can use them.
+func (resolver *Resolver) resolvePattern(pattern Pattern) {
+	switch p := pattern.(type) {
+	case *BindingPattern:
+		resolver.bind(p.name)
+	case *ValuePattern:
+		resolver.resolveExpression(p.value)
+	case *TypePattern:
+		if p.class != nil {
+			resolver.resolveExpression(p.class)
+		}
+
+		if p.binding != nil {
+			resolver.bind(p.binding)
+		}
+	case *ListPattern:
+		for _, element := range p.elements {
+			resolver.resolvePattern(element)
+		}
+
+		if p.rest != nil {
+			resolver.bind(p.rest)
+		}
+	case *FieldsPattern:
+		for _, field := range p.patterns {
+			resolver.resolvePattern(field)
+		}
+	}
+}
+
+func (resolver *Resolver) bind(name *scanner.Token) {
+	if name.Lexeme != "_" {
+		resolver.declare(name, references.None)
+		resolver.define(name, references.None)
+	}
+}
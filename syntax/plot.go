@@ -0,0 +1,183 @@
+package syntax
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxPlotPoints stops Plot from looping forever over an endless range.
+const maxPlotPoints = 100000
+
+const (
+	plotWidth  = 640.0
+	plotHeight = 400.0
+	plotMargin = 48.0
+)
+
+// Chart is a plot a script asked for. Hosts that render charts themselves
+// receive it as JSON through the plotter set with SetPlotter.
+type Chart struct {
+	Kind   string    `json:"kind"`
+	X      []float64 `json:"x,omitempty"`
+	Labels []string  `json:"labels,omitempty"`
+	Y      []float64 `json:"y"`
+}
+
+// SetPlotter hands every chart a script draws to plotter instead of writing
+// it to an SVG file. Passing nil goes back to writing files.
+func (interpreter *Interpreter) SetPlotter(plotter func(chart *Chart)) {
+	interpreter.plotter = plotter
+}
+
+// definePlot adds Plot, whose natives draw a line or bar chart. Without a
+// plotter each chart is written to plot-N.svg in the working directory and
+// the native returns the file name.
+func definePlot(env *Environment) {
+	env.define("Plot", NewLoxNamespace("Plot", map[string]interface{}{
+		"line": NewNativeFunction("line", 2, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+			xs := interpreter.plotNumbers(arguments[0])
+			ys := interpreter.plotNumbers(arguments[1])
+			if len(xs) != len(ys) {
+				throwTypedError(TypeError, interpreter.callSite(), fmt.Sprintf("Plot.line needs as many x values as y values, not %d and %d.", len(xs), len(ys)))
+			}
+
+			return interpreter.plot(&Chart{Kind: "line", X: xs, Y: ys})
+		}),
+		"bar": NewNativeFunction("bar", 2, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+			var labels []string
+			for _, label := range interpreter.plotValues(arguments[0]) {
+				labels = append(labels, stringify(label))
+			}
+
+			values := interpreter.plotNumbers(arguments[1])
+			if len(labels) != len(values) {
+				throwTypedError(TypeError, interpreter.callSite(), fmt.Sprintf("Plot.bar needs as many labels as values, not %d and %d.", len(labels), len(values)))
+			}
+
+			return interpreter.plot(&Chart{Kind: "bar", Labels: labels, Y: values})
+		}),
+	}))
+}
+
+func (interpreter *Interpreter) plot(chart *Chart) interface{} {
+	if interpreter.plotter != nil {
+		interpreter.plotter(chart)
+		return nil
+	}
+
+	interpreter.plots++
+	path := fmt.Sprintf("plot-%d.svg", interpreter.plots)
+	if err := interpreter.writeFile(path, []byte(chart.SVG())); err != nil {
+		throwTypedError(IoError, interpreter.callSite(), err.Error())
+	}
+
+	return path
+}
+
+func (interpreter *Interpreter) plotValues(value interface{}) []interface{} {
+	iterator := getIterator(interpreter, interpreter.callSite(), value)
+	if iterator == nil {
+		throwTypedError(TypeError, interpreter.callSite(), fmt.Sprintf("Can't plot '%s'; expected a list.", stringify(value)))
+	}
+
+	var values []interface{}
+	for iterator.hasNext() {
+		if len(values) == maxPlotPoints {
+			throwRuntimeError(interpreter.callSite(), fmt.Sprintf("Can't plot more than %d points.", maxPlotPoints))
+		}
+
+		values = append(values, iterator.next())
+	}
+
+	return values
+}
+
+func (interpreter *Interpreter) plotNumbers(value interface{}) []float64 {
+	var numbers []float64
+	for _, v := range interpreter.plotValues(value) {
+		n, ok := toFloat(v)
+		if !ok || math.IsNaN(n) || math.IsInf(n, 0) {
+			throwTypedError(TypeError, interpreter.callSite(), fmt.Sprintf("Can only plot numbers, not '%s'.", stringify(v)))
+		}
+
+		numbers = append(numbers, n)
+	}
+
+	return numbers
+}
+
+// SVG draws the chart as a standalone SVG document.
+func (chart *Chart) SVG() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%g\" height=\"%g\">\n", plotWidth, plotHeight)
+	sb.WriteString("<rect width=\"100%\" height=\"100%\" fill=\"white\"/>\n")
+
+	minY, maxY := bounds(chart.Y)
+	if chart.Kind == "bar" {
+		minY, maxY = math.Min(minY, 0), math.Max(maxY, 0)
+	}
+
+	y := scale(minY, maxY, plotHeight-plotMargin, plotMargin)
+	fmt.Fprintf(&sb, "<line x1=\"%g\" y1=\"%g\" x2=\"%g\" y2=\"%g\" stroke=\"black\"/>\n", plotMargin, plotMargin, plotMargin, plotHeight-plotMargin)
+	fmt.Fprintf(&sb, "<line x1=\"%g\" y1=\"%g\" x2=\"%g\" y2=\"%g\" stroke=\"black\"/>\n", plotMargin, plotHeight-plotMargin, plotWidth-plotMargin, plotHeight-plotMargin)
+	fmt.Fprintf(&sb, "<text x=\"%g\" y=\"%g\" font-size=\"12\" text-anchor=\"end\">%s</text>\n", plotMargin-4, y(maxY)+4, formatTick(maxY))
+	fmt.Fprintf(&sb, "<text x=\"%g\" y=\"%g\" font-size=\"12\" text-anchor=\"end\">%s</text>\n", plotMargin-4, y(minY)+4, formatTick(minY))
+
+	switch chart.Kind {
+	case "line":
+		minX, maxX := bounds(chart.X)
+		x := scale(minX, maxX, plotMargin, plotWidth-plotMargin)
+
+		var points []string
+		for i := range chart.X {
+			points = append(points, fmt.Sprintf("%.2f,%.2f", x(chart.X[i]), y(chart.Y[i])))
+		}
+
+		fmt.Fprintf(&sb, "<polyline fill=\"none\" stroke=\"steelblue\" stroke-width=\"2\" points=\"%s\"/>\n", strings.Join(points, " "))
+		fmt.Fprintf(&sb, "<text x=\"%g\" y=\"%g\" font-size=\"12\" text-anchor=\"middle\">%s</text>\n", plotMargin, plotHeight-plotMargin+16, formatTick(minX))
+		fmt.Fprintf(&sb, "<text x=\"%g\" y=\"%g\" font-size=\"12\" text-anchor=\"middle\">%s</text>\n", plotWidth-plotMargin, plotHeight-plotMargin+16, formatTick(maxX))
+	case "bar":
+		slot := (plotWidth - 2*plotMargin) / math.Max(float64(len(chart.Y)), 1)
+		for i, value := range chart.Y {
+			left := plotMargin + float64(i)*slot + slot*0.1
+			top, bottom := math.Min(y(value), y(0)), math.Max(y(value), y(0))
+			fmt.Fprintf(&sb, "<rect x=\"%.2f\" y=\"%.2f\" width=\"%.2f\" height=\"%.2f\" fill=\"steelblue\"/>\n", left, top, slot*0.8, bottom-top)
+			fmt.Fprintf(&sb, "<text x=\"%.2f\" y=\"%g\" font-size=\"12\" text-anchor=\"middle\">%s</text>\n", left+slot*0.4, plotHeight-plotMargin+16, html.EscapeString(chart.Labels[i]))
+		}
+	}
+
+	sb.WriteString("</svg>\n")
+	return sb.String()
+}
+
+func bounds(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 1
+	}
+
+	min, max := values[0], values[0]
+	for _, v := range values {
+		min, max = math.Min(min, v), math.Max(max, v)
+	}
+
+	return min, max
+}
+
+// scale maps values between min and max onto the pixels between from and
+// to, centring everything when all the values are the same.
+func scale(min float64, max float64, from float64, to float64) func(float64) float64 {
+	return func(v float64) float64 {
+		if max == min {
+			return (from + to) / 2
+		}
+
+		return from + (v-min)/(max-min)*(to-from)
+	}
+}
+
+func formatTick(v float64) string {
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
@@ -0,0 +1,63 @@
+package syntax
+
+import (
+	"fmt"
+	"golox/natives"
+	"plugin"
+)
+
+// LoadPlugin opens a Go plugin built with -buildmode=plugin and calls its
+// Register function, letting it add globals to the interpreter.
+func (interpreter *Interpreter) LoadPlugin(path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return err
+	}
+
+	symbol, err := p.Lookup("Register")
+	if err != nil {
+		return err
+	}
+
+	register, ok := symbol.(func(natives.Registry))
+	if !ok {
+		return fmt.Errorf("%s: Register must be a func(natives.Registry), not %T", path, symbol)
+	}
+
+	register(&pluginRegistry{interpreter: interpreter})
+	return nil
+}
+
+// pluginRegistry is the natives.Registry plugins register through.
+type pluginRegistry struct {
+	interpreter *Interpreter
+}
+
+func (registry *pluginRegistry) Define(name string, arity int, fn natives.Func) {
+	registry.interpreter.globals.define(name, NewNativeFunction(name, arity, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		converted := make([]interface{}, len(arguments))
+		for i, argument := range arguments {
+			value, err := FromLox(argument)
+			if err != nil {
+				throwTypedError(TypeError, interpreter.callSite(), fmt.Sprintf("Argument %d to %s: %s", i+1, name, err.Error()))
+			}
+
+			converted[i] = value
+		}
+
+		result, err := fn(converted)
+		if err != nil {
+			throwRuntimeError(interpreter.callSite(), err.Error())
+		}
+
+		return ToLox(result)
+	}))
+}
+
+func (registry *pluginRegistry) Bind(name string, value interface{}) {
+	registry.interpreter.Bind(name, value)
+}
+
+func (registry *pluginRegistry) Value(name string, value interface{}) {
+	registry.interpreter.globals.define(name, ToLox(value))
+}
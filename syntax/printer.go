@@ -0,0 +1,35 @@
+package syntax
+
+import "reflect"
+
+// Printer formats a value the host handed to scripts, for print and string
+// concatenation.
+type Printer func(value interface{}) string
+
+// RegisterPrinter makes values of example's Go type print with printer in
+// the scripts this interpreter runs, so the host decides what they show of
+// its objects. Values of any other Go type print with fmt's default
+// formatting.
+func (interpreter *Interpreter) RegisterPrinter(example interface{}, printer Printer) {
+	interpreter.printers[reflect.TypeOf(example)] = printer
+}
+
+// Define makes value a global that scripts can read.
+func (interpreter *Interpreter) Define(name string, value interface{}) {
+	interpreter.globals.define(name, value)
+}
+
+// hostString formats obj, or the struct it binds, with the printer
+// registered for its type.
+func (interpreter *Interpreter) hostString(obj interface{}) (string, bool) {
+	if object, ok := obj.(*LoxHostObject); ok {
+		obj = object.value.Interface()
+	}
+
+	printer, ok := interpreter.printers[reflect.TypeOf(obj)]
+	if !ok {
+		return "", false
+	}
+
+	return printer(obj), true
+}
@@ -0,0 +1,104 @@
+package syntax
+
+import (
+	"fmt"
+	"strings"
+)
+
+// definePrintf adds format(fmt, ...), which fills in a format string, and
+// printf(fmt, ...), which prints the result. Unlike print, printf doesn't
+// end the line, so a line can be built from several calls; Lox strings have
+// no escapes, so %n stands for a line break. The other verbs each take one
+// argument and may have flags, a width and a precision, as in %-10s or
+// %08.3f: %s shows any value as print does, truncated to the precision, %d
+// an integer and %f a number. %% is a literal percent sign.
+func definePrintf(env *Environment) {
+	env.define("format", newVariadicNative("format", 1, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		return interpreter.sprintf("format", arguments)
+	}))
+
+	env.define("printf", newVariadicNative("printf", 1, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		fmt.Fprint(interpreter.out, interpreter.sprintf("printf", arguments))
+		return nil
+	}))
+}
+
+// sprintf formats arguments[1:] by the format string in arguments[0],
+// translating each verb to Go's and converting its argument first.
+func (interpreter *Interpreter) sprintf(name string, arguments []interface{}) string {
+	format, ok := arguments[0].(string)
+	if !ok {
+		throwTypedError(TypeError, interpreter.callSite(), fmt.Sprintf("%s() expects a format string.", name))
+	}
+
+	values := arguments[1:]
+	used := 0
+
+	var out strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			out.WriteByte(format[i])
+			continue
+		}
+
+		start := i
+		for i++; i < len(format) && strings.IndexByte("-+ 0123456789.", format[i]) >= 0; i++ {
+		}
+
+		if i == len(format) {
+			throwRuntimeError(interpreter.callSite(), fmt.Sprintf("%s() expects a verb after %q.", name, format[start:]))
+		}
+
+		verb := format[i]
+		spec := format[start:i]
+		if verb == '%' && spec == "%" {
+			out.WriteByte('%')
+			continue
+		}
+
+		if verb == 'n' && spec == "%" {
+			out.WriteByte('\n')
+			continue
+		}
+
+		if strings.IndexByte("sdf", verb) < 0 {
+			throwRuntimeError(interpreter.callSite(), fmt.Sprintf("%s() doesn't know the verb %q.", name, format[start:i+1]))
+		}
+
+		if strings.Count(spec, ".") > 1 {
+			throwRuntimeError(interpreter.callSite(), fmt.Sprintf("%s() can't read the width and precision of %q.", name, format[start:i+1]))
+		}
+
+		if used == len(values) {
+			throwRuntimeError(interpreter.callSite(), fmt.Sprintf("%s() has no argument for %q.", name, format[start:i+1]))
+		}
+
+		value := values[used]
+		used++
+
+		switch verb {
+		case 's':
+			fmt.Fprintf(&out, spec+"s", interpreter.display(value))
+		case 'd':
+			n, ok := integral(value)
+			if !ok {
+				throwTypedError(TypeError, interpreter.callSite(), fmt.Sprintf("%s() expects an integer for %q, not %s.", name, format[start:i+1], interpreter.display(value)))
+			}
+
+			fmt.Fprintf(&out, spec+"d", n)
+		case 'f':
+			f, ok := toFloat(value)
+			if !ok {
+				throwTypedError(TypeError, interpreter.callSite(), fmt.Sprintf("%s() expects a number for %q, not %s.", name, format[start:i+1], interpreter.display(value)))
+			}
+
+			fmt.Fprintf(&out, spec+"f", f)
+		}
+	}
+
+	if used < len(values) {
+		throwRuntimeError(interpreter.callSite(), fmt.Sprintf("%s() was passed %d arguments but its format uses %d.", name, len(values), used))
+	}
+
+	return out.String()
+}
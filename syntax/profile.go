@@ -0,0 +1,316 @@
+package syntax
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type functionStats struct {
+	name       string
+	line       int
+	calls      int
+	self       time.Duration
+	cumulative time.Duration
+}
+
+type profileFrame struct {
+	stats    *functionStats
+	start    time.Time
+	children time.Duration
+}
+
+// stackSample is the time spent in one call path, for pprof.
+type stackSample struct {
+	functions []*functionStats
+	calls     int
+	self      time.Duration
+}
+
+// Profiler counts the calls to each function, native and class, and the
+// time spent in each: its own, and cumulatively with the calls it makes.
+type Profiler struct {
+	NopHook
+	// lock guards functions and samples, which the tasks a script spawns
+	// add to as well. Each task has a stack of its own, and counts the
+	// calls to each function it has under way in active, so the time of a
+	// recursive call is counted once in cumulative.
+	lock      *sync.Mutex
+	functions map[interface{}]*functionStats
+	stack     []*profileFrame
+	active    map[*functionStats]int
+	samples   map[string]*stackSample
+	started   time.Time
+}
+
+func NewProfiler() *Profiler {
+	return &Profiler{
+		lock:      &sync.Mutex{},
+		functions: map[interface{}]*functionStats{},
+		active:    map[*functionStats]int{},
+		samples:   map[string]*stackSample{},
+		started:   time.Now(),
+	}
+}
+
+// forTask returns the profiler a spawned task records into: the same
+// functions and samples, with a stack of the task's own calls.
+func (profiler *Profiler) forTask() *Profiler {
+	return &Profiler{
+		lock:      profiler.lock,
+		functions: profiler.functions,
+		active:    map[*functionStats]int{},
+		samples:   profiler.samples,
+		started:   profiler.started,
+	}
+}
+
+// SetProfiler starts profiling calls. Passing nil stops it.
+func (interpreter *Interpreter) SetProfiler(profiler *Profiler) {
+	interpreter.profiler = profiler
+	interpreter.collectHooks()
+}
+
+func (interpreter *Interpreter) Profiler() *Profiler {
+	return interpreter.profiler
+}
+
+// statsFor finds the statistics of a callee. Methods are bound anew for
+// each call, so functions are told apart by their declaration.
+func (profiler *Profiler) statsFor(callee LoxCallable) *functionStats {
+	var key interface{} = callee
+	name, line := callee.name(), 0
+	switch c := callee.(type) {
+	case *LoxFunction:
+		key, line = c.declaration, c.declaration.name.Line
+	case *LoxClass:
+		name += " (class)"
+	case *NativeFunction:
+		name += " (native)"
+	}
+
+	stats, ok := profiler.functions[key]
+	if !ok {
+		stats = &functionStats{name: name, line: line}
+		profiler.functions[key] = stats
+	}
+
+	return stats
+}
+
+func (profiler *Profiler) Call(call *CallPoint) {
+	profiler.lock.Lock()
+	defer profiler.lock.Unlock()
+
+	stats := profiler.statsFor(call.Callee)
+	stats.calls++
+	profiler.active[stats]++
+	profiler.stack = append(profiler.stack, &profileFrame{stats: stats, start: time.Now()})
+}
+
+func (profiler *Profiler) Return(call *CallPoint, result interface{}) {
+	profiler.lock.Lock()
+	defer profiler.lock.Unlock()
+
+	frame := profiler.stack[len(profiler.stack)-1]
+	elapsed := time.Since(frame.start)
+	self := elapsed - frame.children
+
+	frame.stats.self += self
+	profiler.active[frame.stats]--
+	if profiler.active[frame.stats] == 0 {
+		frame.stats.cumulative += elapsed
+	}
+
+	profiler.sample(self)
+	profiler.stack = profiler.stack[:len(profiler.stack)-1]
+	if len(profiler.stack) > 0 {
+		profiler.stack[len(profiler.stack)-1].children += elapsed
+	}
+}
+
+// sample adds self time to the call path of the innermost frame.
+func (profiler *Profiler) sample(self time.Duration) {
+	functions := make([]*functionStats, len(profiler.stack))
+	var key strings.Builder
+	for i, frame := range profiler.stack {
+		functions[len(functions)-1-i] = frame.stats
+		fmt.Fprintf(&key, "%p;", frame.stats)
+	}
+
+	sample, ok := profiler.samples[key.String()]
+	if !ok {
+		sample = &stackSample{functions: functions}
+		profiler.samples[key.String()] = sample
+	}
+
+	sample.calls++
+	sample.self += self
+}
+
+func (profiler *Profiler) sorted() []*functionStats {
+	var sorted []*functionStats
+	for _, stats := range profiler.functions {
+		sorted = append(sorted, stats)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].self != sorted[j].self {
+			return sorted[i].self > sorted[j].self
+		}
+
+		return sorted[i].label() < sorted[j].label()
+	})
+
+	return sorted
+}
+
+func (stats *functionStats) label() string {
+	if stats.line == 0 {
+		return stats.name
+	}
+
+	return fmt.Sprintf("%s (line %d)", stats.name, stats.line)
+}
+
+// Report prints every function called, the ones with the most time of
+// their own first.
+func (profiler *Profiler) Report(out io.Writer) {
+	profiler.lock.Lock()
+	defer profiler.lock.Unlock()
+
+	var total time.Duration
+	sorted := profiler.sorted()
+	for _, stats := range sorted {
+		total += stats.self
+	}
+
+	fmt.Fprintf(out, "%10s %12s %12s %6s  %s\n", "calls", "self", "cumulative", "%", "function")
+	for _, stats := range sorted {
+		percent := 0.0
+		if total > 0 {
+			percent = float64(stats.self) / float64(total) * 100
+		}
+
+		fmt.Fprintf(out, "%10d %12s %12s %5.1f%%  %s\n", stats.calls, stats.self.Round(time.Microsecond), stats.cumulative.Round(time.Microsecond), percent, stats.label())
+	}
+}
+
+// WritePprof writes the profile gzipped in the format of the pprof tool,
+// with a sample for each call path counting its calls and the time spent in
+// the innermost function. filename is the script the functions are in.
+func (profiler *Profiler) WritePprof(w io.Writer, filename string) error {
+	profiler.lock.Lock()
+	defer profiler.lock.Unlock()
+
+	table := []string{""}
+	index := map[string]int64{"": 0}
+	str := func(s string) int64 {
+		if i, ok := index[s]; ok {
+			return i
+		}
+
+		index[s] = int64(len(table))
+		table = append(table, s)
+		return index[s]
+	}
+
+	var profile protoBuffer
+	for _, valueType := range [][2]string{{"calls", "count"}, {"time", "nanoseconds"}} {
+		var vt protoBuffer
+		vt.varint(1, uint64(str(valueType[0])))
+		vt.varint(2, uint64(str(valueType[1])))
+		profile.bytes(1, vt.data)
+	}
+
+	// Each function gets the same id for its pprof function and location.
+	ids := map[*functionStats]uint64{}
+	sorted := profiler.sorted()
+	for i, stats := range sorted {
+		ids[stats] = uint64(i + 1)
+	}
+
+	var keys []string
+	for key := range profiler.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		sample := profiler.samples[key]
+		var locations, values protoBuffer
+		for _, stats := range sample.functions {
+			locations.rawVarint(ids[stats])
+		}
+
+		values.rawVarint(uint64(sample.calls))
+		values.rawVarint(uint64(sample.self.Nanoseconds()))
+
+		var s protoBuffer
+		s.bytes(1, locations.data)
+		s.bytes(2, values.data)
+		profile.bytes(2, s.data)
+	}
+
+	for _, stats := range sorted {
+		var line, location protoBuffer
+		line.varint(1, ids[stats])
+		line.varint(2, uint64(stats.line))
+		location.varint(1, ids[stats])
+		location.bytes(4, line.data)
+		profile.bytes(4, location.data)
+	}
+
+	for _, stats := range sorted {
+		var function protoBuffer
+		function.varint(1, ids[stats])
+		function.varint(2, uint64(str(stats.label())))
+		function.varint(3, uint64(str(stats.name)))
+		function.varint(4, uint64(str(filename)))
+		function.varint(5, uint64(stats.line))
+		profile.bytes(5, function.data)
+	}
+
+	for _, s := range table {
+		profile.bytes(6, []byte(s))
+	}
+
+	profile.varint(9, uint64(profiler.started.UnixNano()))
+	profile.varint(10, uint64(time.Since(profiler.started).Nanoseconds()))
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(profile.data); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// protoBuffer encodes the few protocol buffer fields a pprof profile uses.
+type protoBuffer struct {
+	data []byte
+}
+
+func (buffer *protoBuffer) rawVarint(v uint64) {
+	for v >= 0x80 {
+		buffer.data = append(buffer.data, byte(v)|0x80)
+		v >>= 7
+	}
+
+	buffer.data = append(buffer.data, byte(v))
+}
+
+func (buffer *protoBuffer) varint(field int, v uint64) {
+	buffer.rawVarint(uint64(field)<<3 | 0)
+	buffer.rawVarint(v)
+}
+
+func (buffer *protoBuffer) bytes(field int, data []byte) {
+	buffer.rawVarint(uint64(field)<<3 | 2)
+	buffer.rawVarint(uint64(len(data)))
+	buffer.data = append(buffer.data, data...)
+}
@@ -0,0 +1,1178 @@
+package syntax
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"golox/references"
+	"golox/scanner"
+	"io"
+	"math"
+	"strings"
+)
+
+// Version is the golox release. Compiled programs record the release that
+// built them.
+const Version = "0.9.0"
+
+// programMagic starts every compiled program, and programFormat is the
+// version of the layout that follows it. Bump programFormat whenever the
+// encoding of a node changes.
+const programMagic = "LOXC"
+const programFormat = 4
+
+// Features a compiled program can depend on. A program is only loaded by
+// a golox that knows every feature it uses, so a program that needs
+// something this release lacks fails to load instead of misbehaving.
+const (
+	FeatureIntegers uint64 = 1 << iota
+	FeatureGenerators
+	FeatureTasks
+	FeatureDefer
+	FeatureSwitch
+	FeatureTraits
+	FeatureVariadics
+	FeatureDefaults
+	FeatureUnpack
+	FeatureEnums
+	FeatureMatch
+)
+
+const knownFeatures = FeatureIntegers | FeatureGenerators | FeatureTasks | FeatureDefer | FeatureSwitch | FeatureTraits | FeatureVariadics | FeatureDefaults | FeatureUnpack | FeatureEnums | FeatureMatch
+
+// featureNames are the features' names, in the order of their bits.
+var featureNames = []string{"integers", "generators", "tasks", "defer", "switch", "traits", "variadics", "defaults", "unpack", "enums", "match"}
+
+// FeatureNames names the features set in features. Bits this golox doesn't
+// know, set by a newer one, are named by their number.
+func FeatureNames(features uint64) []string {
+	var names []string
+	for bit := uint(0); bit < 64; bit++ {
+		if features&(1<<bit) == 0 {
+			continue
+		}
+
+		if int(bit) < len(featureNames) {
+			names = append(names, featureNames[bit])
+		} else {
+			names = append(names, fmt.Sprintf("feature %d", bit))
+		}
+	}
+
+	return names
+}
+
+// ErrNotProgram is returned by ReadProgram for data that isn't a compiled
+// Lox program.
+var ErrNotProgram = errors.New("not a compiled Lox program")
+
+// Program is a script that has been parsed and resolved, so it can run
+// without scanning or parsing it again.
+type Program struct {
+	// Version is the golox release that compiled the program.
+	Version string
+	// Features are the language features the program uses.
+	Features uint64
+	// Path is where the script was compiled from, and Source its text. The
+	// source is empty when the program was compiled without it.
+	Path   string
+	Source string
+	// Statements is the program, empty when it couldn't be loaded.
+	Statements []Stmt
+}
+
+// ProgramMismatchError is returned by ReadProgram for a program compiled in
+// a format this golox can't load. The program's Statements are empty but
+// its Source, if any, can be compiled again.
+type ProgramMismatchError struct {
+	Program *Program
+	Format  uint64
+}
+
+func (err *ProgramMismatchError) Error() string {
+	if err.Format != programFormat {
+		return fmt.Sprintf("compiled by golox %s in format %d, but this golox reads format %d", err.Program.Version, err.Format, programFormat)
+	}
+
+	return fmt.Sprintf("compiled by golox %s using features this golox lacks (%s)", err.Program.Version, strings.Join(FeatureNames(err.Program.Features&^knownFeatures), ", "))
+}
+
+// Loadable returns nil when this golox can load program, which was written
+// in format, and otherwise a ProgramMismatchError saying why not.
+func Loadable(format uint64, program *Program) error {
+	if format != programFormat || program.Features&^knownFeatures != 0 {
+		return &ProgramMismatchError{Program: program, Format: format}
+	}
+
+	return nil
+}
+
+// writeHeader starts a compiled program with the magic and the header.
+// Every format keeps this header, so a golox that can't load the rest of a
+// program can still describe it and compile it again from its source.
+func writeHeader(out *bytes.Buffer, program *Program) {
+	out.WriteString(programMagic)
+	writeUvarint(out, programFormat)
+	writeString(out, program.Version)
+	writeUvarint(out, program.Features)
+	writeString(out, program.Path)
+	writeString(out, program.Source)
+}
+
+// WriteProgram serializes statements, which must have been resolved, along
+// with the depths the resolver found for their variables. The source is
+// embedded unless it is empty, letting a golox that can't load the program
+// compile it again.
+func WriteProgram(w io.Writer, path string, source string, statements []Stmt) (err error) {
+	encoder := &programEncoder{tokenIndex: map[*scanner.Token]int{}}
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(programError); ok {
+				err = e
+				return
+			}
+
+			panic(r)
+		}
+	}()
+
+	encoder.stmts(statements)
+
+	var out bytes.Buffer
+	writeHeader(&out, &Program{Version: Version, Features: encoder.features, Path: path, Source: source})
+
+	writeUvarint(&out, uint64(len(encoder.tokens)))
+	for _, token := range encoder.tokens {
+		writeUvarint(&out, uint64(token.Type))
+		writeString(&out, token.Lexeme)
+		encodeValue(&out, token.Literal)
+		writeUvarint(&out, uint64(token.Line))
+		writeUvarint(&out, uint64(token.Column))
+		writeUvarint(&out, uint64(token.Offset))
+	}
+
+	out.Write(encoder.body.Bytes())
+
+	_, err = w.Write(out.Bytes())
+	return err
+}
+
+// ReadProgram loads a program written by WriteProgram and hands the depths
+// of its variables to the interpreter, which can then run its Statements.
+func (interpreter *Interpreter) ReadProgram(r io.Reader) (program *Program, err error) {
+	decoder := &programDecoder{interpreter: interpreter, in: bufio.NewReader(r)}
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(programError); ok {
+				err = e
+				return
+			}
+
+			panic(r)
+		}
+	}()
+
+	program, format, err := decoder.header()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Loadable(format, program); err != nil {
+		return program, err
+	}
+
+	for i := decoder.count(); i > 0; i-- {
+		token := &scanner.Token{}
+		token.Type = references.TokenType(decoder.uvarint())
+		token.Lexeme = decoder.string()
+		token.Literal = decoder.value()
+		token.Line = int(decoder.uvarint())
+		token.Column = int(decoder.uvarint())
+		token.Offset = int(decoder.uvarint())
+		decoder.tokens = append(decoder.tokens, token)
+	}
+
+	program.Statements = decoder.stmts()
+	return program, nil
+}
+
+// ReadProgramHeader reads only the header of a compiled program: who
+// compiled it, in which format, using which features, and its source. It
+// reads programs in any format, including ones this golox can't load.
+func ReadProgramHeader(r io.Reader) (program *Program, format uint64, err error) {
+	decoder := &programDecoder{in: bufio.NewReader(r)}
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(programError); ok {
+				err = e
+				return
+			}
+
+			panic(r)
+		}
+	}()
+
+	return decoder.header()
+}
+
+// header reads the magic and the header after it.
+func (decoder *programDecoder) header() (*Program, uint64, error) {
+	magic := make([]byte, len(programMagic))
+	if _, err := io.ReadFull(decoder.in, magic); err != nil || string(magic) != programMagic {
+		return nil, 0, ErrNotProgram
+	}
+
+	format := decoder.uvarint()
+	program := &Program{}
+	program.Version = decoder.string()
+	program.Features = decoder.uvarint()
+	program.Path = decoder.string()
+	program.Source = decoder.string()
+	return program, format, nil
+}
+
+// programError is how the encoder and decoder give up. WriteProgram,
+// ReadProgram and ReadProgramHeader recover it and return it.
+type programError string
+
+func (err programError) Error() string {
+	return string(err)
+}
+
+// Node tags. Zero is a missing node.
+const (
+	tagNil byte = iota
+	tagBlock
+	tagExpression
+	tagFunction
+	tagIf
+	tagPrint
+	tagReturn
+	tagVar
+	tagWhile
+	tagForIn
+	tagSwitch
+	tagBreak
+	tagContinue
+	tagYield
+	tagDefer
+	tagClass
+	tagAssign
+	tagBinary
+	tagCall
+	tagSpawn
+	tagSpread
+	tagGetMethod
+	tagGetField
+	tagSet
+	tagSuper
+	tagThis
+	tagGrouping
+	tagLiteral
+	tagLogical
+	tagUnary
+	tagVariable
+	tagUnpack
+	tagEnum
+	tagMatch
+)
+
+// Value tags, for literals.
+const (
+	valueNil byte = iota
+	valueFalse
+	valueTrue
+	valueNumber
+	valueInteger
+	valueString
+)
+
+// Pattern tags, for match arms. Zero is the missing pattern of an else arm.
+const (
+	patternNil byte = iota
+	patternBinding
+	patternValue
+	patternType
+	patternList
+	patternFields
+)
+
+// Statement flags, recording what the parser and resolver noted about a
+// statement outside the tree.
+const (
+	stmtHasSpan = 1 << iota
+	stmtForLoop
+	stmtGenerator
+	stmtExported
+	stmtTailCall
+	stmtCaptures
+)
+
+type programEncoder struct {
+	body       bytes.Buffer
+	tokens     []*scanner.Token
+	tokenIndex map[*scanner.Token]int
+	features   uint64
+}
+
+// token writes a reference into the token table, so tokens the parser
+// shares between nodes are still shared once loaded.
+func (encoder *programEncoder) token(token *scanner.Token) {
+	if token == nil {
+		writeUvarint(&encoder.body, 0)
+		return
+	}
+
+	index, ok := encoder.tokenIndex[token]
+	if !ok {
+		encoder.tokens = append(encoder.tokens, token)
+		index = len(encoder.tokens)
+		encoder.tokenIndex[token] = index
+	}
+
+	writeUvarint(&encoder.body, uint64(index))
+}
+
+func (encoder *programEncoder) tokenList(tokens []*scanner.Token) {
+	writeUvarint(&encoder.body, uint64(len(tokens)))
+	for _, token := range tokens {
+		encoder.token(token)
+	}
+}
+
+func (encoder *programEncoder) bool(value bool) {
+	if value {
+		encoder.body.WriteByte(1)
+	} else {
+		encoder.body.WriteByte(0)
+	}
+}
+
+// depth writes where the resolver found a variable: 0 for a global, and
+// otherwise one more than the number of scopes out.
+func (encoder *programEncoder) depth(expr Expr) {
+	distance, ok := resolution(expr)
+	if !ok || distance == nil {
+		writeUvarint(&encoder.body, 0)
+		return
+	}
+
+	writeUvarint(&encoder.body, uint64(*distance)+1)
+}
+
+func (encoder *programEncoder) stmts(statements []Stmt) {
+	writeUvarint(&encoder.body, uint64(len(statements)))
+	for _, stmt := range statements {
+		encoder.stmt(stmt)
+	}
+}
+
+func (encoder *programEncoder) stmt(stmt Stmt) {
+	if stmt == nil {
+		encoder.body.WriteByte(tagNil)
+		return
+	}
+
+	flags := byte(0)
+	span := stmt.info().span
+	hasSpan := span != nil
+	if hasSpan {
+		flags |= stmtHasSpan
+	}
+
+	if stmt.info().forLoop {
+		flags |= stmtForLoop
+	}
+
+	if stmt.info().exported {
+		flags |= stmtExported
+	}
+
+	if function, ok := stmt.(*Function); ok && function.generator {
+		flags |= stmtGenerator
+		encoder.features |= FeatureGenerators
+	}
+
+	if ret, ok := stmt.(*ReturnCmd); ok {
+		if call, ok := ret.value.(*Call); ok && call.tail {
+			flags |= stmtTailCall
+		}
+	}
+
+	var plan capturePlan
+	switch s := stmt.(type) {
+	case *Function:
+		plan = s.capture
+	case *Class:
+		plan = s.capture
+	}
+
+	hasPlan := plan != nil
+	if hasPlan {
+		flags |= stmtCaptures
+	}
+
+	switch s := stmt.(type) {
+	case *Block:
+		encoder.body.WriteByte(tagBlock)
+	case *Expression:
+		encoder.body.WriteByte(tagExpression)
+	case *Function:
+		encoder.body.WriteByte(tagFunction)
+	case *IfCmd:
+		encoder.body.WriteByte(tagIf)
+	case *Print:
+		encoder.body.WriteByte(tagPrint)
+	case *ReturnCmd:
+		encoder.body.WriteByte(tagReturn)
+	case *VarCmd:
+		encoder.body.WriteByte(tagVar)
+	case *Unpack:
+		encoder.body.WriteByte(tagUnpack)
+		encoder.features |= FeatureUnpack
+	case *Enum:
+		encoder.body.WriteByte(tagEnum)
+		encoder.features |= FeatureEnums
+	case *WhileLoop:
+		encoder.body.WriteByte(tagWhile)
+	case *ForIn:
+		encoder.body.WriteByte(tagForIn)
+	case *SwitchCmd:
+		encoder.body.WriteByte(tagSwitch)
+		encoder.features |= FeatureSwitch
+	case *Match:
+		encoder.body.WriteByte(tagMatch)
+		encoder.features |= FeatureMatch
+	case *BreakCmd:
+		encoder.body.WriteByte(tagBreak)
+	case *ContinueCmd:
+		encoder.body.WriteByte(tagContinue)
+	case *Yield:
+		encoder.body.WriteByte(tagYield)
+	case *DeferCmd:
+		encoder.body.WriteByte(tagDefer)
+		encoder.features |= FeatureDefer
+	case *Class:
+		encoder.body.WriteByte(tagClass)
+		if len(s.traits) > 0 {
+			encoder.features |= FeatureTraits
+		}
+	case *ImportCmd:
+		// The module is another file, which the program would need to
+		// carry along.
+		panic(programError("can't compile a program that imports modules"))
+	default:
+		panic(programError(fmt.Sprintf("can't compile a %s statement", stmt.String())))
+	}
+
+	encoder.body.WriteByte(flags)
+	if hasSpan {
+		encoder.token(span.start)
+		encoder.token(span.end)
+	}
+
+	switch s := stmt.(type) {
+	case *Block:
+		encoder.stmts(s.statements)
+	case *Expression:
+		encoder.expr(s.expression)
+	case *Function:
+		encoder.function(s)
+	case *IfCmd:
+		encoder.expr(s.condition)
+		encoder.stmt(s.thenBranch)
+		encoder.stmt(s.elseBranch)
+	case *Print:
+		encoder.expr(s.expression)
+	case *ReturnCmd:
+		encoder.token(s.keyword)
+		encoder.expr(s.value)
+	case *VarCmd:
+		encoder.varCmd(s)
+	case *Unpack:
+		encoder.token(s.keyword)
+		encoder.tokenList(s.names)
+		encoder.expr(s.initializer)
+		encoder.bool(s.constant)
+	case *Enum:
+		encoder.token(s.name)
+		encoder.tokenList(s.members)
+	case *WhileLoop:
+		encoder.expr(s.condition)
+		encoder.stmt(s.body)
+		encoder.expr(s.increment)
+		encoder.token(s.label)
+	case *ForIn:
+		encoder.token(s.name)
+		encoder.expr(s.iterable)
+		encoder.stmt(s.body)
+		encoder.token(s.label)
+	case *SwitchCmd:
+		encoder.token(s.keyword)
+		encoder.expr(s.subject)
+		writeUvarint(&encoder.body, uint64(len(s.cases)))
+		for _, c := range s.cases {
+			encoder.token(c.keyword)
+			encoder.expr(c.value)
+			encoder.stmts(c.body)
+			encoder.bool(c.fallsThrough)
+		}
+	case *Match:
+		encoder.token(s.keyword)
+		encoder.expr(s.subject)
+		writeUvarint(&encoder.body, uint64(len(s.arms)))
+		for _, arm := range s.arms {
+			encoder.token(arm.keyword)
+			encoder.pattern(arm.pattern)
+			encoder.stmt(arm.body)
+		}
+	case *BreakCmd:
+		encoder.token(s.keyword)
+		encoder.token(s.label)
+	case *ContinueCmd:
+		encoder.token(s.keyword)
+		encoder.token(s.label)
+	case *Yield:
+		encoder.token(s.keyword)
+		encoder.expr(s.value)
+	case *DeferCmd:
+		encoder.token(s.keyword)
+		encoder.expr(s.expression)
+	case *Class:
+		encoder.token(s.name)
+		encoder.variable(s.superclass)
+		writeUvarint(&encoder.body, uint64(len(s.traits)))
+		for _, trait := range s.traits {
+			encoder.variable(trait)
+		}
+
+		writeUvarint(&encoder.body, uint64(len(s.methods)))
+		for _, method := range s.methods {
+			encoder.stmt(method)
+		}
+
+		writeUvarint(&encoder.body, uint64(len(s.fields)))
+		for _, field := range s.fields {
+			encoder.stmt(field)
+		}
+	}
+
+	if hasPlan {
+		encoder.capturePlan(plan)
+	}
+}
+
+// capturePlan writes what a closure keeps. A shared level has no names, so
+// its count is written one higher to tell it from a copy of nothing.
+func (encoder *programEncoder) capturePlan(plan capturePlan) {
+	writeUvarint(&encoder.body, uint64(len(plan)))
+	for _, level := range plan {
+		writeUvarint(&encoder.body, uint64(level.depth))
+		if level.names == nil {
+			writeUvarint(&encoder.body, 0)
+			continue
+		}
+
+		writeUvarint(&encoder.body, uint64(len(level.names))+1)
+		for _, name := range level.names {
+			writeString(&encoder.body, name)
+		}
+	}
+}
+
+func (encoder *programEncoder) function(s *Function) {
+	if s.variadic {
+		encoder.features |= FeatureVariadics
+	}
+
+	for _, value := range s.defaults {
+		if value != nil {
+			encoder.features |= FeatureDefaults
+		}
+	}
+
+	encoder.token(s.name)
+	encoder.tokenList(s.params)
+	encoder.stmts(s.body)
+	encoder.bool(s.isStatic)
+	encoder.bool(s.isGetter)
+	encoder.tokenList(s.paramTypes)
+	encoder.token(s.returnType)
+	encoder.bool(s.variadic)
+	encoder.exprs(s.defaults)
+}
+
+func (encoder *programEncoder) varCmd(s *VarCmd) {
+	encoder.token(s.name)
+	encoder.expr(s.initializer)
+	encoder.bool(s.constant)
+	encoder.token(s.annotation)
+}
+
+func (encoder *programEncoder) pattern(pattern Pattern) {
+	switch p := pattern.(type) {
+	case nil:
+		encoder.body.WriteByte(patternNil)
+	case *BindingPattern:
+		encoder.body.WriteByte(patternBinding)
+		encoder.token(p.name)
+	case *ValuePattern:
+		encoder.body.WriteByte(patternValue)
+		encoder.expr(p.value)
+	case *TypePattern:
+		encoder.body.WriteByte(patternType)
+		encoder.token(p.keyword)
+		encoder.token(p.typeName)
+		encoder.variable(p.class)
+		encoder.token(p.binding)
+	case *ListPattern:
+		encoder.body.WriteByte(patternList)
+		encoder.token(p.bracket)
+		encoder.patterns(p.elements)
+		encoder.token(p.rest)
+	case *FieldsPattern:
+		encoder.body.WriteByte(patternFields)
+		encoder.token(p.brace)
+		encoder.tokenList(p.names)
+		encoder.patterns(p.patterns)
+	}
+}
+
+func (encoder *programEncoder) patterns(patterns []Pattern) {
+	writeUvarint(&encoder.body, uint64(len(patterns)))
+	for _, pattern := range patterns {
+		encoder.pattern(pattern)
+	}
+}
+
+// variable writes a Variable that may be missing, such as a class's
+// superclass.
+func (encoder *programEncoder) variable(variable *Variable) {
+	if variable == nil {
+		encoder.expr(nil)
+		return
+	}
+
+	encoder.expr(variable)
+}
+
+func (encoder *programEncoder) exprs(exprs []Expr) {
+	writeUvarint(&encoder.body, uint64(len(exprs)))
+	for _, expr := range exprs {
+		encoder.expr(expr)
+	}
+}
+
+func (encoder *programEncoder) expr(expr Expr) {
+	if expr == nil {
+		encoder.body.WriteByte(tagNil)
+		return
+	}
+
+	switch e := expr.(type) {
+	case *Assign:
+		encoder.body.WriteByte(tagAssign)
+		encoder.token(e.name)
+		encoder.expr(e.value)
+		encoder.depth(e)
+	case *Binary:
+		encoder.body.WriteByte(tagBinary)
+		encoder.expr(e.left)
+		encoder.token(e.operator)
+		encoder.expr(e.right)
+	case *Call:
+		encoder.body.WriteByte(tagCall)
+		encoder.call(e)
+	case *Spawn:
+		encoder.body.WriteByte(tagSpawn)
+		encoder.features |= FeatureTasks
+		encoder.token(e.keyword)
+		encoder.call(e.call)
+	case *Spread:
+		encoder.body.WriteByte(tagSpread)
+		encoder.features |= FeatureVariadics
+		encoder.token(e.ellipsis)
+		encoder.expr(e.expression)
+	case *GetMethod:
+		encoder.body.WriteByte(tagGetMethod)
+		encoder.expr(e.object)
+		encoder.token(e.name)
+		encoder.bool(e.optional)
+	case *GetField:
+		encoder.body.WriteByte(tagGetField)
+		encoder.expr(e.object)
+		encoder.token(e.name)
+		encoder.bool(e.optional)
+	case *Set:
+		encoder.body.WriteByte(tagSet)
+		encoder.expr(e.object)
+		encoder.token(e.name)
+		encoder.expr(e.value)
+	case *Super:
+		encoder.body.WriteByte(tagSuper)
+		encoder.token(e.keyword)
+		encoder.token(e.method)
+		encoder.depth(e)
+	case *This:
+		encoder.body.WriteByte(tagThis)
+		encoder.token(e.keyword)
+		encoder.depth(e)
+	case *Grouping:
+		encoder.body.WriteByte(tagGrouping)
+		encoder.expr(e.expression)
+	case *Literal:
+		encoder.body.WriteByte(tagLiteral)
+		if _, ok := e.value.(int64); ok {
+			encoder.features |= FeatureIntegers
+		}
+
+		encodeValue(&encoder.body, e.value)
+	case *Logical:
+		encoder.body.WriteByte(tagLogical)
+		encoder.expr(e.left)
+		encoder.token(e.operator)
+		encoder.expr(e.right)
+	case *Unary:
+		encoder.body.WriteByte(tagUnary)
+		encoder.token(e.operator)
+		encoder.expr(e.right)
+	case *Variable:
+		encoder.body.WriteByte(tagVariable)
+		encoder.token(e.name)
+		writeUvarint(&encoder.body, uint64(e.t))
+		encoder.depth(e)
+	default:
+		panic(programError(fmt.Sprintf("can't compile a %s expression", expr.String())))
+	}
+}
+
+func (encoder *programEncoder) call(e *Call) {
+	encoder.expr(e.callee)
+	encoder.token(e.paren)
+	encoder.exprs(e.arguments)
+}
+
+type programDecoder struct {
+	interpreter *Interpreter
+	in          *bufio.Reader
+	tokens      []*scanner.Token
+}
+
+func (decoder *programDecoder) byte() byte {
+	b, err := decoder.in.ReadByte()
+	if err != nil {
+		panic(programError("compiled program is truncated"))
+	}
+
+	return b
+}
+
+func (decoder *programDecoder) uvarint() uint64 {
+	value, err := binary.ReadUvarint(decoder.in)
+	if err != nil {
+		panic(programError("compiled program is truncated"))
+	}
+
+	return value
+}
+
+// count reads the length of a list or string. Lists are grown as their
+// items are read, so a corrupt length runs out of input rather than memory.
+func (decoder *programDecoder) count() int {
+	n := decoder.uvarint()
+	if n > math.MaxInt32 {
+		panic(programError("compiled program is corrupt"))
+	}
+
+	return int(n)
+}
+
+func (decoder *programDecoder) string() string {
+	var sb strings.Builder
+	if _, err := io.CopyN(&sb, decoder.in, int64(decoder.count())); err != nil {
+		panic(programError("compiled program is truncated"))
+	}
+
+	return sb.String()
+}
+
+func (decoder *programDecoder) bool() bool {
+	return decoder.byte() != 0
+}
+
+func (decoder *programDecoder) value() interface{} {
+	switch decoder.byte() {
+	case valueNil:
+		return nil
+	case valueFalse:
+		return false
+	case valueTrue:
+		return true
+	case valueNumber:
+		return math.Float64frombits(decoder.uvarint())
+	case valueInteger:
+		value, err := binary.ReadVarint(decoder.in)
+		if err != nil {
+			panic(programError("compiled program is truncated"))
+		}
+
+		return value
+	case valueString:
+		return decoder.string()
+	}
+
+	panic(programError("compiled program is corrupt"))
+}
+
+func (decoder *programDecoder) token() *scanner.Token {
+	index := decoder.uvarint()
+	if index == 0 {
+		return nil
+	}
+
+	if index > uint64(len(decoder.tokens)) {
+		panic(programError("compiled program is corrupt"))
+	}
+
+	return decoder.tokens[index-1]
+}
+
+func (decoder *programDecoder) tokenList() []*scanner.Token {
+	var tokens []*scanner.Token
+	for i := decoder.count(); i > 0; i-- {
+		tokens = append(tokens, decoder.token())
+	}
+
+	return tokens
+}
+
+// depth hands the interpreter the depth encoder.depth wrote for expr.
+func (decoder *programDecoder) depth(expr Expr) {
+	distance := decoder.uvarint()
+	if distance == 0 {
+		return
+	}
+
+	index := int(distance - 1)
+	decoder.interpreter.resolve(expr, &index)
+}
+
+func (decoder *programDecoder) stmts() []Stmt {
+	var statements []Stmt
+	for i := decoder.count(); i > 0; i-- {
+		statements = append(statements, decoder.stmt())
+	}
+
+	return statements
+}
+
+func (decoder *programDecoder) stmt() Stmt {
+	tag := decoder.byte()
+	if tag == tagNil {
+		return nil
+	}
+
+	flags := decoder.byte()
+	var span *stmtSpan
+	if flags&stmtHasSpan != 0 {
+		span = &stmtSpan{start: decoder.token(), end: decoder.token()}
+	}
+
+	var stmt Stmt
+	switch tag {
+	case tagBlock:
+		stmt = NewBlock(decoder.stmts())
+	case tagExpression:
+		stmt = NewExpression(decoder.expr())
+	case tagFunction:
+		function := decoder.function()
+		if flags&stmtGenerator != 0 {
+			function.generator = true
+		}
+
+		stmt = function
+	case tagIf:
+		stmt = NewIfCmd(decoder.expr(), decoder.stmt(), decoder.stmt())
+	case tagPrint:
+		stmt = NewPrint(decoder.expr())
+	case tagReturn:
+		ret := NewReturnCmd(decoder.token(), decoder.expr()).(*ReturnCmd)
+		if call, ok := ret.value.(*Call); ok && flags&stmtTailCall != 0 {
+			call.tail = true
+		}
+
+		stmt = ret
+	case tagVar:
+		stmt = decoder.varCmd()
+	case tagWhile:
+		stmt = NewWhileLoop(decoder.expr(), decoder.stmt(), decoder.expr(), decoder.token())
+	case tagForIn:
+		stmt = NewForIn(decoder.token(), decoder.expr(), decoder.stmt(), decoder.token())
+	case tagSwitch:
+		keyword, subject := decoder.token(), decoder.expr()
+		var cases []*SwitchCase
+		for i := decoder.count(); i > 0; i-- {
+			cases = append(cases, NewSwitchCase(decoder.token(), decoder.expr(), decoder.stmts(), decoder.bool()))
+		}
+
+		stmt = NewSwitchCmd(keyword, subject, cases)
+	case tagMatch:
+		keyword, subject := decoder.token(), decoder.expr()
+		var arms []*MatchArm
+		for i := decoder.count(); i > 0; i-- {
+			arms = append(arms, NewMatchArm(decoder.token(), decoder.pattern(), decoder.stmt()))
+		}
+
+		stmt = NewMatch(keyword, subject, arms)
+	case tagBreak:
+		stmt = NewBreakCmd(decoder.token(), decoder.token())
+	case tagContinue:
+		stmt = NewContinueCmd(decoder.token(), decoder.token())
+	case tagYield:
+		stmt = NewYield(decoder.token(), decoder.expr())
+	case tagDefer:
+		stmt = NewDeferCmd(decoder.token(), decoder.expr())
+	case tagUnpack:
+		stmt = NewUnpack(decoder.token(), decoder.tokenList(), decoder.expr(), decoder.bool())
+	case tagEnum:
+		stmt = NewEnum(decoder.token(), decoder.tokenList())
+	case tagClass:
+		stmt = decoder.class()
+	default:
+		panic(programError("compiled program is corrupt"))
+	}
+
+	if span != nil {
+		stmt.info().span = span
+	}
+
+	if flags&stmtForLoop != 0 {
+		stmt.info().forLoop = true
+	}
+
+	if flags&stmtExported != 0 {
+		stmt.info().exported = true
+	}
+
+	if flags&stmtCaptures != 0 {
+		plan := decoder.capturePlan()
+		switch s := stmt.(type) {
+		case *Function:
+			s.capture = plan
+		case *Class:
+			s.capture = plan
+		}
+	}
+
+	return stmt
+}
+
+func (decoder *programDecoder) capturePlan() capturePlan {
+	var plan capturePlan
+	for i := decoder.count(); i > 0; i-- {
+		level := captureLevel{depth: int(decoder.uvarint())}
+		if n := decoder.count(); n > 0 {
+			level.names = []string{}
+			for ; n > 1; n-- {
+				level.names = append(level.names, decoder.string())
+			}
+		}
+
+		plan = append(plan, level)
+	}
+
+	if len(plan) == 0 {
+		panic(programError("compiled program is corrupt"))
+	}
+
+	return plan
+}
+
+func (decoder *programDecoder) function() *Function {
+	name := decoder.token()
+	params := decoder.tokenList()
+	body := decoder.stmts()
+	isStatic := decoder.bool()
+	isGetter := decoder.bool()
+	paramTypes := decoder.tokenList()
+	returnType := decoder.token()
+	variadic := decoder.bool()
+	defaults := decoder.exprs()
+	return NewFunction(name, params, body, isStatic, isGetter, paramTypes, returnType, variadic, defaults).(*Function)
+}
+
+func (decoder *programDecoder) varCmd() *VarCmd {
+	return NewVarCmd(decoder.token(), decoder.expr(), decoder.bool(), decoder.token()).(*VarCmd)
+}
+
+func (decoder *programDecoder) class() Stmt {
+	name := decoder.token()
+	superclass := decoder.variable()
+	var traits []*Variable
+	for i := decoder.count(); i > 0; i-- {
+		traits = append(traits, decoder.variable())
+	}
+
+	var methods []*Function
+	for i := decoder.count(); i > 0; i-- {
+		function, ok := decoder.stmt().(*Function)
+		if !ok {
+			panic(programError("compiled program is corrupt"))
+		}
+
+		methods = append(methods, function)
+	}
+
+	var fields []*VarCmd
+	for i := decoder.count(); i > 0; i-- {
+		field, ok := decoder.stmt().(*VarCmd)
+		if !ok {
+			panic(programError("compiled program is corrupt"))
+		}
+
+		fields = append(fields, field)
+	}
+
+	return NewClass(name, superclass, traits, methods, fields)
+}
+
+func (decoder *programDecoder) pattern() Pattern {
+	switch decoder.byte() {
+	case patternNil:
+		return nil
+	case patternBinding:
+		return &BindingPattern{name: decoder.token()}
+	case patternValue:
+		return &ValuePattern{value: decoder.expr()}
+	case patternType:
+		return &TypePattern{keyword: decoder.token(), typeName: decoder.token(), class: decoder.variable(), binding: decoder.token()}
+	case patternList:
+		return &ListPattern{bracket: decoder.token(), elements: decoder.patterns(), rest: decoder.token()}
+	case patternFields:
+		return &FieldsPattern{brace: decoder.token(), names: decoder.tokenList(), patterns: decoder.patterns()}
+	}
+
+	panic(programError("compiled program is corrupt"))
+}
+
+func (decoder *programDecoder) patterns() []Pattern {
+	var patterns []Pattern
+	for i := decoder.count(); i > 0; i-- {
+		patterns = append(patterns, decoder.pattern())
+	}
+
+	return patterns
+}
+
+// variable reads a Variable that may be missing, keeping it a nil
+// *Variable rather than a nil Expr.
+func (decoder *programDecoder) variable() *Variable {
+	expr := decoder.expr()
+	if expr == nil {
+		return nil
+	}
+
+	variable, ok := expr.(*Variable)
+	if !ok {
+		panic(programError("compiled program is corrupt"))
+	}
+
+	return variable
+}
+
+func (decoder *programDecoder) exprs() []Expr {
+	var exprs []Expr
+	for i := decoder.count(); i > 0; i-- {
+		exprs = append(exprs, decoder.expr())
+	}
+
+	return exprs
+}
+
+func (decoder *programDecoder) expr() Expr {
+	switch decoder.byte() {
+	case tagNil:
+		return nil
+	case tagAssign:
+		expr := NewAssign(decoder.token(), decoder.expr())
+		decoder.depth(expr)
+		return expr
+	case tagBinary:
+		return NewBinary(decoder.expr(), decoder.token(), decoder.expr())
+	case tagCall:
+		return decoder.call()
+	case tagSpawn:
+		return NewSpawn(decoder.token(), decoder.call())
+	case tagSpread:
+		return NewSpread(decoder.token(), decoder.expr())
+	case tagGetMethod:
+		return NewGetMethod(decoder.expr(), decoder.token(), decoder.bool())
+	case tagGetField:
+		return NewGetField(decoder.expr(), decoder.token(), decoder.bool())
+	case tagSet:
+		return NewSet(decoder.expr(), decoder.token(), decoder.expr())
+	case tagSuper:
+		expr := NewSuper(decoder.token(), decoder.token())
+		decoder.depth(expr)
+		return expr
+	case tagThis:
+		expr := NewThis(decoder.token())
+		decoder.depth(expr)
+		return expr
+	case tagGrouping:
+		return NewGrouping(decoder.expr())
+	case tagLiteral:
+		return NewLiteral(decoder.value())
+	case tagLogical:
+		return NewLogical(decoder.expr(), decoder.token(), decoder.expr())
+	case tagUnary:
+		return NewUnary(decoder.token(), decoder.expr())
+	case tagVariable:
+		expr := NewVariable(decoder.token(), references.FunctionType(decoder.uvarint()))
+		decoder.depth(expr)
+		return expr
+	}
+
+	panic(programError("compiled program is corrupt"))
+}
+
+func (decoder *programDecoder) call() *Call {
+	return NewCall(decoder.expr(), decoder.token(), decoder.exprs()).(*Call)
+}
+
+func writeUvarint(out *bytes.Buffer, value uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	out.Write(buf[:binary.PutUvarint(buf[:], value)])
+}
+
+func writeString(out *bytes.Buffer, value string) {
+	writeUvarint(out, uint64(len(value)))
+	out.WriteString(value)
+}
+
+func encodeValue(out *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		out.WriteByte(valueNil)
+	case bool:
+		if v {
+			out.WriteByte(valueTrue)
+		} else {
+			out.WriteByte(valueFalse)
+		}
+	case float64:
+		out.WriteByte(valueNumber)
+		writeUvarint(out, math.Float64bits(v))
+	case int64:
+		out.WriteByte(valueInteger)
+		var buf [binary.MaxVarintLen64]byte
+		out.Write(buf[:binary.PutVarint(buf[:], v)])
+	case string:
+		out.WriteByte(valueString)
+		writeString(out, v)
+	default:
+		panic(programError(fmt.Sprintf("can't compile a literal of type %T", value)))
+	}
+}
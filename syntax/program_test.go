@@ -0,0 +1,117 @@
+package syntax
+
+import (
+	"bytes"
+	"golox/loxerror"
+	"golox/scanner"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// TestProgramRoundTrip compiles a fixture that uses most of the language,
+// loads it into a fresh interpreter and checks it prints what running the
+// source does.
+func TestProgramRoundTrip(t *testing.T) {
+	previous := loxerror.SetReporter(nil)
+	defer loxerror.SetReporter(previous)
+
+	path := filepath.Join("testdata", "compiled.lox")
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	interpreter, statements := resolveFixture(t, string(source))
+	var want bytes.Buffer
+	interpreter.SetOutput(&want)
+	interpreter.Interpret(statements)
+	if want.Len() == 0 {
+		t.Fatal("the fixture printed nothing")
+	}
+
+	// The program is compiled from a fresh parse, so nothing the first run
+	// left in the tree is saved with it.
+	_, statements = resolveFixture(t, string(source))
+	var compiled bytes.Buffer
+	if err := WriteProgram(&compiled, path, string(source), statements); err != nil {
+		t.Fatalf("compiling %s: %v", path, err)
+	}
+
+	loaded := NewInterpreter()
+	program, err := loaded.ReadProgram(&compiled)
+	if err != nil {
+		t.Fatalf("loading %s: %v", path, err)
+	}
+
+	if program.Path != path || program.Source != string(source) || program.Version != Version {
+		t.Errorf("header came back as %q, %q, version %q", program.Path, program.Source, program.Version)
+	}
+
+	var got bytes.Buffer
+	loaded.SetOutput(&got)
+	loaded.Interpret(program.Statements)
+	if loxerror.HadError() || loxerror.HadRuntimeError() {
+		t.Fatal("the loaded program failed")
+	}
+
+	if got.String() != want.String() {
+		t.Errorf("the loaded program printed\n%s\nbut the source printed\n%s", got.String(), want.String())
+	}
+}
+
+// TestProgramRejectsBadHeaders checks that a compiled program with a
+// corrupt magic, a format this golox doesn't read or a missing body is
+// refused rather than run.
+func TestProgramRejectsBadHeaders(t *testing.T) {
+	previous := loxerror.SetReporter(nil)
+	defer loxerror.SetReporter(previous)
+
+	_, statements := resolveFixture(t, "print 1 + 2;")
+	var compiled bytes.Buffer
+	if err := WriteProgram(&compiled, "fixture.lox", "print 1 + 2;", statements); err != nil {
+		t.Fatal(err)
+	}
+
+	data := compiled.Bytes()
+
+	corrupt := append([]byte{}, data...)
+	corrupt[0] = 'X'
+	if _, err := NewInterpreter().ReadProgram(bytes.NewReader(corrupt)); err != ErrNotProgram {
+		t.Errorf("a corrupt magic gave %v, want ErrNotProgram", err)
+	}
+
+	// The format follows the magic as a one-byte uvarint.
+	otherFormat := append([]byte{}, data...)
+	otherFormat[len(programMagic)] = programFormat + 1
+	program, err := NewInterpreter().ReadProgram(bytes.NewReader(otherFormat))
+	if mismatch, ok := err.(*ProgramMismatchError); !ok || mismatch.Format != programFormat+1 {
+		t.Errorf("another format gave %v, want a ProgramMismatchError", err)
+	} else if program.Statements != nil || program.Source != "print 1 + 2;" {
+		t.Errorf("another format loaded statements %v and source %q", program.Statements, program.Source)
+	}
+
+	truncated := data[:len(data)-1]
+	if _, err := NewInterpreter().ReadProgram(bytes.NewReader(truncated)); err == nil {
+		t.Error("a truncated program loaded")
+	}
+
+	if _, err := NewInterpreter().ReadProgram(bytes.NewReader(nil)); err != ErrNotProgram {
+		t.Errorf("an empty file gave %v, want ErrNotProgram", err)
+	}
+}
+
+// resolveFixture parses and resolves source for a new interpreter.
+func resolveFixture(t *testing.T, source string) (*Interpreter, []Stmt) {
+	loxerror.Reset()
+	interpreter := NewInterpreter()
+	parser := NewAstParser(scanner.NewScanner(source).ScanTokens())
+	parser.SetInterpreter(interpreter)
+	statements := parser.Parse()
+	NewResolver(interpreter).Resolve(statements)
+	if loxerror.HadError() {
+		t.Fatal("the fixture doesn't compile")
+	}
+
+	return interpreter, statements
+}
@@ -0,0 +1,67 @@
+package syntax
+
+import (
+	"math/rand"
+	"time"
+)
+
+// defineRandom adds the natives that draw from the interpreter's random
+// generator: random(), a float in [0, 1), randomInt(lo, hi), an integer
+// from lo to hi inclusive, and seedRandom(n), which restarts the sequence
+// so a run can be repeated.
+func defineRandom(env *Environment) {
+	env.define("random", NewNativeFunction("random", 0, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		return interpreter.random.Float64()
+	}))
+
+	env.define("randomInt", NewNativeFunction("randomInt", 2, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		lo, ok := integral(arguments[0])
+		hi, hiOk := integral(arguments[1])
+		if !ok || !hiOk {
+			throwTypedError(TypeError, interpreter.callSite(), "randomInt() expects two integers.")
+		}
+
+		if lo > hi {
+			throwRuntimeError(interpreter.callSite(), "randomInt() expects lo to be at most hi.")
+		}
+
+		return randomBetween(interpreter.random, lo, hi)
+	}))
+
+	env.define("seedRandom", NewNativeFunction("seedRandom", 1, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		seed, ok := integral(arguments[0])
+		if !ok {
+			throwTypedError(TypeError, interpreter.callSite(), "seedRandom() expects an integer.")
+		}
+
+		interpreter.SeedRandom(seed)
+		return nil
+	}))
+}
+
+// SeedRandom restarts the generator behind random() and randomInt(), so
+// runs given the same seed draw the same numbers. Each interpreter has its
+// own generator, seeded from the clock until this is called; tasks share
+// their interpreter's.
+func (interpreter *Interpreter) SeedRandom(seed int64) {
+	interpreter.random.Seed(seed)
+}
+
+func newRandom() *rand.Rand {
+	return rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+// randomBetween picks an integer from lo to hi inclusive, even when the
+// span doesn't fit in an int64.
+func randomBetween(random *rand.Rand, lo int64, hi int64) int64 {
+	span := uint64(hi) - uint64(lo)
+	if span < 1<<63-1 {
+		return lo + random.Int63n(int64(span)+1)
+	}
+
+	for {
+		if n := random.Uint64(); n <= span {
+			return int64(uint64(lo) + n)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package syntax
+
+import (
+	"fmt"
+	"golox/references"
+	"math"
+)
+
+type Range struct{}
+
+func NewRange() LoxCallable {
+	return &Range{}
+}
+
+func (r *Range) arity() int {
+	return 3
+}
+
+func (r *Range) call(interpreter *Interpreter, arguments []interface{}) interface{} {
+	var bounds [3]float64
+	integers := true
+	for i, arg := range arguments {
+		f, ok := toFloat(arg)
+		if !ok {
+			throwTypedError(TypeError, interpreter.callSite(), "Range bounds must be numbers.")
+		}
+
+		_, isInteger := arg.(int64)
+		integers = integers && isInteger
+		bounds[i] = f
+	}
+
+	if bounds[2] == 0 {
+		throwRuntimeError(interpreter.callSite(), "Range step can't be zero.")
+	}
+
+	loxRange := NewLoxRange(bounds[0], bounds[1], bounds[2])
+	loxRange.integers = integers
+	return loxRange
+}
+
+func (r *Range) callableType() references.FunctionType {
+	return references.Function
+}
+
+func (r *Range) String() string {
+	return "<native fn>"
+}
+
+func (r *Range) name() string {
+	return "range"
+}
+
+type LoxRange struct {
+	start float64
+	end   float64
+	step  float64
+	// integers is set when every bound is an integer, so the range counts
+	// in integers too.
+	integers bool
+}
+
+func NewLoxRange(start float64, end float64, step float64) *LoxRange {
+	return &LoxRange{
+		start: start,
+		end:   end,
+		step:  step,
+	}
+}
+
+func (r *LoxRange) iterator() loxIterator {
+	return &rangeIterator{r: r, current: r.start}
+}
+
+func (r *LoxRange) String() string {
+	return fmt.Sprintf("range(%s, %s, %s)", stringify(r.number(r.start)), stringify(r.number(r.end)), stringify(r.number(r.step)))
+}
+
+func (r *LoxRange) number(f float64) interface{} {
+	if r.integers {
+		return int64(f)
+	}
+
+	return f
+}
+
+type rangeIterator struct {
+	r       *LoxRange
+	current float64
+}
+
+func (iterator *rangeIterator) hasNext() bool {
+	if iterator.r.step > 0 {
+		return iterator.current < iterator.r.end
+	}
+
+	return iterator.current > iterator.r.end
+}
+
+func (iterator *rangeIterator) next() interface{} {
+	value := iterator.current
+	iterator.current = iterator.r.start + math.Round((value-iterator.r.start)/iterator.r.step+1)*iterator.r.step
+	return iterator.r.number(value)
+}
@@ -0,0 +1,120 @@
+package syntax
+
+import "sort"
+
+// defineReflection adds the natives that let scripts inspect values and
+// classes at runtime.
+func defineReflection(env *Environment) {
+	env.define("type", NewNativeFunction("type", 1, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		return typeName(arguments[0])
+	}))
+
+	env.define("isInstance", NewNativeFunction("isInstance", 2, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		class, ok := arguments[1].(*LoxClass)
+		if !ok {
+			throwTypedError(TypeError, interpreter.callSite(), "Second argument to isInstance must be a class.")
+		}
+
+		instance, ok := arguments[0].(*LoxInstance)
+		if !ok {
+			return false
+		}
+
+		for c := instance.class; c != nil; c = c.superclass {
+			if c == class {
+				return true
+			}
+		}
+
+		return false
+	}))
+
+	env.define("fields", NewNativeFunction("fields", 1, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		instance, ok := arguments[0].(*LoxInstance)
+		if !ok {
+			throwTypedError(TypeError, interpreter.callSite(), "Only instances have fields.")
+		}
+
+		names := make([]string, 0, len(instance.fields))
+		for name := range instance.fields {
+			names = append(names, name)
+		}
+
+		return sortedList(names)
+	}))
+
+	env.define("methods", NewNativeFunction("methods", 1, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		class, ok := arguments[0].(*LoxClass)
+		if !ok {
+			throwTypedError(TypeError, interpreter.callSite(), "Only classes have methods.")
+		}
+
+		seen := make(map[string]bool)
+		var names []string
+		for c := class; c != nil; c = c.superclass {
+			for name := range c.methods {
+				if !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+
+		return sortedList(names)
+	}))
+}
+
+// typeName names the type of a value: an instance's class name, or one of
+// "nil", "boolean", "number", "string", "list", "range", "generator",
+// "function", "class" and "enum". An enum member's type is its enum's name.
+func typeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case int64, float64:
+		return "number"
+	case string:
+		return "string"
+	case *LoxList:
+		return "list"
+	case *LoxRange:
+		return "range"
+	case *LoxGenerator:
+		return "generator"
+	case *LoxTask:
+		return "task"
+	case *LoxChannel:
+		return "channel"
+	case *LoxNamespace:
+		return "namespace"
+	case *LoxStringBuilder:
+		return "StringBuilder"
+	case *LoxEnum:
+		return "enum"
+	case *LoxEnumMember:
+		return v.enum.enumName
+	case *LoxInstance:
+		return v.class.name()
+	case *LoxHostObject:
+		return v.typeName()
+	case *LoxClass:
+		return "class"
+	case LoxCallable:
+		return "function"
+	}
+
+	return "unknown"
+}
+
+func sortedList(names []string) *LoxList {
+	sort.Strings(names)
+
+	elements := make([]interface{}, len(names))
+	for i, name := range names {
+		elements[i] = name
+	}
+
+	return NewLoxList(elements)
+}
@@ -0,0 +1,112 @@
+package syntax
+
+import (
+	"fmt"
+	"regexp"
+	resyntax "regexp/syntax"
+	"sync"
+)
+
+// regexCacheSize bounds how many compiled patterns are kept. Scripts
+// usually reuse a handful, so the cache is simply emptied when it fills.
+const regexCacheSize = 64
+
+// maxRegexInstructions bounds the size of a compiled pattern. RE2 matches
+// in time linear in the string, but multiplied by the pattern's size, and a
+// match can't be interrupted, so a huge pattern could hang the script past
+// its time limit.
+const maxRegexInstructions = 2000
+
+var regexCache = struct {
+	sync.Mutex
+	patterns map[string]*regexp.Regexp
+}{patterns: map[string]*regexp.Regexp{}}
+
+// defineRegex adds the regular expression natives, which use Go's RE2
+// syntax: regexMatch(pattern, s), which reports whether s contains a match,
+// regexFind(pattern, s), which returns the first match followed by its
+// capture groups, or nil, and regexReplace(pattern, s, repl), which
+// replaces every match, expanding $1 and ${name} in repl.
+func defineRegex(env *Environment) {
+	env.define("regexMatch", NewNativeFunction("regexMatch", 2, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		re, s := interpreter.regexArguments("regexMatch", arguments)
+		return re.MatchString(s)
+	}))
+
+	env.define("regexFind", NewNativeFunction("regexFind", 2, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		re, s := interpreter.regexArguments("regexFind", arguments)
+		indexes := re.FindStringSubmatchIndex(s)
+		if indexes == nil {
+			return nil
+		}
+
+		// A group that took no part in the match is nil rather than "".
+		groups := make([]interface{}, len(indexes)/2)
+		for i := range groups {
+			if start, end := indexes[2*i], indexes[2*i+1]; start >= 0 {
+				groups[i] = s[start:end]
+			}
+		}
+
+		return NewLoxList(groups)
+	}))
+
+	env.define("regexReplace", NewNativeFunction("regexReplace", 3, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		re, s := interpreter.regexArguments("regexReplace", arguments)
+		repl, ok := arguments[2].(string)
+		if !ok {
+			throwTypedError(TypeError, interpreter.callSite(), "regexReplace() expects a string to replace matches with.")
+		}
+
+		return re.ReplaceAllString(s, repl)
+	}))
+}
+
+// regexArguments checks the pattern and string every regex native takes,
+// compiling the pattern or fetching it from the cache.
+func (interpreter *Interpreter) regexArguments(name string, arguments []interface{}) (*regexp.Regexp, string) {
+	pattern, ok := arguments[0].(string)
+	s, sOk := arguments[1].(string)
+	if !ok || !sOk {
+		throwTypedError(TypeError, interpreter.callSite(), fmt.Sprintf("%s() expects a pattern and a string.", name))
+	}
+
+	re, err := compileRegex(pattern)
+	if err != nil {
+		message := err.Error()
+		if e, ok := err.(*resyntax.Error); ok {
+			message = fmt.Sprintf("Invalid pattern %q: %s.", pattern, e.Code)
+		}
+
+		throwTypedError(RegexError, interpreter.callSite(), message)
+	}
+
+	return re, s
+}
+
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	regexCache.Lock()
+	defer regexCache.Unlock()
+
+	if re, ok := regexCache.patterns[pattern]; ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	// The pattern parsed above, so it parses and compiles again here.
+	parsed, _ := resyntax.Parse(pattern, resyntax.Perl)
+	if prog, _ := resyntax.Compile(parsed.Simplify()); len(prog.Inst) > maxRegexInstructions {
+		return nil, fmt.Errorf("Pattern is too large; it may compile to at most %d instructions.", maxRegexInstructions)
+	}
+
+	if len(regexCache.patterns) >= regexCacheSize {
+		regexCache.patterns = map[string]*regexp.Regexp{}
+	}
+
+	regexCache.patterns[pattern] = re
+	return re, nil
+}
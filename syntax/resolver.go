@@ -5,29 +5,100 @@ import (
 	"golox/loxerror"
 	"golox/references"
 	"golox/scanner"
+	"sort"
 )
 
-var currentClass references.ClassType = references.NoneClass
-
 type VariableData struct {
 	variableType references.FunctionType
 	defined      bool
+	global       bool
+	constant     bool
+	symbol       *Symbol
+	// assigned is set once an assignment to the variable is resolved, and
+	// read once a read is.
+	assigned bool
+	read     bool
+	// local marks a variable declared with var or const outside the top
+	// level, and function the declaration of a function, for strict mode.
+	local    bool
+	function *Function
 }
 
 type Resolver struct {
 	interpreter     *Interpreter
 	scopes          *Stack
 	currentFunction references.FunctionType
+	currentClass    references.ClassType
+	function        *Function
+	loopDepth       int
+	switchDepth     int
+	labels          []string
+	symbols         *SymbolTable
+	scope           *Scope
+	inStaticMethod  bool
+	// classMethods lists the methods each class declares, inherits or takes
+	// from its traits, so conflicts between traits are caught before
+	// running.
+	classMethods map[string][]string
+	// properties holds every property read along with its receiver's
+	// class, when that is known, which Warnings checks against the
+	// deprecated methods once the whole program is resolved.
+	properties []*propertyRead
+	classes    map[string]*Class
+	class      *Class
+	// undefined holds the names read without being declared anywhere,
+	// while collectUndefined is set.
+	collectUndefined bool
+	undefined        []*scanner.Token
+	// returnedCalls are the calls returned by the function being resolved,
+	// which become tail calls unless it defers.
+	returnedCalls []*Call
+	defers        bool
+	// unit is the innermost function or class whose closure is trimmed to
+	// the scopes it uses, and units and references are collected for
+	// trimClosures once the whole program is resolved.
+	unit       *captureUnit
+	units      []*captureUnit
+	references []captureReference
+	// strict holds the strict checks to make. Errors that need the whole
+	// program are collected in lateErrors, and callees and calls keep what
+	// checkArity needs.
+	strict     StrictCheck
+	lateErrors []*Warning
+	callees    map[*Variable]*VariableData
+	calls      []knownCall
 }
 
 func NewResolver(interpreter *Interpreter) *Resolver {
 	return &Resolver{
-		interpreter:     interpreter,
-		scopes:          NewStack(),
-		currentFunction: references.None,
+		interpreter:       interpreter,
+		scopes:            NewStack(),
+		currentFunction:   references.None,
+		currentClass:      references.NoneClass,
+		symbols:           NewSymbolTable(),
+		classMethods:      make(map[string][]string),
+		classes:           make(map[string]*Class),
 	}
 }
 
+// Symbols returns the declarations and references found by Resolve, along
+// with the tree of scopes they were found in. Tooling reads it instead of
+// the depths Resolve hands the interpreter.
+func (resolver *Resolver) Symbols() *SymbolTable {
+	return resolver.symbols
+}
+
+// CollectUndefined makes Resolve carry on past names that aren't declared
+// anywhere, listing them for Undefined instead of reporting the first.
+func (resolver *Resolver) CollectUndefined() {
+	resolver.collectUndefined = true
+}
+
+// Undefined returns the names CollectUndefined found, in source order.
+func (resolver *Resolver) Undefined() []*scanner.Token {
+	return resolver.undefined
+}
+
 func (resolver *Resolver) Resolve(stmts []Stmt) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -41,13 +112,36 @@ func (resolver *Resolver) Resolve(stmts []Stmt) {
 		}
 	}()
 
-	resolver.beginScope()
+	resolver.beginScope(nil, nil)
+	resolver.declareGlobals()
 	resolver.resolveStatements(stmts)
+	resolver.trimClosures()
 	resolver.endScope()
+	resolver.reportLateErrors()
+}
+
+// declareGlobals makes natives and names defined by earlier runs (such as
+// previous REPL lines) visible in the top-level scope.
+func (resolver *Resolver) declareGlobals() {
+	scope := resolver.scopes.Peek().(map[string]*VariableData)
+	for name, value := range resolver.interpreter.globals.values {
+		t := references.None
+		switch value.(type) {
+		case *LoxClass:
+			t = references.Klass
+		case *LoxFunction:
+			t = references.Function
+		}
+
+		scope[buildKey(name, t)] = &VariableData{variableType: t, defined: true, global: true, constant: resolver.interpreter.globals.constants[name]}
+		resolver.symbols.Globals = append(resolver.symbols.Globals, name)
+	}
+
+	sort.Strings(resolver.symbols.Globals)
 }
 
 func (resolver *Resolver) visitBlockStmt(stmt *Block) interface{} {
-	resolver.beginScope()
+	resolver.beginStmtScope(stmt)
 	resolver.resolveStatements(stmt.statements)
 	resolver.endScope()
 	return nil
@@ -60,10 +154,59 @@ func (resolver *Resolver) visitVarCmdStmt(stmt *VarCmd) interface{} {
 	}
 
 	resolver.define(stmt.name, references.None)
+	if !resolver.scopes.IsEmpty() {
+		data := resolver.scopes.Peek().(map[string]*VariableData)[buildKey(stmt.name.Lexeme, references.None)]
+		data.constant = stmt.constant
+		data.local = resolver.scopes.Len() > 1
+	}
+
+	return nil
+}
+
+// visitUnpackStmt declares every name after resolving the list they come
+// from, so none of them can be read in it.
+func (resolver *Resolver) visitUnpackStmt(stmt *Unpack) interface{} {
+	for _, name := range stmt.names {
+		resolver.declare(name, references.None)
+	}
+
+	resolver.resolveExpression(stmt.initializer)
+	for _, name := range stmt.names {
+		resolver.define(name, references.None)
+		if !resolver.scopes.IsEmpty() {
+			data := resolver.scopes.Peek().(map[string]*VariableData)[buildKey(name.Lexeme, references.None)]
+			data.constant = stmt.constant
+			data.local = resolver.scopes.Len() > 1
+		}
+	}
+
+	return nil
+}
+
+// visitEnumStmt declares an enum as a constant, keeping its members in the
+// symbol table for tooling.
+func (resolver *Resolver) visitEnumStmt(stmt *Enum) interface{} {
+	resolver.declare(stmt.name, references.None)
+	resolver.define(stmt.name, references.None)
+	if !resolver.scopes.IsEmpty() {
+		data := resolver.scopes.Peek().(map[string]*VariableData)[buildKey(stmt.name.Lexeme, references.None)]
+		data.constant = true
+		if data.symbol != nil {
+			data.symbol.Members = stmt.members
+		}
+	}
+
 	return nil
 }
 
 func (resolver *Resolver) visitVariableExpr(expr *Variable) interface{} {
+	if resolver.collectUndefined {
+		if _, ok := resolver.lookup(expr.name.Lexeme); !ok {
+			resolver.undefined = append(resolver.undefined, expr.name)
+			return nil
+		}
+	}
+
 	if !resolver.scopes.IsEmpty() && !resolver.isDefined(expr.name.Lexeme, expr.t) {
 		throwError(expr.name, fmt.Sprintf("Can't read local variable '%s' in its own initializer.", expr.name.Lexeme))
 	}
@@ -73,17 +216,21 @@ func (resolver *Resolver) visitVariableExpr(expr *Variable) interface{} {
 }
 
 func (resolver *Resolver) visitThisExpr(expr *This) interface{} {
-	if currentClass == references.NoneClass {
+	if resolver.currentClass == references.NoneClass {
 		throwError(expr.keyword, "Can't use 'this' outside of a class.")
 	}
 
+	if resolver.inStaticMethod {
+		throwError(expr.keyword, "Can't use 'this' in a static method.")
+	}
+
 	resolver.resolveLocal(expr, expr.keyword)
 	return nil
 }
 
 func (resolver *Resolver) isDefined(lexeme string, t references.FunctionType) bool {
 	for i := resolver.scopes.length - 1; i >= 0; i-- {
-		data, ok := resolver.scopes.Get(i).(map[string]*VariableData)[buildKey(lexeme, t)]
+		data, ok := lookupKey(resolver.scopes.Get(i).(map[string]*VariableData), lexeme, t)
 		if ok {
 			return data.defined
 		}
@@ -94,6 +241,10 @@ func (resolver *Resolver) isDefined(lexeme string, t references.FunctionType) bo
 
 func (resolver *Resolver) visitAssignExpr(expr *Assign) interface{} {
 	resolver.resolveExpression(expr.value)
+	if data, ok := resolver.lookup(expr.name.Lexeme); ok && data.constant {
+		throwError(expr.name, fmt.Sprintf("Can't assign to constant '%s'.", expr.name.Lexeme))
+	}
+
 	resolver.resolveLocal(expr, expr.name)
 	return nil
 }
@@ -101,8 +252,18 @@ func (resolver *Resolver) visitAssignExpr(expr *Assign) interface{} {
 func (resolver *Resolver) visitFunctionStmt(stmt *Function) interface{} {
 	resolver.declare(stmt.name, references.Function)
 	resolver.define(stmt.name, references.Function)
+	resolver.markDeprecated(stmt, stmt.name, references.Function)
+	if !resolver.scopes.IsEmpty() {
+		data := resolver.scopes.Peek().(map[string]*VariableData)[buildKey(stmt.name.Lexeme, references.Function)]
+		data.function = stmt
+		if data.symbol != nil {
+			data.symbol.MinArgs, data.symbol.MaxArgs = arityRange(NewLoxFunction(stmt, nil, false, false))
+		}
+	}
 
+	resolver.beginCapture(&stmt.capture)
 	resolver.resolveFunction(stmt, references.Function)
+	resolver.endCapture()
 	return nil
 }
 
@@ -112,6 +273,7 @@ func (resolver *Resolver) visitExpressionStmt(stmt *Expression) interface{} {
 }
 
 func (resolver *Resolver) visitIfCmdStmt(stmt *IfCmd) interface{} {
+	resolver.checkCondition(stmt.condition)
 	resolver.resolveExpression(stmt.condition)
 	resolver.resolveStatement(stmt.thenBranch)
 	if stmt.elseBranch != nil {
@@ -128,68 +290,153 @@ func (resolver *Resolver) visitSetExpr(expr *Set) interface{} {
 }
 
 func (resolver *Resolver) visitClassStmt(stmt *Class) interface{} {
-	enclosingClassType := currentClass
-	currentClass = references.KlassClass
+	enclosingClassType, enclosingClass := resolver.currentClass, resolver.class
+	resolver.currentClass, resolver.class = references.KlassClass, stmt
+	resolver.classes[stmt.name.Lexeme] = stmt
 
 	resolver.declare(stmt.name, references.Klass)
 	resolver.define(stmt.name, references.Klass)
+	resolver.markDeprecated(stmt, stmt.name, references.Klass)
 
 	if stmt.superclass != nil && stmt.name.Lexeme == stmt.superclass.name.Lexeme {
 		throwError(stmt.superclass.name, "A class can't inherit from itself.")
 	}
 
 	if stmt.superclass != nil {
-		//resolver.beginScope()
-		resolver.scopes.Peek().(map[string]*VariableData)[buildKey("super", references.None)] = &VariableData{variableType: references.Method, defined: true}
+		resolver.currentClass = references.SubClass
+		resolver.resolveExpression(stmt.superclass)
+	}
+
+	for _, trait := range stmt.traits {
+		if trait.name.Lexeme == stmt.name.Lexeme {
+			throwError(trait.name, "A class can't include itself.")
+		}
+
+		resolver.resolveExpression(trait)
 	}
+	resolver.checkTraits(stmt)
 
+	// The interpreter keeps 'super' in an environment of its own between
+	// the class's and the one it is declared in. Tooling has no use for it,
+	// so it gets no symbol scope.
 	if stmt.superclass != nil {
-		currentClass = references.SubClass
-		resolver.resolveExpression(stmt.superclass)
+		resolver.scopes.Push(map[string]*VariableData{
+			buildKey("super", references.None): {variableType: references.Method, defined: true},
+		})
 	}
 
-	resolver.beginScope()
+	resolver.beginCapture(&stmt.capture)
+	resolver.beginStmtScope(stmt)
+	resolver.describeClass(stmt)
 	resolver.scopes.Peek().(map[string]*VariableData)[buildKey("this", references.None)] = &VariableData{
 		variableType: references.Property,
 		defined:      true,
 	}
 
+	enclosingStatic := resolver.inStaticMethod
+	resolver.inStaticMethod = false
+	for _, field := range stmt.fields {
+		if field.initializer != nil {
+			resolver.resolveExpression(field.initializer)
+		}
+	}
+
 	for _, method := range stmt.methods {
 		declaration := references.Method
-		if method.name.Lexeme == "init" {
+		if method.name.Lexeme == "init" && !method.isStatic {
 			declaration = references.Initializer
 		}
+
+		resolver.inStaticMethod = method.isStatic
 		resolver.resolveFunction(method, declaration)
 	}
+	resolver.inStaticMethod = enclosingStatic
 
 	resolver.endScope()
+	resolver.endCapture()
 
 	if stmt.superclass != nil {
-		//resolver.endScope()
+		resolver.scopes.Pop()
 	}
 
-	currentClass = enclosingClassType
+	resolver.currentClass, resolver.class = enclosingClassType, enclosingClass
 
 	return nil
 }
 
+// checkTraits reports a method that two traits of a class both provide,
+// unless the class settles it by declaring the method itself.
+func (resolver *Resolver) checkTraits(stmt *Class) {
+	var names []string
+	declared := make(map[string]bool)
+	for _, method := range stmt.methods {
+		declared[method.name.Lexeme] = true
+		names = append(names, method.name.Lexeme)
+	}
+
+	providers := make(map[string]string)
+	for _, trait := range stmt.traits {
+		for _, name := range resolver.classMethods[trait.name.Lexeme] {
+			if declared[name] {
+				continue
+			}
+
+			if other, ok := providers[name]; ok && other != trait.name.Lexeme {
+				throwError(trait.name, fmt.Sprintf("Traits '%s' and '%s' both define method '%s'.", other, trait.name.Lexeme, name))
+			}
+
+			if _, ok := providers[name]; !ok {
+				names = append(names, name)
+			}
+			providers[name] = trait.name.Lexeme
+		}
+	}
+
+	// A class used as a trait brings what it inherits as well.
+	if stmt.superclass != nil {
+		for _, name := range resolver.classMethods[stmt.superclass.name.Lexeme] {
+			if !declared[name] && providers[name] == "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	resolver.classMethods[stmt.name.Lexeme] = names
+}
+
 func (resolver *Resolver) visitSuperExpr(expr *Super) interface{} {
-	if currentClass == references.NoneClass {
+	if resolver.currentClass == references.NoneClass {
 		throwError(expr.keyword, "Can't use 'super' outside of a class.")
-	} else if currentClass != references.SubClass {
+	} else if resolver.currentClass != references.SubClass {
 		throwError(expr.keyword, "Can't use 'super' in a class with no superclass.")
+	} else if resolver.inStaticMethod {
+		throwError(expr.keyword, "Can't use 'super' in a static method.")
 	}
 
+	resolver.properties = append(resolver.properties, &propertyRead{name: expr.method, class: resolver.class.superclass.name.Lexeme})
 	resolver.resolveLocal(expr, expr.keyword)
+
+	// The interpreter finds this in the scope just inside super's, so a
+	// closure using super has to keep that scope too.
+	for i := resolver.scopes.Len() - 1; i >= 0; i-- {
+		if data, ok := lookupKey(resolver.scopes.Get(i).(map[string]*VariableData), "this", references.None); ok {
+			depth := resolver.scopes.Len() - 1 - i
+			resolver.capture("this", data, i, &depth)
+			break
+		}
+	}
+
 	return nil
 }
 
 func (resolver *Resolver) visitGetMethodExpr(expr *GetMethod) interface{} {
+	resolver.readProperty(expr.object, expr.name)
 	resolver.resolveExpression(expr.object)
 	return nil
 }
 
 func (resolver *Resolver) visitGetFieldExpr(expr *GetField) interface{} {
+	resolver.readProperty(expr.object, expr.name)
 	resolver.resolveExpression(expr.object)
 	return nil
 }
@@ -200,21 +447,58 @@ func (resolver *Resolver) visitPrintStmt(stmt *Print) interface{} {
 }
 
 func (resolver *Resolver) visitBreakCmdStmt(stmt *BreakCmd) interface{} {
-	if resolver.currentFunction == references.None {
-		throwError(stmt.keyword, "Can't break from top-level code.")
+	if resolver.loopDepth == 0 && resolver.switchDepth == 0 {
+		throwError(stmt.keyword, "Can't use 'break' outside of a loop or switch.")
 	}
 
+	resolver.checkLabel(stmt.label)
 	return nil
 }
 
 func (resolver *Resolver) visitContinueCmdStmt(stmt *ContinueCmd) interface{} {
-	if resolver.currentFunction == references.None {
-		throwError(stmt.keyword, "Can't continue from top-level code.")
+	if resolver.loopDepth == 0 {
+		throwError(stmt.keyword, "Can't use 'continue' outside of a loop.")
 	}
 
+	resolver.checkLabel(stmt.label)
 	return nil
 }
 
+func (resolver *Resolver) checkLabel(label *scanner.Token) {
+	if label == nil {
+		return
+	}
+
+	for _, name := range resolver.labels {
+		if name == label.Lexeme {
+			return
+		}
+	}
+
+	throwError(label, fmt.Sprintf("No enclosing loop labeled '%s'.", label.Lexeme))
+}
+
+// resolveLoopBody resolves a loop body with the loop's label, if any, in
+// scope for break and continue.
+func (resolver *Resolver) resolveLoopBody(body Stmt, label *scanner.Token) {
+	if label != nil {
+		for _, name := range resolver.labels {
+			if name == label.Lexeme {
+				throwError(label, fmt.Sprintf("Label '%s' is already used by an enclosing loop.", label.Lexeme))
+			}
+		}
+
+		resolver.labels = append(resolver.labels, label.Lexeme)
+		defer func() {
+			resolver.labels = resolver.labels[:len(resolver.labels)-1]
+		}()
+	}
+
+	resolver.loopDepth++
+	resolver.resolveStatement(body)
+	resolver.loopDepth--
+}
+
 func (resolver *Resolver) visitReturnCmdStmt(stmt *ReturnCmd) interface{} {
 	if resolver.currentFunction == references.None {
 		throwError(stmt.keyword, "Can't return from top-level code.")
@@ -228,12 +512,88 @@ func (resolver *Resolver) visitReturnCmdStmt(stmt *ReturnCmd) interface{} {
 		resolver.resolveExpression(stmt.value)
 	}
 
+	if call, ok := stmt.value.(*Call); ok {
+		resolver.returnedCalls = append(resolver.returnedCalls, call)
+	}
+
+	return nil
+}
+
+func (resolver *Resolver) visitDeferCmdStmt(stmt *DeferCmd) interface{} {
+	if resolver.currentFunction == references.None {
+		throwError(stmt.keyword, "Can't defer from top-level code.")
+	}
+
+	resolver.defers = true
+
+	resolver.resolveExpression(stmt.expression)
+	return nil
+}
+
+// visitYieldStmt turns the enclosing function into a generator.
+func (resolver *Resolver) visitYieldStmt(stmt *Yield) interface{} {
+	if resolver.currentFunction == references.None {
+		throwError(stmt.keyword, "Can't yield from top-level code.")
+	}
+
+	if resolver.currentFunction == references.Initializer {
+		throwError(stmt.keyword, "Can't yield from an initializer.")
+	}
+
+	resolver.function.generator = true
+	if stmt.value != nil {
+		resolver.resolveExpression(stmt.value)
+	}
+
 	return nil
 }
 
 func (resolver *Resolver) visitWhileLoopStmt(stmt *WhileLoop) interface{} {
+	resolver.checkCondition(stmt.condition)
 	resolver.resolveExpression(stmt.condition)
-	resolver.resolveStatement(stmt.body)
+	resolver.resolveLoopBody(stmt.body, stmt.label)
+	if stmt.increment != nil {
+		resolver.resolveExpression(stmt.increment)
+	}
+
+	return nil
+}
+
+func (resolver *Resolver) visitForInStmt(stmt *ForIn) interface{} {
+	resolver.resolveExpression(stmt.iterable)
+
+	// The loop variable lives in its own scope so each iteration gets a
+	// fresh binding for closures to capture.
+	resolver.beginStmtScope(stmt)
+	resolver.declare(stmt.name, references.None)
+	resolver.define(stmt.name, references.None)
+	resolver.resolveLoopBody(stmt.body, stmt.label)
+	resolver.endScope()
+	return nil
+}
+
+func (resolver *Resolver) visitSwitchCmdStmt(stmt *SwitchCmd) interface{} {
+	resolver.resolveExpression(stmt.subject)
+
+	for _, c := range stmt.cases {
+		if c.value != nil {
+			resolver.resolveExpression(c.value)
+		}
+
+		end := c.keyword
+		if len(c.body) > 0 {
+			if _, last, ok := StmtTokens(c.body[len(c.body)-1]); ok {
+				end = last
+			}
+		}
+
+		resolver.beginScope(c.keyword, end)
+		resolver.switchDepth++
+		resolver.resolveStatements(c.body)
+		resolver.switchDepth--
+		resolver.endScope()
+	}
+
 	return nil
 }
 
@@ -250,6 +610,17 @@ func (resolver *Resolver) visitCallExpr(expr *Call) interface{} {
 		resolver.resolveExpression(arg)
 	}
 
+	resolver.noteCall(expr)
+	return nil
+}
+
+func (resolver *Resolver) visitSpawnExpr(expr *Spawn) interface{} {
+	resolver.resolveExpression(expr.call)
+	return nil
+}
+
+func (resolver *Resolver) visitSpreadExpr(expr *Spread) interface{} {
+	resolver.resolveExpression(expr.expression)
 	return nil
 }
 
@@ -274,18 +645,37 @@ func (resolver *Resolver) visitLogicalExpr(expr *Logical) interface{} {
 }
 
 func (resolver *Resolver) resolveFunction(stmt *Function, functionType references.FunctionType) {
-	enclosingFunction := resolver.currentFunction
-	resolver.currentFunction = functionType
+	enclosingFunction, enclosingDeclaration := resolver.currentFunction, resolver.function
+	resolver.currentFunction, resolver.function = functionType, stmt
+
+	// Loops, switches and labels don't reach into nested functions.
+	enclosingLoopDepth, enclosingSwitchDepth, enclosingLabels := resolver.loopDepth, resolver.switchDepth, resolver.labels
+	resolver.loopDepth, resolver.switchDepth, resolver.labels = 0, 0, nil
+	enclosingReturnedCalls, enclosingDefers := resolver.returnedCalls, resolver.defers
+	resolver.returnedCalls, resolver.defers = nil, false
 
-	resolver.beginScope()
-	for _, token := range stmt.params {
+	resolver.beginStmtScope(stmt)
+	for i, token := range stmt.params {
 		resolver.declare(token, references.None)
+		if stmt.defaults[i] != nil {
+			resolver.resolveExpression(stmt.defaults[i])
+		}
 		resolver.define(token, references.None)
 	}
 
 	resolver.resolveStatements(stmt.body)
 	resolver.endScope()
-	resolver.currentFunction = enclosingFunction
+
+	// Deferred calls and generators need the frame to outlive the return.
+	if !resolver.defers && !stmt.generator {
+		for _, call := range resolver.returnedCalls {
+			call.tail = true
+		}
+	}
+
+	resolver.currentFunction, resolver.function = enclosingFunction, enclosingDeclaration
+	resolver.loopDepth, resolver.switchDepth, resolver.labels = enclosingLoopDepth, enclosingSwitchDepth, enclosingLabels
+	resolver.returnedCalls, resolver.defers = enclosingReturnedCalls, enclosingDefers
 }
 
 func (resolver *Resolver) resolveLocal(expr Expr, name *scanner.Token) {
@@ -295,9 +685,30 @@ func (resolver *Resolver) resolveLocal(expr Expr, name *scanner.Token) {
 	}
 
 	for i := resolver.scopes.Len() - 1; i >= 0; i-- {
-		if _, ok := resolver.scopes.Get(i).(map[string]*VariableData)[buildKey(name.Lexeme, t)]; ok {
+		if data, ok := lookupKey(resolver.scopes.Get(i).(map[string]*VariableData), name.Lexeme, t); ok {
+			_, write := expr.(*Assign)
+			if write {
+				data.assigned = true
+				resolver.checkGlobal(name, data)
+			} else {
+				data.read = true
+			}
+
+			if variable, ok := expr.(*Variable); ok {
+				if resolver.callees == nil {
+					resolver.callees = make(map[*Variable]*VariableData)
+				}
+
+				resolver.callees[variable] = data
+			}
+
+			if data.symbol != nil {
+				resolver.symbols.use(name, data.symbol, write)
+			}
+
 			index := resolver.scopes.Len() - 1 - i
 			resolver.interpreter.resolve(expr, &index)
+			resolver.capture(name.Lexeme, data, i, &index)
 			return
 		}
 	}
@@ -305,6 +716,17 @@ func (resolver *Resolver) resolveLocal(expr Expr, name *scanner.Token) {
 	throwError(name, fmt.Sprintf("Couldn't resolve variable '%s'.", name.Lexeme))
 }
 
+// lookup finds the innermost variable a name refers to.
+func (resolver *Resolver) lookup(name string) (*VariableData, bool) {
+	for i := resolver.scopes.Len() - 1; i >= 0; i-- {
+		if data, ok := lookupKey(resolver.scopes.Get(i).(map[string]*VariableData), name, references.None); ok {
+			return data, true
+		}
+	}
+
+	return nil, false
+}
+
 func (resolver *Resolver) resolveStatements(statements []Stmt) {
 	for _, stmt := range statements {
 		resolver.resolveStatement(stmt)
@@ -325,13 +747,34 @@ func (resolver *Resolver) declare(name *scanner.Token, t references.FunctionType
 	}
 
 	scope := resolver.scopes.Peek().(map[string]*VariableData)
-	if v, ok := scope[buildKey(name.Lexeme, t)]; ok {
+	if v, ok := scope[buildKey(name.Lexeme, t)]; ok && !v.global {
 		throwError(name, fmt.Sprintf("%s already exists with name %s", references.GetFunctionTypeName(v.variableType), name.Lexeme))
 	}
 
+	if resolver.scopes.Len() == 1 {
+		resolver.interpreter.scriptGlobals[name.Lexeme] = true
+	} else {
+		resolver.checkShadowing(name)
+	}
+
 	scope[buildKey(name.Lexeme, t)] = &VariableData{
 		variableType: t,
 		defined:      false,
+		symbol:       resolver.symbols.declare(name, t, resolver.scope, resolver.scopes.Len()-1),
+	}
+}
+
+// markDeprecated flags the symbol just declared for a function or class
+// annotated with @deprecated.
+func (resolver *Resolver) markDeprecated(stmt Stmt, name *scanner.Token, t references.FunctionType) {
+	hint, ok := deprecation(stmt)
+	if !ok || resolver.scopes.IsEmpty() {
+		return
+	}
+
+	if data := resolver.scopes.Peek().(map[string]*VariableData)[buildKey(name.Lexeme, t)]; data.symbol != nil {
+		data.symbol.Deprecated = true
+		data.symbol.DeprecationHint = hint
 	}
 }
 
@@ -343,12 +786,81 @@ func (resolver *Resolver) define(name *scanner.Token, t references.FunctionType)
 	resolver.scopes.Peek().(map[string]*VariableData)[buildKey(name.Lexeme, t)].defined = true
 }
 
-func (resolver *Resolver) beginScope() {
+// beginScope opens a scope covering the source from start to end, which are
+// nil for the top level.
+func (resolver *Resolver) beginScope(start *scanner.Token, end *scanner.Token) {
 	resolver.scopes.Push(map[string]*VariableData{})
+	resolver.scope = resolver.symbols.openScope(resolver.scope, start, end)
+}
+
+func (resolver *Resolver) beginStmtScope(stmt Stmt) {
+	start, end, _ := StmtTokens(stmt)
+	resolver.beginScope(start, end)
 }
 
 func (resolver *Resolver) endScope() {
-	resolver.scopes.Pop()
+	resolver.checkUnused(resolver.scopes.Pop().(map[string]*VariableData))
+	resolver.scope = resolver.scope.Parent
+}
+
+// describeClass records the members and superclass of the class whose body
+// scope was just opened, for completing names after 'this.'.
+func (resolver *Resolver) describeClass(stmt *Class) {
+	// The class is declared just outside its body, or the scope holding
+	// 'super' when it has a superclass.
+	declared := resolver.scopes.Len() - 2
+	if stmt.superclass != nil {
+		declared--
+	}
+
+	data, ok := lookupKey(resolver.scopes.Get(declared).(map[string]*VariableData), stmt.name.Lexeme, references.Klass)
+	if !ok || data.symbol == nil {
+		return
+	}
+
+	class := data.symbol
+	class.Members = nil
+	for _, field := range stmt.fields {
+		class.Members = append(class.Members, field.name)
+	}
+
+	for _, method := range stmt.methods {
+		class.Members = append(class.Members, method.name)
+	}
+
+	if stmt.superclass != nil {
+		for i := resolver.scopes.Len() - 2; i >= 0; i-- {
+			if superclass, ok := lookupKey(resolver.scopes.Get(i).(map[string]*VariableData), stmt.superclass.name.Lexeme, references.Klass); ok {
+				class.Superclass = superclass.symbol
+				break
+			}
+		}
+	}
+
+	resolver.scope.Class = class
+}
+
+// lookupKey finds the variable data for a name in a single scope. A plain
+// identifier (references.None) can refer to a variable, function or class.
+func lookupKey(scope map[string]*VariableData, name string, t references.FunctionType) (*VariableData, bool) {
+	if data, ok := scope[buildKey(name, t)]; ok || t == references.Function {
+		return data, ok
+	}
+
+	// A class instantiated with 'new' may be held in a variable, such as a
+	// name imported from a module that wasn't read.
+	if t == references.Klass {
+		data, ok := scope[buildKey(name, references.None)]
+		return data, ok
+	}
+
+	for _, kind := range []references.FunctionType{references.Function, references.Klass} {
+		if data, ok := scope[buildKey(name, kind)]; ok {
+			return data, ok
+		}
+	}
+
+	return nil, false
 }
 
 func buildKey(name string, t references.FunctionType) string {
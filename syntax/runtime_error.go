@@ -0,0 +1,90 @@
+package syntax
+
+import (
+	"fmt"
+	"golox/scanner"
+)
+
+// ErrorKind classifies runtime errors so hosts and diagnostics can tell
+// them apart.
+type ErrorKind int
+
+const (
+	// GenericError covers failures that fit no other kind, such as division
+	// by zero.
+	GenericError ErrorKind = iota
+	// TypeError is an operation applied to a value of the wrong type.
+	TypeError
+	// NameError is a variable, field or method that doesn't exist.
+	NameError
+	// ArityError is a call with the wrong number of arguments.
+	ArityError
+	// IndexError is an index outside the bounds of a sequence.
+	IndexError
+	// IoError is a failure reading or writing outside the interpreter.
+	IoError
+	// AssertionError is a failed assert or assertEquals.
+	AssertionError
+	// RegexError is a regular expression that doesn't compile.
+	RegexError
+	// PermissionError is a native the embedder or a hermetic run doesn't
+	// allow, such as exec.
+	PermissionError
+)
+
+var errorKindNames = map[ErrorKind]string{
+	GenericError:    "RuntimeError",
+	TypeError:       "TypeError",
+	NameError:       "NameError",
+	ArityError:      "ArityError",
+	IndexError:      "IndexError",
+	IoError:         "IoError",
+	AssertionError:  "AssertionError",
+	RegexError:      "RegexError",
+	PermissionError: "PermissionError",
+}
+
+func (kind ErrorKind) String() string {
+	return errorKindNames[kind]
+}
+
+// Code is the stable identifier diagnostics print for the kind, E1000 for
+// generic errors and counting up from there.
+func (kind ErrorKind) Code() string {
+	return fmt.Sprintf("E%d", 1000+int(kind))
+}
+
+type RuntimeError struct {
+	kind    ErrorKind
+	token   *scanner.Token
+	message string
+}
+
+func NewRuntimeError(kind ErrorKind, token *scanner.Token, message string) *RuntimeError {
+	return &RuntimeError{
+		kind:    kind,
+		token:   token,
+		message: message,
+	}
+}
+
+func (err *RuntimeError) Error() string {
+	return err.message
+}
+
+func (err *RuntimeError) Kind() ErrorKind {
+	return err.kind
+}
+
+func (err *RuntimeError) Line() int {
+	return err.token.Line
+}
+
+func (err *RuntimeError) Column() int {
+	return err.token.Column
+}
+
+// Lexeme is the source text of the token the error was reported at.
+func (err *RuntimeError) Lexeme() string {
+	return err.token.Lexeme
+}
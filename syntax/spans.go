@@ -0,0 +1,99 @@
+package syntax
+
+import "golox/scanner"
+
+type stmtSpan struct {
+	start *scanner.Token
+	end   *scanner.Token
+}
+
+// stmtInfo is embedded in every statement. The parser records where the
+// statement was written, whether it was built from a for loop so the
+// formatter can print the loop back, and whether it was exported.
+type stmtInfo struct {
+	span     *stmtSpan
+	forLoop  bool
+	exported bool
+}
+
+func (info *stmtInfo) info() *stmtInfo {
+	return info
+}
+
+// isForLoop reports whether the parser built stmt from a for loop.
+func isForLoop(stmt Stmt) bool {
+	return stmt != nil && stmt.info().forLoop
+}
+
+func recordSpan(stmt Stmt, start *scanner.Token, end *scanner.Token) {
+	stmt.info().span = &stmtSpan{start: start, end: end}
+}
+
+func stmtLine(stmt Stmt) (int, bool) {
+	if stmt == nil || stmt.info().span == nil {
+		return 0, false
+	}
+
+	return stmt.info().span.start.Line, true
+}
+
+// StmtTokens returns the first and last tokens of a parsed statement.
+func StmtTokens(stmt Stmt) (*scanner.Token, *scanner.Token, bool) {
+	if stmt == nil || stmt.info().span == nil {
+		return nil, nil, false
+	}
+
+	span := stmt.info().span
+	return span.start, span.end, true
+}
+
+// StatementLists returns every list of statements in a program, starting
+// with the top level and including blocks, function and method bodies and
+// switch cases.
+func StatementLists(statements []Stmt) [][]Stmt {
+	lists := [][]Stmt{statements}
+	for _, stmt := range statements {
+		lists = append(lists, nestedLists(stmt)...)
+	}
+
+	return lists
+}
+
+func nestedLists(stmt Stmt) [][]Stmt {
+	switch s := stmt.(type) {
+	case *Block:
+		return StatementLists(s.statements)
+	case *Function:
+		return StatementLists(s.body)
+	case *Class:
+		var lists [][]Stmt
+		for _, method := range s.methods {
+			lists = append(lists, StatementLists(method.body)...)
+		}
+		return lists
+	case *IfCmd:
+		lists := nestedLists(s.thenBranch)
+		if s.elseBranch != nil {
+			lists = append(lists, nestedLists(s.elseBranch)...)
+		}
+		return lists
+	case *WhileLoop:
+		return nestedLists(s.body)
+	case *ForIn:
+		return nestedLists(s.body)
+	case *SwitchCmd:
+		var lists [][]Stmt
+		for _, c := range s.cases {
+			lists = append(lists, StatementLists(c.body)...)
+		}
+		return lists
+	case *Match:
+		var lists [][]Stmt
+		for _, arm := range s.arms {
+			lists = append(lists, nestedLists(arm.body)...)
+		}
+		return lists
+	}
+
+	return nil
+}
@@ -4,6 +4,7 @@ import "golox/scanner"
 
 type Stmt interface{
 	accept(visitor StmtVisitor) interface{}
+	info() *stmtInfo
 	String() string}
 
 type StmtVisitor interface {
@@ -14,21 +15,28 @@ type StmtVisitor interface {
 	visitPrintStmt(stmt *Print) interface{}
 	visitReturnCmdStmt(stmt *ReturnCmd) interface{}
 	visitVarCmdStmt(stmt *VarCmd) interface{}
+	visitUnpackStmt(stmt *Unpack) interface{}
 	visitWhileLoopStmt(stmt *WhileLoop) interface{}
+	visitForInStmt(stmt *ForIn) interface{}
+	visitSwitchCmdStmt(stmt *SwitchCmd) interface{}
+	visitMatchStmt(stmt *Match) interface{}
 	visitBreakCmdStmt(stmt *BreakCmd) interface{}
 	visitContinueCmdStmt(stmt *ContinueCmd) interface{}
+	visitImportCmdStmt(stmt *ImportCmd) interface{}
+	visitYieldStmt(stmt *Yield) interface{}
+	visitDeferCmdStmt(stmt *DeferCmd) interface{}
+	visitEnumStmt(stmt *Enum) interface{}
 	visitClassStmt(stmt *Class) interface{}
 }
 
 type Block struct {
+	stmtInfo
 	statements []Stmt
-	isLoopIncrementer bool
 }
 
-func NewBlock(statements []Stmt, isLoopIncrementer bool) Stmt {
+func NewBlock(statements []Stmt) Stmt {
 	return &Block{
 		statements: statements,
-		isLoopIncrementer: isLoopIncrementer,
 	}
 }
 
@@ -41,6 +49,7 @@ func (block *Block) String() string {
 
 
 type Expression struct {
+	stmtInfo
 	expression Expr
 }
 
@@ -59,18 +68,34 @@ func (expression *Expression) String() string {
 
 
 type Function struct {
+	stmtInfo
 	name *scanner.Token
 	params []*scanner.Token
 	body []Stmt
 	isStatic bool
-}
-
-func NewFunction(name *scanner.Token, params []*scanner.Token, body []Stmt, isStatic bool) Stmt {
+	isGetter bool
+	paramTypes []*scanner.Token
+	returnType *scanner.Token
+	variadic bool
+	defaults []Expr
+	generator bool
+	deprecated bool
+	deprecation string
+	capture capturePlan
+	module *loxModule
+}
+
+func NewFunction(name *scanner.Token, params []*scanner.Token, body []Stmt, isStatic bool, isGetter bool, paramTypes []*scanner.Token, returnType *scanner.Token, variadic bool, defaults []Expr) Stmt {
 	return &Function{
 		name: name,
 		params: params,
 		body: body,
 		isStatic: isStatic,
+		isGetter: isGetter,
+		paramTypes: paramTypes,
+		returnType: returnType,
+		variadic: variadic,
+		defaults: defaults,
 	}
 }
 
@@ -83,6 +108,7 @@ func (function *Function) String() string {
 
 
 type IfCmd struct {
+	stmtInfo
 	condition Expr
 	thenBranch Stmt
 	elseBranch Stmt
@@ -105,6 +131,7 @@ func (ifcmd *IfCmd) String() string {
 
 
 type Print struct {
+	stmtInfo
 	expression Expr
 }
 
@@ -123,6 +150,7 @@ func (print *Print) String() string {
 
 
 type ReturnCmd struct {
+	stmtInfo
 	keyword *scanner.Token
 	value Expr
 }
@@ -143,14 +171,19 @@ func (returncmd *ReturnCmd) String() string {
 
 
 type VarCmd struct {
+	stmtInfo
 	name *scanner.Token
 	initializer Expr
+	constant bool
+	annotation *scanner.Token
 }
 
-func NewVarCmd(name *scanner.Token, initializer Expr) Stmt {
+func NewVarCmd(name *scanner.Token, initializer Expr, constant bool, annotation *scanner.Token) Stmt {
 	return &VarCmd{
 		name: name,
 		initializer: initializer,
+		constant: constant,
+		annotation: annotation,
 	}
 }
 
@@ -162,15 +195,45 @@ func (varcmd *VarCmd) String() string {
 	return "VarCmd"}
 
 
+type Unpack struct {
+	stmtInfo
+	keyword *scanner.Token
+	names []*scanner.Token
+	initializer Expr
+	constant bool
+}
+
+func NewUnpack(keyword *scanner.Token, names []*scanner.Token, initializer Expr, constant bool) Stmt {
+	return &Unpack{
+		keyword: keyword,
+		names: names,
+		initializer: initializer,
+		constant: constant,
+	}
+}
+
+func (unpack *Unpack) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitUnpackStmt(unpack)
+}
+
+func (unpack *Unpack) String() string {
+	return "Unpack"}
+
+
 type WhileLoop struct {
+	stmtInfo
 	condition Expr
 	body Stmt
+	increment Expr
+	label *scanner.Token
 }
 
-func NewWhileLoop(condition Expr, body Stmt) Stmt {
+func NewWhileLoop(condition Expr, body Stmt, increment Expr, label *scanner.Token) Stmt {
 	return &WhileLoop{
 		condition: condition,
 		body: body,
+		increment: increment,
+		label: label,
 	}
 }
 
@@ -182,15 +245,87 @@ func (whileloop *WhileLoop) String() string {
 	return "WhileLoop"}
 
 
+type ForIn struct {
+	stmtInfo
+	name *scanner.Token
+	iterable Expr
+	body Stmt
+	label *scanner.Token
+}
+
+func NewForIn(name *scanner.Token, iterable Expr, body Stmt, label *scanner.Token) Stmt {
+	return &ForIn{
+		name: name,
+		iterable: iterable,
+		body: body,
+		label: label,
+	}
+}
+
+func (forin *ForIn) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitForInStmt(forin)
+}
+
+func (forin *ForIn) String() string {
+	return "ForIn"}
+
+
+type SwitchCmd struct {
+	stmtInfo
+	keyword *scanner.Token
+	subject Expr
+	cases []*SwitchCase
+}
+
+func NewSwitchCmd(keyword *scanner.Token, subject Expr, cases []*SwitchCase) Stmt {
+	return &SwitchCmd{
+		keyword: keyword,
+		subject: subject,
+		cases: cases,
+	}
+}
+
+func (switchcmd *SwitchCmd) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitSwitchCmdStmt(switchcmd)
+}
+
+func (switchcmd *SwitchCmd) String() string {
+	return "SwitchCmd"}
+
+
+type Match struct {
+	stmtInfo
+	keyword *scanner.Token
+	subject Expr
+	arms []*MatchArm
+}
+
+func NewMatch(keyword *scanner.Token, subject Expr, arms []*MatchArm) Stmt {
+	return &Match{
+		keyword: keyword,
+		subject: subject,
+		arms: arms,
+	}
+}
+
+func (match *Match) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitMatchStmt(match)
+}
+
+func (match *Match) String() string {
+	return "Match"}
+
+
 type BreakCmd struct {
+	stmtInfo
 	keyword *scanner.Token
-	envDepth int
+	label *scanner.Token
 }
 
-func NewBreakCmd(keyword *scanner.Token, envDepth int) Stmt {
+func NewBreakCmd(keyword *scanner.Token, label *scanner.Token) Stmt {
 	return &BreakCmd{
 		keyword: keyword,
-		envDepth: envDepth,
+		label: label,
 	}
 }
 
@@ -203,14 +338,15 @@ func (breakcmd *BreakCmd) String() string {
 
 
 type ContinueCmd struct {
+	stmtInfo
 	keyword *scanner.Token
-	envDepth int
+	label *scanner.Token
 }
 
-func NewContinueCmd(keyword *scanner.Token, envDepth int) Stmt {
+func NewContinueCmd(keyword *scanner.Token, label *scanner.Token) Stmt {
 	return &ContinueCmd{
 		keyword: keyword,
-		envDepth: envDepth,
+		label: label,
 	}
 }
 
@@ -222,17 +358,110 @@ func (continuecmd *ContinueCmd) String() string {
 	return "ContinueCmd"}
 
 
+type ImportCmd struct {
+	stmtInfo
+	keyword *scanner.Token
+	names []*scanner.Token
+	path *scanner.Token
+	module *loxModule
+}
+
+func NewImportCmd(keyword *scanner.Token, names []*scanner.Token, path *scanner.Token) Stmt {
+	return &ImportCmd{
+		keyword: keyword,
+		names: names,
+		path: path,
+	}
+}
+
+func (importcmd *ImportCmd) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitImportCmdStmt(importcmd)
+}
+
+func (importcmd *ImportCmd) String() string {
+	return "ImportCmd"}
+
+
+type Yield struct {
+	stmtInfo
+	keyword *scanner.Token
+	value Expr
+}
+
+func NewYield(keyword *scanner.Token, value Expr) Stmt {
+	return &Yield{
+		keyword: keyword,
+		value: value,
+	}
+}
+
+func (yield *Yield) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitYieldStmt(yield)
+}
+
+func (yield *Yield) String() string {
+	return "Yield"}
+
+
+type DeferCmd struct {
+	stmtInfo
+	keyword *scanner.Token
+	expression Expr
+}
+
+func NewDeferCmd(keyword *scanner.Token, expression Expr) Stmt {
+	return &DeferCmd{
+		keyword: keyword,
+		expression: expression,
+	}
+}
+
+func (defercmd *DeferCmd) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitDeferCmdStmt(defercmd)
+}
+
+func (defercmd *DeferCmd) String() string {
+	return "DeferCmd"}
+
+
+type Enum struct {
+	stmtInfo
+	name *scanner.Token
+	members []*scanner.Token
+}
+
+func NewEnum(name *scanner.Token, members []*scanner.Token) Stmt {
+	return &Enum{
+		name: name,
+		members: members,
+	}
+}
+
+func (enum *Enum) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitEnumStmt(enum)
+}
+
+func (enum *Enum) String() string {
+	return "Enum"}
+
+
 type Class struct {
+	stmtInfo
 	name *scanner.Token
 	superclass *Variable
+	traits []*Variable
 	methods []*Function
 	fields []*VarCmd
+	deprecated bool
+	deprecation string
+	capture capturePlan
 }
 
-func NewClass(name *scanner.Token, superclass *Variable, methods []*Function, fields []*VarCmd) Stmt {
+func NewClass(name *scanner.Token, superclass *Variable, traits []*Variable, methods []*Function, fields []*VarCmd) Stmt {
 	return &Class{
 		name: name,
 		superclass: superclass,
+		traits: traits,
 		methods: methods,
 		fields: fields,
 	}
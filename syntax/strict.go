@@ -0,0 +1,201 @@
+package syntax
+
+import (
+	"fmt"
+	"golox/references"
+	"golox/scanner"
+	"strings"
+)
+
+// StrictCheck is a set of the extra checks strict mode makes while
+// resolving. Each reports an error, so a program failing one doesn't run.
+type StrictCheck uint
+
+const (
+	// CheckUnused reports local variables that are never read.
+	CheckUnused StrictCheck = 1 << iota
+	// CheckShadowing reports declarations that hide a variable of an
+	// enclosing scope.
+	CheckShadowing
+	// CheckGlobals reports assignments to globals the program didn't
+	// declare, such as natives.
+	CheckGlobals
+	// CheckConditions reports if and while conditions that can't be
+	// booleans.
+	CheckConditions
+	// CheckArity reports calls to natives with the wrong number of
+	// arguments, as the resolver always does for declared functions.
+	CheckArity
+)
+
+// StrictAll is every check, which --strict turns on.
+const StrictAll = CheckUnused | CheckShadowing | CheckGlobals | CheckConditions | CheckArity
+
+var strictCheckNames = []struct {
+	name  string
+	check StrictCheck
+}{
+	{"unused", CheckUnused},
+	{"shadowing", CheckShadowing},
+	{"globals", CheckGlobals},
+	{"conditions", CheckConditions},
+	{"arity", CheckArity},
+}
+
+// ParseStrictChecks reads a comma-separated list of checks, such as
+// "unused,arity". "all" stands for every check, and a name after a '-' turns
+// that check off again, as in "all,-shadowing".
+func ParseStrictChecks(spec string) (StrictCheck, error) {
+	var checks StrictCheck
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		off := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+
+		check, ok := StrictAll, name == "all"
+		for _, known := range strictCheckNames {
+			if known.name == name {
+				check, ok = known.check, true
+			}
+		}
+
+		if !ok {
+			return 0, fmt.Errorf("unknown strict check '%s'", name)
+		}
+
+		if off {
+			checks &^= check
+		} else {
+			checks |= check
+		}
+	}
+
+	return checks, nil
+}
+
+func (checks StrictCheck) String() string {
+	var names []string
+	for _, known := range strictCheckNames {
+		if checks&known.check != 0 {
+			names = append(names, known.name)
+		}
+	}
+
+	return strings.Join(names, ",")
+}
+
+// SetStrict turns on the strict checks the resolver makes.
+func (resolver *Resolver) SetStrict(checks StrictCheck) {
+	resolver.strict = checks
+}
+
+// checkUnused reports the variables of a scope that is ending which were
+// declared with var or const but never read. Names starting with '_' are
+// left alone, for variables kept on purpose.
+func (resolver *Resolver) checkUnused(scope map[string]*VariableData) {
+	if resolver.strict&CheckUnused == 0 {
+		return
+	}
+
+	for _, data := range scope {
+		if data.local && !data.read && data.symbol != nil && !strings.HasPrefix(data.symbol.Name, "_") {
+			resolver.lateError(data.symbol.Declaration, fmt.Sprintf("Local variable '%s' is never read.", data.symbol.Name))
+		}
+	}
+}
+
+// checkShadowing reports a declaration in the innermost scope that hides
+// one the program made in an enclosing scope.
+func (resolver *Resolver) checkShadowing(name *scanner.Token) {
+	if resolver.strict&CheckShadowing == 0 {
+		return
+	}
+
+	for i := resolver.scopes.Len() - 2; i >= 0; i-- {
+		data, ok := lookupKey(resolver.scopes.Get(i).(map[string]*VariableData), name.Lexeme, references.None)
+		if !ok || data.global || data.symbol == nil {
+			continue
+		}
+
+		resolver.lateError(name, fmt.Sprintf("'%s' shadows the declaration on line %d.", name.Lexeme, data.symbol.Declaration.Line))
+		return
+	}
+}
+
+// checkGlobal reports an assignment to a global the program didn't
+// declare.
+func (resolver *Resolver) checkGlobal(name *scanner.Token, data *VariableData) {
+	if resolver.strict&CheckGlobals != 0 && data.global && !resolver.interpreter.scriptGlobals[name.Lexeme] {
+		resolver.lateError(name, fmt.Sprintf("Can't assign to '%s', which the program didn't declare.", name.Lexeme))
+	}
+}
+
+// checkCondition reports a condition whose type is known not to be
+// boolean, leaving its truthiness to decide the branch.
+func (resolver *Resolver) checkCondition(condition Expr) {
+	if resolver.strict&CheckConditions == 0 {
+		return
+	}
+
+	if t := staticType(condition); t != "" && t != "boolean" {
+		token, _ := exprTokens(condition)
+		resolver.lateError(token, fmt.Sprintf("Condition must be a boolean, not %s.", t))
+	}
+}
+
+// staticType works out the type an expression always has from its form,
+// or "" when that depends on values only known at run time.
+func staticType(expr Expr) string {
+	switch e := expr.(type) {
+	case *Literal:
+		return typeName(e.value)
+	case *Grouping:
+		return staticType(e.expression)
+	case *Assign:
+		return staticType(e.value)
+	case *Unary:
+		if e.operator.Type == references.Bang {
+			return "boolean"
+		}
+
+		return "number"
+	case *Binary:
+		switch e.operator.Type {
+		case references.EqualEqual, references.BangEqual, references.Greater, references.GreaterEqual, references.Less, references.LessEqual:
+			return "boolean"
+		case references.Plus:
+			left, right := staticType(e.left), staticType(e.right)
+			if left == "string" || right == "string" {
+				return "string"
+			}
+
+			if left == "number" && right == "number" {
+				return "number"
+			}
+
+			return ""
+		}
+
+		return "number"
+	case *Logical:
+		// 'and' and 'or' give one of their operands.
+		left, right := staticType(e.left), staticType(e.right)
+		if e.operator.Type == references.QuestionQuestion || left == "boolean" {
+			left = right
+		}
+
+		if left != "" && left != "boolean" {
+			return left
+		}
+
+		if right != "" && right != "boolean" {
+			return right
+		}
+
+		if left == "boolean" && right == "boolean" {
+			return "boolean"
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,59 @@
+package syntax
+
+import (
+	"fmt"
+	"golox/scanner"
+	"strings"
+	"unicode/utf8"
+)
+
+// LoxStringBuilder collects a string piece by piece. Appending copies only
+// the new piece, where building the same string with + copies everything
+// so far each time.
+type LoxStringBuilder struct {
+	builder strings.Builder
+}
+
+func NewLoxStringBuilder() *LoxStringBuilder {
+	return &LoxStringBuilder{}
+}
+
+// defineStringBuilder adds StringBuilder(), which returns an empty builder.
+func defineStringBuilder(env *Environment) {
+	env.define("StringBuilder", NewNativeFunction("StringBuilder", 0, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		return NewLoxStringBuilder()
+	}))
+}
+
+// get returns the builder's methods: append(value), which adds value as
+// print would show it and returns the builder so calls can be chained,
+// toString(), length(), which counts characters, and clear().
+func (sb *LoxStringBuilder) get(name *scanner.Token) interface{} {
+	switch name.Lexeme {
+	case "append":
+		return NewNativeFunction("append", 1, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+			sb.builder.WriteString(interpreter.display(arguments[0]))
+			return sb
+		})
+	case "toString":
+		return NewNativeFunction("toString", 0, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+			return sb.builder.String()
+		})
+	case "length":
+		return NewNativeFunction("length", 0, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+			return int64(utf8.RuneCountInString(sb.builder.String()))
+		})
+	case "clear":
+		return NewNativeFunction("clear", 0, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+			sb.builder.Reset()
+			return sb
+		})
+	}
+
+	throwTypedError(NameError, name, fmt.Sprintf("Undefined property '%s' in StringBuilder.", name.Lexeme))
+	return nil
+}
+
+func (sb *LoxStringBuilder) String() string {
+	return sb.builder.String()
+}
@@ -0,0 +1,22 @@
+package syntax
+
+import "golox/scanner"
+
+// SwitchCase is one arm of a switch statement. The default arm has no value.
+// end is the arm's last token, which the parser fills in.
+type SwitchCase struct {
+	keyword      *scanner.Token
+	value        Expr
+	body         []Stmt
+	fallsThrough bool
+	end          *scanner.Token
+}
+
+func NewSwitchCase(keyword *scanner.Token, value Expr, body []Stmt, fallsThrough bool) *SwitchCase {
+	return &SwitchCase{
+		keyword:      keyword,
+		value:        value,
+		body:         body,
+		fallsThrough: fallsThrough,
+	}
+}
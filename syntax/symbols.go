@@ -0,0 +1,206 @@
+package syntax
+
+import (
+	"golox/references"
+	"golox/scanner"
+	"sort"
+)
+
+// Symbol is a variable, function or class declaration together with every
+// name the resolver bound to it. Writes holds the references that assign
+// to it, and Depth is 0 for top-level declarations.
+type Symbol struct {
+	Name        string
+	Kind        references.FunctionType
+	Declaration *scanner.Token
+	References  []*scanner.Token
+	Writes      []*scanner.Token
+	Depth       int
+	// Deprecated is set for functions and classes annotated @deprecated,
+	// with the annotation's message in DeprecationHint.
+	Deprecated      bool
+	DeprecationHint string
+	// Scope is where the symbol is visible.
+	Scope *Scope
+	// Members holds the names of a class's fields and methods, and
+	// Superclass the class it inherits from.
+	Members    []*scanner.Token
+	Superclass *Symbol
+	// MinArgs and MaxArgs bound the arguments a function declaration
+	// takes, with MaxArgs -1 when it is variadic.
+	MinArgs int
+	MaxArgs int
+}
+
+// Scope is a block, function, class body or loop the resolver opened. Start
+// and End are the offsets of its first and last tokens, and Class is set for
+// the scope of a class body, where 'this' is bound.
+type Scope struct {
+	Parent   *Scope
+	Children []*Scope
+	Start    int
+	End      int
+	Class    *Symbol
+	Symbols  []*Symbol
+}
+
+func (scope *Scope) contains(offset int) bool {
+	return scope.Parent == nil || offset >= scope.Start && offset <= scope.End
+}
+
+// SymbolTable is the reference graph the resolver builds while resolving a
+// program.
+type SymbolTable struct {
+	Symbols []*Symbol
+	// Scopes starts with the top level, which holds the whole program, and
+	// lists the rest in the order they open.
+	Scopes []*Scope
+	// Globals names the natives and the globals of earlier runs.
+	Globals []string
+	// tokens maps each declaration and use to its symbol.
+	tokens map[*scanner.Token]*Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{tokens: map[*scanner.Token]*Symbol{}}
+}
+
+func (table *SymbolTable) declare(name *scanner.Token, kind references.FunctionType, scope *Scope, depth int) *Symbol {
+	symbol := &Symbol{
+		Name:        name.Lexeme,
+		Kind:        kind,
+		Declaration: name,
+		Depth:       depth,
+		Scope:       scope,
+	}
+
+	table.Symbols = append(table.Symbols, symbol)
+	table.tokens[name] = symbol
+	if scope != nil {
+		scope.Symbols = append(scope.Symbols, symbol)
+	}
+
+	return symbol
+}
+
+func (table *SymbolTable) openScope(parent *Scope, start *scanner.Token, end *scanner.Token) *Scope {
+	scope := &Scope{Parent: parent}
+	if start != nil && end != nil {
+		scope.Start, scope.End = start.Offset, end.Offset+len(end.Lexeme)
+	}
+
+	if parent != nil {
+		parent.Children = append(parent.Children, scope)
+	}
+
+	table.Scopes = append(table.Scopes, scope)
+	return scope
+}
+
+func (table *SymbolTable) use(name *scanner.Token, symbol *Symbol, write bool) {
+	symbol.References = append(symbol.References, name)
+	if write {
+		symbol.Writes = append(symbol.Writes, name)
+	}
+
+	table.tokens[name] = symbol
+}
+
+// Root is the top-level scope, whose children form the tree of every scope
+// in the program.
+func (table *SymbolTable) Root() *Scope {
+	if len(table.Scopes) == 0 {
+		return nil
+	}
+
+	return table.Scopes[0]
+}
+
+// SymbolOf finds the symbol a declaration or use of a name belongs to, or
+// nil for names the program doesn't declare, such as natives.
+func (table *SymbolTable) SymbolOf(name *scanner.Token) *Symbol {
+	return table.tokens[name]
+}
+
+// ScopeAt finds the innermost scope holding a byte offset. Scopes are
+// opened outside in, so that is the last one holding it.
+func (table *SymbolTable) ScopeAt(offset int) *Scope {
+	var innermost *Scope
+	for _, scope := range table.Scopes {
+		if scope.contains(offset) {
+			innermost = scope
+		}
+	}
+
+	return innermost
+}
+
+// Visible returns the symbols that can be named at a byte offset, innermost
+// first. Locals count once they are declared, while anything at the top
+// level can be used from anywhere, as functions run after it is defined.
+func (table *SymbolTable) Visible(offset int) []*Symbol {
+	var visible []*Symbol
+	shadowed := map[string]bool{}
+	for scope := table.ScopeAt(offset); scope != nil; scope = scope.Parent {
+		for _, symbol := range scope.Symbols {
+			if shadowed[symbol.Name] || scope.Parent != nil && symbol.Declaration.Offset > offset {
+				continue
+			}
+
+			shadowed[symbol.Name] = true
+			visible = append(visible, symbol)
+		}
+	}
+
+	return visible
+}
+
+// EnclosingClass finds the class whose body holds a byte offset.
+func (table *SymbolTable) EnclosingClass(offset int) *Symbol {
+	for scope := table.ScopeAt(offset); scope != nil; scope = scope.Parent {
+		if scope.Class != nil {
+			return scope.Class
+		}
+	}
+
+	return nil
+}
+
+// AllMembers returns the fields and methods of a class, including the ones
+// it inherits, by name.
+func (symbol *Symbol) AllMembers() []string {
+	seen := map[string]bool{}
+	visited := map[*Symbol]bool{}
+	var names []string
+	for class := symbol; class != nil && !visited[class]; class = class.Superclass {
+		visited[class] = true
+		for _, member := range class.Members {
+			if !seen[member.Lexeme] {
+				seen[member.Lexeme] = true
+				names = append(names, member.Lexeme)
+			}
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// SymbolAt finds the symbol declared or referenced by the name at a 1-based
+// line and column.
+func (table *SymbolTable) SymbolAt(line int, column int) *Symbol {
+	for _, symbol := range table.Symbols {
+		for _, token := range symbol.Tokens() {
+			if token.Line == line && column >= token.Column && column < token.Column+len(token.Lexeme) {
+				return symbol
+			}
+		}
+	}
+
+	return nil
+}
+
+// Tokens returns the declaration followed by each reference.
+func (symbol *Symbol) Tokens() []*scanner.Token {
+	return append([]*scanner.Token{symbol.Declaration}, symbol.References...)
+}
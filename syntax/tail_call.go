@@ -0,0 +1,32 @@
+package syntax
+
+import "golox/scanner"
+
+// The resolver sets the tail field of calls in tail position: the value of
+// a return in a function that neither defers nor yields. Returning one of
+// them unwinds the caller before the callee runs, so recursion through tail
+// calls runs in constant Go stack.
+//
+// tailCall is thrown by a return whose value is a tail call, in place of
+// the value. The function it unwinds calls function with the arguments
+// once its own frame is gone.
+type tailCall struct {
+	function  *LoxFunction
+	arguments []interface{}
+	paren     *scanner.Token
+}
+
+// evaluateTailCall evaluates the callee and arguments of a tail call. A
+// callee that can't take over the caller's frame, such as a native or a
+// generator, is called the usual way and its result returned instead.
+func (interpreter *Interpreter) evaluateTailCall(expr *Call) interface{} {
+	callee := interpreter.evaluate(expr.callee)
+	function, ok := callee.(*LoxFunction)
+	if !ok || function == nil || function.isInitializer || function.declaration.generator {
+		return interpreter.finishCall(expr, callee)
+	}
+
+	arguments := interpreter.evaluateArguments(expr.arguments)
+	checkCallable(expr.paren, function, arguments)
+	return &tailCall{function: function, arguments: arguments, paren: expr.paren}
+}
@@ -0,0 +1,213 @@
+package syntax
+
+import (
+	"golox/scanner"
+	"runtime"
+	"sync"
+)
+
+// ticksPerTurn is how many statements a task runs before letting the others
+// have a turn.
+const ticksPerTurn = 1000
+
+// scheduler lets tasks run on their own goroutines while only one of them
+// runs Lox code at a time, so environments and the resolver's tables need no
+// locks of their own. A task gives up its turn while it waits on a channel
+// or another task, and every so often in between so a busy loop can't
+// starve the rest.
+type scheduler struct {
+	lock  sync.Mutex
+	ticks int
+}
+
+func (scheduler *scheduler) acquire() {
+	scheduler.lock.Lock()
+}
+
+func (scheduler *scheduler) release() {
+	scheduler.lock.Unlock()
+}
+
+func (scheduler *scheduler) tick() {
+	scheduler.ticks++
+	if scheduler.ticks%ticksPerTurn == 0 {
+		scheduler.release()
+		runtime.Gosched()
+		scheduler.acquire()
+	}
+}
+
+// LoxTask is a function call running on its own goroutine, started with
+// spawn. Awaiting it gives back what the call returned.
+type LoxTask struct {
+	function LoxCallable
+	done     chan struct{}
+	result   interface{}
+	panicked interface{}
+}
+
+func NewLoxTask(function LoxCallable) *LoxTask {
+	return &LoxTask{
+		function: function,
+		done:     make(chan struct{}),
+	}
+}
+
+func (task *LoxTask) run(interpreter *Interpreter, paren *scanner.Token, arguments []interface{}) {
+	interpreter.scheduler.acquire()
+	defer func() {
+		task.panicked = recover()
+		interpreter.scheduler.release()
+		close(task.done)
+	}()
+
+	if len(interpreter.hooks) > 0 {
+		task.result = interpreter.callHooked(task.function, paren, arguments)
+	} else {
+		task.result = task.function.call(interpreter, arguments)
+	}
+}
+
+func (task *LoxTask) String() string {
+	return "<task " + task.function.name() + ">"
+}
+
+// LoxChannel passes values between tasks. Sending waits until another task
+// receives.
+type LoxChannel struct {
+	values chan interface{}
+}
+
+func NewLoxChannel() *LoxChannel {
+	return &LoxChannel{
+		values: make(chan interface{}),
+	}
+}
+
+func (channel *LoxChannel) String() string {
+	return "<channel>"
+}
+
+// defineConcurrency adds the natives for waiting on tasks and talking over
+// channels.
+func defineConcurrency(env *Environment) {
+	env.define("await", NewNativeFunction("await", 1, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		task, ok := arguments[0].(*LoxTask)
+		if !ok {
+			throwTypedError(TypeError, interpreter.callSite(), "Can only await a task.")
+		}
+
+		interpreter.wait(func() {
+			<-task.done
+		})
+
+		// The error was reported where it happened in the task, and now
+		// fails the awaiting code too.
+		if task.panicked != nil {
+			panic(task.panicked)
+		}
+
+		return task.result
+	}))
+
+	env.define("channel", NewNativeFunction("channel", 0, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		return NewLoxChannel()
+	}))
+
+	env.define("send", NewNativeFunction("send", 2, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		channel, ok := arguments[0].(*LoxChannel)
+		if !ok {
+			throwTypedError(TypeError, interpreter.callSite(), "Can only send on a channel.")
+		}
+
+		interpreter.wait(func() {
+			channel.values <- arguments[1]
+		})
+
+		return nil
+	}))
+
+	env.define("receive", NewNativeFunction("receive", 1, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+		channel, ok := arguments[0].(*LoxChannel)
+		if !ok {
+			throwTypedError(TypeError, interpreter.callSite(), "Can only receive from a channel.")
+		}
+
+		var value interface{}
+		interpreter.wait(func() {
+			value = <-channel.values
+		})
+
+		return value
+	}))
+}
+
+// wait gives up the interpreter's turn while block waits on another task.
+func (interpreter *Interpreter) wait(block func()) {
+	if interpreter.scheduler == nil {
+		throwRuntimeError(interpreter.callSite(), "No task is running, so this would wait forever.")
+	}
+
+	interpreter.scheduler.release()
+	defer interpreter.scheduler.acquire()
+
+	block()
+}
+
+func (interpreter *Interpreter) visitSpawnExpr(expr *Spawn) interface{} {
+	callee := interpreter.evaluate(expr.call.callee)
+
+	arguments := interpreter.evaluateArguments(expr.call.arguments)
+	function := checkCallable(expr.call.paren, callee, arguments)
+
+	// The spawning code already holds the turn the first scheduler hands
+	// out.
+	if interpreter.scheduler == nil {
+		interpreter.scheduler = &scheduler{}
+		interpreter.scheduler.acquire()
+	}
+
+	task := NewLoxTask(function)
+	worker := &Interpreter{
+		env: interpreter.env,
+		frames: []*callFrame{{
+			name:  function.name(),
+			token: expr.call.paren,
+			env:   interpreter.env,
+		}},
+		scheduler:     interpreter.scheduler,
+		vfs:           interpreter.vfs,
+		out:           interpreter.out,
+		budget:        interpreter.budget,
+		ctx:           interpreter.ctx,
+		random:        interpreter.random,
+		noOS:          interpreter.noOS,
+		globals:       interpreter.globals,
+		classes:       interpreter.classes,
+		scriptGlobals: interpreter.scriptGlobals,
+		modules:       interpreter.modules,
+		temporaries:   interpreter.temporaries,
+		abandoned:     interpreter.abandoned,
+		debugger:      interpreter.debugger,
+		tracer:        interpreter.tracer,
+		coverage:      interpreter.coverage,
+		extraHooks:    interpreter.extraHooks,
+		printers:      interpreter.printers,
+	}
+
+	// The task is observed like the code that spawned it. Hotspots and
+	// profiles time statements and calls on a stack, so each task keeps
+	// its own.
+	if interpreter.hotspots != nil {
+		worker.hotspots = interpreter.hotspots.forTask()
+	}
+
+	if interpreter.profiler != nil {
+		worker.profiler = interpreter.profiler.forTask()
+	}
+
+	worker.collectHooks()
+
+	go task.run(worker, expr.call.paren, arguments)
+	return task
+}
@@ -0,0 +1,66 @@
+package syntax
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// temporaryPaths are the paths Tmp handed out during a run. Tasks share
+// the one of the interpreter that spawned them, taking turns with the
+// scheduler, so their paths are removed when the run ends too.
+type temporaryPaths struct {
+	paths []string
+}
+
+// defineTemporaries adds Tmp, whose natives hand out temporary paths that
+// are removed when the run that asked for them ends.
+func defineTemporaries(env *Environment) {
+	env.define("Tmp", NewLoxNamespace("Tmp", map[string]interface{}{
+		"dir": NewNativeFunction("dir", 0, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+			if interpreter.vfs != nil {
+				path := interpreter.vfs.tempPath()
+				interpreter.temporaries.paths = append(interpreter.temporaries.paths, path)
+				return path
+			}
+
+			path, err := ioutil.TempDir("", "lox-")
+			if err != nil {
+				throwTypedError(IoError, interpreter.callSite(), err.Error())
+			}
+
+			interpreter.temporaries.paths = append(interpreter.temporaries.paths, path)
+			return path
+		}),
+		"file": NewNativeFunction("file", 0, func(interpreter *Interpreter, arguments []interface{}) interface{} {
+			if interpreter.vfs != nil {
+				path := interpreter.vfs.tempPath()
+				interpreter.vfs.WriteFile(path, nil)
+				interpreter.temporaries.paths = append(interpreter.temporaries.paths, path)
+				return path
+			}
+
+			file, err := ioutil.TempFile("", "lox-")
+			if err != nil {
+				throwTypedError(IoError, interpreter.callSite(), err.Error())
+			}
+
+			file.Close()
+			interpreter.temporaries.paths = append(interpreter.temporaries.paths, file.Name())
+			return file.Name()
+		}),
+	}))
+}
+
+// removeTemporaries deletes every path Tmp handed out, along with anything
+// the script put inside them.
+func (interpreter *Interpreter) removeTemporaries() {
+	for _, path := range interpreter.temporaries.paths {
+		if interpreter.vfs != nil {
+			interpreter.vfs.remove(path)
+		} else {
+			os.RemoveAll(path)
+		}
+	}
+
+	interpreter.temporaries.paths = nil
+}
@@ -0,0 +1,79 @@
+package syntax
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Tracer writes a line for each statement the script runs and for each call
+// and return, indented by how deep in calls it is.
+type Tracer struct {
+	NopHook
+	// lock keeps the lines of the tasks a script spawns from mixing.
+	lock sync.Mutex
+	out  io.Writer
+}
+
+func NewTracer(out io.Writer) *Tracer {
+	return &Tracer{out: out}
+}
+
+// SetTracer starts tracing the script. Passing nil stops it.
+func (interpreter *Interpreter) SetTracer(tracer *Tracer) {
+	interpreter.tracer = tracer
+	interpreter.collectHooks()
+}
+
+func (tracer *Tracer) BeforeStatement(point *StopPoint) {
+	// A block's statements are traced on their own, and the ones the parser
+	// made a for loop into with it.
+	if _, ok := point.Stmt.(*Block); ok && !isForLoop(point.Stmt) || point.Token == nil {
+		return
+	}
+
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+
+	text := strings.SplitN(Format([]Stmt{point.Stmt}, nil), "\n", 2)[0]
+	fmt.Fprintf(tracer.out, "%s[line %d] %s\n", indentation(point.Depth), point.Line, text)
+}
+
+func (tracer *Tracer) Call(call *CallPoint) {
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+
+	arguments := make([]string, len(call.Arguments))
+	for i, argument := range call.Arguments {
+		arguments[i] = traceValue(argument)
+	}
+
+	fmt.Fprintf(tracer.out, "%s-> %s(%s)\n", indentation(call.Depth), call.Name, strings.Join(arguments, ", "))
+}
+
+func (tracer *Tracer) Return(call *CallPoint, result interface{}) {
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+
+	if call.Failed {
+		fmt.Fprintf(tracer.out, "%s<- %s failed\n", indentation(call.Depth), call.Name)
+		return
+	}
+
+	fmt.Fprintf(tracer.out, "%s<- %s returned %s\n", indentation(call.Depth), call.Name, traceValue(result))
+}
+
+func indentation(depth int) string {
+	return strings.Repeat("  ", depth)
+}
+
+// traceValue shows strings quoted, so they can be told apart from other
+// values.
+func traceValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+
+	return stringify(value)
+}
@@ -0,0 +1,200 @@
+package syntax
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// VFS is a virtual filesystem for hermetic runs. Scripts read the files it
+// was created with, and whatever they write lands in an in-memory overlay
+// instead of on disk, so a run has no side effects and can be repeated.
+type VFS struct {
+	mu      sync.Mutex
+	files   map[string][]byte
+	overlay map[string][]byte
+	// temporaries counts the paths Tmp handed out, to keep them unique.
+	temporaries int
+}
+
+// NewVFS makes a virtual filesystem holding files, keyed by their path
+// relative to its root.
+func NewVFS(files map[string][]byte) *VFS {
+	vfs := &VFS{
+		files:   map[string][]byte{},
+		overlay: map[string][]byte{},
+	}
+
+	for name, data := range files {
+		vfs.files[vfsPath(name)] = data
+	}
+
+	return vfs
+}
+
+// LoadTar makes a virtual filesystem holding the regular files in a tar
+// archive.
+func LoadTar(r io.Reader) (*VFS, error) {
+	files := map[string][]byte{}
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(archive)
+		if err != nil {
+			return nil, err
+		}
+
+		files[header.Name] = data
+	}
+
+	return NewVFS(files), nil
+}
+
+// vfsPath turns a name into a path relative to the root, so that neither
+// absolute names nor '..' can reach outside it.
+func vfsPath(name string) string {
+	return path.Clean("/" + filepath.ToSlash(name))[1:]
+}
+
+// ReadFile reads a file, preferring what the script wrote over the original.
+func (vfs *VFS) ReadFile(name string) ([]byte, error) {
+	vfs.mu.Lock()
+	defer vfs.mu.Unlock()
+
+	key := vfsPath(name)
+	if data, ok := vfs.overlay[key]; ok {
+		if data == nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+
+		return data, nil
+	}
+
+	if data, ok := vfs.files[key]; ok {
+		return data, nil
+	}
+
+	return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+}
+
+// WriteFile records a file in the overlay.
+func (vfs *VFS) WriteFile(name string, data []byte) {
+	vfs.mu.Lock()
+	defer vfs.mu.Unlock()
+
+	if data == nil {
+		data = []byte{}
+	}
+
+	vfs.overlay[vfsPath(name)] = data
+}
+
+// remove deletes a path and everything under it. Deleting an original file
+// is recorded in the overlay as a nil entry, which hides it.
+func (vfs *VFS) remove(name string) {
+	vfs.mu.Lock()
+	defer vfs.mu.Unlock()
+
+	key := vfsPath(name)
+	for existing := range vfs.overlay {
+		if existing == key || strings.HasPrefix(existing, key+"/") {
+			delete(vfs.overlay, existing)
+		}
+	}
+
+	for existing := range vfs.files {
+		if existing == key || strings.HasPrefix(existing, key+"/") {
+			vfs.overlay[existing] = nil
+		}
+	}
+}
+
+func (vfs *VFS) tempPath() string {
+	vfs.mu.Lock()
+	defer vfs.mu.Unlock()
+
+	vfs.temporaries++
+	return fmt.Sprintf("tmp/lox-%d", vfs.temporaries)
+}
+
+// Overlay returns the files the script wrote. Files it deleted map to nil.
+func (vfs *VFS) Overlay() map[string][]byte {
+	vfs.mu.Lock()
+	defer vfs.mu.Unlock()
+
+	overlay := map[string][]byte{}
+	for name, data := range vfs.overlay {
+		overlay[name] = data
+	}
+
+	return overlay
+}
+
+// WriteTar writes the files the script wrote as a tar archive, in name
+// order. Deleted files are left out.
+func (vfs *VFS) WriteTar(w io.Writer) error {
+	overlay := vfs.Overlay()
+	var names []string
+	for name, data := range overlay {
+		if data != nil {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	archive := tar.NewWriter(w)
+	for _, name := range names {
+		header := &tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(overlay[name])),
+			Typeflag: tar.TypeReg,
+		}
+
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if _, err := archive.Write(overlay[name]); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// SetVFS makes the interpreter's file operations use vfs instead of the
+// real filesystem. Passing nil goes back to the real one.
+func (interpreter *Interpreter) SetVFS(vfs *VFS) {
+	interpreter.vfs = vfs
+}
+
+// writeFile writes to the virtual filesystem during hermetic runs and to
+// disk otherwise.
+func (interpreter *Interpreter) writeFile(name string, data []byte) error {
+	if interpreter.vfs != nil {
+		interpreter.vfs.WriteFile(name, data)
+		return nil
+	}
+
+	return ioutil.WriteFile(name, data, 0644)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"golox/loxerror"
+	"golox/scanner"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// testTimeout is how long a test script may run before it fails.
+const testTimeout = 10 * time.Second
+
+// errorHeader matches the first line of a reported error, such as
+// "[line 3] TypeError[E1001] at '-': Operands must be numbers." or, in an
+// imported module, "[line 3 of lib/util.lox] ...", and snippetLine the
+// quoted source and carets that follow it.
+var errorHeader = regexp.MustCompile(`^\[line (\d+)(?: of [^\]]+)?\] (\S+)[^:]*: (.*)$`)
+var snippetLine = regexp.MustCompile(`^ *\d* \| `)
+
+// expectations are what a test script's comments say running it prints:
+// its output, and the runtime error it ends with, if any.
+type expectations struct {
+	output       []string
+	runtimeError string
+	errorLine    int
+}
+
+// runTest runs every .lox file under the given paths and compares what it
+// prints with its "// expect: output" and "// expect runtime error: message"
+// comments, exiting with 1 when any fails.
+func runTest(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Usage: golox test <file.lox|directory>...")
+		os.Exit(64)
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(70)
+	}
+
+	// Scanning for expectations reports nothing; errors in a script show up
+	// when it runs.
+	loxerror.SetReporter(nil)
+
+	passed, failed := 0, 0
+	for _, root := range args {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if info.IsDir() || filepath.Ext(path) != ".lox" {
+				return nil
+			}
+
+			if problems := runTestFile(self, path); len(problems) > 0 {
+				fmt.Printf("FAIL %s\n", path)
+				for _, problem := range problems {
+					fmt.Printf("     %s\n", problem)
+				}
+				failed++
+			} else {
+				fmt.Printf("PASS %s\n", path)
+				passed++
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(74)
+		}
+	}
+
+	fmt.Printf("\n%d passed, %d failed.\n", passed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runTestFile runs a script in its own golox process, so that no state
+// leaks between scripts, and returns how it differed from its expectations.
+func runTestFile(self string, path string) []string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	expected := parseExpectations(string(data))
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, self, path)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stdout
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		return []string{fmt.Sprintf("timed out after %s", testTimeout)}
+	}
+
+	exitCode := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		exitCode = exitErr.ExitCode()
+	} else if err != nil {
+		return []string{err.Error()}
+	}
+
+	var problems []string
+	var output []string
+	for _, line := range splitLines(stdout.String()) {
+		if snippetLine.MatchString(line) {
+			continue
+		}
+
+		match := errorHeader.FindStringSubmatch(line)
+		if match == nil || match[2] == "Warning" {
+			output = append(output, line)
+			continue
+		}
+
+		errorLine, _ := strconv.Atoi(match[1])
+		if expected.runtimeError == "" || exitCode != 70 {
+			problems = append(problems, fmt.Sprintf("unexpected error: %s", line))
+		} else if match[3] != expected.runtimeError {
+			problems = append(problems, fmt.Sprintf("expected runtime error '%s' but got '%s'", expected.runtimeError, match[3]))
+		} else if errorLine != expected.errorLine {
+			problems = append(problems, fmt.Sprintf("expected runtime error on line %d but got it on line %d", expected.errorLine, errorLine))
+		}
+	}
+
+	if expected.runtimeError != "" && exitCode != 70 {
+		problems = append(problems, fmt.Sprintf("expected runtime error '%s' but exited with %d", expected.runtimeError, exitCode))
+	} else if expected.runtimeError == "" && exitCode != 0 && len(problems) == 0 {
+		problems = append(problems, fmt.Sprintf("exited with %d", exitCode))
+	}
+
+	if diff := diffLines(expected.output, output); diff != nil {
+		problems = append(problems, "output differs (- expected, + actual):")
+		problems = append(problems, diff...)
+	}
+
+	return problems
+}
+
+// parseExpectations reads the expect comments of a script from the
+// scanner's trivia.
+func parseExpectations(source string) *expectations {
+	s := scanner.NewScanner(source)
+	s.KeepTrivia = true
+	s.ScanTokens()
+
+	expected := &expectations{}
+	for _, comment := range s.Comments {
+		if comment.Kind != scanner.LineComment {
+			continue
+		}
+
+		text := strings.TrimSpace(strings.TrimPrefix(comment.Text, "//"))
+		if strings.HasPrefix(text, "expect: ") {
+			expected.output = append(expected.output, strings.TrimPrefix(text, "expect: "))
+		} else if strings.HasPrefix(text, "expect runtime error: ") {
+			expected.runtimeError = strings.TrimPrefix(text, "expect runtime error: ")
+			expected.errorLine = comment.Line
+		}
+	}
+
+	return expected
+}
+
+func splitLines(text string) []string {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+
+	return strings.Split(text, "\n")
+}
+
+// diffLines returns the lines of a minimal diff between expected and
+// actual, or nil when they are the same.
+func diffLines(expected []string, actual []string) []string {
+	// common[i][j] is the length of the longest common subsequence of
+	// expected[i:] and actual[j:].
+	common := make([][]int, len(expected)+1)
+	for i := range common {
+		common[i] = make([]int, len(actual)+1)
+	}
+
+	for i := len(expected) - 1; i >= 0; i-- {
+		for j := len(actual) - 1; j >= 0; j-- {
+			if expected[i] == actual[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	var diff []string
+	changed := false
+	i, j := 0, 0
+	for i < len(expected) || j < len(actual) {
+		switch {
+		case i < len(expected) && j < len(actual) && expected[i] == actual[j]:
+			diff = append(diff, "  "+expected[i])
+			i++
+			j++
+		case j == len(actual) || i < len(expected) && common[i+1][j] >= common[i][j+1]:
+			diff = append(diff, "- "+expected[i])
+			changed = true
+			i++
+		default:
+			diff = append(diff, "+ "+actual[j])
+			changed = true
+			j++
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return diff
+}